@@ -34,6 +34,11 @@ func main() {
 			log.Fatal(err)
 		}
 	}()
+	go func() {
+		if err := srv.StartGRPC(); err != nil {
+			log.Fatal(err)
+		}
+	}()
 
 	// 优雅关闭
 	quit := make(chan os.Signal, 1)
@@ -2,20 +2,59 @@ package app
 
 import (
 	"context"
+	"crypto/rand"
 	"fmt"
+	"os"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/songfei1983/play-go-api/internal/config"
+	"github.com/songfei1983/play-go-api/internal/events"
 	"github.com/songfei1983/play-go-api/internal/handler"
+	"github.com/songfei1983/play-go-api/internal/money"
+	"github.com/songfei1983/play-go-api/internal/notify"
+	"github.com/songfei1983/play-go-api/internal/payment"
+	"github.com/songfei1983/play-go-api/internal/search"
+	"github.com/songfei1983/play-go-api/internal/storage"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 )
 
 type App struct {
-	DB      *gorm.DB
-	Redis   *redis.Client
-	cleanup func()
+	DB             *gorm.DB
+	Redis          *redis.Client
+	Search         search.Backend
+	Rates          *money.Rates
+	Blobs          storage.BlobStore
+	URLSigner      *storage.URLSigner
+	MaxUploadBytes int64
+	SignedURLTTL   time.Duration
+	Payments       payment.Provider
+	// Notifier 低库存告警的通知渠道
+	Notifier           notify.Notifier
+	AlertCheckInterval time.Duration
+	// AdminUserIDs 管理员的用户 ID
+	AdminUserIDs []uint
+	// Broker 领域事件的外部消息代理，为 nil 时事件只投递给 webhook
+	Broker        events.Broker
+	RelayInterval time.Duration
+	// Feed 所有资源变更的 Redis stream，供 SSE 推送与断线续传
+	Feed              *events.RedisFeed
+	HeartbeatInterval time.Duration
+	// MaxSubscriptions 单个实时库存连接最多订阅的产品数
+	MaxSubscriptions int
+	// WebhookPolicy webhook 重试与自动停用策略
+	WebhookPolicy   handler.WebhookPolicy
+	WebhookInterval time.Duration
+	// GRPCAddr gRPC 服务监听地址
+	GRPCAddr string
+	// GraphQLMaxDepth、GraphQLMaxComplexity GraphQL 查询的深度与复杂度上限
+	GraphQLMaxDepth      int
+	GraphQLMaxComplexity int
+	// ValidateRequests、ValidateResponses 是否按 OpenAPI 文档校验请求与响应
+	ValidateRequests  bool
+	ValidateResponses bool
+	cleanup           func()
 }
 
 func New(cfg *config.Config) (*App, error) {
@@ -29,6 +68,36 @@ func New(cfg *config.Config) (*App, error) {
 		return nil, err
 	}
 
+	searchBackend, err := initSearch(cfg, db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize search: %w", err)
+	}
+
+	rates, err := initRates(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load exchange rates: %w", err)
+	}
+
+	blobs, signer, err := initStorage(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize storage: %w", err)
+	}
+
+	payments, err := initPayments(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize payments: %w", err)
+	}
+
+	notifier, err := initNotifier(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize notifiers: %w", err)
+	}
+
+	broker, err := initBroker(cfg, redisClient)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize event broker: %w", err)
+	}
+
 	// 初始化OpenTelemetry追踪器
 	cleanup, err := initTracer(cfg.Tracing.Endpoint)
 	if err != nil {
@@ -36,9 +105,34 @@ func New(cfg *config.Config) (*App, error) {
 	}
 
 	return &App{
-		DB:      db,
-		Redis:   redisClient,
-		cleanup: cleanup,
+		DB:                 db,
+		Redis:              redisClient,
+		Search:             searchBackend,
+		Rates:              rates,
+		Blobs:              blobs,
+		URLSigner:          signer,
+		MaxUploadBytes:     cfg.Storage.MaxUploadBytes,
+		SignedURLTTL:       cfg.Storage.SignedURLTTL,
+		Payments:           payments,
+		Notifier:           notifier,
+		AlertCheckInterval: cfg.Alerts.CheckInterval,
+		AdminUserIDs:       cfg.Admin.UserIDs,
+		Broker:             broker,
+		RelayInterval:      cfg.Events.RelayInterval,
+		Feed:               events.NewRedisFeed(redisClient, cfg.Events.StreamPrefix+":feed", cfg.Events.StreamMaxLen),
+		HeartbeatInterval:  cfg.Events.HeartbeatInterval,
+		MaxSubscriptions:   cfg.Events.MaxSubscriptions,
+		WebhookPolicy: handler.WebhookPolicy{
+			MaxAttempts:  cfg.Webhooks.MaxAttempts,
+			DisableAfter: cfg.Webhooks.DisableAfter,
+		},
+		WebhookInterval:      cfg.Webhooks.DeliveryInterval,
+		GRPCAddr:             ":" + cfg.Server.GRPCPort,
+		GraphQLMaxDepth:      cfg.GraphQL.MaxDepth,
+		GraphQLMaxComplexity: cfg.GraphQL.MaxComplexity,
+		ValidateRequests:     cfg.OpenAPI.ValidateRequests,
+		ValidateResponses:    cfg.OpenAPI.ValidateResponses,
+		cleanup:              cleanup,
 	}, nil
 }
 
@@ -79,3 +173,115 @@ func initRedis(cfg *config.Config) (*redis.Client, error) {
 	_, err := client.Ping(ctx).Result()
 	return client, err
 }
+
+// initSearch 创建产品检索后端，进程内索引在启动时从数据库重建
+func initSearch(cfg *config.Config, db *gorm.DB) (search.Backend, error) {
+	switch cfg.Search.Backend {
+	case "mysql":
+		return search.NewMySQLBackend(db, handler.Product{}.TableName()), nil
+	case "memory":
+		idx := search.NewMemoryBackend()
+		ctx := context.Background()
+		var batch []handler.Product
+		err := db.WithContext(ctx).Where("deleted_at IS NULL").FindInBatches(&batch, 500, func(tx *gorm.DB, _ int) error {
+			docs := make([]search.Document, len(batch))
+			for i, p := range batch {
+				docs[i] = handler.ProductDocument(p)
+			}
+			return idx.Index(ctx, docs...)
+		}).Error
+		if err != nil {
+			return nil, err
+		}
+		return idx, nil
+	default:
+		return nil, fmt.Errorf("unknown search backend %q", cfg.Search.Backend)
+	}
+}
+
+// initRates 加载汇率表
+func initRates(cfg *config.Config) (*money.Rates, error) {
+	if cfg.Money.RatesFile == "" {
+		return money.NewRates(money.DefaultCurrency, nil)
+	}
+	return money.LoadRates(cfg.Money.RatesFile)
+}
+
+// initStorage 创建上传文件存储与下载地址签名器
+func initStorage(cfg *config.Config) (storage.BlobStore, *storage.URLSigner, error) {
+	key := []byte(cfg.Storage.SigningKey)
+	if len(key) == 0 {
+		// 随机密钥只在当前进程内有效，多实例部署需要配置 STORAGE_SIGNING_KEY
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, nil, err
+		}
+	}
+	signer := storage.NewURLSigner(key)
+
+	switch cfg.Storage.Backend {
+	case "local":
+		store, err := storage.NewLocalStore(cfg.Storage.LocalDir)
+		return store, signer, err
+	case "s3":
+		store, err := storage.NewS3Store(storage.S3Config{
+			Endpoint:  cfg.Storage.S3.Endpoint,
+			Region:    cfg.Storage.S3.Region,
+			Bucket:    cfg.Storage.S3.Bucket,
+			AccessKey: cfg.Storage.S3.AccessKey,
+			SecretKey: cfg.Storage.S3.SecretKey,
+			PathStyle: cfg.Storage.S3.PathStyle,
+		})
+		return store, signer, err
+	default:
+		return nil, nil, fmt.Errorf("unknown storage backend %q", cfg.Storage.Backend)
+	}
+}
+
+// initPayments 创建支付渠道
+func initPayments(cfg *config.Config) (payment.Provider, error) {
+	switch cfg.Payment.Provider {
+	case "fake":
+		return payment.NewFakeProvider(), nil
+	default:
+		return nil, fmt.Errorf("unknown payment provider %q", cfg.Payment.Provider)
+	}
+}
+
+// initBroker 根据配置选择领域事件的消息代理
+func initBroker(cfg *config.Config, client *redis.Client) (events.Broker, error) {
+	switch cfg.Events.Broker {
+	case "redis":
+		return events.NewRedisStreamBroker(client, cfg.Events.StreamPrefix, cfg.Events.StreamMaxLen), nil
+	case "memory":
+		return events.NewMemoryBroker(), nil
+	case "none":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown event broker %q", cfg.Events.Broker)
+	}
+}
+
+// initNotifier 按配置组合告警通知渠道
+func initNotifier(cfg *config.Config) (notify.Notifier, error) {
+	var notifiers notify.Multi
+	for _, name := range cfg.Alerts.Notifiers {
+		switch name {
+		case "log":
+			notifiers = append(notifiers, notify.NewLogNotifier(os.Stdout))
+		case "webhook":
+			if cfg.Alerts.WebhookURL == "" {
+				return nil, fmt.Errorf("ALERT_WEBHOOK_URL is required for the webhook notifier")
+			}
+			notifiers = append(notifiers, notify.NewWebhookNotifier(cfg.Alerts.WebhookURL))
+		case "smtp":
+			if cfg.Alerts.SMTPAddr == "" || cfg.Alerts.SMTPFrom == "" || len(cfg.Alerts.EmailTo) == 0 {
+				return nil, fmt.Errorf("SMTP_ADDR, SMTP_FROM and ALERT_EMAIL_TO are required for the smtp notifier")
+			}
+			notifiers = append(notifiers, notify.NewSMTPNotifier(cfg.Alerts.SMTPAddr, cfg.Alerts.SMTPFrom, cfg.Alerts.EmailTo))
+		default:
+			return nil, fmt.Errorf("unknown notifier %q", name)
+		}
+	}
+	return notifiers, nil
+}
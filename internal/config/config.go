@@ -3,6 +3,9 @@ package config
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
@@ -19,10 +22,76 @@ type Config struct {
 	}
 	Server struct {
 		Port string
+		// GRPCPort gRPC 服务端口，与 HTTP 分开监听
+		GRPCPort string
+		// Env 运行环境，production 时关闭只用于排查问题的功能
+		Env string
 	}
 	Tracing struct {
 		Endpoint string
 	}
+	Search struct {
+		Backend string
+	}
+	Money struct {
+		RatesFile string
+	}
+	Storage struct {
+		Backend        string
+		LocalDir       string
+		SigningKey     string
+		MaxUploadBytes int64
+		SignedURLTTL   time.Duration
+		S3             struct {
+			Endpoint  string
+			Region    string
+			Bucket    string
+			AccessKey string
+			SecretKey string
+			PathStyle bool
+		}
+	}
+	Payment struct {
+		Provider string
+	}
+	Alerts struct {
+		CheckInterval time.Duration
+		Notifiers     []string
+		WebhookURL    string
+		SMTPAddr      string
+		SMTPFrom      string
+		EmailTo       []string
+	}
+	Admin struct {
+		UserIDs []uint
+	}
+	Events struct {
+		Broker        string
+		StreamPrefix  string
+		StreamMaxLen  int64
+		RelayInterval time.Duration
+		// HeartbeatInterval SSE 连接空闲时的心跳间隔
+		HeartbeatInterval time.Duration
+		// MaxSubscriptions 单个实时库存 WebSocket 连接最多订阅的产品数
+		MaxSubscriptions int
+	}
+	GraphQL struct {
+		// MaxDepth 查询允许的最大嵌套层数
+		MaxDepth int
+		// MaxComplexity 查询允许的最大复杂度，分页字段按每页条数放大
+		MaxComplexity int
+	}
+	Webhooks struct {
+		MaxAttempts      int
+		DisableAfter     int
+		DeliveryInterval time.Duration
+	}
+	OpenAPI struct {
+		// ValidateRequests 按 OpenAPI 文档校验请求，不符合时返回 400
+		ValidateRequests bool
+		// ValidateResponses 按 OpenAPI 文档校验响应，只记录日志与指标
+		ValidateResponses bool
+	}
 }
 
 func Load() (*Config, error) {
@@ -42,12 +111,184 @@ func Load() (*Config, error) {
 	if cfg.Server.Port == "" {
 		cfg.Server.Port = "8080"
 	}
+	cfg.Server.GRPCPort = os.Getenv("GRPC_PORT")
+	if cfg.Server.GRPCPort == "" {
+		cfg.Server.GRPCPort = "50051"
+	}
+	cfg.Server.Env = os.Getenv("APP_ENV")
+	if cfg.Server.Env == "" {
+		cfg.Server.Env = "development"
+	}
 
 	cfg.Tracing.Endpoint = os.Getenv("TRACING_ENDPOINT")
 	if cfg.Tracing.Endpoint == "" {
 		cfg.Tracing.Endpoint = "jaeger:4317"
 	}
 
+	// 产品检索后端：mysql（FULLTEXT 索引）或 memory（进程内索引）
+	cfg.Search.Backend = os.Getenv("SEARCH_BACKEND")
+	if cfg.Search.Backend == "" {
+		cfg.Search.Backend = "mysql"
+	}
+
+	// 汇率文件，未配置时只支持默认币种
+	cfg.Money.RatesFile = os.Getenv("EXCHANGE_RATES_FILE")
+
+	// 上传文件存储：local（本地目录）或 s3（S3 兼容存储，如 MinIO）
+	cfg.Storage.Backend = os.Getenv("STORAGE_BACKEND")
+	if cfg.Storage.Backend == "" {
+		cfg.Storage.Backend = "local"
+	}
+	cfg.Storage.LocalDir = os.Getenv("STORAGE_LOCAL_DIR")
+	if cfg.Storage.LocalDir == "" {
+		cfg.Storage.LocalDir = "./data/uploads"
+	}
+	// 签名下载地址的密钥，未配置时每次启动随机生成
+	cfg.Storage.SigningKey = os.Getenv("STORAGE_SIGNING_KEY")
+	if v := os.Getenv("UPLOAD_MAX_BYTES"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid UPLOAD_MAX_BYTES %q", v)
+		}
+		cfg.Storage.MaxUploadBytes = n
+	}
+	if v := os.Getenv("SIGNED_URL_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid SIGNED_URL_TTL %q", v)
+		}
+		cfg.Storage.SignedURLTTL = d
+	}
+	cfg.Storage.S3.Endpoint = os.Getenv("S3_ENDPOINT")
+	cfg.Storage.S3.Region = os.Getenv("S3_REGION")
+	cfg.Storage.S3.Bucket = os.Getenv("S3_BUCKET")
+	cfg.Storage.S3.AccessKey = os.Getenv("S3_ACCESS_KEY")
+	cfg.Storage.S3.SecretKey = os.Getenv("S3_SECRET_KEY")
+	cfg.Storage.S3.PathStyle = os.Getenv("S3_PATH_STYLE") == "true"
+
+	// 支付渠道，目前只有 fake（模拟支付，不产生真实扣款）
+	cfg.Payment.Provider = os.Getenv("PAYMENT_PROVIDER")
+	if cfg.Payment.Provider == "" {
+		cfg.Payment.Provider = "fake"
+	}
+
+	// 低库存告警：定期检查间隔与通知渠道（log、webhook、smtp，逗号分隔）
+	cfg.Alerts.CheckInterval = 5 * time.Minute
+	if v := os.Getenv("ALERT_CHECK_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid ALERT_CHECK_INTERVAL %q", v)
+		}
+		cfg.Alerts.CheckInterval = d
+	}
+	cfg.Alerts.Notifiers = splitList(os.Getenv("ALERT_NOTIFIERS"))
+	if len(cfg.Alerts.Notifiers) == 0 {
+		cfg.Alerts.Notifiers = []string{"log"}
+	}
+	cfg.Alerts.WebhookURL = os.Getenv("ALERT_WEBHOOK_URL")
+	cfg.Alerts.SMTPAddr = os.Getenv("SMTP_ADDR")
+	cfg.Alerts.SMTPFrom = os.Getenv("SMTP_FROM")
+	cfg.Alerts.EmailTo = splitList(os.Getenv("ALERT_EMAIL_TO"))
+
+	// 管理员的用户 ID，逗号分隔，未配置时没有管理员
+	for _, v := range splitList(os.Getenv("ADMIN_USER_IDS")) {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil || id == 0 {
+			return nil, fmt.Errorf("invalid ADMIN_USER_IDS %q", v)
+		}
+		cfg.Admin.UserIDs = append(cfg.Admin.UserIDs, uint(id))
+	}
+
+	// 领域事件：redis（Redis Streams）、memory（进程内，仅用于开发）或 none（只投递 webhook）
+	cfg.Events.Broker = os.Getenv("EVENTS_BROKER")
+	if cfg.Events.Broker == "" {
+		cfg.Events.Broker = "redis"
+	}
+	cfg.Events.StreamPrefix = os.Getenv("EVENTS_STREAM_PREFIX")
+	if cfg.Events.StreamPrefix == "" {
+		cfg.Events.StreamPrefix = "events"
+	}
+	cfg.Events.StreamMaxLen = 100000
+	if v := os.Getenv("EVENTS_STREAM_MAXLEN"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid EVENTS_STREAM_MAXLEN %q", v)
+		}
+		cfg.Events.StreamMaxLen = n
+	}
+	cfg.Events.RelayInterval = time.Second
+	if v := os.Getenv("OUTBOX_RELAY_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid OUTBOX_RELAY_INTERVAL %q", v)
+		}
+		cfg.Events.RelayInterval = d
+	}
+	cfg.Events.HeartbeatInterval = 15 * time.Second
+	if v := os.Getenv("SSE_HEARTBEAT_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid SSE_HEARTBEAT_INTERVAL %q", v)
+		}
+		cfg.Events.HeartbeatInterval = d
+	}
+	cfg.Events.MaxSubscriptions = 100
+	if v := os.Getenv("WS_MAX_SUBSCRIPTIONS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid WS_MAX_SUBSCRIPTIONS %q", v)
+		}
+		cfg.Events.MaxSubscriptions = n
+	}
+
+	// GraphQL 查询限制，拒绝过深或过于复杂的查询
+	cfg.GraphQL.MaxDepth = 10
+	if v := os.Getenv("GRAPHQL_MAX_DEPTH"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid GRAPHQL_MAX_DEPTH %q", v)
+		}
+		cfg.GraphQL.MaxDepth = n
+	}
+	cfg.GraphQL.MaxComplexity = 5000
+	if v := os.Getenv("GRAPHQL_MAX_COMPLEXITY"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid GRAPHQL_MAX_COMPLEXITY %q", v)
+		}
+		cfg.GraphQL.MaxComplexity = n
+	}
+
+	// webhook 投递：单次投递最多尝试次数与订阅连续失败多少次后自动停用
+	cfg.Webhooks.MaxAttempts = 8
+	if v := os.Getenv("WEBHOOK_MAX_ATTEMPTS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid WEBHOOK_MAX_ATTEMPTS %q", v)
+		}
+		cfg.Webhooks.MaxAttempts = n
+	}
+	cfg.Webhooks.DisableAfter = 20
+	if v := os.Getenv("WEBHOOK_DISABLE_AFTER"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid WEBHOOK_DISABLE_AFTER %q", v)
+		}
+		cfg.Webhooks.DisableAfter = n
+	}
+	cfg.Webhooks.DeliveryInterval = 5 * time.Second
+	if v := os.Getenv("WEBHOOK_DELIVERY_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid WEBHOOK_DELIVERY_INTERVAL %q", v)
+		}
+		cfg.Webhooks.DeliveryInterval = d
+	}
+
+	// OpenAPI 校验：请求校验默认关闭；响应校验需要缓存响应体，生产环境总是关闭，其他环境默认开启
+	cfg.OpenAPI.ValidateRequests = os.Getenv("OPENAPI_VALIDATE_REQUESTS") == "true"
+	cfg.OpenAPI.ValidateResponses = cfg.Server.Env != "production" && os.Getenv("OPENAPI_VALIDATE_RESPONSES") != "false"
+
 	return cfg, nil
 }
 
@@ -63,3 +304,14 @@ func (c *Config) GetDBDSN() string {
 func (c *Config) GetRedisAddr() string {
 	return fmt.Sprintf("%s:%s", c.Redis.Host, c.Redis.Port)
 }
+
+// splitList 解析逗号分隔的列表，忽略空项
+func splitList(v string) []string {
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
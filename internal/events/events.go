@@ -0,0 +1,40 @@
+// Package events 定义领域事件与消息代理接口，并通过 outbox 表可靠地发布事件
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Event 领域事件，ID 在同一 outbox 内单调递增，消费者可据此去重
+type Event struct {
+	ID            string            `json:"id"`
+	Type          string            `json:"type"`
+	AggregateType string            `json:"aggregate_type"`
+	AggregateID   string            `json:"aggregate_id"`
+	Payload       json.RawMessage   `json:"payload"`
+	Metadata      map[string]string `json:"metadata,omitempty"`
+	OccurredAt    time.Time         `json:"occurred_at"`
+}
+
+// Broker 消息代理，Publish 返回 nil 表示事件已被代理持久接收
+type Broker interface {
+	Publish(ctx context.Context, event Event) error
+}
+
+// Multi 依次发布到多个消息代理，单个代理失败不影响其他代理，返回合并后的错误；
+// 失败时 Relay 会重发整条事件，各代理需能容忍重复
+type Multi []Broker
+
+// Publish 实现 Broker 接口
+func (m Multi) Publish(ctx context.Context, event Event) error {
+	var errs []error
+	for _, b := range m {
+		if err := b.Publish(ctx, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,215 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-redis/redis/v8"
+	"github.com/go-redis/redismock/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func TestRedisStreamBroker(t *testing.T) {
+	client, mock := redismock.NewClientMock()
+	broker := NewRedisStreamBroker(client, "events", 1000)
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	mock.ExpectXAdd(&redis.XAddArgs{
+		Stream: "events:product",
+		MaxLen: 1000,
+		Approx: true,
+		Values: []interface{}{
+			"id", "7",
+			"type", "ProductUpdated",
+			"aggregate_id", "1",
+			"payload", `{"id":1}`,
+			"metadata", `{"actor":"alice"}`,
+			"occurred_at", "2026-01-02T03:04:05Z",
+		},
+	}).SetVal("1-0")
+
+	err := broker.Publish(context.Background(), Event{
+		ID:            "7",
+		Type:          "ProductUpdated",
+		AggregateType: "Product",
+		AggregateID:   "1",
+		Payload:       []byte(`{"id":1}`),
+		Metadata:      map[string]string{"actor": "alice"},
+		OccurredAt:    at,
+	})
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRelay(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	gormDB, err := gorm.Open(mysql.New(mysql.Config{Conn: db, SkipInitializeWithVersion: true}), &gorm.Config{})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	columns := []string{"id", "aggregate_type", "aggregate_id", "event_type", "payload", "metadata", "created_at"}
+	expectPending := func(rows *sqlmock.Rows) {
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT \\* FROM `outbox_events` WHERE published_at IS NULL AND dead_at IS NULL ORDER BY id LIMIT \\? FOR UPDATE").
+			WithArgs(defaultRelayBatch).
+			WillReturnRows(rows)
+	}
+
+	t.Run("写入事件", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO `outbox_events`").
+			WithArgs("Product", "1", "ProductCreated", `{"id":1}`, `{"actor":"alice"}`, sqlmock.AnyArg(), nil, nil, 0, "").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		require.NoError(t, Append(gormDB, "Product", "1", "ProductCreated", map[string]int{"id": 1}, map[string]string{"actor": "alice"}))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("按顺序发布并标记", func(t *testing.T) {
+		broker := NewMemoryBroker()
+		expectPending(sqlmock.NewRows(columns).
+			AddRow(1, "Product", "1", "ProductCreated", `{"id":1}`, `{"actor":"alice"}`, time.Now()).
+			AddRow(2, "User", "3", "UserDeleted", `null`, `{}`, time.Now()))
+		mock.ExpectExec("UPDATE `outbox_events` SET `published_at`=\\? WHERE id IN \\(\\?,\\?\\)").
+			WithArgs(sqlmock.AnyArg(), 1, 2).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectCommit()
+
+		published, fetched, err := NewRelay(gormDB, broker).RelayOnce(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 2, published)
+		assert.Equal(t, 2, fetched)
+		got := broker.Events()
+		require.Len(t, got, 2)
+		assert.Equal(t, "ProductCreated", got[0].Type)
+		assert.Equal(t, "alice", got[0].Metadata["actor"])
+		assert.Equal(t, "UserDeleted", got[1].Type)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("发布失败时跳过同一聚合的后续事件", func(t *testing.T) {
+		broker := NewMemoryBroker()
+		broker.Fail = func(e Event) error {
+			if e.ID == "3" {
+				return errors.New("broker unavailable")
+			}
+			return nil
+		}
+		expectPending(sqlmock.NewRows(columns).
+			AddRow(3, "Product", "1", "ProductUpdated", `{}`, `{}`, time.Now()).
+			AddRow(4, "Product", "2", "ProductUpdated", `{}`, `{}`, time.Now()).
+			AddRow(5, "Product", "1", "ProductDeleted", `{}`, `{}`, time.Now()))
+		mock.ExpectExec("UPDATE `outbox_events` SET `attempts`=attempts \\+ 1,`last_error`=\\? WHERE `id` = \\?").
+			WithArgs("broker unavailable", 3).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("UPDATE `outbox_events` SET `published_at`=\\? WHERE id IN \\(\\?\\)").
+			WithArgs(sqlmock.AnyArg(), 4).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		published, fetched, err := NewRelay(gormDB, broker).RelayOnce(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, published)
+		assert.Equal(t, 3, fetched)
+		got := broker.Events()
+		require.Len(t, got, 1)
+		assert.Equal(t, "4", got[0].ID)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("多次发布失败后转入死信且不再阻塞聚合", func(t *testing.T) {
+		broker := NewMemoryBroker()
+		broker.Fail = func(e Event) error {
+			if e.ID == "6" {
+				return errors.New("payload rejected")
+			}
+			return nil
+		}
+		expectPending(sqlmock.NewRows(append(columns, "attempts")).
+			AddRow(6, "Product", "1", "ProductUpdated", `{}`, `{}`, time.Now(), defaultRelayMaxAttempts-1).
+			AddRow(7, "Product", "1", "ProductDeleted", `{}`, `{}`, time.Now(), 0))
+		mock.ExpectExec("UPDATE `outbox_events` SET `attempts`=attempts \\+ 1,`dead_at`=\\?,`last_error`=\\? WHERE `id` = \\?").
+			WithArgs(sqlmock.AnyArg(), "payload rejected", 6).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("UPDATE `outbox_events` SET `published_at`=\\? WHERE id IN \\(\\?\\)").
+			WithArgs(sqlmock.AnyArg(), 7).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		published, fetched, err := NewRelay(gormDB, broker).RelayOnce(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, published)
+		assert.Equal(t, 2, fetched)
+		got := broker.Events()
+		require.Len(t, got, 1)
+		assert.Equal(t, "7", got[0].ID)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestRedisFeed(t *testing.T) {
+	client, mock := redismock.NewClientMock()
+	feed := NewRedisFeed(client, "events:feed", 0)
+	event := Event{ID: "7", Type: "ProductUpdated", AggregateType: "Product", AggregateID: "1", Payload: []byte(`{"id":1}`)}
+	data := `{"id":"7","type":"ProductUpdated","aggregate_type":"Product","aggregate_id":"1","payload":{"id":1},"occurred_at":"0001-01-01T00:00:00Z"}`
+
+	t.Run("追加到变更流", func(t *testing.T) {
+		mock.ExpectXAdd(&redis.XAddArgs{Stream: "events:feed", Values: []interface{}{"event", data}}).SetVal("1-0")
+
+		require.NoError(t, feed.Publish(context.Background(), event))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("从指定 ID 之后续传", func(t *testing.T) {
+		mock.ExpectXRangeN("events:feed", "(1-0", "+", FeedPageSize).SetVal([]redis.XMessage{
+			{ID: "2-0", Values: map[string]interface{}{"event": data}},
+		})
+
+		entries, err := feed.Since(context.Background(), "1-0")
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		assert.Equal(t, "2-0", entries[0].ID)
+		assert.Equal(t, "ProductUpdated", entries[0].Event.Type)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("读取新事件并分发给订阅者", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		live, unsubscribe := feed.Subscribe()
+		defer unsubscribe()
+
+		mock.ExpectXRead(&redis.XReadArgs{Streams: []string{"events:feed", "$"}, Block: feedReadBlock}).
+			SetVal([]redis.XStream{{Stream: "events:feed", Messages: []redis.XMessage{{ID: "3-0", Values: map[string]interface{}{"event": data}}}}})
+		// 之后的读取从上次的 ID 继续，返回时结束循环
+		mock.ExpectXRead(&redis.XReadArgs{Streams: []string{"events:feed", "3-0"}, Block: feedReadBlock}).
+			RedisNil()
+
+		done := make(chan struct{})
+		go func() {
+			feed.Run(ctx)
+			close(done)
+		}()
+		entry := <-live
+		assert.Equal(t, "3-0", entry.ID)
+		assert.Equal(t, "7", entry.Event.ID)
+		cancel()
+		<-done
+	})
+
+	t.Run("比较条目 ID", func(t *testing.T) {
+		assert.True(t, FeedIDAfter("10-0", "9-5"))
+		assert.True(t, FeedIDAfter("9-6", "9-5"))
+		assert.False(t, FeedIDAfter("9-5", "9-5"))
+		assert.True(t, ValidFeedID("1700000000000-3"))
+		assert.False(t, ValidFeedID("abc"))
+	})
+}
@@ -0,0 +1,183 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	feedBuffer     = 64
+	feedReadBlock  = 5 * time.Second
+	feedRetryDelay = time.Second
+	// FeedPageSize Since 每次最多返回的条数
+	FeedPageSize = 500
+)
+
+// FeedEntry 变更流中的一条事件，ID 为 Redis stream 条目 ID，可用于断线续传
+type FeedEntry struct {
+	ID    string
+	Event Event
+}
+
+// RedisFeed 把所有聚合的事件追加到同一个 Redis stream，供 SSE 等实时推送使用。
+// 每个实例只用一个协程阻塞读取 stream 并分发给本地订阅者，多实例部署时各自读取同一 stream
+type RedisFeed struct {
+	client *redis.Client
+	stream string
+	maxLen int64
+
+	mu   sync.Mutex
+	subs map[chan FeedEntry]struct{}
+}
+
+// NewRedisFeed 创建变更流，maxLen 大于 0 时近似裁剪 stream 长度，决定了可续传的范围
+func NewRedisFeed(client *redis.Client, stream string, maxLen int64) *RedisFeed {
+	return &RedisFeed{client: client, stream: stream, maxLen: maxLen, subs: make(map[chan FeedEntry]struct{})}
+}
+
+// Publish 实现 Broker 接口
+func (f *RedisFeed) Publish(ctx context.Context, event Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	args := &redis.XAddArgs{
+		Stream: f.stream,
+		Values: []interface{}{"event", string(data)},
+	}
+	if f.maxLen > 0 {
+		args.MaxLen = f.maxLen
+		args.Approx = true
+	}
+	return f.client.XAdd(ctx, args).Err()
+}
+
+// Since 返回 ID 之后的事件，最多 FeedPageSize 条；ID 早于已裁剪的部分时从最早保留的事件开始
+func (f *RedisFeed) Since(ctx context.Context, id string) ([]FeedEntry, error) {
+	msgs, err := f.client.XRangeN(ctx, f.stream, "("+id, "+", FeedPageSize).Result()
+	if err != nil {
+		return nil, err
+	}
+	return decodeEntries(msgs)
+}
+
+// Subscribe 订阅此后到达的事件，返回的函数用于取消订阅。
+// 订阅者处理过慢、缓冲区写满时通道会被关闭，调用方应结束推送，由客户端带 Last-Event-ID 重连
+func (f *RedisFeed) Subscribe() (<-chan FeedEntry, func()) {
+	ch := make(chan FeedEntry, feedBuffer)
+	f.mu.Lock()
+	f.subs[ch] = struct{}{}
+	f.mu.Unlock()
+	return ch, func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if _, ok := f.subs[ch]; ok {
+			delete(f.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// Run 从 stream 末尾开始阻塞读取新事件并分发给订阅者，直到 ctx 取消
+func (f *RedisFeed) Run(ctx context.Context) {
+	last := "$"
+	for ctx.Err() == nil {
+		streams, err := f.client.XRead(ctx, &redis.XReadArgs{
+			Streams: []string{f.stream, last},
+			Block:   feedReadBlock,
+		}).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				fmt.Printf("Error reading event feed: %v\n", err)
+				select {
+				case <-ctx.Done():
+				case <-time.After(feedRetryDelay):
+				}
+			}
+			continue
+		}
+		for _, stream := range streams {
+			entries, err := decodeEntries(stream.Messages)
+			if err != nil {
+				fmt.Printf("Error decoding event feed: %v\n", err)
+			}
+			for _, entry := range entries {
+				f.dispatch(entry)
+			}
+			if n := len(stream.Messages); n > 0 {
+				last = stream.Messages[n-1].ID
+			}
+		}
+	}
+}
+
+// dispatch 非阻塞地发给每个订阅者，缓冲区已满的订阅者被移除
+func (f *RedisFeed) dispatch(entry FeedEntry) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for ch := range f.subs {
+		select {
+		case ch <- entry:
+		default:
+			delete(f.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// decodeEntries 解析 stream 条目，无法解析的条目被跳过并返回错误
+func decodeEntries(msgs []redis.XMessage) ([]FeedEntry, error) {
+	entries := make([]FeedEntry, 0, len(msgs))
+	var firstErr error
+	for _, msg := range msgs {
+		data, _ := msg.Values["event"].(string)
+		var event Event
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("feed entry %s: %w", msg.ID, err)
+			}
+			continue
+		}
+		entries = append(entries, FeedEntry{ID: msg.ID, Event: event})
+	}
+	return entries, firstErr
+}
+
+// ValidFeedID 判断是否为合法的 stream 条目 ID（毫秒时间戳-序号）
+func ValidFeedID(id string) bool {
+	_, _, ok := parseFeedID(id)
+	return ok
+}
+
+// FeedIDAfter 判断条目 ID a 是否在 b 之后
+func FeedIDAfter(a, b string) bool {
+	ams, aseq, _ := parseFeedID(a)
+	bms, bseq, _ := parseFeedID(b)
+	return ams > bms || (ams == bms && aseq > bseq)
+}
+
+func parseFeedID(id string) (uint64, uint64, bool) {
+	msPart, seqPart, found := strings.Cut(id, "-")
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	if !found {
+		return ms, 0, true
+	}
+	seq, err := strconv.ParseUint(seqPart, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return ms, seq, true
+}
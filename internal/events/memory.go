@@ -0,0 +1,39 @@
+package events
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryBroker 进程内消息代理，保存收到的全部事件，用于测试与本地开发
+type MemoryBroker struct {
+	mu     sync.Mutex
+	events []Event
+	// Fail 不为 nil 时对匹配的事件返回错误，用于模拟代理故障
+	Fail func(Event) error
+}
+
+// NewMemoryBroker 创建进程内消息代理
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{}
+}
+
+// Publish 实现 Broker 接口
+func (m *MemoryBroker) Publish(_ context.Context, event Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Fail != nil {
+		if err := m.Fail(event); err != nil {
+			return err
+		}
+	}
+	m.events = append(m.events, event)
+	return nil
+}
+
+// Events 返回已发布事件的副本，按发布顺序排列
+func (m *MemoryBroker) Events() []Event {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Event(nil), m.events...)
+}
@@ -0,0 +1,166 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	defaultRelayBatch = 100
+	// defaultRelayMaxAttempts 事件连续发布失败的次数上限，达到后转入死信
+	defaultRelayMaxAttempts = 10
+)
+
+// OutboxEvent 待发布的事件，与业务数据在同一事务中写入，由 Relay 异步发布
+type OutboxEvent struct {
+	ID            uint64     `gorm:"primaryKey"`
+	AggregateType string     `gorm:"size:64;not null"`
+	AggregateID   string     `gorm:"size:64;not null"`
+	EventType     string     `gorm:"size:128;not null"`
+	Payload       string     `gorm:"type:json"`
+	Metadata      string     `gorm:"type:json"`
+	CreatedAt     time.Time  `gorm:"not null"`
+	PublishedAt   *time.Time `gorm:"index"`
+	DeadAt        *time.Time `gorm:"index"`
+	Attempts      int        `gorm:"not null;default:0"`
+	LastError     string
+}
+
+// TableName 指定 outbox 表名
+func (OutboxEvent) TableName() string {
+	return "outbox_events"
+}
+
+// Append 在事务 tx 中写入一条待发布事件，payload 与 metadata 序列化为 JSON
+func Append(tx *gorm.DB, aggregateType, aggregateID, eventType string, payload interface{}, metadata map[string]string) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	meta, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+	return tx.Create(&OutboxEvent{
+		AggregateType: aggregateType,
+		AggregateID:   aggregateID,
+		EventType:     eventType,
+		Payload:       string(data),
+		Metadata:      string(meta),
+		CreatedAt:     time.Now(),
+	}).Error
+}
+
+// event 转换为发布用的事件
+func (o *OutboxEvent) event() Event {
+	event := Event{
+		ID:            strconv.FormatUint(o.ID, 10),
+		Type:          o.EventType,
+		AggregateType: o.AggregateType,
+		AggregateID:   o.AggregateID,
+		Payload:       json.RawMessage(o.Payload),
+		OccurredAt:    o.CreatedAt,
+	}
+	if o.Metadata != "" {
+		_ = json.Unmarshal([]byte(o.Metadata), &event.Metadata)
+	}
+	return event
+}
+
+// Relay 按写入顺序把 outbox 中的事件发布到消息代理。
+// 发布成功后才标记为已发布，进程在两步之间退出会重复发布（至少一次）；
+// 同一聚合的事件发布失败后，本轮跳过该聚合的后续事件以保持顺序。
+// 连续失败 maxAttempts 次的事件记录 dead_at 转入死信，不再发布，也不再阻塞所属聚合与后续批次，
+// 需要人工排查后清空 dead_at 重新发布
+type Relay struct {
+	db          *gorm.DB
+	broker      Broker
+	batch       int
+	maxAttempts int
+}
+
+// NewRelay 创建 outbox 发布器
+func NewRelay(db *gorm.DB, broker Broker) *Relay {
+	return &Relay{db: db, broker: broker, batch: defaultRelayBatch, maxAttempts: defaultRelayMaxAttempts}
+}
+
+// RelayOnce 发布一批待发布事件，返回成功发布的数量与本批读取的数量。
+// 读取时锁定这批事件，多个实例同时运行时依次处理，不会打乱顺序
+func (r *Relay) RelayOnce(ctx context.Context) (published, fetched int, err error) {
+	err = r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var pending []OutboxEvent
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("published_at IS NULL AND dead_at IS NULL").Order("id").Limit(r.batch).Find(&pending).Error; err != nil {
+			return err
+		}
+		fetched = len(pending)
+
+		blocked := make(map[string]bool)
+		var done []uint64
+		for i := range pending {
+			ev := &pending[i]
+			aggregate := ev.AggregateType + ":" + ev.AggregateID
+			if blocked[aggregate] {
+				continue
+			}
+			if err := r.broker.Publish(ctx, ev.event()); err != nil {
+				updates := map[string]interface{}{
+					"attempts":   gorm.Expr("attempts + 1"),
+					"last_error": err.Error(),
+				}
+				if ev.Attempts+1 >= r.maxAttempts {
+					// 转入死信，同一聚合的后续事件照常发布
+					updates["dead_at"] = time.Now()
+				} else {
+					blocked[aggregate] = true
+				}
+				if err := tx.Model(ev).Updates(updates).Error; err != nil {
+					return err
+				}
+				continue
+			}
+			done = append(done, ev.ID)
+		}
+		if len(done) == 0 {
+			return nil
+		}
+		published = len(done)
+		return tx.Model(&OutboxEvent{}).Where("id IN ?", done).Update("published_at", time.Now()).Error
+	})
+	if err != nil {
+		return 0, fetched, err
+	}
+	return published, fetched, nil
+}
+
+// Run 定期发布待发布事件，积压时连续处理，直到 ctx 取消
+func (r *Relay) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for ctx.Err() == nil {
+				published, fetched, err := r.RelayOnce(ctx)
+				if err != nil {
+					if ctx.Err() == nil {
+						fmt.Printf("Error relaying outbox events: %v\n", err)
+					}
+					break
+				}
+				// 本批有失败或已取完时等待下一轮
+				if fetched < r.batch || published < fetched {
+					break
+				}
+			}
+		}
+	}
+}
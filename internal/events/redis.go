@@ -0,0 +1,52 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RedisStreamBroker 将事件写入 Redis Streams，每种聚合一个 stream（如 events:product），
+// 同一聚合的事件按发布顺序追加
+type RedisStreamBroker struct {
+	client *redis.Client
+	prefix string
+	maxLen int64
+}
+
+// NewRedisStreamBroker 创建 Redis Streams 消息代理，maxLen 大于 0 时近似裁剪 stream 长度
+func NewRedisStreamBroker(client *redis.Client, prefix string, maxLen int64) *RedisStreamBroker {
+	return &RedisStreamBroker{client: client, prefix: prefix, maxLen: maxLen}
+}
+
+// Stream 返回聚合类型对应的 stream 名称
+func (b *RedisStreamBroker) Stream(aggregateType string) string {
+	return b.prefix + ":" + strings.ToLower(aggregateType)
+}
+
+// Publish 实现 Broker 接口
+func (b *RedisStreamBroker) Publish(ctx context.Context, event Event) error {
+	metadata, err := json.Marshal(event.Metadata)
+	if err != nil {
+		return err
+	}
+	args := &redis.XAddArgs{
+		Stream: b.Stream(event.AggregateType),
+		Values: []interface{}{
+			"id", event.ID,
+			"type", event.Type,
+			"aggregate_id", event.AggregateID,
+			"payload", string(event.Payload),
+			"metadata", string(metadata),
+			"occurred_at", event.OccurredAt.UTC().Format(time.RFC3339Nano),
+		},
+	}
+	if b.maxLen > 0 {
+		args.MaxLen = b.maxLen
+		args.Approx = true
+	}
+	return b.client.XAdd(ctx, args).Err()
+}
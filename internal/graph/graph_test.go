@@ -0,0 +1,278 @@
+package graph
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-redis/redismock/v8"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/songfei1983/play-go-api/internal/handler"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+// setupGraphTest 创建使用 sqlmock 与 redismock 的 GraphQL 处理器
+func setupGraphTest(t *testing.T, limits Limits) (*Handler, sqlmock.Sqlmock, redismock.ClientMock) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	gormDB, err := gorm.Open(mysql.New(mysql.Config{
+		Conn:                      db,
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{})
+	require.NoError(t, err)
+	redisClient, redisMock := redismock.NewClientMock()
+
+	h := NewHandler(
+		handler.NewUserHandler(gormDB, redisClient),
+		handler.NewProductHandler(gormDB, redisClient),
+		handler.NewCategoryHandler(gormDB, redisClient),
+		handler.NewAdmins([]uint{9}),
+		limits,
+	)
+	return h, mock, redisMock
+}
+
+type response struct {
+	Data   map[string]json.RawMessage `json:"data"`
+	Errors []struct {
+		Message    string                 `json:"message"`
+		Extensions map[string]interface{} `json:"extensions"`
+	} `json:"errors"`
+}
+
+// execute 以 username 的身份执行 GraphQL 请求，admin 的用户 ID 为 9，其他用户为 1
+func execute(t *testing.T, h *Handler, username, query string, variables map[string]interface{}) response {
+	body, err := json.Marshal(Request{Query: query, Variables: variables})
+	require.NoError(t, err)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/graphql", strings.NewReader(string(body)))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	userID := float64(1)
+	if username == "admin" {
+		userID = 9
+	}
+	c.Set("user", &jwt.Token{Claims: jwt.MapClaims{"user_id": userID, "username": username}})
+
+	require.NoError(t, h.Serve(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var resp response
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	return resp
+}
+
+func productRows(categoryID interface{}, ids ...int) *sqlmock.Rows {
+	rows := sqlmock.NewRows([]string{"id", "name", "price", "currency", "stock", "status", "category_id"})
+	for _, id := range ids {
+		rows.AddRow(id, "Mug", "9.99", "USD", 5, "active", categoryID)
+	}
+	return rows
+}
+
+func TestProductQueries(t *testing.T) {
+	h, mock, redisMock := setupGraphTest(t, Limits{MaxDepth: 6, MaxComplexity: 500})
+
+	t.Run("批量加载变体与分类", func(t *testing.T) {
+		// 两个加载器的求值顺序不固定
+		mock.MatchExpectationsInOrder(false)
+		defer mock.MatchExpectationsInOrder(true)
+
+		mock.ExpectQuery("SELECT \\* FROM `products` WHERE deleted_at IS NULL ORDER BY id LIMIT \\?").
+			WithArgs(3).
+			WillReturnRows(productRows(7, 1, 2, 3))
+		mock.ExpectQuery("SELECT \\* FROM `product_variants` WHERE product_id IN \\(\\?,\\?\\) ORDER BY id").
+			WithArgs(1, 2).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "product_id", "sku", "options", "price", "stock"}).
+				AddRow(10, 1, "MUG-RED", `{"colour":"red","size":"M"}`, nil, 2).
+				AddRow(11, 1, "MUG-BLUE", `{"colour":"blue"}`, "12.50", 3))
+		mock.ExpectQuery("SELECT \\* FROM `categories` WHERE deleted_at IS NULL AND id IN \\(\\?\\)").
+			WithArgs(7).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(7, "Kitchen"))
+
+		resp := execute(t, h, "alice", `{
+			products(first: 2) {
+				nodes { id name price stock category { name } variants { sku price stock options { name value } } }
+				nextCursor
+			}
+		}`, nil)
+		require.Empty(t, resp.Errors)
+
+		var products struct {
+			Nodes []struct {
+				ID       string
+				Price    string
+				Stock    int
+				Category struct{ Name string }
+				Variants []struct {
+					SKU     string
+					Price   *string
+					Options []struct{ Name, Value string }
+				}
+			}
+			NextCursor *string
+		}
+		require.NoError(t, json.Unmarshal(resp.Data["products"], &products))
+		require.Len(t, products.Nodes, 2)
+		assert.Equal(t, "2", *products.NextCursor)
+		assert.Equal(t, "9.99", products.Nodes[0].Price)
+		assert.Equal(t, "Kitchen", products.Nodes[1].Category.Name)
+		require.Len(t, products.Nodes[0].Variants, 2)
+		assert.Nil(t, products.Nodes[0].Variants[0].Price)
+		assert.Equal(t, "12.50", *products.Nodes[0].Variants[1].Price)
+		assert.Equal(t, []struct{ Name, Value string }{{"colour", "red"}, {"size", "M"}}, products.Nodes[0].Variants[0].Options)
+		assert.Empty(t, products.Nodes[1].Variants)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("产品不存在时返回 null", func(t *testing.T) {
+		redisMock.ExpectGet("products:9").RedisNil()
+		mock.ExpectQuery("SELECT \\* FROM `products` WHERE deleted_at IS NULL AND `products`\\.`id` = \\? ORDER BY `products`\\.`id` LIMIT \\?").
+			WithArgs(9, 1).
+			WillReturnError(gorm.ErrRecordNotFound)
+
+		resp := execute(t, h, "alice", `{ product(id: 9) { name } }`, nil)
+		require.Empty(t, resp.Errors)
+		assert.JSONEq(t, "null", string(resp.Data["product"]))
+	})
+
+	t.Run("超过复杂度上限", func(t *testing.T) {
+		resp := execute(t, h, "alice", `query($n: Int) { products(first: $n) { nodes { id name price stock status } } }`,
+			map[string]interface{}{"n": 200})
+		require.Len(t, resp.Errors, 1)
+		assert.Equal(t, codeQueryTooComplex, resp.Errors[0].Extensions["code"])
+		assert.Contains(t, resp.Errors[0].Message, "complexity")
+	})
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.NoError(t, redisMock.ExpectationsWereMet())
+}
+
+func TestLimits(t *testing.T) {
+	h, _, _ := setupGraphTest(t, Limits{MaxDepth: 3, MaxComplexity: 100})
+
+	t.Run("深度超限", func(t *testing.T) {
+		resp := execute(t, h, "alice", `{ products { nodes { variants { options { name } } } } }`, nil)
+		require.Len(t, resp.Errors, 1)
+		assert.Equal(t, codeQueryTooComplex, resp.Errors[0].Extensions["code"])
+		assert.Contains(t, resp.Errors[0].Message, "depth 5")
+	})
+
+	t.Run("片段计入深度，内省字段不计入", func(t *testing.T) {
+		resp := execute(t, h, "alice", `fragment N on Product { variants { sku } } { products { nodes { ...N } } }`, nil)
+		require.Len(t, resp.Errors, 1)
+		assert.Contains(t, resp.Errors[0].Message, "depth 4")
+
+		resp = execute(t, h, "alice", `{ __schema { types { name fields { name type { name ofType { name } } } } } }`, nil)
+		assert.Empty(t, resp.Errors)
+	})
+
+	t.Run("语法错误", func(t *testing.T) {
+		resp := execute(t, h, "alice", `{ products {`, nil)
+		require.Len(t, resp.Errors, 1)
+	})
+}
+
+func TestUserQueries(t *testing.T) {
+	h, mock, redisMock := setupGraphTest(t, Limits{})
+
+	t.Run("非管理员不能列出用户", func(t *testing.T) {
+		resp := execute(t, h, "alice", `{ users { nodes { username } } }`, nil)
+		require.Len(t, resp.Errors, 1)
+		assert.Equal(t, codeForbidden, resp.Errors[0].Extensions["code"])
+	})
+
+	t.Run("管理员列出用户", func(t *testing.T) {
+		mock.ExpectQuery("SELECT \\* FROM `users` WHERE deleted_at IS NULL ORDER BY id LIMIT \\?").
+			WithArgs(51).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password"}).AddRow(1, "alice", "secret"))
+
+		resp := execute(t, h, "admin", `{ users { nodes { id username } nextCursor } }`, nil)
+		require.Empty(t, resp.Errors)
+		assert.JSONEq(t, `{"nodes":[{"id":"1","username":"alice"}],"nextCursor":null}`, string(resp.Data["users"]))
+	})
+
+	t.Run("当前用户", func(t *testing.T) {
+		redisMock.ExpectGet("user:1").SetVal(`{"id":1,"username":"alice","first_name":"Alice"}`)
+
+		resp := execute(t, h, "alice", `{ me { username firstName } }`, nil)
+		require.Empty(t, resp.Errors)
+		assert.JSONEq(t, `{"username":"alice","firstName":"Alice"}`, string(resp.Data["me"]))
+	})
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.NoError(t, redisMock.ExpectationsWereMet())
+}
+
+func TestMutations(t *testing.T) {
+	h, mock, redisMock := setupGraphTest(t, Limits{})
+
+	t.Run("只更新提供的字段", func(t *testing.T) {
+		mock.ExpectQuery("SELECT \\* FROM `products` WHERE deleted_at IS NULL AND `products`\\.`id` = \\? ORDER BY `products`\\.`id` LIMIT \\?").
+			WithArgs(1, 1).
+			WillReturnRows(productRows(nil, 1))
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE `products` SET `status`=\\?,`updated_at`=\\? WHERE `id` = \\?").
+			WithArgs("inactive", sqlmock.AnyArg(), 1).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		redisMock.ExpectDel("products:1").SetVal(1)
+
+		resp := execute(t, h, "alice", `mutation($id: ID!) { updateProduct(id: $id, input: {status: "inactive"}) { name status categoryId } }`,
+			map[string]interface{}{"id": "1"})
+		require.Empty(t, resp.Errors)
+		assert.JSONEq(t, `{"name":"Mug","status":"inactive","categoryId":null}`, string(resp.Data["updateProduct"]))
+	})
+
+	t.Run("校验失败", func(t *testing.T) {
+		mock.ExpectQuery("SELECT \\* FROM `products` WHERE deleted_at IS NULL AND `products`\\.`id` = \\? ORDER BY `products`\\.`id` LIMIT \\?").
+			WithArgs(1, 1).
+			WillReturnRows(productRows(nil, 1))
+
+		resp := execute(t, h, "alice", `mutation { updateProduct(id: 1, input: {status: "archived"}) { status } }`, nil)
+		require.Len(t, resp.Errors, 1)
+		assert.Equal(t, codeBadRequest, resp.Errors[0].Extensions["code"])
+	})
+
+	t.Run("库存不能通过更新修改", func(t *testing.T) {
+		mock.ExpectQuery("SELECT \\* FROM `products` WHERE deleted_at IS NULL AND `products`\\.`id` = \\? ORDER BY `products`\\.`id` LIMIT \\?").
+			WithArgs(1, 1).
+			WillReturnRows(productRows(nil, 1))
+
+		resp := execute(t, h, "alice", `mutation { updateProduct(id: 1, input: {stock: 7}) { stock } }`, nil)
+		require.Len(t, resp.Errors, 1)
+		assert.Equal(t, codeBadRequest, resp.Errors[0].Extensions["code"])
+		assert.Contains(t, resp.Errors[0].Message, "cannot be written")
+	})
+
+	t.Run("创建产品缺少名称", func(t *testing.T) {
+		resp := execute(t, h, "alice", `mutation { createProduct(input: {price: "1.00"}) { id } }`, nil)
+		require.Len(t, resp.Errors, 1)
+		assert.Contains(t, resp.Errors[0].Message, "name is required")
+	})
+
+	t.Run("用户本人不能修改用户名", func(t *testing.T) {
+		mock.ExpectQuery("SELECT \\* FROM `users` WHERE deleted_at IS NULL AND `users`\\.`id` = \\? ORDER BY `users`\\.`id` LIMIT \\?").
+			WithArgs(1, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "email", "status"}).AddRow(1, "alice", "secret", "alice@example.com", "active"))
+
+		resp := execute(t, h, "alice", `mutation { updateUser(id: 1, input: {username: "admin"}) { username } }`, nil)
+		require.Len(t, resp.Errors, 1)
+		assert.Equal(t, codeForbidden, resp.Errors[0].Extensions["code"])
+	})
+
+	t.Run("输入为空", func(t *testing.T) {
+		resp := execute(t, h, "alice", `mutation { updateUser(id: 1, input: {}) { id } }`, nil)
+		require.Len(t, resp.Errors, 1)
+		assert.Equal(t, codeBadRequest, resp.Errors[0].Extensions["code"])
+	})
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.NoError(t, redisMock.ExpectationsWereMet())
+}
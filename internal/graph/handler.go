@@ -0,0 +1,213 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"github.com/labstack/echo/v4"
+	"github.com/songfei1983/play-go-api/internal/handler"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"gorm.io/gorm"
+)
+
+// 错误的 extensions.code，客户端据此区分错误类型
+const (
+	codeBadRequest      = "BAD_REQUEST"
+	codeUnauthenticated = "UNAUTHENTICATED"
+	codeForbidden       = "FORBIDDEN"
+	codeNotFound        = "NOT_FOUND"
+	codeConflict        = "CONFLICT"
+	codeQueryTooComplex = "QUERY_TOO_COMPLEX"
+	codeInternal        = "INTERNAL"
+)
+
+// apiError 带 extensions.code 的 GraphQL 错误
+type apiError struct {
+	code    string
+	message string
+}
+
+func (e *apiError) Error() string {
+	return e.message
+}
+
+// Extensions 实现 gqlerrors.ExtendedError
+func (e *apiError) Extensions() map[string]interface{} {
+	return map[string]interface{}{"code": e.code}
+}
+
+// toAPIError 将处理器返回的 HTTP 错误与数据库错误转换为 GraphQL 错误
+func toAPIError(err error) error {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &apiError{code: codeNotFound, message: "record not found"}
+	}
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		return &apiError{code: codeOf(httpErr.Code), message: fmt.Sprint(httpErr.Message)}
+	}
+	return &apiError{code: codeInternal, message: err.Error()}
+}
+
+// codeOf HTTP 状态码对应的错误码
+func codeOf(status int) string {
+	switch status {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity, http.StatusUnsupportedMediaType:
+		return codeBadRequest
+	case http.StatusUnauthorized:
+		return codeUnauthenticated
+	case http.StatusForbidden:
+		return codeForbidden
+	case http.StatusNotFound:
+		return codeNotFound
+	case http.StatusConflict:
+		return codeConflict
+	default:
+		return codeInternal
+	}
+}
+
+// viewer 当前请求的用户，admin 与审计日志、变更推送使用同一管理员列表
+type viewer struct {
+	id    uint
+	name  string
+	admin bool
+}
+
+// requestState 单个 GraphQL 请求内共享的用户信息与批量加载器
+type requestState struct {
+	viewer     viewer
+	categories *loader[uint, handler.Category]
+	variants   *loader[uint, []handler.ProductVariant]
+}
+
+type requestStateKey struct{}
+
+func stateFrom(ctx context.Context) *requestState {
+	return ctx.Value(requestStateKey{}).(*requestState)
+}
+
+// Handler GraphQL 接口，业务逻辑与 REST、gRPC 共用同一组处理器
+type Handler struct {
+	schema     graphql.Schema
+	users      *handler.UserHandler
+	products   *handler.ProductHandler
+	categories *handler.CategoryHandler
+	admins     handler.Admins
+	limits     Limits
+}
+
+// NewHandler 创建 GraphQL 处理器，admins 为可以列出全部用户的管理员
+func NewHandler(users *handler.UserHandler, products *handler.ProductHandler, categories *handler.CategoryHandler, admins handler.Admins, limits Limits) *Handler {
+	h := &Handler{
+		users:      users,
+		products:   products,
+		categories: categories,
+		admins:     admins,
+		limits:     limits,
+	}
+	h.schema = h.buildSchema()
+	return h
+}
+
+// Request GraphQL 请求体
+type Request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// Serve 执行 GraphQL 查询或变更，GraphQL 层面的错误在响应的 errors 中返回，HTTP 状态码为 200
+func (h *Handler) Serve(c echo.Context) error {
+	ctx := c.Request().Context()
+	tracer := otel.Tracer("api-service")
+	ctx, span := tracer.Start(ctx, "GraphQLHandler.Serve")
+	span.SetAttributes(attribute.String("Request-ID", c.Response().Header().Get("X-Request-ID")))
+	defer span.End()
+
+	var req Request
+	if err := c.Bind(&req); err != nil || req.Query == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "request body must be a JSON object with a query")
+	}
+	span.SetAttributes(attribute.String("graphql.operation.name", req.OperationName))
+
+	doc, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{
+		Body: []byte(req.Query),
+		Name: "GraphQL request",
+	})})
+	if err != nil {
+		span.RecordError(err)
+		return c.JSON(http.StatusOK, &graphql.Result{Errors: gqlerrors.FormatErrors(err)})
+	}
+	if validation := graphql.ValidateDocument(&h.schema, doc, nil); !validation.IsValid {
+		return c.JSON(http.StatusOK, &graphql.Result{Errors: validation.Errors})
+	}
+	if err := h.limits.check(doc, req.OperationName, req.Variables); err != nil {
+		span.RecordError(err)
+		formatted := gqlerrors.FormatError(gqlerrors.NewError(err.Error(), nil, "", nil, nil, err))
+		return c.JSON(http.StatusOK, &graphql.Result{Errors: []gqlerrors.FormattedError{formatted}})
+	}
+	// 查询不修改数据，不需要审计中间件补记；变更由变更回调写入审计日志
+	if !isMutation(doc, req.OperationName) {
+		handler.SkipAudit(ctx)
+	}
+
+	ctx = context.WithValue(ctx, requestStateKey{}, h.newRequestState(ctx, c))
+	result := graphql.Execute(graphql.ExecuteParams{
+		Schema:        h.schema,
+		AST:           doc,
+		OperationName: req.OperationName,
+		Args:          req.Variables,
+		Context:       ctx,
+	})
+	if result.HasErrors() {
+		span.SetAttributes(attribute.Int("graphql.errors", len(result.Errors)))
+	}
+	return c.JSON(http.StatusOK, result)
+}
+
+// newRequestState 读取 JWT 中的用户并创建本次请求的批量加载器
+func (h *Handler) newRequestState(ctx context.Context, c echo.Context) *requestState {
+	state := &requestState{
+		categories: newLoader(func(ids []uint) (map[uint]handler.Category, error) {
+			return h.categories.FindByIDs(ctx, ids)
+		}),
+		variants: newLoader(func(ids []uint) (map[uint][]handler.ProductVariant, error) {
+			return h.products.VariantsByProduct(ctx, ids)
+		}),
+	}
+	if token, ok := c.Get("user").(*jwt.Token); ok {
+		if claims, ok := token.Claims.(jwt.MapClaims); ok {
+			if id, ok := claims["user_id"].(float64); ok && id > 0 {
+				state.viewer.id = uint(id)
+			}
+			state.viewer.name, _ = claims["username"].(string)
+		}
+	}
+	state.viewer.admin = h.admins.Has(state.viewer.id)
+	return state
+}
+
+// isMutation 判断将要执行的操作是否为变更
+func isMutation(doc *ast.Document, operationName string) bool {
+	for _, def := range doc.Definitions {
+		if op, ok := def.(*ast.OperationDefinition); ok {
+			if operationName == "" || (op.Name != nil && op.Name.Value == operationName) {
+				return op.Operation == ast.OperationTypeMutation
+			}
+		}
+	}
+	return false
+}
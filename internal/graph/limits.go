@@ -0,0 +1,115 @@
+package graph
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// Limits 查询深度与复杂度上限，0 表示不限制
+type Limits struct {
+	MaxDepth      int
+	MaxComplexity int
+}
+
+// check 在执行前拒绝超过上限的操作
+func (l Limits) check(doc *ast.Document, operationName string, variables map[string]interface{}) error {
+	depth, complexity := measure(doc, operationName, variables)
+	if l.MaxDepth > 0 && depth > l.MaxDepth {
+		return &apiError{code: codeQueryTooComplex, message: fmt.Sprintf("query depth %d exceeds the limit of %d", depth, l.MaxDepth)}
+	}
+	if l.MaxComplexity > 0 && complexity > l.MaxComplexity {
+		return &apiError{code: codeQueryTooComplex, message: fmt.Sprintf("query complexity %d exceeds the limit of %d", complexity, l.MaxComplexity)}
+	}
+	return nil
+}
+
+// measure 计算操作的深度与复杂度：每个字段计 1，分页字段的子字段按每页条数倍计算，
+// 以 __ 开头的内省字段不计入
+func measure(doc *ast.Document, operationName string, variables map[string]interface{}) (int, int) {
+	m := &meter{
+		fragments: make(map[string]*ast.FragmentDefinition),
+		variables: variables,
+		visiting:  make(map[string]bool),
+	}
+	var operation *ast.OperationDefinition
+	for _, def := range doc.Definitions {
+		switch def := def.(type) {
+		case *ast.FragmentDefinition:
+			m.fragments[def.Name.Value] = def
+		case *ast.OperationDefinition:
+			if operationName == "" || (def.Name != nil && def.Name.Value == operationName) {
+				operation = def
+			}
+		}
+	}
+	if operation == nil {
+		return 0, 0
+	}
+	return m.selectionSet(operation.SelectionSet)
+}
+
+type meter struct {
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]interface{}
+	visiting  map[string]bool
+}
+
+func (m *meter) selectionSet(set *ast.SelectionSet) (depth, complexity int) {
+	if set == nil {
+		return 0, 0
+	}
+	for _, selection := range set.Selections {
+		var d, c int
+		switch sel := selection.(type) {
+		case *ast.Field:
+			if strings.HasPrefix(sel.Name.Value, "__") {
+				continue
+			}
+			d, c = m.selectionSet(sel.SelectionSet)
+			d, c = d+1, 1+m.multiplier(sel)*c
+		case *ast.InlineFragment:
+			d, c = m.selectionSet(sel.SelectionSet)
+		case *ast.FragmentSpread:
+			frag, ok := m.fragments[sel.Name.Value]
+			if !ok || m.visiting[sel.Name.Value] {
+				continue
+			}
+			m.visiting[sel.Name.Value] = true
+			d, c = m.selectionSet(frag.SelectionSet)
+			delete(m.visiting, sel.Name.Value)
+		}
+		depth = max(depth, d)
+		complexity += c
+	}
+	return depth, complexity
+}
+
+// multiplier 分页字段按 first 参数（未指定时为默认每页条数）放大子字段的复杂度
+func (m *meter) multiplier(field *ast.Field) int {
+	if !pagedFields[field.Name.Value] {
+		return 1
+	}
+	first := defaultPageSize
+	for _, arg := range field.Arguments {
+		if arg.Name.Value != "first" {
+			continue
+		}
+		switch v := arg.Value.(type) {
+		case *ast.IntValue:
+			if n, err := strconv.Atoi(v.Value); err == nil {
+				first = n
+			}
+		case *ast.Variable:
+			switch n := m.variables[v.Name.Value].(type) {
+			case int:
+				first = n
+			case float64:
+				first = int(n)
+			}
+		}
+	}
+	return pageSize(first)
+}
@@ -0,0 +1,62 @@
+package graph
+
+import "sync"
+
+// loader 按请求收集同一层级需要的键，第一次取值时一次性批量查询，避免 N+1 查询。
+// 解析器返回 thunk，执行器在展开同一层的所有字段后才逐个求值，
+// 因此同一层级的键总是在同一批中查询
+type loader[K comparable, V any] struct {
+	fetch   func(keys []K) (map[K]V, error)
+	mu      sync.Mutex
+	pending []K
+	queued  map[K]bool
+	results map[K]V
+}
+
+func newLoader[K comparable, V any](fetch func(keys []K) (map[K]V, error)) *loader[K, V] {
+	return &loader[K, V]{
+		fetch:   fetch,
+		queued:  make(map[K]bool),
+		results: make(map[K]V),
+	}
+}
+
+// load 登记 key 并返回延迟求值的函数，不存在的键得到零值
+func (l *loader[K, V]) load(key K) func() (V, error) {
+	l.mu.Lock()
+	if _, done := l.results[key]; !done && !l.queued[key] {
+		l.queued[key] = true
+		l.pending = append(l.pending, key)
+	}
+	l.mu.Unlock()
+
+	return func() (V, error) {
+		return l.get(key)
+	}
+}
+
+// get 返回 key 的结果，key 尚未查询时连同所有待查询的键一起批量查询
+func (l *loader[K, V]) get(key K) (V, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if v, ok := l.results[key]; ok {
+		return v, nil
+	}
+	keys := l.pending
+	l.pending = nil
+	l.queued = make(map[K]bool)
+	if len(keys) == 0 {
+		keys = []K{key}
+	}
+
+	found, err := l.fetch(keys)
+	if err != nil {
+		var zero V
+		return zero, err
+	}
+	for _, k := range keys {
+		l.results[k] = found[k]
+	}
+	return l.results[key], nil
+}
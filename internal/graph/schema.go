@@ -0,0 +1,525 @@
+package graph
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+
+	"github.com/graphql-go/graphql"
+	"github.com/songfei1983/play-go-api/internal/handler"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// pagedFields 支持 first/after 分页的字段，复杂度按每页条数计算
+var pagedFields = map[string]bool{
+	"users":    true,
+	"products": true,
+}
+
+// pageSize 将 first 参数限制在 1 到 maxPageSize 之间
+func pageSize(first int) int {
+	if first <= 0 {
+		return defaultPageSize
+	}
+	return min(first, maxPageSize)
+}
+
+// parseID 解析 ID 参数
+func parseID(v interface{}) (uint, error) {
+	s, _ := v.(string)
+	id, err := strconv.ParseUint(s, 10, 64)
+	if err != nil || id == 0 {
+		return 0, &apiError{code: codeBadRequest, message: "invalid id"}
+	}
+	return uint(id), nil
+}
+
+// optionalID 将 *uint 外键序列化为 ID，为空时返回 null
+func optionalID(id *uint) interface{} {
+	if id == nil {
+		return nil
+	}
+	return strconv.FormatUint(uint64(*id), 10)
+}
+
+// inputField 输入对象字段与 REST 请求体 JSON 字段的对应关系
+type inputField struct {
+	name     string
+	jsonName string
+	typ      graphql.Input
+}
+
+var productInputFields = []inputField{
+	{"name", "name", graphql.String},
+	{"description", "description", graphql.String},
+	{"price", "price", graphql.String},
+	{"currency", "currency", graphql.String},
+	{"stock", "stock", graphql.Int},
+	{"status", "status", graphql.String},
+	{"categoryId", "category_id", graphql.ID},
+}
+
+var userInputFields = []inputField{
+	{"username", "username", graphql.String},
+	{"email", "email", graphql.String},
+	{"firstName", "first_name", graphql.String},
+	{"lastName", "last_name", graphql.String},
+	{"phone", "phone", graphql.String},
+	{"status", "status", graphql.String},
+}
+
+func inputObject(name string, fields []inputField) *graphql.InputObject {
+	config := graphql.InputObjectConfigFieldMap{}
+	for _, f := range fields {
+		config[f.name] = &graphql.InputObjectFieldConfig{Type: f.typ}
+	}
+	return graphql.NewInputObject(graphql.InputObjectConfig{Name: name, Fields: config})
+}
+
+// inputBody 将输入对象中提供的字段转换为与 REST 请求体相同的 JSON 对象，
+// 交给处理器做可写字段检查与校验
+func inputBody(input map[string]interface{}, fields []inputField) (map[string]json.RawMessage, error) {
+	body := make(map[string]json.RawMessage, len(input))
+	for _, f := range fields {
+		v, ok := input[f.name]
+		if !ok {
+			continue
+		}
+		if f.typ == graphql.ID && v != nil {
+			id, err := parseID(v)
+			if err != nil {
+				return nil, &apiError{code: codeBadRequest, message: "invalid " + f.name}
+			}
+			v = id
+		}
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		body[f.jsonName] = data
+	}
+	if len(body) == 0 {
+		return nil, &apiError{code: codeBadRequest, message: "input must contain at least one field"}
+	}
+	return body, nil
+}
+
+// connection 分页结果，nextCursor 为最后一条记录的 ID，没有下一页时为 null
+type connection struct {
+	Nodes      interface{} `json:"nodes"`
+	NextCursor *string     `json:"nextCursor"`
+}
+
+// pageArgs 解析 first/after/includeDeleted 参数
+func pageArgs(args map[string]interface{}) (uint, int, bool, error) {
+	first, _ := args["first"].(int)
+	includeDeleted, _ := args["includeDeleted"].(bool)
+	after, ok := args["after"].(string)
+	if !ok || after == "" {
+		return 0, pageSize(first), includeDeleted, nil
+	}
+	afterID, err := strconv.ParseUint(after, 10, 64)
+	if err != nil {
+		return 0, 0, false, &apiError{code: codeBadRequest, message: "invalid cursor"}
+	}
+	return uint(afterID), pageSize(first), includeDeleted, nil
+}
+
+// page 多查询一条判断是否还有下一页
+func page[T handler.Model](models []T, limit int) connection {
+	if len(models) <= limit {
+		return connection{Nodes: models}
+	}
+	cursor := strconv.FormatUint(uint64(models[limit-1].GetID()), 10)
+	return connection{Nodes: models[:limit], NextCursor: &cursor}
+}
+
+func connectionType(name string, node graphql.Type) *graphql.Object {
+	return graphql.NewObject(graphql.ObjectConfig{
+		Name: name,
+		Fields: graphql.Fields{
+			"nodes":      &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(node)))},
+			"nextCursor": &graphql.Field{Type: graphql.String},
+		},
+	})
+}
+
+var pageArgConfig = graphql.FieldConfigArgument{
+	"first":          &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: defaultPageSize},
+	"after":          &graphql.ArgumentConfig{Type: graphql.String},
+	"includeDeleted": &graphql.ArgumentConfig{Type: graphql.Boolean, DefaultValue: false},
+}
+
+var idArgConfig = graphql.FieldConfigArgument{
+	"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+}
+
+// notFoundAsNull 查询单条记录不存在时返回 null
+func notFoundAsNull(v interface{}, err error) (interface{}, error) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, toAPIError(err)
+	}
+	return v, nil
+}
+
+func (h *Handler) buildSchema() graphql.Schema {
+	userType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "User",
+		Description: "用户，不包含密码",
+		Fields: graphql.Fields{
+			"id":        &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+			"username":  &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"email":     &graphql.Field{Type: graphql.String},
+			"firstName": &graphql.Field{Type: graphql.String},
+			"lastName":  &graphql.Field{Type: graphql.String},
+			"phone":     &graphql.Field{Type: graphql.String},
+			"status":    &graphql.Field{Type: graphql.String},
+			"createdAt": &graphql.Field{Type: graphql.DateTime},
+			"updatedAt": &graphql.Field{Type: graphql.DateTime},
+			"deletedAt": &graphql.Field{Type: graphql.DateTime},
+		},
+	})
+
+	categoryType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Category",
+		Fields: graphql.Fields{
+			"id":          &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+			"name":        &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"slug":        &graphql.Field{Type: graphql.String},
+			"description": &graphql.Field{Type: graphql.String},
+			"parentId": &graphql.Field{
+				Type: graphql.ID,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return optionalID(p.Source.(handler.Category).ParentID), nil
+				},
+			},
+		},
+	})
+
+	optionType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "VariantOption",
+		Fields: graphql.Fields{
+			"name":  &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"value": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		},
+	})
+
+	variantType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "ProductVariant",
+		Description: "产品变体（SKU），price 为空时沿用产品价格",
+		Fields: graphql.Fields{
+			"id":    &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+			"sku":   &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"price": &graphql.Field{Type: graphql.String},
+			"stock": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"options": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(optionType))),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					options := p.Source.(handler.ProductVariant).Options
+					out := make([]map[string]string, 0, len(options))
+					for name, value := range options {
+						out = append(out, map[string]string{"name": name, "value": value})
+					}
+					sort.Slice(out, func(i, j int) bool { return out[i]["name"] < out[j]["name"] })
+					return out, nil
+				},
+			},
+		},
+	})
+
+	productType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Product",
+		Fields: graphql.Fields{
+			"id":          &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+			"name":        &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"description": &graphql.Field{Type: graphql.String},
+			"price":       &graphql.Field{Type: graphql.NewNonNull(graphql.String), Description: "十进制字符串，保留两位小数"},
+			"currency":    &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"stock":       &graphql.Field{Type: graphql.NewNonNull(graphql.Int), Description: "有变体时为全部变体库存之和"},
+			"status":      &graphql.Field{Type: graphql.String},
+			"createdAt":   &graphql.Field{Type: graphql.DateTime},
+			"updatedAt":   &graphql.Field{Type: graphql.DateTime},
+			"deletedAt":   &graphql.Field{Type: graphql.DateTime},
+			"categoryId": &graphql.Field{
+				Type: graphql.ID,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return optionalID(p.Source.(handler.Product).CategoryID), nil
+				},
+			},
+			"category": &graphql.Field{
+				Type:    categoryType,
+				Resolve: h.resolveCategory,
+			},
+			"variants": &graphql.Field{
+				Type:    graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(variantType))),
+				Resolve: h.resolveVariants,
+			},
+		},
+	})
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"me": &graphql.Field{
+				Type:        graphql.NewNonNull(userType),
+				Description: "当前登录的用户",
+				Resolve:     h.resolveMe,
+			},
+			"user": &graphql.Field{
+				Type: userType,
+				Args: idArgConfig,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					id, err := parseID(p.Args["id"])
+					if err != nil {
+						return nil, err
+					}
+					return notFoundAsNull(h.users.FindUser(p.Context, id))
+				},
+			},
+			"users": &graphql.Field{
+				Type:        graphql.NewNonNull(connectionType("UserConnection", userType)),
+				Description: "全部用户，只对管理员开放",
+				Args:        pageArgConfig,
+				Resolve:     h.resolveUsers,
+			},
+			"product": &graphql.Field{
+				Type: productType,
+				Args: idArgConfig,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					id, err := parseID(p.Args["id"])
+					if err != nil {
+						return nil, err
+					}
+					return notFoundAsNull(h.products.FindRecord(p.Context, id))
+				},
+			},
+			"products": &graphql.Field{
+				Type:    graphql.NewNonNull(connectionType("ProductConnection", productType)),
+				Args:    pageArgConfig,
+				Resolve: h.resolveProducts,
+			},
+		},
+	})
+
+	productInput := inputObject("ProductInput", productInputFields)
+	userInput := inputObject("UserInput", userInputFields)
+	withInput := func(input *graphql.InputObject) graphql.FieldConfigArgument {
+		return graphql.FieldConfigArgument{
+			"id":    &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+			"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(input)},
+		}
+	}
+
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"createProduct": &graphql.Field{
+				Type: graphql.NewNonNull(productType),
+				Args: graphql.FieldConfigArgument{
+					"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(productInput)},
+				},
+				Resolve: h.createProduct,
+			},
+			"updateProduct": &graphql.Field{
+				Type:        graphql.NewNonNull(productType),
+				Description: "只更新 input 中提供的字段，与 PATCH /products/:id 相同",
+				Args:        withInput(productInput),
+				Resolve:     h.updateProduct,
+			},
+			"deleteProduct": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Boolean),
+				Args: idArgConfig,
+				Resolve: byID(func(p graphql.ResolveParams, id uint) error {
+					return h.products.DeleteRecord(p.Context, id)
+				}),
+			},
+			"restoreProduct": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Boolean),
+				Args: idArgConfig,
+				Resolve: byID(func(p graphql.ResolveParams, id uint) error {
+					return h.products.RestoreRecord(p.Context, id)
+				}),
+			},
+			"updateUser": &graphql.Field{
+				Type:        graphql.NewNonNull(userType),
+				Description: "只更新 input 中提供的字段，与 PATCH /users/:id 相同",
+				Args:        withInput(userInput),
+				Resolve:     h.updateUser,
+			},
+			"deleteUser": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Boolean),
+				Args: idArgConfig,
+				Resolve: byID(func(p graphql.ResolveParams, id uint) error {
+					return h.users.DeleteUser(p.Context, id)
+				}),
+			},
+			"restoreUser": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Boolean),
+				Args: idArgConfig,
+				Resolve: byID(func(p graphql.ResolveParams, id uint) error {
+					return h.users.RestoreRecord(p.Context, id)
+				}),
+			},
+		},
+	})
+
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{Query: query, Mutation: mutation})
+	if err != nil {
+		// schema 在代码中静态定义，出错属于编程错误
+		panic(err)
+	}
+	return schema
+}
+
+// byID 解析 id 参数并执行删除、恢复等操作，成功时返回 true
+func byID(op func(p graphql.ResolveParams, id uint) error) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		id, err := parseID(p.Args["id"])
+		if err != nil {
+			return nil, err
+		}
+		if err := op(p, id); err != nil {
+			return nil, toAPIError(err)
+		}
+		return true, nil
+	}
+}
+
+func (h *Handler) resolveMe(p graphql.ResolveParams) (interface{}, error) {
+	id := stateFrom(p.Context).viewer.id
+	if id == 0 {
+		return nil, &apiError{code: codeUnauthenticated, message: "authentication required"}
+	}
+	user, err := h.users.FindUser(p.Context, id)
+	if err != nil {
+		return nil, toAPIError(err)
+	}
+	return user, nil
+}
+
+func (h *Handler) resolveUsers(p graphql.ResolveParams) (interface{}, error) {
+	if !stateFrom(p.Context).viewer.admin {
+		return nil, &apiError{code: codeForbidden, message: "listing users is restricted to administrators"}
+	}
+	after, limit, includeDeleted, err := pageArgs(p.Args)
+	if err != nil {
+		return nil, err
+	}
+	users, err := h.users.Page(p.Context, after, limit+1, includeDeleted)
+	if err != nil {
+		return nil, toAPIError(err)
+	}
+	return page(users, limit), nil
+}
+
+func (h *Handler) resolveProducts(p graphql.ResolveParams) (interface{}, error) {
+	after, limit, includeDeleted, err := pageArgs(p.Args)
+	if err != nil {
+		return nil, err
+	}
+	products, err := h.products.Page(p.Context, after, limit+1, includeDeleted)
+	if err != nil {
+		return nil, toAPIError(err)
+	}
+	return page(products, limit), nil
+}
+
+// resolveCategory 通过批量加载器读取分类，同一层级的所有产品只查询一次
+func (h *Handler) resolveCategory(p graphql.ResolveParams) (interface{}, error) {
+	categoryID := p.Source.(handler.Product).CategoryID
+	if categoryID == nil {
+		return nil, nil
+	}
+	load := stateFrom(p.Context).categories.load(*categoryID)
+	return func() (interface{}, error) {
+		category, err := load()
+		if err != nil {
+			return nil, toAPIError(err)
+		}
+		if category.ID == 0 {
+			return nil, nil
+		}
+		return category, nil
+	}, nil
+}
+
+// resolveVariants 通过批量加载器读取变体，同一层级的所有产品只查询一次
+func (h *Handler) resolveVariants(p graphql.ResolveParams) (interface{}, error) {
+	load := stateFrom(p.Context).variants.load(p.Source.(handler.Product).ID)
+	return func() (interface{}, error) {
+		variants, err := load()
+		if err != nil {
+			return nil, toAPIError(err)
+		}
+		if variants == nil {
+			variants = []handler.ProductVariant{}
+		}
+		return variants, nil
+	}, nil
+}
+
+func (h *Handler) createProduct(p graphql.ResolveParams) (interface{}, error) {
+	input, _ := p.Args["input"].(map[string]interface{})
+	body, err := inputBody(input, productInputFields)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, toAPIError(err)
+	}
+	var product handler.Product
+	if err := json.Unmarshal(data, &product); err != nil {
+		return nil, &apiError{code: codeBadRequest, message: err.Error()}
+	}
+	if err := product.Validate(); err != nil {
+		return nil, &apiError{code: codeBadRequest, message: err.Error()}
+	}
+	if err := h.products.CreateRecord(p.Context, &product); err != nil {
+		return nil, toAPIError(err)
+	}
+	return product, nil
+}
+
+func (h *Handler) updateProduct(p graphql.ResolveParams) (interface{}, error) {
+	id, err := parseID(p.Args["id"])
+	if err != nil {
+		return nil, err
+	}
+	input, _ := p.Args["input"].(map[string]interface{})
+	body, err := inputBody(input, productInputFields)
+	if err != nil {
+		return nil, err
+	}
+	product, err := h.products.UpdateRecord(p.Context, id, body, false)
+	if err != nil {
+		return nil, toAPIError(err)
+	}
+	return product, nil
+}
+
+func (h *Handler) updateUser(p graphql.ResolveParams) (interface{}, error) {
+	id, err := parseID(p.Args["id"])
+	if err != nil {
+		return nil, err
+	}
+	input, _ := p.Args["input"].(map[string]interface{})
+	body, err := inputBody(input, userInputFields)
+	if err != nil {
+		return nil, err
+	}
+	user, err := h.users.UpdateUserFields(p.Context, id, body, false, stateFrom(p.Context).viewer.admin)
+	if err != nil {
+		return nil, toAPIError(err)
+	}
+	return user, nil
+}
@@ -0,0 +1,29 @@
+package handler
+
+import (
+	"github.com/labstack/echo/v4"
+)
+
+// Admins 管理员的用户 ID 集合，来自服务端配置 ADMIN_USER_IDS。
+// 用户 ID 由数据库分配，注册或修改账户都不能获得管理员权限
+type Admins map[uint]bool
+
+// NewAdmins 由管理员用户 ID 列表创建集合
+func NewAdmins(userIDs []uint) Admins {
+	admins := make(Admins, len(userIDs))
+	for _, id := range userIDs {
+		admins[id] = true
+	}
+	return admins
+}
+
+// Has 判断用户是否为管理员
+func (a Admins) Has(userID uint) bool {
+	return userID != 0 && a[userID]
+}
+
+// IsAdmin 判断当前请求的 JWT 用户是否为管理员，未认证时返回 false
+func (a Admins) IsAdmin(c echo.Context) bool {
+	userID, err := currentUserID(c)
+	return err == nil && a.Has(userID)
+}
@@ -0,0 +1,430 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/songfei1983/play-go-api/internal/notify"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 库存告警状态
+const (
+	AlertOpen         = "open"
+	AlertAcknowledged = "acknowledged"
+	AlertResolved     = "resolved"
+)
+
+const (
+	alertQueueSize  = 256
+	alertCheckBatch = 100
+)
+
+// ReorderRule 产品补货规则，库存降到 Threshold 及以下时产生告警
+type ReorderRule struct {
+	ProductID       uint      `json:"product_id" gorm:"primaryKey;autoIncrement:false"`
+	Threshold       int       `json:"threshold" gorm:"not null"`
+	ReorderQuantity int       `json:"reorder_quantity"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (ReorderRule) TableName() string {
+	return "reorder_rules"
+}
+
+// StockAlert 低库存告警，同一产品同时最多一条未解决的告警；
+// 库存回升到阈值以上时自动解决
+type StockAlert struct {
+	ID              uint       `json:"id" gorm:"primaryKey"`
+	ProductID       uint       `json:"product_id" gorm:"not null;index"`
+	Stock           int        `json:"stock"`
+	Threshold       int        `json:"threshold"`
+	ReorderQuantity int        `json:"reorder_quantity"`
+	Status          string     `json:"status" gorm:"size:16;not null;default:open;index"`
+	AcknowledgedBy  string     `json:"acknowledged_by,omitempty"`
+	AcknowledgedAt  *time.Time `json:"acknowledged_at,omitempty"`
+	ResolvedAt      *time.Time `json:"resolved_at,omitempty"`
+	NotifiedAt      *time.Time `json:"notified_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (StockAlert) TableName() string {
+	return "stock_alerts"
+}
+
+// StockAlerter 后台库存检查器：库存变动时按产品检查，并定期全量检查，
+// 检查在单个协程内串行执行，避免同一产品重复告警
+type StockAlerter struct {
+	db       *gorm.DB
+	notifier notify.Notifier
+	queue    chan uint
+}
+
+// NewStockAlerter 创建库存检查器，notifier 为 nil 时只记录告警不发送通知
+func NewStockAlerter(db *gorm.DB, notifier notify.Notifier) *StockAlerter {
+	return &StockAlerter{db: db, notifier: notifier, queue: make(chan uint, alertQueueSize)}
+}
+
+// ProductChanged 作为产品 ChangeHook 注册，将变动的产品加入检查队列
+func (a *StockAlerter) ProductChanged(_ context.Context, change Change[Product]) {
+	a.Enqueue(change.ID)
+}
+
+// Enqueue 将产品加入检查队列，队列已满时丢弃，由定期检查兜底
+func (a *StockAlerter) Enqueue(productID uint) {
+	select {
+	case a.queue <- productID:
+	default:
+	}
+}
+
+// Run 处理检查队列，并按 interval 定期全量检查，直到 ctx 取消
+func (a *StockAlerter) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case id := <-a.queue:
+			if err := a.Check(ctx, id); err != nil && ctx.Err() == nil {
+				fmt.Printf("Error checking stock of product %d: %v\n", id, err)
+			}
+		case <-ticker.C:
+			if _, err := a.CheckAll(ctx); err != nil && ctx.Err() == nil {
+				fmt.Printf("Error checking stock levels: %v\n", err)
+			}
+		}
+	}
+}
+
+// Check 检查单个产品：低于阈值时产生告警并通知，回升后自动解决告警
+func (a *StockAlerter) Check(ctx context.Context, productID uint) error {
+	_, err := a.check(ctx, productID)
+	return err
+}
+
+// CheckAll 检查所有配置了补货规则的产品，并重发此前发送失败的通知，返回新产生的告警数
+func (a *StockAlerter) CheckAll(ctx context.Context) (int, error) {
+	raised := 0
+	var errs []error
+	var lastID uint
+	for {
+		var ids []uint
+		if err := a.db.WithContext(ctx).Model(&ReorderRule{}).Where("product_id > ?", lastID).
+			Order("product_id").Limit(alertCheckBatch).Pluck("product_id", &ids).Error; err != nil {
+			return raised, err
+		}
+		for _, id := range ids {
+			// 单个产品失败不影响其他产品的检查
+			ok, err := a.check(ctx, id)
+			if err != nil {
+				errs = append(errs, err)
+			}
+			if ok {
+				raised++
+			}
+			lastID = id
+		}
+		if len(ids) < alertCheckBatch {
+			break
+		}
+	}
+
+	var pending []StockAlert
+	if err := a.db.WithContext(ctx).Where("status = ? AND notified_at IS NULL", AlertOpen).Find(&pending).Error; err != nil {
+		return raised, err
+	}
+	for i := range pending {
+		if err := a.dispatch(ctx, &pending[i]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return raised, errors.Join(errs...)
+}
+
+// check 返回是否产生了新告警；告警已保存但通知失败时同时返回 true 与错误
+func (a *StockAlerter) check(ctx context.Context, productID uint) (bool, error) {
+	var created *StockAlert
+	err := a.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var rule ReorderRule
+		err := tx.First(&rule, productID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return resolveAlerts(tx, productID)
+		}
+		if err != nil {
+			return err
+		}
+		var stock []int
+		if err := tx.Model(&Product{}).Where("id = ? AND deleted_at IS NULL", productID).Pluck("stock", &stock).Error; err != nil {
+			return err
+		}
+		if len(stock) == 0 || stock[0] > rule.Threshold {
+			return resolveAlerts(tx, productID)
+		}
+
+		var count int64
+		if err := tx.Model(&StockAlert{}).Where("product_id = ? AND status <> ?", productID, AlertResolved).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return nil
+		}
+		created = &StockAlert{
+			ProductID:       productID,
+			Stock:           stock[0],
+			Threshold:       rule.Threshold,
+			ReorderQuantity: rule.ReorderQuantity,
+			Status:          AlertOpen,
+		}
+		return tx.Create(created).Error
+	})
+	if err != nil || created == nil {
+		return false, err
+	}
+	return true, a.dispatch(ctx, created)
+}
+
+// dispatch 发送告警通知，成功后记录发送时间，失败的通知由定期检查重发
+func (a *StockAlerter) dispatch(ctx context.Context, alert *StockAlert) error {
+	if a.notifier == nil {
+		return nil
+	}
+	var product Product
+	if err := a.db.WithContext(ctx).Select("id", "name").First(&product, alert.ProductID).Error; err != nil {
+		return err
+	}
+	msg := notify.Message{
+		Subject: fmt.Sprintf("Low stock: %s", product.Name),
+		Body: fmt.Sprintf("Product #%d %q has %d in stock, at or below the reorder threshold of %d. Suggested reorder quantity: %d.",
+			product.ID, product.Name, alert.Stock, alert.Threshold, alert.ReorderQuantity),
+		Data: alert,
+	}
+	if err := a.notifier.Notify(ctx, msg); err != nil {
+		return fmt.Errorf("notify alert %d: %w", alert.ID, err)
+	}
+	now := time.Now()
+	alert.NotifiedAt = &now
+	return a.db.WithContext(ctx).Model(alert).Update("notified_at", now).Error
+}
+
+// resolveAlerts 自动解决产品所有未解决的告警
+func resolveAlerts(tx *gorm.DB, productID uint) error {
+	return tx.Model(&StockAlert{}).
+		Where("product_id = ? AND status <> ?", productID, AlertResolved).
+		Updates(map[string]interface{}{"status": AlertResolved, "resolved_at": time.Now()}).Error
+}
+
+// AlertHandler 补货规则与库存告警处理器
+type AlertHandler struct {
+	db      *gorm.DB
+	alerter *StockAlerter
+}
+
+// NewAlertHandler 创建告警处理器，补货规则变更后立即触发检查
+func NewAlertHandler(db *gorm.DB, alerter *StockAlerter) *AlertHandler {
+	return &AlertHandler{db: db, alerter: alerter}
+}
+
+type reorderRuleRequest struct {
+	Threshold       *int `json:"threshold"`
+	ReorderQuantity int  `json:"reorder_quantity"`
+}
+
+// GetReorderRule 获取产品补货规则
+func (h *AlertHandler) GetReorderRule(c echo.Context) error {
+	ctx := c.Request().Context()
+	tracer := otel.Tracer("api-service")
+	ctx, span := tracer.Start(ctx, "AlertHandler.GetReorderRule")
+	span.SetAttributes(attribute.String("Request-ID", c.Response().Header().Get("X-Request-ID")))
+	defer span.End()
+
+	productID, err := productIDParam(c)
+	if err != nil {
+		return err
+	}
+	var rule ReorderRule
+	if err := h.db.WithContext(ctx).First(&rule, productID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "Reorder rule not found")
+		}
+		span.RecordError(err)
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, rule)
+}
+
+// SetReorderRule 创建或替换产品补货规则
+func (h *AlertHandler) SetReorderRule(c echo.Context) error {
+	ctx := c.Request().Context()
+	tracer := otel.Tracer("api-service")
+	ctx, span := tracer.Start(ctx, "AlertHandler.SetReorderRule")
+	span.SetAttributes(attribute.String("Request-ID", c.Response().Header().Get("X-Request-ID")))
+	defer span.End()
+
+	productID, err := productIDParam(c)
+	if err != nil {
+		return err
+	}
+	var req reorderRuleRequest
+	if err := c.Bind(&req); err != nil {
+		span.RecordError(err)
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	if req.Threshold == nil || *req.Threshold < 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "threshold must be a non-negative integer")
+	}
+	if req.ReorderQuantity < 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "reorder_quantity must not be negative")
+	}
+
+	rule := ReorderRule{ProductID: productID, Threshold: *req.Threshold, ReorderQuantity: req.ReorderQuantity}
+	err = h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := productExists(tx, productID); err != nil {
+			return err
+		}
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "product_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"threshold", "reorder_quantity", "updated_at"}),
+		}).Create(&rule).Error
+	})
+	if err != nil {
+		span.RecordError(err)
+		return httpError(err)
+	}
+
+	h.alerter.Enqueue(productID)
+	return c.JSON(http.StatusOK, rule)
+}
+
+// DeleteReorderRule 删除产品补货规则，未解决的告警随之解决
+func (h *AlertHandler) DeleteReorderRule(c echo.Context) error {
+	ctx := c.Request().Context()
+	tracer := otel.Tracer("api-service")
+	ctx, span := tracer.Start(ctx, "AlertHandler.DeleteReorderRule")
+	span.SetAttributes(attribute.String("Request-ID", c.Response().Header().Get("X-Request-ID")))
+	defer span.End()
+
+	productID, err := productIDParam(c)
+	if err != nil {
+		return err
+	}
+	result := h.db.WithContext(ctx).Delete(&ReorderRule{}, productID)
+	if result.Error != nil {
+		span.RecordError(result.Error)
+		return echo.NewHTTPError(http.StatusInternalServerError, result.Error.Error())
+	}
+	if result.RowsAffected == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, "Reorder rule not found")
+	}
+
+	h.alerter.Enqueue(productID)
+	return c.NoContent(http.StatusNoContent)
+}
+
+// ListAlerts 获取库存告警，可按 status 与 product_id 过滤
+func (h *AlertHandler) ListAlerts(c echo.Context) error {
+	ctx := c.Request().Context()
+	tracer := otel.Tracer("api-service")
+	ctx, span := tracer.Start(ctx, "AlertHandler.ListAlerts")
+	span.SetAttributes(attribute.String("Request-ID", c.Response().Header().Get("X-Request-ID")))
+	defer span.End()
+
+	query := h.db.WithContext(ctx)
+	if status := c.QueryParam("status"); status != "" {
+		switch status {
+		case AlertOpen, AlertAcknowledged, AlertResolved:
+			query = query.Where("status = ?", status)
+		default:
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unknown alert status %q", status))
+		}
+	}
+	if v := c.QueryParam("product_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid product_id")
+		}
+		query = query.Where("product_id = ?", id)
+	}
+
+	alerts := []StockAlert{}
+	if err := query.Order("id DESC").Find(&alerts).Error; err != nil {
+		span.RecordError(err)
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, alerts)
+}
+
+// AcknowledgeAlert 确认告警，表示已安排补货
+func (h *AlertHandler) AcknowledgeAlert(c echo.Context) error {
+	return h.transitionAlert(c, "AlertHandler.AcknowledgeAlert", AlertAcknowledged)
+}
+
+// ResolveAlert 手动解决告警；库存仍低于阈值时下次检查会重新告警
+func (h *AlertHandler) ResolveAlert(c echo.Context) error {
+	return h.transitionAlert(c, "AlertHandler.ResolveAlert", AlertResolved)
+}
+
+func (h *AlertHandler) transitionAlert(c echo.Context, spanName, status string) error {
+	ctx := c.Request().Context()
+	tracer := otel.Tracer("api-service")
+	ctx, span := tracer.Start(ctx, spanName)
+	span.SetAttributes(attribute.String("Request-ID", c.Response().Header().Get("X-Request-ID")))
+	defer span.End()
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid alert ID")
+	}
+
+	var alert StockAlert
+	err = h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&alert, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return echo.NewHTTPError(http.StatusNotFound, "Alert not found")
+			}
+			return err
+		}
+		from := alert.Status
+		now := time.Now()
+		updates := map[string]interface{}{"status": status}
+		switch {
+		case status == AlertAcknowledged && from == AlertOpen:
+			updates["acknowledged_by"] = currentActor(c)
+			updates["acknowledged_at"] = now
+			alert.AcknowledgedBy = updates["acknowledged_by"].(string)
+			alert.AcknowledgedAt = &now
+		case status == AlertResolved && from != AlertResolved:
+			updates["resolved_at"] = now
+			alert.ResolvedAt = &now
+		default:
+			return echo.NewHTTPError(http.StatusConflict, fmt.Sprintf("cannot change alert from %s to %s", from, status))
+		}
+		result := tx.Model(&StockAlert{}).Where("id = ? AND status = ?", alert.ID, from).Updates(updates)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return echo.NewHTTPError(http.StatusConflict, "alert status changed concurrently")
+		}
+		alert.Status = status
+		return nil
+	})
+	if err != nil {
+		span.RecordError(err)
+		return httpError(err)
+	}
+	return c.JSON(http.StatusOK, alert)
+}
@@ -0,0 +1,220 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/songfei1983/play-go-api/internal/notify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingNotifier 记录收到的通知，fail 不为 nil 时返回该错误
+type recordingNotifier struct {
+	messages []notify.Message
+	fail     error
+}
+
+func (r *recordingNotifier) Notify(_ context.Context, msg notify.Message) error {
+	if r.fail != nil {
+		return r.fail
+	}
+	r.messages = append(r.messages, msg)
+	return nil
+}
+
+func TestStockAlerts(t *testing.T) {
+	e, products, mock, _ := setupProductTest(t)
+	notifier := &recordingNotifier{}
+	alerter := NewStockAlerter(products.db, notifier)
+	handler := NewAlertHandler(products.db, alerter)
+	ctx := context.Background()
+
+	expectRule := func(threshold int) {
+		mock.ExpectQuery("SELECT \\* FROM `reorder_rules` WHERE `reorder_rules`\\.`product_id` = \\?").
+			WithArgs(1, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"product_id", "threshold", "reorder_quantity"}).AddRow(1, threshold, 50))
+	}
+	expectStock := func(stock int) {
+		mock.ExpectQuery("SELECT `stock` FROM `products` WHERE id = \\? AND deleted_at IS NULL").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"stock"}).AddRow(stock))
+	}
+	expectUnresolved := func(count int) {
+		mock.ExpectQuery("SELECT count\\(\\*\\) FROM `stock_alerts` WHERE product_id = \\? AND status <> \\?").
+			WithArgs(1, AlertResolved).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(count))
+	}
+	expectDispatch := func(alertID, productID int) {
+		mock.ExpectQuery("SELECT `id`,`name` FROM `products` WHERE `products`\\.`id` = \\?").
+			WithArgs(productID, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(productID, "Mug"))
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE `stock_alerts` SET `notified_at`=\\?,`updated_at`=\\? WHERE `id` = \\?").
+			WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), alertID).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+	}
+	newContext := func(method, body, id string) (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(method, "/", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set("user", &jwt.Token{Claims: jwt.MapClaims{"user_id": float64(7), "username": "alice"}})
+		c.SetParamNames("id")
+		c.SetParamValues(id)
+		return c, rec
+	}
+
+	t.Run("库存低于阈值产生告警并通知", func(t *testing.T) {
+		mock.ExpectBegin()
+		expectRule(5)
+		expectStock(2)
+		expectUnresolved(0)
+		mock.ExpectExec("INSERT INTO `stock_alerts`").
+			WithArgs(1, 2, 5, 50, AlertOpen, "", nil, nil, nil, sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(4, 1))
+		mock.ExpectCommit()
+		expectDispatch(4, 1)
+
+		require.NoError(t, alerter.Check(ctx, 1))
+		require.Len(t, notifier.messages, 1)
+		assert.Equal(t, "Low stock: Mug", notifier.messages[0].Subject)
+		assert.Contains(t, notifier.messages[0].Body, "Suggested reorder quantity: 50")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("已有未解决告警不重复告警", func(t *testing.T) {
+		mock.ExpectBegin()
+		expectRule(5)
+		expectStock(1)
+		expectUnresolved(1)
+		mock.ExpectCommit()
+
+		require.NoError(t, alerter.Check(ctx, 1))
+		assert.Len(t, notifier.messages, 1)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("通知失败时保留告警", func(t *testing.T) {
+		notifier.fail = errors.New("smtp down")
+		defer func() { notifier.fail = nil }()
+
+		mock.ExpectBegin()
+		expectRule(5)
+		expectStock(2)
+		expectUnresolved(0)
+		mock.ExpectExec("INSERT INTO `stock_alerts`").WillReturnResult(sqlmock.NewResult(5, 1))
+		mock.ExpectCommit()
+		mock.ExpectQuery("SELECT `id`,`name` FROM `products`").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "Mug"))
+
+		err := alerter.Check(ctx, 1)
+		assert.ErrorContains(t, err, "smtp down")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("定期检查自动解决并重发通知", func(t *testing.T) {
+		mock.ExpectQuery("SELECT `product_id` FROM `reorder_rules` WHERE product_id > \\? ORDER BY product_id LIMIT \\?").
+			WithArgs(0, alertCheckBatch).
+			WillReturnRows(sqlmock.NewRows([]string{"product_id"}).AddRow(1))
+		mock.ExpectBegin()
+		expectRule(5)
+		expectStock(30)
+		mock.ExpectExec("UPDATE `stock_alerts` SET `resolved_at`=\\?,`status`=\\?,`updated_at`=\\? WHERE product_id = \\? AND status <> \\?").
+			WithArgs(sqlmock.AnyArg(), AlertResolved, sqlmock.AnyArg(), 1, AlertResolved).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectCommit()
+		mock.ExpectQuery("SELECT \\* FROM `stock_alerts` WHERE status = \\? AND notified_at IS NULL").
+			WithArgs(AlertOpen).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "product_id", "stock", "threshold", "status"}).AddRow(6, 2, 0, 3, AlertOpen))
+		expectDispatch(6, 2)
+
+		raised, err := alerter.CheckAll(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 0, raised)
+		assert.Len(t, notifier.messages, 2)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("设置补货规则", func(t *testing.T) {
+		c, rec := newContext(http.MethodPut, `{"threshold":5,"reorder_quantity":50}`, "1")
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT count\\(\\*\\) FROM `products` WHERE id = \\? AND deleted_at IS NULL").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectExec("INSERT INTO `reorder_rules` .* ON DUPLICATE KEY UPDATE `threshold`=VALUES\\(`threshold`\\),`reorder_quantity`=VALUES\\(`reorder_quantity`\\),`updated_at`=VALUES\\(`updated_at`\\)").
+			WithArgs(1, 5, 50, sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		require.NoError(t, handler.SetReorderRule(c))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, uint(1), <-alerter.queue)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("阈值不能为空", func(t *testing.T) {
+		c, _ := newContext(http.MethodPut, `{"reorder_quantity":50}`, "1")
+
+		err := handler.SetReorderRule(c)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	})
+
+	t.Run("确认告警", func(t *testing.T) {
+		c, rec := newContext(http.MethodPost, "", "4")
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT \\* FROM `stock_alerts` WHERE `stock_alerts`\\.`id` = \\?").
+			WithArgs(4, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "product_id", "status"}).AddRow(4, 1, AlertOpen))
+		mock.ExpectExec("UPDATE `stock_alerts` SET `acknowledged_at`=\\?,`acknowledged_by`=\\?,`status`=\\?,`updated_at`=\\? WHERE id = \\? AND status = \\?").
+			WithArgs(sqlmock.AnyArg(), "alice", AlertAcknowledged, sqlmock.AnyArg(), 4, AlertOpen).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		require.NoError(t, handler.AcknowledgeAlert(c))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"acknowledged_by":"alice"`)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("已解决的告警不能确认", func(t *testing.T) {
+		c, _ := newContext(http.MethodPost, "", "4")
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT \\* FROM `stock_alerts` WHERE `stock_alerts`\\.`id` = \\?").
+			WithArgs(4, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "product_id", "status"}).AddRow(4, 1, AlertResolved))
+		mock.ExpectRollback()
+
+		err := handler.AcknowledgeAlert(c)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusConflict, err.(*echo.HTTPError).Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("按状态过滤告警", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/?status=open&product_id=1", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mock.ExpectQuery("SELECT \\* FROM `stock_alerts` WHERE status = \\? AND product_id = \\? ORDER BY id DESC").
+			WithArgs(AlertOpen, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "product_id", "status"}).AddRow(4, 1, AlertOpen))
+
+		require.NoError(t, handler.ListAlerts(c))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"status":"open"`)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,474 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/songfei1983/play-go-api/internal/storage"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+// 附件类型
+const (
+	AttachmentKindFile   = "file"
+	AttachmentKindAvatar = "avatar"
+)
+
+const (
+	defaultUploadMaxBytes = 10 << 20
+	defaultSignedURLTTL   = 15 * time.Minute
+	thumbnailMaxSide      = 256
+	// FilesPath 签名下载地址的路径前缀，不经过 JWT 认证
+	FilesPath = "/api/v1/files/"
+)
+
+// 允许上传的内容类型（按文件内容嗅探，不信任客户端声明）与对应扩展名
+var (
+	imageTypes = map[string]string{
+		"image/jpeg": ".jpg",
+		"image/png":  ".png",
+		"image/gif":  ".gif",
+		"image/webp": ".webp",
+	}
+	attachmentTypes = map[string]string{
+		"image/jpeg":                ".jpg",
+		"image/png":                 ".png",
+		"image/gif":                 ".gif",
+		"image/webp":                ".webp",
+		"application/pdf":           ".pdf",
+		"text/plain; charset=utf-8": ".txt",
+	}
+)
+
+// Attachment 上传的文件，对象本身保存在 BlobStore 中
+type Attachment struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	OwnerType    string    `json:"owner_type" gorm:"size:32;not null;index:idx_attachments_owner"`
+	OwnerID      uint      `json:"owner_id" gorm:"not null;index:idx_attachments_owner"`
+	Kind         string    `json:"kind" gorm:"size:16;not null"`
+	Filename     string    `json:"filename"`
+	ContentType  string    `json:"content_type" gorm:"size:100;not null"`
+	Size         int64     `json:"size"`
+	Checksum     string    `json:"checksum" gorm:"size:64"`
+	StorageKey   string    `json:"-" gorm:"size:255;not null;uniqueIndex"`
+	ThumbnailKey string    `json:"-" gorm:"size:255"`
+	URL          string    `json:"url" gorm:"-"`
+	ThumbnailURL string    `json:"thumbnail_url,omitempty" gorm:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// TableName 指定表名
+func (Attachment) TableName() string {
+	return "attachments"
+}
+
+// AttachmentHandler 产品附件与用户头像的上传、下载处理器
+type AttachmentHandler struct {
+	db       *gorm.DB
+	store    storage.BlobStore
+	signer   *storage.URLSigner
+	maxBytes int64
+	urlTTL   time.Duration
+}
+
+// NewAttachmentHandler 创建附件处理器，maxBytes 与 urlTTL 为 0 时使用默认值
+func NewAttachmentHandler(db *gorm.DB, store storage.BlobStore, signer *storage.URLSigner, maxBytes int64, urlTTL time.Duration) *AttachmentHandler {
+	if maxBytes <= 0 {
+		maxBytes = defaultUploadMaxBytes
+	}
+	if urlTTL <= 0 {
+		urlTTL = defaultSignedURLTTL
+	}
+	return &AttachmentHandler{db: db, store: store, signer: signer, maxBytes: maxBytes, urlTTL: urlTTL}
+}
+
+// UploadProductAttachment 上传产品附件，图片会同时生成缩略图
+func (h *AttachmentHandler) UploadProductAttachment(c echo.Context) error {
+	ctx := c.Request().Context()
+	tracer := otel.Tracer("api-service")
+	ctx, span := tracer.Start(ctx, "AttachmentHandler.UploadProductAttachment")
+	span.SetAttributes(attribute.String("Request-ID", c.Response().Header().Get("X-Request-ID")))
+	defer span.End()
+
+	ownerID, err := productIDParam(c)
+	if err != nil {
+		return err
+	}
+	if err := ownerExists(h.db.WithContext(ctx), Product{}.TableName(), ownerID); err != nil {
+		return err
+	}
+	attachment, err := h.upload(ctx, c, Product{}.TableName(), ownerID, AttachmentKindFile, attachmentTypes)
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+	if err := h.db.WithContext(ctx).Create(attachment).Error; err != nil {
+		span.RecordError(err)
+		h.deleteBlobs(ctx, attachment)
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	if err := h.sign(attachment); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusCreated, attachment)
+}
+
+// ListProductAttachments 列出产品附件，返回的下载地址带有时效签名
+func (h *AttachmentHandler) ListProductAttachments(c echo.Context) error {
+	ctx := c.Request().Context()
+	tracer := otel.Tracer("api-service")
+	ctx, span := tracer.Start(ctx, "AttachmentHandler.ListProductAttachments")
+	span.SetAttributes(attribute.String("Request-ID", c.Response().Header().Get("X-Request-ID")))
+	defer span.End()
+
+	ownerID, err := productIDParam(c)
+	if err != nil {
+		return err
+	}
+	if err := ownerExists(h.db.WithContext(ctx), Product{}.TableName(), ownerID); err != nil {
+		return err
+	}
+
+	attachments := []Attachment{}
+	if err := h.db.WithContext(ctx).
+		Where("owner_type = ? AND owner_id = ? AND kind = ?", Product{}.TableName(), ownerID, AttachmentKindFile).
+		Order("id").Find(&attachments).Error; err != nil {
+		span.RecordError(err)
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	for i := range attachments {
+		if err := h.sign(&attachments[i]); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+	}
+	return c.JSON(http.StatusOK, attachments)
+}
+
+// DeleteProductAttachment 删除产品附件及其存储对象
+func (h *AttachmentHandler) DeleteProductAttachment(c echo.Context) error {
+	ctx := c.Request().Context()
+	tracer := otel.Tracer("api-service")
+	ctx, span := tracer.Start(ctx, "AttachmentHandler.DeleteProductAttachment")
+	span.SetAttributes(attribute.String("Request-ID", c.Response().Header().Get("X-Request-ID")))
+	defer span.End()
+
+	ownerID, err := productIDParam(c)
+	if err != nil {
+		return err
+	}
+	attachmentID, err := strconv.ParseUint(c.Param("attachment_id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid attachment ID")
+	}
+
+	var attachment Attachment
+	if err := h.db.WithContext(ctx).
+		Where("owner_type = ? AND owner_id = ?", Product{}.TableName(), ownerID).
+		First(&attachment, attachmentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "Attachment not found")
+		}
+		span.RecordError(err)
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	if err := h.db.WithContext(ctx).Delete(&attachment).Error; err != nil {
+		span.RecordError(err)
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	h.deleteBlobs(ctx, &attachment)
+	return c.NoContent(http.StatusNoContent)
+}
+
+// SetUserAvatar 上传用户头像，替换已有头像，只接受图片。路由限制为本人或管理员
+func (h *AttachmentHandler) SetUserAvatar(c echo.Context) error {
+	ctx := c.Request().Context()
+	tracer := otel.Tracer("api-service")
+	ctx, span := tracer.Start(ctx, "AttachmentHandler.SetUserAvatar")
+	span.SetAttributes(attribute.String("Request-ID", c.Response().Header().Get("X-Request-ID")))
+	defer span.End()
+
+	ownerID, err := userIDParam(c)
+	if err != nil {
+		return err
+	}
+	if err := ownerExists(h.db.WithContext(ctx), User{}.TableName(), ownerID); err != nil {
+		return err
+	}
+	avatar, err := h.upload(ctx, c, User{}.TableName(), ownerID, AttachmentKindAvatar, imageTypes)
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	var previous []Attachment
+	err = h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("owner_type = ? AND owner_id = ? AND kind = ?", User{}.TableName(), ownerID, AttachmentKindAvatar).
+			Find(&previous).Error; err != nil {
+			return err
+		}
+		if len(previous) > 0 {
+			if err := tx.Delete(&previous).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Create(avatar).Error
+	})
+	if err != nil {
+		span.RecordError(err)
+		h.deleteBlobs(ctx, avatar)
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	for i := range previous {
+		h.deleteBlobs(ctx, &previous[i])
+	}
+	if err := h.sign(avatar); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, avatar)
+}
+
+// GetUserAvatar 重定向到头像的签名下载地址，thumbnail=true 时返回缩略图
+func (h *AttachmentHandler) GetUserAvatar(c echo.Context) error {
+	ctx := c.Request().Context()
+	tracer := otel.Tracer("api-service")
+	ctx, span := tracer.Start(ctx, "AttachmentHandler.GetUserAvatar")
+	span.SetAttributes(attribute.String("Request-ID", c.Response().Header().Get("X-Request-ID")))
+	defer span.End()
+
+	ownerID, err := userIDParam(c)
+	if err != nil {
+		return err
+	}
+	avatar, err := h.findAvatar(ctx, ownerID)
+	if err != nil {
+		return err
+	}
+	if err := h.sign(avatar); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	target := avatar.URL
+	if c.QueryParam("thumbnail") == "true" && avatar.ThumbnailURL != "" {
+		target = avatar.ThumbnailURL
+	}
+	return c.Redirect(http.StatusFound, target)
+}
+
+// DeleteUserAvatar 删除用户头像，路由限制为本人或管理员
+func (h *AttachmentHandler) DeleteUserAvatar(c echo.Context) error {
+	ctx := c.Request().Context()
+	tracer := otel.Tracer("api-service")
+	ctx, span := tracer.Start(ctx, "AttachmentHandler.DeleteUserAvatar")
+	span.SetAttributes(attribute.String("Request-ID", c.Response().Header().Get("X-Request-ID")))
+	defer span.End()
+
+	ownerID, err := userIDParam(c)
+	if err != nil {
+		return err
+	}
+	avatar, err := h.findAvatar(ctx, ownerID)
+	if err != nil {
+		return err
+	}
+	if err := h.db.WithContext(ctx).Delete(avatar).Error; err != nil {
+		span.RecordError(err)
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	h.deleteBlobs(ctx, avatar)
+	return c.NoContent(http.StatusNoContent)
+}
+
+// Download 校验签名后输出存储对象，用于不支持预签名地址的存储后端
+func (h *AttachmentHandler) Download(c echo.Context) error {
+	ctx := c.Request().Context()
+	tracer := otel.Tracer("api-service")
+	ctx, span := tracer.Start(ctx, "AttachmentHandler.Download")
+	span.SetAttributes(attribute.String("Request-ID", c.Response().Header().Get("X-Request-ID")))
+	defer span.End()
+
+	key := c.Param("*")
+	expiresAt, err := strconv.ParseInt(c.QueryParam("expires"), 10, 64)
+	if err != nil || h.signer == nil ||
+		!h.signer.Verify(key, time.Unix(expiresAt, 0), c.QueryParam("signature"), time.Now()) {
+		return echo.NewHTTPError(http.StatusForbidden, "invalid or expired signature")
+	}
+
+	r, err := h.store.Get(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrInvalidKey) {
+		return echo.NewHTTPError(http.StatusNotFound, "File not found")
+	}
+	if err != nil {
+		span.RecordError(err)
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	defer r.Close() // nolint: errcheck
+
+	// 上传时按内容嗅探过类型，下载时同样嗅探即可得到一致结果
+	br := bufio.NewReaderSize(r, 512)
+	head, _ := br.Peek(512)
+	c.Response().Header().Set("X-Content-Type-Options", "nosniff")
+	c.Response().Header().Set(echo.HeaderCacheControl, fmt.Sprintf("private, max-age=%d", int(time.Until(time.Unix(expiresAt, 0)).Seconds())))
+	return c.Stream(http.StatusOK, http.DetectContentType(head), br)
+}
+
+// upload 读取表单中的 file 字段，校验大小与类型后写入存储，返回尚未保存的附件记录
+func (h *AttachmentHandler) upload(ctx context.Context, c echo.Context, ownerType string, ownerID uint, kind string, allowed map[string]string) (*Attachment, error) {
+	c.Request().Body = http.MaxBytesReader(c.Response(), c.Request().Body, h.maxBytes+1<<20)
+	fh, err := c.FormFile("file")
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			return nil, h.tooLarge()
+		}
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "multipart field \"file\" is required")
+	}
+	if fh.Size > h.maxBytes {
+		return nil, h.tooLarge()
+	}
+	f, err := fh.Open()
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	defer f.Close() // nolint: errcheck
+	data, err := io.ReadAll(io.LimitReader(f, h.maxBytes+1))
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if int64(len(data)) > h.maxBytes {
+		return nil, h.tooLarge()
+	}
+
+	contentType := http.DetectContentType(data)
+	ext, ok := allowed[contentType]
+	if !ok {
+		return nil, echo.NewHTTPError(http.StatusUnsupportedMediaType, fmt.Sprintf("content type %q is not allowed", contentType))
+	}
+
+	var thumbnail []byte
+	var thumbnailType string
+	if _, isImage := imageTypes[contentType]; isImage && contentType != "image/webp" {
+		thumbnail, thumbnailType, err = storage.Thumbnail(data, thumbnailMaxSide)
+		switch {
+		case errors.Is(err, storage.ErrImageTooLarge):
+			thumbnail = nil
+		case err != nil:
+			return nil, echo.NewHTTPError(http.StatusUnprocessableEntity, "invalid image: "+err.Error())
+		}
+	}
+
+	sum := sha256.Sum256(data)
+	base := fmt.Sprintf("%s/%d/%s", ownerType, ownerID, uuid.NewString())
+	attachment := &Attachment{
+		OwnerType:   ownerType,
+		OwnerID:     ownerID,
+		Kind:        kind,
+		Filename:    fh.Filename,
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		Checksum:    hex.EncodeToString(sum[:]),
+		StorageKey:  base + ext,
+	}
+	if err := h.store.Put(ctx, attachment.StorageKey, bytes.NewReader(data), attachment.Size, contentType); err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	if thumbnail != nil {
+		attachment.ThumbnailKey = base + "_thumb" + imageTypes[thumbnailType]
+		if err := h.store.Put(ctx, attachment.ThumbnailKey, bytes.NewReader(thumbnail), int64(len(thumbnail)), thumbnailType); err != nil {
+			h.deleteBlobs(ctx, attachment)
+			return nil, echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+	}
+	return attachment, nil
+}
+
+func (h *AttachmentHandler) tooLarge() error {
+	return echo.NewHTTPError(http.StatusRequestEntityTooLarge, fmt.Sprintf("file exceeds the %d byte limit", h.maxBytes))
+}
+
+// sign 为附件生成限时下载地址
+func (h *AttachmentHandler) sign(a *Attachment) error {
+	var err error
+	if a.URL, err = h.signedURL(a.StorageKey); err != nil {
+		return err
+	}
+	if a.ThumbnailKey != "" {
+		a.ThumbnailURL, err = h.signedURL(a.ThumbnailKey)
+	}
+	return err
+}
+
+func (h *AttachmentHandler) signedURL(key string) (string, error) {
+	if p, ok := h.store.(storage.Presigner); ok {
+		return p.PresignGet(key, h.urlTTL)
+	}
+	if h.signer == nil {
+		return "", errors.New("no URL signer configured")
+	}
+	expires := time.Now().Add(h.urlTTL)
+	return fmt.Sprintf("%s%s?expires=%d&signature=%s", FilesPath, key, expires.Unix(), h.signer.Sign(key, time.Unix(expires.Unix(), 0))), nil
+}
+
+// deleteBlobs 尽力删除附件的存储对象，失败只记录到追踪中
+func (h *AttachmentHandler) deleteBlobs(ctx context.Context, a *Attachment) {
+	for _, key := range []string{a.StorageKey, a.ThumbnailKey} {
+		if key == "" {
+			continue
+		}
+		if err := h.store.Delete(ctx, key); err != nil {
+			trace.SpanFromContext(ctx).RecordError(err)
+		}
+	}
+}
+
+func (h *AttachmentHandler) findAvatar(ctx context.Context, userID uint) (*Attachment, error) {
+	var avatar Attachment
+	err := h.db.WithContext(ctx).
+		Where("owner_type = ? AND owner_id = ? AND kind = ?", User{}.TableName(), userID, AttachmentKindAvatar).
+		Order("id DESC").First(&avatar).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "Avatar not found")
+	}
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return &avatar, nil
+}
+
+// ownerExists 校验附件所属记录存在且未删除
+func ownerExists(tx *gorm.DB, table string, id uint) error {
+	var count int64
+	if err := tx.Table(table).Where("id = ? AND deleted_at IS NULL", id).Count(&count).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	if count == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, "Record not found")
+	}
+	return nil
+}
+
+func userIDParam(c echo.Context) (uint, error) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, "Invalid user ID")
+	}
+	return uint(id), nil
+}
+
+// IsFilesPath 判断请求是否为签名下载地址
+func IsFilesPath(path string) bool {
+	return strings.HasPrefix(path, FilesPath)
+}
@@ -0,0 +1,243 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/labstack/echo/v4"
+	"github.com/songfei1983/play-go-api/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func setupAttachmentTest(t *testing.T, maxBytes int64) (*echo.Echo, *AttachmentHandler, sqlmock.Sqlmock, string) {
+	e := echo.New()
+
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+
+	gormDB, err := gorm.Open(mysql.New(mysql.Config{
+		Conn:                      db,
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{})
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	store, err := storage.NewLocalStore(dir)
+	require.NoError(t, err)
+
+	signer := storage.NewURLSigner([]byte("test-signing-key"))
+	return e, NewAttachmentHandler(gormDB, store, signer, maxBytes, time.Minute), mock, dir
+}
+
+func multipartBody(t *testing.T, filename string, data []byte) (*bytes.Buffer, string) {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	part, err := w.CreateFormFile("file", filename)
+	require.NoError(t, err)
+	_, err = part.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return &body, w.FormDataContentType()
+}
+
+func pngBytes(t *testing.T, w, h int) []byte {
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, w, h))))
+	return buf.Bytes()
+}
+
+func countFiles(t *testing.T, dir string) int {
+	n := 0
+	err := filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			n++
+		}
+		return err
+	})
+	require.NoError(t, err)
+	return n
+}
+
+func TestAttachment(t *testing.T) {
+	e, handler, mock, dir := setupAttachmentTest(t, 64<<10)
+
+	newUploadContext := func(method, id, filename string, data []byte) (echo.Context, *httptest.ResponseRecorder) {
+		body, contentType := multipartBody(t, filename, data)
+		req := httptest.NewRequest(method, "/", body)
+		req.Header.Set(echo.HeaderContentType, contentType)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues(id)
+		return c, rec
+	}
+	expectOwner := func(table string, count int) {
+		mock.ExpectQuery("SELECT count\\(\\*\\) FROM `" + table + "` WHERE id = \\? AND deleted_at IS NULL").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(count))
+	}
+	download := func(rawURL string) *httptest.ResponseRecorder {
+		u, err := url.Parse(rawURL)
+		require.NoError(t, err)
+		req := httptest.NewRequest(http.MethodGet, u.String(), nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("*")
+		c.SetParamValues(strings.TrimPrefix(u.Path, FilesPath))
+		if err := handler.Download(c); err != nil {
+			e.HTTPErrorHandler(err, c)
+		}
+		return rec
+	}
+
+	var uploaded Attachment
+
+	t.Run("上传图片并生成缩略图", func(t *testing.T) {
+		data := pngBytes(t, 600, 300)
+		c, rec := newUploadContext(http.MethodPost, "1", "photo.png", data)
+
+		expectOwner("products", 1)
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO `attachments`").
+			WithArgs("products", 1, AttachmentKindFile, "photo.png", "image/png", len(data),
+				sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(5, 1))
+		mock.ExpectCommit()
+
+		require.NoError(t, handler.UploadProductAttachment(c))
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &uploaded))
+		assert.Equal(t, uint(5), uploaded.ID)
+		assert.True(t, strings.HasPrefix(uploaded.URL, FilesPath+"products/1/"))
+		assert.NotEmpty(t, uploaded.ThumbnailURL)
+		assert.NotContains(t, rec.Body.String(), "storage_key")
+		assert.Equal(t, 2, countFiles(t, dir))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("签名地址下载", func(t *testing.T) {
+		rec := download(uploaded.URL)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "image/png", rec.Header().Get(echo.HeaderContentType))
+		assert.Equal(t, "nosniff", rec.Header().Get("X-Content-Type-Options"))
+
+		thumb, _, err := image.DecodeConfig(bytes.NewReader(download(uploaded.ThumbnailURL).Body.Bytes()))
+		require.NoError(t, err)
+		assert.Equal(t, 256, thumb.Width)
+		assert.Equal(t, 128, thumb.Height)
+	})
+
+	t.Run("签名被篡改", func(t *testing.T) {
+		u, err := url.Parse(uploaded.URL)
+		require.NoError(t, err)
+		query := u.Query()
+		query.Set("expires", "9999999999")
+		u.RawQuery = query.Encode()
+
+		rec := download(u.String())
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("不允许的文件类型", func(t *testing.T) {
+		c, _ := newUploadContext(http.MethodPost, "1", "run.sh", []byte("\x7fELF\x02\x01\x01"))
+
+		expectOwner("products", 1)
+
+		err := handler.UploadProductAttachment(c)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusUnsupportedMediaType, err.(*echo.HTTPError).Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("文件过大", func(t *testing.T) {
+		c, _ := newUploadContext(http.MethodPost, "1", "big.txt", bytes.Repeat([]byte("a"), 64<<10+1))
+
+		expectOwner("products", 1)
+
+		err := handler.UploadProductAttachment(c)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, err.(*echo.HTTPError).Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("产品不存在", func(t *testing.T) {
+		c, _ := newUploadContext(http.MethodPost, "1", "photo.png", pngBytes(t, 8, 8))
+
+		expectOwner("products", 0)
+
+		err := handler.UploadProductAttachment(c)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusNotFound, err.(*echo.HTTPError).Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("替换头像并删除旧文件", func(t *testing.T) {
+		before := countFiles(t, dir)
+		c, rec := newUploadContext(http.MethodPut, "1", "me.png", pngBytes(t, 64, 64))
+
+		expectOwner("users", 1)
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT \\* FROM `attachments` WHERE owner_type = \\? AND owner_id = \\? AND kind = \\?").
+			WithArgs("users", 1, AttachmentKindAvatar).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "owner_type", "owner_id", "kind", "storage_key", "thumbnail_key"}).
+				AddRow(3, "users", 1, AttachmentKindAvatar, "users/1/old.png", ""))
+		mock.ExpectExec("DELETE FROM `attachments` WHERE `attachments`.`id` = \\?").
+			WithArgs(3).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO `attachments`").WillReturnResult(sqlmock.NewResult(6, 1))
+		mock.ExpectCommit()
+
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, "users", "1"), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "users", "1", "old.png"), []byte("old"), 0o644))
+
+		require.NoError(t, handler.SetUserAvatar(c))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.NoFileExists(t, filepath.Join(dir, "users", "1", "old.png"))
+		assert.Equal(t, before+2, countFiles(t, dir))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("头像只接受图片", func(t *testing.T) {
+		c, _ := newUploadContext(http.MethodPut, "1", "cv.pdf", []byte("%PDF-1.4\n"))
+
+		expectOwner("users", 1)
+
+		err := handler.SetUserAvatar(c)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusUnsupportedMediaType, err.(*echo.HTTPError).Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("头像重定向到缩略图", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/?thumbnail=true", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+
+		mock.ExpectQuery("SELECT \\* FROM `attachments` WHERE owner_type = \\? AND owner_id = \\? AND kind = \\? ORDER BY id DESC").
+			WithArgs("users", 1, AttachmentKindAvatar, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "storage_key", "thumbnail_key"}).
+				AddRow(6, "users/1/a.png", "users/1/a_thumb.png"))
+
+		require.NoError(t, handler.GetUserAvatar(c))
+		assert.Equal(t, http.StatusFound, rec.Code)
+		assert.True(t, strings.HasPrefix(rec.Header().Get(echo.HeaderLocation), FilesPath+"users/1/a_thumb.png?"))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
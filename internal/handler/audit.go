@@ -0,0 +1,366 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	AuditLoginSucceeded = "auth.login_succeeded"
+	AuditLoginFailed    = "auth.login_failed"
+
+	auditVerifyBatch = 500
+)
+
+// AuditLog 审计日志，只追加不修改；Hash 覆盖本条内容与上一条的 Hash，
+// 任意一条被改动或删除都会使后续链路校验失败
+type AuditLog struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	Actor        string    `json:"actor" gorm:"not null"`
+	Action       string    `json:"action" gorm:"size:128;not null"`
+	ResourceType string    `json:"resource_type,omitempty" gorm:"size:64"`
+	ResourceID   uint      `json:"resource_id,omitempty"`
+	Diff         JSONValue `json:"diff,omitempty" gorm:"type:longtext"`
+	IP           string    `json:"ip,omitempty" gorm:"column:ip;size:64"`
+	RequestID    string    `json:"request_id,omitempty"`
+	TraceID      string    `json:"trace_id,omitempty"`
+	PrevHash     string    `json:"prev_hash" gorm:"size:64;not null"`
+	Hash         string    `json:"hash" gorm:"size:64;not null"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// TableName 指定审计日志表名
+func (AuditLog) TableName() string {
+	return "audit_logs"
+}
+
+// computeHash 计算审计日志的链式哈希，时间统一按 UTC 微秒精度参与计算，与数据库存储精度一致
+func (l *AuditLog) computeHash() string {
+	content, _ := json.Marshal([]interface{}{
+		l.PrevHash,
+		l.Actor,
+		l.Action,
+		l.ResourceType,
+		l.ResourceID,
+		string(l.Diff),
+		l.IP,
+		l.RequestID,
+		l.TraceID,
+		l.CreatedAt.UTC().Format(time.RFC3339Nano),
+	})
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// AuditVerification 哈希链校验结果，BrokenAt 为第一条校验失败的日志 ID
+type AuditVerification struct {
+	Checked  int   `json:"checked"`
+	Valid    bool  `json:"valid"`
+	BrokenAt *uint `json:"broken_at,omitempty"`
+}
+
+// auditStateKey 审计状态在 context 中的键
+type auditStateKey struct{}
+
+// auditState 记录当前请求是否已写入审计日志，避免中间件重复记录
+type auditState struct {
+	recorded bool
+}
+
+// SkipAudit 标记当前请求不需要由中间件补记审计日志，用于以 POST 提交的只读请求，
+// 如 GraphQL 查询；其中的变更仍由变更回调记录
+func SkipAudit(ctx context.Context) {
+	if state, ok := ctx.Value(auditStateKey{}).(*auditState); ok {
+		state.recorded = true
+	}
+}
+
+// Auditor 写入与校验审计日志
+type Auditor struct {
+	db *gorm.DB
+	// mu 保证同一进程内哈希链按顺序追加，跨进程由 FOR UPDATE 锁住链尾
+	mu sync.Mutex
+}
+
+// NewAuditor 创建审计日志记录器
+func NewAuditor(db *gorm.DB) *Auditor {
+	return &Auditor{db: db}
+}
+
+// Record 追加一条审计日志，未指定的操作者、IP、请求 ID 与 trace ID 从 context 中补全
+func (a *Auditor) Record(ctx context.Context, entry *AuditLog) error {
+	info := requestInfoFrom(ctx)
+	if entry.Actor == "" {
+		entry.Actor = info.Actor
+	}
+	if entry.IP == "" {
+		entry.IP = info.IP
+	}
+	if entry.RequestID == "" {
+		entry.RequestID = info.RequestID
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+		entry.TraceID = sc.TraceID().String()
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	err := a.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var last AuditLog
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("hash").Order("id DESC").Limit(1).Find(&last).Error; err != nil {
+			return err
+		}
+		entry.PrevHash = last.Hash
+		entry.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+		entry.Hash = entry.computeHash()
+		return tx.Create(entry).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	if state, ok := ctx.Value(auditStateKey{}).(*auditState); ok {
+		state.recorded = true
+	}
+	return nil
+}
+
+// Verify 按顺序重新计算整条哈希链
+func (a *Auditor) Verify(ctx context.Context) (*AuditVerification, error) {
+	result := &AuditVerification{Valid: true}
+	var lastID uint
+	prev := ""
+	for {
+		var batch []AuditLog
+		if err := a.db.WithContext(ctx).Where("id > ?", lastID).
+			Order("id").Limit(auditVerifyBatch).Find(&batch).Error; err != nil {
+			return nil, err
+		}
+		for i := range batch {
+			entry := &batch[i]
+			if entry.PrevHash != prev || entry.Hash != entry.computeHash() {
+				result.Valid = false
+				result.BrokenAt = &entry.ID
+				return result, nil
+			}
+			prev = entry.Hash
+			result.Checked++
+		}
+		if len(batch) < auditVerifyBatch {
+			return result, nil
+		}
+		lastID = batch[len(batch)-1].ID
+	}
+}
+
+// AuditChanges 返回把资源变更写入审计日志的回调，更新时记录前后字段差异
+func AuditChanges[T Model](auditor *Auditor) ChangeHook[T] {
+	return func(ctx context.Context, change Change[T]) {
+		var model T
+		entry := &AuditLog{
+			Action:       fmt.Sprintf("%s.%s", model.TableName(), change.Type),
+			ResourceType: model.TableName(),
+			ResourceID:   change.ID,
+		}
+		diff, err := changeDiff(change)
+		if err == nil && diff != nil {
+			entry.Diff, err = json.Marshal(diff)
+		}
+		if err == nil {
+			err = auditor.Record(ctx, entry)
+		}
+		if err != nil {
+			trace.SpanFromContext(ctx).RecordError(err)
+		}
+	}
+}
+
+// changeDiff 根据回调携带的 Before/After 计算字段差异，都没有时返回 nil
+func changeDiff[T Model](change Change[T]) (map[string]FieldChange, error) {
+	if change.After == nil {
+		return nil, nil
+	}
+	after, err := snapshotOf(*change.After)
+	if err != nil {
+		return nil, err
+	}
+	var before JSONValue
+	if change.Before != nil {
+		if before, err = snapshotOf(*change.Before); err != nil {
+			return nil, err
+		}
+	}
+	return diffSnapshots(before, after)
+}
+
+// Middleware 为没有经过变更回调记录的写请求（如价格、标签、订单）补一条审计日志，
+// 只记录成功的请求，需注册在 RequestInfo 之后
+func (a *Auditor) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			switch c.Request().Method {
+			case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+			default:
+				return next(c)
+			}
+
+			state := &auditState{}
+			ctx := context.WithValue(c.Request().Context(), auditStateKey{}, state)
+			c.SetRequest(c.Request().WithContext(ctx))
+
+			err := next(c)
+
+			status := c.Response().Status
+			if err != nil {
+				status = http.StatusInternalServerError
+				var httpErr *echo.HTTPError
+				if errors.As(err, &httpErr) {
+					status = httpErr.Code
+				}
+			}
+			if state.recorded || status >= http.StatusBadRequest {
+				return err
+			}
+
+			entry := &AuditLog{
+				Action:       c.Request().Method + " " + c.Path(),
+				ResourceType: routeResource(c.Path()),
+			}
+			if id, perr := strconv.ParseUint(c.Param("id"), 10, 64); perr == nil {
+				entry.ResourceID = uint(id)
+			}
+			if rerr := a.Record(ctx, entry); rerr != nil {
+				trace.SpanFromContext(ctx).RecordError(rerr)
+			}
+			return err
+		}
+	}
+}
+
+// routeResource 取路由模板中 /api/v1 之后的第一段作为资源类型
+func routeResource(path string) string {
+	path = strings.TrimPrefix(path, "/api/v1")
+	segment, _, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	return segment
+}
+
+// AuditHandler 审计日志查询接口，只对管理员开放
+type AuditHandler struct {
+	auditor *Auditor
+	admins  Admins
+}
+
+// NewAuditHandler 创建审计日志处理器，只有管理员可以查询
+func NewAuditHandler(auditor *Auditor, admins Admins) *AuditHandler {
+	return &AuditHandler{auditor: auditor, admins: admins}
+}
+
+// requireAdmin 当前用户不在管理员列表中时返回 403
+func (h *AuditHandler) requireAdmin(c echo.Context) error {
+	if _, err := currentUserID(c); err != nil {
+		return err
+	}
+	if !h.admins.IsAdmin(c) {
+		return echo.NewHTTPError(http.StatusForbidden, "audit log is restricted to administrators")
+	}
+	return nil
+}
+
+// ListAuditLogs 查询审计日志，最新的在前，可按操作者、动作、资源与时间范围过滤
+func (h *AuditHandler) ListAuditLogs(c echo.Context) error {
+	ctx := c.Request().Context()
+	tracer := otel.Tracer("api-service")
+	ctx, span := tracer.Start(ctx, "AuditHandler.ListAuditLogs")
+	span.SetAttributes(attribute.String("Request-ID", c.Response().Header().Get("X-Request-ID")))
+	defer span.End()
+
+	if err := h.requireAdmin(c); err != nil {
+		return err
+	}
+
+	query := h.auditor.db.WithContext(ctx)
+	for _, param := range []string{"actor", "action", "resource_type"} {
+		if v := c.QueryParam(param); v != "" {
+			query = query.Where(param+" = ?", v)
+		}
+	}
+	if v := c.QueryParam("resource_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "resource_id must be an integer")
+		}
+		query = query.Where("resource_id = ?", id)
+	}
+	if v := c.QueryParam("before"); v != "" {
+		before, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "before must be an audit log id")
+		}
+		query = query.Where("id < ?", before)
+	}
+	if v := c.QueryParam("since"); v != "" {
+		since, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "since must be an RFC 3339 timestamp")
+		}
+		query = query.Where("created_at >= ?", since)
+	}
+	if v := c.QueryParam("until"); v != "" {
+		until, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "until must be an RFC 3339 timestamp")
+		}
+		query = query.Where("created_at < ?", until)
+	}
+	limit := defaultHistoryLimit
+	if v := c.QueryParam("limit"); v != "" {
+		var err error
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 || limit > maxHistoryLimit {
+			return echo.NewHTTPError(http.StatusBadRequest, "limit must be between 1 and 500")
+		}
+	}
+
+	logs := []AuditLog{}
+	if err := query.Order("id DESC").Limit(limit).Find(&logs).Error; err != nil {
+		span.RecordError(err)
+		return httpError(err)
+	}
+	return c.JSON(http.StatusOK, logs)
+}
+
+// VerifyAuditLogs 校验审计日志哈希链是否完整
+func (h *AuditHandler) VerifyAuditLogs(c echo.Context) error {
+	ctx := c.Request().Context()
+	tracer := otel.Tracer("api-service")
+	ctx, span := tracer.Start(ctx, "AuditHandler.VerifyAuditLogs")
+	span.SetAttributes(attribute.String("Request-ID", c.Response().Header().Get("X-Request-ID")))
+	defer span.End()
+
+	if err := h.requireAdmin(c); err != nil {
+		return err
+	}
+
+	result, err := h.auditor.Verify(ctx)
+	if err != nil {
+		span.RecordError(err)
+		return httpError(err)
+	}
+	return c.JSON(http.StatusOK, result)
+}
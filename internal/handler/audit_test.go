@@ -0,0 +1,189 @@
+package handler
+
+import (
+	"context"
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditLog(t *testing.T) {
+	e, products, mock, _ := setupProductTest(t)
+	auditor := NewAuditor(products.db)
+	ctx := context.WithValue(context.Background(), requestInfoKey{}, requestInfo{Actor: "alice", IP: "10.0.0.1", RequestID: "req-1"})
+
+	auditColumns := []string{"id", "actor", "action", "resource_type", "resource_id", "diff", "ip", "request_id", "trace_id", "prev_hash", "hash", "created_at"}
+	expectAppend := func(prevHash string, args ...driver.Value) {
+		mock.ExpectBegin()
+		rows := sqlmock.NewRows([]string{"hash"})
+		if prevHash != "" {
+			rows.AddRow(prevHash)
+		}
+		mock.ExpectQuery("SELECT `hash` FROM `audit_logs` ORDER BY id DESC LIMIT \\? FOR UPDATE").
+			WithArgs(1).
+			WillReturnRows(rows)
+		exec := mock.ExpectExec("INSERT INTO `audit_logs`")
+		if len(args) > 0 {
+			exec.WithArgs(args...)
+		}
+		exec.WillReturnResult(sqlmock.NewResult(2, 1))
+		mock.ExpectCommit()
+	}
+	// chain 生成一段有效的哈希链
+	chain := func() []AuditLog {
+		logs := []AuditLog{
+			{ID: 1, Actor: "alice", Action: "products.created", ResourceType: "products", ResourceID: 1, CreatedAt: time.Now().UTC().Truncate(time.Microsecond)},
+			{ID: 2, Actor: "bob", Action: "users.deleted", ResourceType: "users", ResourceID: 3, CreatedAt: time.Now().UTC().Truncate(time.Microsecond)},
+		}
+		prev := ""
+		for i := range logs {
+			logs[i].PrevHash = prev
+			logs[i].Hash = logs[i].computeHash()
+			prev = logs[i].Hash
+		}
+		return logs
+	}
+	chainRows := func(logs []AuditLog) *sqlmock.Rows {
+		rows := sqlmock.NewRows(auditColumns)
+		for _, l := range logs {
+			rows.AddRow(l.ID, l.Actor, l.Action, l.ResourceType, l.ResourceID, nil, "", "", "", l.PrevHash, l.Hash, l.CreatedAt)
+		}
+		return rows
+	}
+
+	t.Run("追加日志链接上一条哈希", func(t *testing.T) {
+		expectAppend("abc", "alice", "products.updated", "products", 1, nil, "10.0.0.1", "req-1", "", "abc", sqlmock.AnyArg(), sqlmock.AnyArg())
+
+		entry := &AuditLog{Action: "products.updated", ResourceType: "products", ResourceID: 1}
+		require.NoError(t, auditor.Record(ctx, entry))
+		assert.Equal(t, "abc", entry.PrevHash)
+		assert.Equal(t, entry.computeHash(), entry.Hash)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("资源变更记录字段差异", func(t *testing.T) {
+		expectAppend("", "alice", "users.updated", "users", 3,
+			`{"email":{"from":"a@example.com","to":"b@example.com"}}`, "10.0.0.1", "req-1", "", "", sqlmock.AnyArg(), sqlmock.AnyArg())
+
+		before := User{ID: 3, Username: "carol", Password: "old", Email: "a@example.com"}
+		after := User{ID: 3, Username: "carol", Password: "new", Email: "b@example.com"}
+		AuditChanges[User](auditor)(ctx, Change[User]{Type: ChangeUpdated, ID: 3, Before: &before, After: &after})
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("校验完整的哈希链", func(t *testing.T) {
+		mock.ExpectQuery("SELECT \\* FROM `audit_logs` WHERE id > \\? ORDER BY id LIMIT \\?").
+			WithArgs(0, auditVerifyBatch).
+			WillReturnRows(chainRows(chain()))
+
+		result, err := auditor.Verify(ctx)
+		require.NoError(t, err)
+		assert.True(t, result.Valid)
+		assert.Equal(t, 2, result.Checked)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("篡改的日志校验失败", func(t *testing.T) {
+		logs := chain()
+		logs[1].Actor = "mallory"
+		mock.ExpectQuery("SELECT \\* FROM `audit_logs` WHERE id > \\? ORDER BY id LIMIT \\?").
+			WillReturnRows(chainRows(logs))
+
+		result, err := auditor.Verify(ctx)
+		require.NoError(t, err)
+		assert.False(t, result.Valid)
+		require.NotNil(t, result.BrokenAt)
+		assert.Equal(t, uint(2), *result.BrokenAt)
+	})
+
+	t.Run("中间件记录其他写请求", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPut, "/api/v1/products/5/tags", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetRequest(req.WithContext(ctx))
+		c.SetPath("/api/v1/products/:id/tags")
+		c.SetParamNames("id")
+		c.SetParamValues("5")
+
+		expectAppend("", "alice", "PUT /api/v1/products/:id/tags", "products", 5, nil, "10.0.0.1", "req-1", "", "", sqlmock.AnyArg(), sqlmock.AnyArg())
+
+		err := auditor.Middleware()(func(c echo.Context) error {
+			return c.NoContent(http.StatusOK)
+		})(c)
+		require.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("已由回调记录或失败的请求不重复记录", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodDelete, "/api/v1/products/5/soft", nil)
+		c := e.NewContext(req, httptest.NewRecorder())
+		c.SetRequest(req.WithContext(ctx))
+
+		expectAppend("")
+		err := auditor.Middleware()(func(c echo.Context) error {
+			require.NoError(t, auditor.Record(c.Request().Context(), &AuditLog{Action: "products.deleted"}))
+			return c.NoContent(http.StatusNoContent)
+		})(c)
+		require.NoError(t, err)
+
+		err = auditor.Middleware()(func(c echo.Context) error {
+			return echo.NewHTTPError(http.StatusConflict, "conflict")
+		})(c)
+		require.Error(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("记录登录失败", func(t *testing.T) {
+		users := NewUserHandler(products.db, nil)
+		users.UseAuditor(auditor)
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"username":"carol","password":"wrong"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		c := e.NewContext(req, httptest.NewRecorder())
+
+		mock.ExpectQuery("SELECT \\* FROM `users` WHERE username = \\?").
+			WithArgs("carol", 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password"}).AddRow(3, "carol", "secret"))
+		expectAppend("", "carol", AuditLoginFailed, "users", 3, nil, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "", sqlmock.AnyArg(), sqlmock.AnyArg())
+
+		err := users.Login(c)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusUnauthorized, err.(*echo.HTTPError).Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("仅管理员可以查询", func(t *testing.T) {
+		handler := NewAuditHandler(auditor, NewAdmins([]uint{9}))
+		newContext := func(userID float64, query string) (echo.Context, *httptest.ResponseRecorder) {
+			req := httptest.NewRequest(http.MethodGet, "/?"+query, nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.Set("user", &jwt.Token{Claims: jwt.MapClaims{"user_id": userID, "username": "admin"}})
+			return c, rec
+		}
+
+		// 用户名不能决定管理员身份
+		c, _ := newContext(1, "")
+		err := handler.ListAuditLogs(c)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusForbidden, err.(*echo.HTTPError).Code)
+
+		c, rec := newContext(9, "actor=bob&resource_type=users&resource_id=3&limit=10")
+		mock.ExpectQuery("SELECT \\* FROM `audit_logs` WHERE actor = \\? AND resource_type = \\? AND resource_id = \\? ORDER BY id DESC LIMIT \\?").
+			WithArgs("bob", "users", 3, 10).
+			WillReturnRows(chainRows(chain()[1:]))
+
+		require.NoError(t, handler.ListAuditLogs(c))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"action":"users.deleted"`)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -1,8 +1,12 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
 	"strconv"
 	"time"
@@ -11,6 +15,7 @@ import (
 	"github.com/labstack/echo/v4"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"gorm.io/gorm"
 )
 
@@ -20,20 +25,41 @@ type Model interface {
 	TableName() string
 }
 
+// Validator 可选接口，模型在更新持久化前进行校验
+type Validator interface {
+	Validate() error
+}
+
 // BaseHandler 通用CRUD处理器
 type BaseHandler[T Model] struct {
-	db    *gorm.DB
-	redis *redis.Client
+	db         *gorm.DB
+	redis      *redis.Client
+	hooks      []ChangeHook[T]
+	txHooks    []TxChangeHook[T]
+	presenters []Presenter[T]
+	filters    []ListFilter
+	validators []ModelValidator[T]
+	history    bool
+	cacheTTL   time.Duration
 }
 
+// defaultCacheTTL 单条记录缓存的默认有效期
+const defaultCacheTTL = time.Hour
+
 // NewBaseHandler 创建基础处理器
 func NewBaseHandler[T Model](db *gorm.DB, redis *redis.Client) *BaseHandler[T] {
 	return &BaseHandler[T]{
-		db:    db,
-		redis: redis,
+		db:       db,
+		redis:    redis,
+		cacheTTL: defaultCacheTTL,
 	}
 }
 
+// UseCacheTTL 设置单条记录的缓存有效期
+func (h *BaseHandler[T]) UseCacheTTL(ttl time.Duration) {
+	h.cacheTTL = ttl
+}
+
 // getCacheKey 获取缓存键
 func (h *BaseHandler[T]) getCacheKey(id string) string {
 	var model T
@@ -54,15 +80,37 @@ func (h *BaseHandler[T]) Create(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
 	}
 
-	result := h.db.WithContext(ctx).Create(&model)
-	if result.Error != nil {
-		span.RecordError(result.Error)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": result.Error.Error()})
+	if err := h.CreateRecord(ctx, &model); err != nil {
+		span.RecordError(err)
+		var httpErr *echo.HTTPError
+		if errors.As(err, &httpErr) {
+			return httpErr
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
 
 	return c.JSON(http.StatusCreated, model)
 }
 
+// CreateRecord 校验后在事务中创建记录并触发变更回调，REST 与 gRPC 接口共用
+func (h *BaseHandler[T]) CreateRecord(ctx context.Context, model *T) error {
+	if err := h.validate(*model); err != nil {
+		return err
+	}
+	err := h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(model).Error; err != nil {
+			return err
+		}
+		return h.notifyTx(tx, Change[T]{Type: ChangeCreated, ID: (*model).GetID(), After: model})
+	})
+	if err != nil {
+		return duplicateKeyError(err)
+	}
+
+	h.notify(ctx, Change[T]{Type: ChangeCreated, ID: (*model).GetID(), After: model})
+	return nil
+}
+
 // Get 通用获取单个记录方法
 func (h *BaseHandler[T]) Get(c echo.Context) error {
 	ctx := c.Request().Context()
@@ -74,38 +122,102 @@ func (h *BaseHandler[T]) Get(c echo.Context) error {
 	id := c.Param("id")
 	span.SetAttributes(attribute.String("id", id))
 
-	// 尝试从缓存获取
-	cacheKey := h.getCacheKey(id)
-	modelJSON, err := h.redis.Get(ctx, cacheKey).Result()
-	if err == nil {
-		var model T
-		if err = json.Unmarshal([]byte(modelJSON), &model); err == nil {
-			span.SetAttributes(attribute.String("data_source", "cache"))
-			return c.JSON(http.StatusOK, model)
+	// as_of 从版本快照还原历史状态，不能与字段投影同时使用
+	if asOf := c.QueryParam("as_of"); asOf != "" {
+		if c.QueryParam("fields") != "" || c.QueryParam("include") != "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "as_of cannot be combined with fields or include")
 		}
+		return h.getAsOf(ctx, c, id, asOf)
+	}
+
+	// 指定了 fields 或 include 时绕过缓存，只查询需要的列
+	proj, err := h.parseProjection(c)
+	if err != nil {
 		span.RecordError(err)
+		return err
+	}
+	if proj != nil {
+		return h.getProjected(ctx, c, id, proj)
 	}
 
-	var model T
-	intID, err := strconv.Atoi(id)
+	intID, err := strconv.ParseUint(id, 10, 64)
 	if err != nil {
 		span.RecordError(err)
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
 	}
 
-	if err = h.db.WithContext(ctx).Where("deleted_at IS NULL").First(&model, intID).Error; err != nil {
+	model, err := h.FindRecord(ctx, uint(intID))
+	if err != nil {
 		span.RecordError(err)
 		return c.JSON(http.StatusNotFound, map[string]string{"error": "Record not found"})
 	}
 
+	models := []T{model}
+	if err := h.present(ctx, c, models); err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, models[0])
+}
+
+// FindRecord 读取未删除的记录，优先读取缓存，未命中时查询数据库并写入缓存
+func (h *BaseHandler[T]) FindRecord(ctx context.Context, id uint) (T, error) {
+	return h.findRecord(ctx, id, h.getCacheKey(strconv.FormatUint(uint64(id), 10)))
+}
+
+func (h *BaseHandler[T]) findRecord(ctx context.Context, id uint, cacheKey string) (T, error) {
+	span := trace.SpanFromContext(ctx)
+
+	var model T
+	modelJSON, err := h.redis.Get(ctx, cacheKey).Result()
+	if err == nil {
+		if err = json.Unmarshal([]byte(modelJSON), &model); err == nil {
+			span.SetAttributes(attribute.String("data_source", "cache"))
+			return model, nil
+		}
+		span.RecordError(err)
+		var zero T
+		model = zero
+	}
+
+	if err := h.db.WithContext(ctx).Where("deleted_at IS NULL").First(&model, id).Error; err != nil {
+		return model, err
+	}
 	span.SetAttributes(attribute.String("data_source", "mysql"))
 
 	// 缓存结果
 	if modelByte, err := json.Marshal(model); err == nil {
-		h.redis.Set(ctx, cacheKey, string(modelByte), time.Hour)
+		h.redis.Set(ctx, cacheKey, string(modelByte), h.cacheTTL)
 	}
+	return model, nil
+}
 
-	return c.JSON(http.StatusOK, model)
+// Page 按 ID 升序返回 afterID 之后最多 limit 条记录，供 gRPC 等不使用查询参数过滤的调用方分页
+func (h *BaseHandler[T]) Page(ctx context.Context, afterID uint, limit int, includeDeleted bool) ([]T, error) {
+	query := h.db.WithContext(ctx)
+	if !includeDeleted {
+		query = query.Where("deleted_at IS NULL")
+	}
+	if afterID > 0 {
+		query = query.Where("id > ?", afterID)
+	}
+	var models []T
+	if err := query.Order("id").Limit(limit).Find(&models).Error; err != nil {
+		return nil, err
+	}
+	return models, nil
+}
+
+// FindByIDs 批量读取未删除的记录，不存在的 ID 不出现在结果中
+func (h *BaseHandler[T]) FindByIDs(ctx context.Context, ids []uint) (map[uint]T, error) {
+	var models []T
+	if err := h.db.WithContext(ctx).Where("deleted_at IS NULL AND id IN ?", ids).Find(&models).Error; err != nil {
+		return nil, err
+	}
+	found := make(map[uint]T, len(models))
+	for _, model := range models {
+		found[model.GetID()] = model
+	}
+	return found, nil
 }
 
 // List 通用获取列表方法
@@ -115,20 +227,79 @@ func (h *BaseHandler[T]) List(c echo.Context) error {
 	ctx, span := tracer.Start(ctx, "BaseHandler.List")
 	defer span.End()
 
-	var models []T
-	query := h.db.WithContext(ctx)
+	proj, err := h.parseProjection(c)
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
 
-	includeSoftDeleted := c.QueryParam("include_deleted") == "true"
-	if !includeSoftDeleted {
-		query = query.Where("deleted_at IS NULL")
+	var models []T
+	query, err := h.listQuery(c, h.db.WithContext(ctx))
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+	if proj != nil {
+		query = proj.apply(query)
 	}
 
 	if err := query.Find(&models).Error; err != nil {
 		span.RecordError(err)
 		return echo.NewHTTPError(http.StatusNotFound, err.Error())
 	}
+	if err := h.present(ctx, c, models); err != nil {
+		return err
+	}
+
+	if proj == nil {
+		return c.JSON(http.StatusOK, models)
+	}
+	items := make([]interface{}, len(models))
+	for i, model := range models {
+		if items[i], err = proj.render(model); err != nil {
+			span.RecordError(err)
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+	}
+	return c.JSON(http.StatusOK, items)
+}
+
+// getProjected 按字段投影查询单条记录，结果不写入缓存
+func (h *BaseHandler[T]) getProjected(ctx context.Context, c echo.Context, id string, proj *projection) error {
+	intID, err := strconv.Atoi(id)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
 
-	return c.JSON(http.StatusOK, models)
+	var model T
+	if err := proj.apply(h.db.WithContext(ctx)).Where("deleted_at IS NULL").First(&model, intID).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Record not found"})
+	}
+	models := []T{model}
+	if err := h.present(ctx, c, models); err != nil {
+		return err
+	}
+
+	out, err := proj.render(models[0])
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, out)
+}
+
+// listQuery 根据查询参数构造列表过滤条件，List 与 Export 共用
+func (h *BaseHandler[T]) listQuery(c echo.Context, query *gorm.DB) (*gorm.DB, error) {
+	includeSoftDeleted := c.QueryParam("include_deleted") == "true"
+	if !includeSoftDeleted {
+		query = query.Where("deleted_at IS NULL")
+	}
+	for _, filter := range h.filters {
+		var err error
+		if query, err = filter(c, query); err != nil {
+			return nil, err
+		}
+	}
+	return query, nil
 }
 
 // Update 通用更新方法
@@ -147,32 +318,151 @@ func (h *BaseHandler[T]) Update(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "Invalid ID")
 	}
 
-	if err := h.db.WithContext(ctx).First(&model, intID).Error; err != nil {
+	// 已软删除的记录视为不存在，与删除、读取一致
+	if err := h.db.WithContext(ctx).Where("deleted_at IS NULL").First(&model, intID).Error; err != nil {
 		span.RecordError(err)
 		return echo.NewHTTPError(http.StatusNotFound, "Record not found")
 	}
 
-	if c.Request().Method == "PUT" {
-		if err := c.Bind(&model); err != nil {
-			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
-		}
-	} else {
-		updates := make(map[string]interface{})
-		if err := c.Bind(&updates); err != nil {
-			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
-		}
-		if err := h.db.Model(&model).Updates(updates).Error; err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
-		}
+	before := model
+	if err := h.applyUpdate(ctx, c, &model); err != nil {
+		span.RecordError(err)
+		return err
 	}
 
 	// 清除缓存
 	cacheKey := h.getCacheKey(id)
 	h.redis.Del(ctx, cacheKey)
 
+	h.notify(ctx, Change[T]{Type: ChangeUpdated, ID: model.GetID(), Before: &before, After: &model})
+
 	return c.JSON(http.StatusOK, model)
 }
 
+// applyUpdate 将请求体写入 model，校验后在事务中持久化
+func (h *BaseHandler[T]) applyUpdate(ctx context.Context, c echo.Context, model *T) error {
+	before := *model
+	columns, err := h.prepareUpdate(c, model)
+	if err != nil {
+		return err
+	}
+	return h.saveUpdate(ctx, model, before, columns)
+}
+
+// UpdateRecord 按字段名（JSON 名称）更新记录，replace 为 true 时未提供的可写字段重置为零值；
+// 与 PUT/PATCH 共用可写字段检查、校验与变更回调
+func (h *BaseHandler[T]) UpdateRecord(ctx context.Context, id uint, body map[string]json.RawMessage, replace bool) (T, error) {
+	return h.updateRecord(ctx, id, body, replace, h.getCacheKey(strconv.FormatUint(uint64(id), 10)), nil)
+}
+
+// updateRecord 按字段名更新记录，check 不为 nil 时在持久化前检查修改前后的记录
+func (h *BaseHandler[T]) updateRecord(ctx context.Context, id uint, body map[string]json.RawMessage, replace bool, cacheKey string, check func(before, after T) error) (T, error) {
+	var model T
+	if err := h.db.WithContext(ctx).Where("deleted_at IS NULL").First(&model, id).Error; err != nil {
+		return model, httpError(err)
+	}
+
+	fields, err := modelFields[T](h.db)
+	if err != nil {
+		return model, echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	before := model
+	columns, err := h.assignBody(fields, &model, body, replace)
+	if err != nil {
+		return model, err
+	}
+	if check != nil {
+		if err := check(before, model); err != nil {
+			return model, err
+		}
+	}
+	if err := h.saveUpdate(ctx, &model, before, columns); err != nil {
+		return model, err
+	}
+
+	h.redis.Del(ctx, cacheKey)
+	h.notify(ctx, Change[T]{Type: ChangeUpdated, ID: model.GetID(), Before: &before, After: &model})
+	return model, nil
+}
+
+// saveUpdate 在事务中持久化 columns 并触发事务内回调，没有变更的列时直接返回
+func (h *BaseHandler[T]) saveUpdate(ctx context.Context, model *T, before T, columns []string) error {
+	if len(columns) == 0 {
+		return nil
+	}
+	err := h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(model).Select(columns).Updates(model).Error; err != nil {
+			return err
+		}
+		return h.notifyTx(tx, Change[T]{Type: ChangeUpdated, ID: (*model).GetID(), Before: &before, After: model})
+	})
+	if err != nil {
+		return httpError(err)
+	}
+	return nil
+}
+
+// prepareUpdate 将请求体写入 model 并校验，返回需要持久化的列名，没有变更时返回空
+// PUT 为整体替换，未提供的可写字段重置为零值；PATCH 根据 Content-Type 选择
+// JSON Merge Patch、JSON Patch 或普通 JSON 的部分更新
+func (h *BaseHandler[T]) prepareUpdate(c echo.Context, model *T) ([]string, error) {
+	fields, err := modelFields[T](h.db)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	data, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+
+	var columns []string
+	switch {
+	case c.Request().Method == http.MethodPatch && (mediaType == MIMEMergePatch || mediaType == MIMEJSONPatch):
+		columns, err = patchFields(fields, model, mediaType, data)
+	case mediaType == "" || mediaType == echo.MIMEApplicationJSON:
+		var body map[string]json.RawMessage
+		if body, err = decodeObject(data); err != nil {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		return h.assignBody(fields, model, body, c.Request().Method == http.MethodPut)
+	default:
+		return nil, echo.NewHTTPError(http.StatusUnsupportedMediaType, fmt.Sprintf("unsupported content type %q", mediaType))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return h.completeUpdate(fields, model, columns)
+}
+
+// assignBody 将 JSON 对象中的可写字段写入 model 并校验，返回需要持久化的列名
+func (h *BaseHandler[T]) assignBody(fields map[string]modelField, model *T, body map[string]json.RawMessage, replace bool) ([]string, error) {
+	if err := checkWritable(fields, body); err != nil {
+		return nil, err
+	}
+	columns, err := assignFields(fields, model, body, replace)
+	if err != nil {
+		return nil, err
+	}
+	return h.completeUpdate(fields, model, columns)
+}
+
+// completeUpdate 校验修改后的 model，有变更时追加 updated_at 列
+func (h *BaseHandler[T]) completeUpdate(fields map[string]modelField, model *T, columns []string) ([]string, error) {
+	if len(columns) == 0 {
+		return nil, nil
+	}
+	if err := h.validate(*model); err != nil {
+		return nil, err
+	}
+	if f, ok := fields["updated_at"]; ok {
+		columns = append(columns, f.Column)
+	}
+	return columns, nil
+}
+
 // Delete 通用软删除方法
 func (h *BaseHandler[T]) Delete(c echo.Context) error {
 	ctx := c.Request().Context()
@@ -188,19 +478,92 @@ func (h *BaseHandler[T]) Delete(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "Invalid ID")
 	}
 
-	var model T
-	if err := h.db.WithContext(ctx).Model(&model).Unscoped().Where("id = ?", intID).Update("deleted_at", time.Now()).Error; err != nil {
+	if err := h.DeleteRecord(ctx, uint(intID)); err != nil {
 		span.RecordError(err)
-		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "Record not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// DeleteRecord 软删除记录、清除缓存并触发变更回调，记录不存在或已删除时返回 gorm.ErrRecordNotFound
+func (h *BaseHandler[T]) DeleteRecord(ctx context.Context, id uint) error {
+	return h.deleteRecord(ctx, id, h.getCacheKey(strconv.FormatUint(uint64(id), 10)))
+}
+
+func (h *BaseHandler[T]) deleteRecord(ctx context.Context, id uint, cacheKey string) error {
+	var model T
+	err := h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model).Unscoped().Where("id = ? AND deleted_at IS NULL", id).Update("deleted_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		// 已删除的记录不重复删除，也不再触发变更回调
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return h.notifyTx(tx, Change[T]{Type: ChangeDeleted, ID: id})
+	})
+	if err != nil {
+		return err
 	}
 
 	// 清除缓存
-	cacheKey := h.getCacheKey(id)
 	h.redis.Del(ctx, cacheKey)
 
+	h.notify(ctx, Change[T]{Type: ChangeDeleted, ID: id})
+	return nil
+}
+
+// Destroy 通用物理删除方法，用于不做软删除的资源
+func (h *BaseHandler[T]) Destroy(c echo.Context) error {
+	ctx := c.Request().Context()
+	tracer := otel.Tracer("api-service")
+	ctx, span := tracer.Start(ctx, "BaseHandler.Destroy")
+	defer span.End()
+
+	intID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		span.RecordError(err)
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid ID")
+	}
+
+	if err := h.DestroyRecord(ctx, uint(intID)); err != nil {
+		span.RecordError(err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "Record not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
 	return c.NoContent(http.StatusNoContent)
 }
 
+// DestroyRecord 物理删除记录、清除缓存并触发变更回调，记录不存在时返回 gorm.ErrRecordNotFound
+func (h *BaseHandler[T]) DestroyRecord(ctx context.Context, id uint) error {
+	var model T
+	err := h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ?", id).Delete(&model)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return h.notifyTx(tx, Change[T]{Type: ChangeDeleted, ID: id})
+	})
+	if err != nil {
+		return err
+	}
+
+	h.redis.Del(ctx, h.getCacheKey(strconv.FormatUint(uint64(id), 10)))
+	h.notify(ctx, Change[T]{Type: ChangeDeleted, ID: id})
+	return nil
+}
+
 // Restore 通用恢复方法
 func (h *BaseHandler[T]) Restore(c echo.Context) error {
 	ctx := c.Request().Context()
@@ -215,11 +578,35 @@ func (h *BaseHandler[T]) Restore(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "Invalid ID")
 	}
 
-	var model T
-	if err := h.db.WithContext(ctx).Model(&model).Unscoped().Where("id = ?", intID).Update("deleted_at", nil).Error; err != nil {
+	if err := h.RestoreRecord(ctx, uint(intID)); err != nil {
 		span.RecordError(err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "Record not found")
+		}
 		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
 
 	return c.NoContent(http.StatusOK)
 }
+
+// RestoreRecord 恢复软删除的记录并触发变更回调，记录不存在或未删除时返回 gorm.ErrRecordNotFound
+func (h *BaseHandler[T]) RestoreRecord(ctx context.Context, id uint) error {
+	var model T
+	err := h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model).Unscoped().Where("id = ? AND deleted_at IS NOT NULL", id).Update("deleted_at", nil)
+		if result.Error != nil {
+			return result.Error
+		}
+		// 未删除的记录不需要恢复，也不触发变更回调
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return h.notifyTx(tx, Change[T]{Type: ChangeRestored, ID: id})
+	})
+	if err != nil {
+		return err
+	}
+
+	h.notify(ctx, Change[T]{Type: ChangeRestored, ID: id})
+	return nil
+}
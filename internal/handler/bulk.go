@@ -0,0 +1,343 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"gorm.io/gorm"
+)
+
+const (
+	// BulkModeAtomic 全部操作在同一事务中执行，任一失败则整体回滚
+	BulkModeAtomic = "atomic"
+	// BulkModePartial 每个操作独立执行，返回逐条结果
+	BulkModePartial = "partial"
+
+	bulkMaxOperations = 1000
+	bulkBatchSize     = 100
+)
+
+// BulkOperation 批量请求中的单个操作
+type BulkOperation struct {
+	Op   string          `json:"op"`
+	ID   uint            `json:"id,omitempty"`
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// BulkRequest 批量操作请求
+type BulkRequest struct {
+	Mode       string          `json:"mode"`
+	Operations []BulkOperation `json:"operations"`
+}
+
+// BulkResult 单个操作的执行结果
+type BulkResult struct {
+	Index  int         `json:"index"`
+	Op     string      `json:"op"`
+	ID     uint        `json:"id,omitempty"`
+	Status int         `json:"status"`
+	Error  interface{} `json:"error,omitempty"`
+}
+
+// BulkResponse 批量操作响应
+type BulkResponse struct {
+	Mode      string       `json:"mode"`
+	Succeeded int          `json:"succeeded"`
+	Failed    int          `json:"failed"`
+	Results   []BulkResult `json:"results"`
+}
+
+// Bulk 通用批量创建、更新、删除方法
+func (h *BaseHandler[T]) Bulk(c echo.Context) error {
+	ctx := c.Request().Context()
+	tracer := otel.Tracer("api-service")
+	ctx, span := tracer.Start(ctx, "BaseHandler.Bulk")
+	span.SetAttributes(attribute.String("Request-ID", c.Response().Header().Get("X-Request-ID")))
+	defer span.End()
+
+	var req BulkRequest
+	if err := c.Bind(&req); err != nil {
+		span.RecordError(err)
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	if req.Mode == "" {
+		req.Mode = BulkModeAtomic
+	}
+	if req.Mode != BulkModeAtomic && req.Mode != BulkModePartial {
+		return echo.NewHTTPError(http.StatusBadRequest, "mode must be one of atomic, partial")
+	}
+	if len(req.Operations) == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "operations must not be empty")
+	}
+	if len(req.Operations) > bulkMaxOperations {
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge, fmt.Sprintf("at most %d operations are allowed", bulkMaxOperations))
+	}
+	span.SetAttributes(
+		attribute.String("bulk.mode", req.Mode),
+		attribute.Int("bulk.operations", len(req.Operations)),
+	)
+
+	fields, err := modelFields[T](h.db)
+	if err != nil {
+		span.RecordError(err)
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	ops := req.Operations
+	results := make([]BulkResult, len(ops))
+	for i, op := range ops {
+		results[i] = BulkResult{Index: i, Op: op.Op, ID: op.ID}
+	}
+
+	status := http.StatusOK
+	var changes []Change[T]
+	if req.Mode == BulkModeAtomic {
+		var pending []Change[T]
+		err = h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			for start := 0; start < len(ops); start += bulkBatchSize {
+				end := min(start+bulkBatchSize, len(ops))
+				if err := h.bulkBatch(tx, fields, ops[start:end], results[start:end], &pending); err != nil {
+					return err
+				}
+			}
+			return h.notifyTx(tx, pending...)
+		})
+		if err != nil {
+			span.RecordError(err)
+			status = http.StatusInternalServerError
+			var httpErr *echo.HTTPError
+			if errors.As(err, &httpErr) {
+				status = httpErr.Code
+			}
+			// 事务已回滚，其余操作均未生效
+			for i := range results {
+				if results[i].Error == nil {
+					results[i].Status = http.StatusFailedDependency
+					results[i].Error = "transaction rolled back"
+					if results[i].Op == "create" {
+						results[i].ID = 0
+					}
+				}
+			}
+		} else {
+			changes = pending
+		}
+	} else {
+		for i := range ops {
+			var pending []Change[T]
+			err := h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+				if err := h.bulkItem(tx, fields, ops[i], results[i:i+1], &pending); err != nil {
+					return err
+				}
+				if err := h.notifyTx(tx, pending...); err != nil {
+					return setBulkError(&results[i], err)
+				}
+				return nil
+			})
+			if err != nil {
+				span.RecordError(err)
+				status = http.StatusMultiStatus
+				continue
+			}
+			changes = append(changes, pending...)
+		}
+	}
+
+	resp := BulkResponse{Mode: req.Mode, Results: results}
+	for start := 0; start < len(results); start += bulkBatchSize {
+		end := min(start+bulkBatchSize, len(results))
+		var keys []string
+		for _, r := range results[start:end] {
+			if r.Error != nil {
+				resp.Failed++
+				continue
+			}
+			resp.Succeeded++
+			if key := h.getCacheKey(fmt.Sprint(r.ID)); r.Op != "create" && !slices.Contains(keys, key) {
+				keys = append(keys, key)
+			}
+		}
+		// 每个批次只清除一次缓存
+		if len(keys) > 0 {
+			h.redis.Del(ctx, keys...)
+		}
+	}
+	h.notify(ctx, changes...)
+
+	return c.JSON(status, resp)
+}
+
+// bulkBatch 在事务中执行一个批次，连续的创建与删除操作合并为批量语句，
+// 成功的变更追加到 changes，由调用方在事务提交前后分别通知
+func (h *BaseHandler[T]) bulkBatch(tx *gorm.DB, fields map[string]modelField, ops []BulkOperation, results []BulkResult, changes *[]Change[T]) error {
+	for i := 0; i < len(ops); {
+		j := i + 1
+		for j < len(ops) && ops[j].Op == ops[i].Op {
+			j++
+		}
+
+		var err error
+		switch ops[i].Op {
+		case "create":
+			err = h.bulkCreate(tx, fields, ops[i:j], results[i:j], changes)
+		case "delete":
+			err = h.bulkDelete(tx, ops[i:j], results[i:j], changes)
+		default:
+			for k := i; k < j && err == nil; k++ {
+				err = h.bulkItem(tx, fields, ops[k], results[k:k+1], changes)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		i = j
+	}
+	return nil
+}
+
+// bulkItem 执行单个操作并将结果写入 results[0]
+func (h *BaseHandler[T]) bulkItem(tx *gorm.DB, fields map[string]modelField, op BulkOperation, results []BulkResult, changes *[]Change[T]) error {
+	result := &results[0]
+	switch op.Op {
+	case "create":
+		return h.bulkCreate(tx, fields, []BulkOperation{op}, results, changes)
+	case "update":
+		var model T
+		if op.ID == 0 {
+			return setBulkError(result, echo.NewHTTPError(http.StatusBadRequest, "id is required"))
+		}
+		if err := tx.Where("deleted_at IS NULL").First(&model, op.ID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return setBulkError(result, echo.NewHTTPError(http.StatusNotFound, "Record not found"))
+			}
+			return setBulkError(result, echo.NewHTTPError(http.StatusInternalServerError, err.Error()))
+		}
+		before := model
+		body, err := decodeObject(op.Data)
+		if err != nil {
+			return setBulkError(result, echo.NewHTTPError(http.StatusBadRequest, err.Error()))
+		}
+		if err := checkWritable(fields, body); err != nil {
+			return setBulkError(result, err)
+		}
+		columns, err := assignFields(fields, &model, body, false)
+		if err != nil {
+			return setBulkError(result, err)
+		}
+		if err := h.validate(model); err != nil {
+			return setBulkError(result, err)
+		}
+		if len(columns) > 0 {
+			if f, ok := fields["updated_at"]; ok {
+				columns = append(columns, f.Column)
+			}
+			if err := tx.Model(&model).Select(columns).Updates(&model).Error; err != nil {
+				return setBulkError(result, echo.NewHTTPError(http.StatusInternalServerError, err.Error()))
+			}
+		}
+		result.Status = http.StatusOK
+		*changes = append(*changes, Change[T]{Type: ChangeUpdated, ID: op.ID, Before: &before, After: &model})
+		return nil
+	case "delete":
+		return h.bulkDelete(tx, []BulkOperation{op}, results, changes)
+	default:
+		return setBulkError(result, echo.NewHTTPError(http.StatusBadRequest, "op must be one of create, update, delete"))
+	}
+}
+
+// bulkCreate 校验并批量插入新记录。批量语句失败时逐条重试以定位失败的操作，
+// 调用方会回滚整个事务，重试中已插入的记录不会生效
+func (h *BaseHandler[T]) bulkCreate(tx *gorm.DB, fields map[string]modelField, ops []BulkOperation, results []BulkResult, changes *[]Change[T]) error {
+	models := make([]T, len(ops))
+	for i, op := range ops {
+		body, err := decodeObject(op.Data)
+		if err != nil {
+			return setBulkError(&results[i], echo.NewHTTPError(http.StatusBadRequest, err.Error()))
+		}
+		if err := checkCreatable(fields, body); err != nil {
+			return setBulkError(&results[i], err)
+		}
+		if err := json.Unmarshal(op.Data, &models[i]); err != nil {
+			return setBulkError(&results[i], echo.NewHTTPError(http.StatusBadRequest, err.Error()))
+		}
+		if err := h.validate(models[i]); err != nil {
+			return setBulkError(&results[i], err)
+		}
+	}
+
+	if err := tx.CreateInBatches(&models, bulkBatchSize).Error; err != nil {
+		for i := range models {
+			if rowErr := tx.Create(&models[i]).Error; rowErr != nil {
+				return setBulkError(&results[i], echo.NewHTTPError(http.StatusInternalServerError, rowErr.Error()))
+			}
+		}
+		return setBulkError(&results[0], echo.NewHTTPError(http.StatusInternalServerError, err.Error()))
+	}
+	for i := range models {
+		results[i].ID = models[i].GetID()
+		results[i].Status = http.StatusCreated
+		*changes = append(*changes, Change[T]{Type: ChangeCreated, ID: models[i].GetID(), After: &models[i]})
+	}
+	return nil
+}
+
+// bulkDelete 批量软删除记录，不存在的记录视为失败；重复的 ID 只删除一次，也只产生一次变更
+func (h *BaseHandler[T]) bulkDelete(tx *gorm.DB, ops []BulkOperation, results []BulkResult, changes *[]Change[T]) error {
+	ids := make([]uint, 0, len(ops))
+	seen := make(map[uint]bool, len(ops))
+	for i, op := range ops {
+		if op.ID == 0 {
+			return setBulkError(&results[i], echo.NewHTTPError(http.StatusBadRequest, "id is required"))
+		}
+		if !seen[op.ID] {
+			seen[op.ID] = true
+			ids = append(ids, op.ID)
+		}
+	}
+
+	var model T
+	var existing []uint
+	if err := tx.Model(&model).Where("id IN ? AND deleted_at IS NULL", ids).Pluck("id", &existing).Error; err != nil {
+		return setBulkError(&results[0], echo.NewHTTPError(http.StatusInternalServerError, err.Error()))
+	}
+	found := make(map[uint]bool, len(existing))
+	for _, id := range existing {
+		found[id] = true
+	}
+	for i, op := range ops {
+		if !found[op.ID] {
+			return setBulkError(&results[i], echo.NewHTTPError(http.StatusNotFound, "Record not found"))
+		}
+	}
+
+	if err := tx.Model(&model).Unscoped().Where("id IN ?", ids).Update("deleted_at", time.Now()).Error; err != nil {
+		return setBulkError(&results[0], echo.NewHTTPError(http.StatusInternalServerError, err.Error()))
+	}
+	for i := range results {
+		results[i].Status = http.StatusNoContent
+	}
+	for _, id := range ids {
+		*changes = append(*changes, Change[T]{Type: ChangeDeleted, ID: id})
+	}
+	return nil
+}
+
+// setBulkError 记录操作失败的状态码与错误信息
+func setBulkError(result *BulkResult, err error) error {
+	err = duplicateKeyError(err)
+	result.Status = http.StatusInternalServerError
+	result.Error = err.Error()
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		result.Status = httpErr.Code
+		result.Error = httpErr.Message
+	}
+	return err
+}
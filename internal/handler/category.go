@@ -0,0 +1,412 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Category 产品分类，层级关系同时保存在 parent_id 与闭包表中
+type Category struct {
+	ID          uint        `json:"id" gorm:"primaryKey"`
+	Name        string      `json:"name" gorm:"not null"`
+	Slug        *string     `json:"slug" gorm:"size:191;uniqueIndex"`
+	Description string      `json:"description"`
+	ParentID    *uint       `json:"parent_id" gorm:"index"`
+	CreatedAt   time.Time   `json:"created_at"`
+	UpdatedAt   time.Time   `json:"updated_at"`
+	DeletedAt   *time.Time  `json:"deleted_at,omitempty" gorm:"index"`
+	Children    []*Category `json:"children,omitempty" gorm:"-"`
+}
+
+// GetID 实现 Model 接口
+func (c Category) GetID() uint {
+	return c.ID
+}
+
+// TableName 实现 Model 接口
+func (c Category) TableName() string {
+	return "categories"
+}
+
+// WritableFields 实现 WritableModel 接口，父分类只能通过 move 修改
+func (c Category) WritableFields() []string {
+	return []string{"name", "slug", "description"}
+}
+
+// Validate 实现 Validator 接口
+func (c Category) Validate() error {
+	if c.Name == "" {
+		return errors.New("name is required")
+	}
+	return nil
+}
+
+// BeforeSave 空 slug 保存为 NULL，唯一索引允许多个分类不设置 slug
+func (c *Category) BeforeSave(tx *gorm.DB) error {
+	if c.Slug != nil && *c.Slug == "" {
+		c.Slug = nil
+	}
+	return nil
+}
+
+// AfterCreate 为新分类写入闭包表：自身一行，以及父分类的每个祖先一行
+func (c *Category) AfterCreate(tx *gorm.DB) error {
+	if c.ParentID != nil {
+		result := tx.Exec("INSERT INTO category_closure (ancestor_id, descendant_id, depth) "+
+			"SELECT ancestor_id, ?, depth + 1 FROM category_closure WHERE descendant_id = ?", c.ID, *c.ParentID)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("parent category %d not found", *c.ParentID)
+		}
+	}
+	return tx.Create(&CategoryClosure{AncestorID: c.ID, DescendantID: c.ID}).Error
+}
+
+// CategoryClosure 分类闭包表，每对祖先与后代（含自身，depth 为 0）一行
+type CategoryClosure struct {
+	AncestorID   uint `gorm:"primaryKey;autoIncrement:false"`
+	DescendantID uint `gorm:"primaryKey;autoIncrement:false;index"`
+	Depth        int  `gorm:"not null"`
+}
+
+// TableName 指定表名
+func (CategoryClosure) TableName() string {
+	return "category_closure"
+}
+
+// Tag 自由标签，与产品多对多关联
+type Tag struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	Name      string     `json:"name" gorm:"size:191;not null;uniqueIndex"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty" gorm:"index"`
+}
+
+// GetID 实现 Model 接口
+func (t Tag) GetID() uint {
+	return t.ID
+}
+
+// TableName 实现 Model 接口
+func (t Tag) TableName() string {
+	return "tags"
+}
+
+// WritableFields 实现 WritableModel 接口
+func (t Tag) WritableFields() []string {
+	return []string{"name"}
+}
+
+// Validate 实现 Validator 接口
+func (t Tag) Validate() error {
+	if normalizeTag(t.Name) == "" {
+		return errors.New("name is required")
+	}
+	return nil
+}
+
+// BeforeSave 标签名统一为去除首尾空白的小写形式
+func (t *Tag) BeforeSave(tx *gorm.DB) error {
+	t.Name = normalizeTag(t.Name)
+	return nil
+}
+
+func normalizeTag(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// CategoryHandler 分类处理器
+type CategoryHandler struct {
+	*BaseHandler[Category]
+}
+
+// NewCategoryHandler 创建分类处理器
+func NewCategoryHandler(db *gorm.DB, redis *redis.Client) *CategoryHandler {
+	return &CategoryHandler{
+		BaseHandler: NewBaseHandler[Category](db, redis),
+	}
+}
+
+// TagHandler 标签处理器
+type TagHandler struct {
+	*BaseHandler[Tag]
+}
+
+// NewTagHandler 创建标签处理器
+func NewTagHandler(db *gorm.DB, redis *redis.Client) *TagHandler {
+	return &TagHandler{
+		BaseHandler: NewBaseHandler[Tag](db, redis),
+	}
+}
+
+type moveRequest struct {
+	ParentID *uint `json:"parent_id"`
+}
+
+// Move 将分类及其整个子树移动到新的父分类下，parent_id 为 null 时移动为根分类
+func (h *CategoryHandler) Move(c echo.Context) error {
+	ctx := c.Request().Context()
+	tracer := otel.Tracer("api-service")
+	ctx, span := tracer.Start(ctx, "CategoryHandler.Move")
+	span.SetAttributes(attribute.String("Request-ID", c.Response().Header().Get("X-Request-ID")))
+	defer span.End()
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid ID")
+	}
+	var req moveRequest
+	if err := c.Bind(&req); err != nil {
+		span.RecordError(err)
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	var category Category
+	err = h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("deleted_at IS NULL").First(&category, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return echo.NewHTTPError(http.StatusNotFound, "Category not found")
+			}
+			return err
+		}
+
+		// 锁定被移动子树与新父分类所在路径的闭包行，并发移动不能交叉形成环
+		var subtree []uint
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Model(&CategoryClosure{}).
+			Where("ancestor_id = ?", id).Pluck("descendant_id", &subtree).Error; err != nil {
+			return err
+		}
+		if req.ParentID != nil {
+			for _, d := range subtree {
+				if d == *req.ParentID {
+					return echo.NewHTTPError(http.StatusConflict, "cannot move a category under itself or its descendants")
+				}
+			}
+			var parent Category
+			if err := tx.Where("deleted_at IS NULL").First(&parent, *req.ParentID).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return echo.NewHTTPError(http.StatusNotFound, "Parent category not found")
+				}
+				return err
+			}
+			var ancestors []uint
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Model(&CategoryClosure{}).
+				Where("descendant_id = ?", *req.ParentID).Pluck("ancestor_id", &ancestors).Error; err != nil {
+				return err
+			}
+			if slices.Contains(ancestors, uint(id)) {
+				return echo.NewHTTPError(http.StatusConflict, "cannot move a category under itself or its descendants")
+			}
+		}
+
+		// 断开子树与原祖先的关系
+		if err := tx.Where("descendant_id IN ? AND ancestor_id NOT IN ?", subtree, subtree).Delete(&CategoryClosure{}).Error; err != nil {
+			return err
+		}
+		// 将新父分类的每个祖先与子树的每个节点相连
+		if req.ParentID != nil {
+			if err := tx.Exec("INSERT INTO category_closure (ancestor_id, descendant_id, depth) "+
+				"SELECT p.ancestor_id, s.descendant_id, p.depth + s.depth + 1 "+
+				"FROM category_closure p CROSS JOIN category_closure s "+
+				"WHERE p.descendant_id = ? AND s.ancestor_id = ?", *req.ParentID, id).Error; err != nil {
+				return err
+			}
+		}
+		category.ParentID = req.ParentID
+		if err := tx.Model(&category).Update("parent_id", req.ParentID).Error; err != nil {
+			return err
+		}
+		return h.notifyTx(tx, Change[Category]{Type: ChangeUpdated, ID: category.ID, After: &category})
+	})
+	if err != nil {
+		span.RecordError(err)
+		return httpError(err)
+	}
+
+	h.redis.Del(ctx, h.getCacheKey(strconv.FormatUint(id, 10)))
+	h.notify(ctx, Change[Category]{Type: ChangeUpdated, ID: category.ID, After: &category})
+	return c.JSON(http.StatusOK, category)
+}
+
+// Tree 返回未删除分类组成的树
+func (h *CategoryHandler) Tree(c echo.Context) error {
+	ctx := c.Request().Context()
+	tracer := otel.Tracer("api-service")
+	ctx, span := tracer.Start(ctx, "CategoryHandler.Tree")
+	span.SetAttributes(attribute.String("Request-ID", c.Response().Header().Get("X-Request-ID")))
+	defer span.End()
+
+	var categories []*Category
+	if err := h.db.WithContext(ctx).Where("deleted_at IS NULL").Order("name").Find(&categories).Error; err != nil {
+		span.RecordError(err)
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	byID := make(map[uint]*Category, len(categories))
+	for _, cat := range categories {
+		byID[cat.ID] = cat
+	}
+	roots := []*Category{}
+	for _, cat := range categories {
+		// 父分类被删除时子分类作为根节点展示
+		if parent, ok := byID[derefID(cat.ParentID)]; ok && cat.ParentID != nil {
+			parent.Children = append(parent.Children, cat)
+		} else {
+			roots = append(roots, cat)
+		}
+	}
+	return c.JSON(http.StatusOK, roots)
+}
+
+// Products 列出分类及其所有子分类下的产品
+func (h *CategoryHandler) Products(c echo.Context) error {
+	ctx := c.Request().Context()
+	tracer := otel.Tracer("api-service")
+	ctx, span := tracer.Start(ctx, "CategoryHandler.Products")
+	span.SetAttributes(attribute.String("Request-ID", c.Response().Header().Get("X-Request-ID")))
+	defer span.End()
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid ID")
+	}
+
+	products := []Product{}
+	if err := categoryScope(h.db.WithContext(ctx), uint(id)).Where("deleted_at IS NULL").Find(&products).Error; err != nil {
+		span.RecordError(err)
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, products)
+}
+
+// categoryScope 限定为分类及其子分类下的产品
+func categoryScope(query *gorm.DB, categoryID uint) *gorm.DB {
+	return query.Where("category_id IN (?)",
+		query.Session(&gorm.Session{NewDB: true}).Model(&CategoryClosure{}).Select("descendant_id").Where("ancestor_id = ?", categoryID))
+}
+
+func derefID(id *uint) uint {
+	if id == nil {
+		return 0
+	}
+	return *id
+}
+
+// filterProducts 支持按 category（含子分类）与 tag（逗号分隔，任一匹配）过滤产品列表
+func filterProducts(c echo.Context, query *gorm.DB) (*gorm.DB, error) {
+	if v := c.QueryParam("category"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, "category must be a category ID")
+		}
+		query = categoryScope(query, uint(id))
+	}
+	if v := c.QueryParam("tag"); v != "" {
+		names := tagNames(strings.Split(v, ","))
+		if len(names) == 0 {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, "tag must not be empty")
+		}
+		query = query.Where("id IN (?)", query.Session(&gorm.Session{NewDB: true}).
+			Table("product_tags").
+			Select("product_tags.product_id").
+			Joins("JOIN tags ON tags.id = product_tags.tag_id").
+			Where("tags.name IN ? AND tags.deleted_at IS NULL", names))
+	}
+	return query, nil
+}
+
+// tagNames 规范化并去重标签名
+func tagNames(raw []string) []string {
+	seen := make(map[string]bool, len(raw))
+	names := make([]string, 0, len(raw))
+	for _, name := range raw {
+		name = normalizeTag(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names
+}
+
+type tagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+// SetTags 替换产品的全部标签，不存在的标签会自动创建，已删除的标签返回 409
+func (h *ProductHandler) SetTags(c echo.Context) error {
+	ctx := c.Request().Context()
+	tracer := otel.Tracer("api-service")
+	ctx, span := tracer.Start(ctx, "ProductHandler.SetTags")
+	span.SetAttributes(attribute.String("Request-ID", c.Response().Header().Get("X-Request-ID")))
+	defer span.End()
+
+	productID, err := productIDParam(c)
+	if err != nil {
+		return err
+	}
+	var req tagsRequest
+	if err := c.Bind(&req); err != nil {
+		span.RecordError(err)
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	names := tagNames(req.Tags)
+
+	tags := []Tag{}
+	err = h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := productExists(tx, productID); err != nil {
+			return err
+		}
+		if len(names) > 0 {
+			if err := tx.Where("name IN ?", names).Find(&tags).Error; err != nil {
+				return err
+			}
+			// 名称唯一，已删除的标签不能重新创建，需要先恢复
+			existing := make(map[string]bool, len(tags))
+			for _, tag := range tags {
+				if tag.DeletedAt != nil {
+					return echo.NewHTTPError(http.StatusConflict, fmt.Sprintf("tag %q has been deleted", tag.Name))
+				}
+				existing[tag.Name] = true
+			}
+			for _, name := range names {
+				if existing[name] {
+					continue
+				}
+				tag := Tag{Name: name}
+				if err := tx.Create(&tag).Error; err != nil {
+					return err
+				}
+				tags = append(tags, tag)
+			}
+		}
+		if err := tx.Model(&Product{ID: productID}).Association("Tags").Replace(tags); err != nil {
+			return err
+		}
+		return h.notifyTx(tx, Change[Product]{Type: ChangeUpdated, ID: productID})
+	})
+	if err != nil {
+		span.RecordError(err)
+		return httpError(err)
+	}
+
+	h.redis.Del(ctx, h.getCacheKey(strconv.FormatUint(uint64(productID), 10)))
+	h.notify(ctx, Change[Product]{Type: ChangeUpdated, ID: productID})
+	return c.JSON(http.StatusOK, tags)
+}
@@ -0,0 +1,367 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-redis/redismock/v8"
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func setupCategoryTest(t *testing.T) (*echo.Echo, *CategoryHandler, sqlmock.Sqlmock, redismock.ClientMock) {
+	e := echo.New()
+
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+
+	gormDB, err := gorm.Open(mysql.New(mysql.Config{
+		Conn:                      db,
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{})
+	require.NoError(t, err)
+
+	redisMock, redisMockClient := redismock.NewClientMock()
+
+	return e, NewCategoryHandler(gormDB, redisMock), mock, redisMockClient
+}
+
+func TestCategory(t *testing.T) {
+	e, handler, mock, redisMock := setupCategoryTest(t)
+
+	newMoveContext := func(id, body string) (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetPath("/categories/:id/move")
+		c.SetParamNames("id")
+		c.SetParamValues(id)
+		return c, rec
+	}
+
+	expectCategory := func(id int, parentID interface{}) {
+		mock.ExpectQuery("SELECT \\* FROM `categories` WHERE deleted_at IS NULL AND `categories`\\.`id` = \\?").
+			WithArgs(id, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "parent_id"}).AddRow(id, "Category", parentID))
+	}
+
+	t.Run("创建子分类写入闭包表", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/categories", strings.NewReader(`{"name":"Phones","slug":"phones","parent_id":1}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO `categories`").WillReturnResult(sqlmock.NewResult(2, 1))
+		mock.ExpectExec("INSERT INTO category_closure \\(ancestor_id, descendant_id, depth\\) SELECT ancestor_id, \\?, depth \\+ 1 FROM category_closure WHERE descendant_id = \\?").
+			WithArgs(2, 1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO `category_closure` \\(`ancestor_id`,`descendant_id`,`depth`\\)").
+			WithArgs(2, 2, 0).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		require.NoError(t, handler.Create(c))
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("未设置slug时保存为NULL", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/categories", strings.NewReader(`{"name":"Misc","slug":""}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO `categories` \\(`name`,`slug`,").
+			WithArgs("Misc", nil, "", nil, sqlmock.AnyArg(), sqlmock.AnyArg(), nil).
+			WillReturnResult(sqlmock.NewResult(4, 1))
+		mock.ExpectExec("INSERT INTO `category_closure`").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		require.NoError(t, handler.Create(c))
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"slug":null`)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("slug重复时返回409", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/categories", strings.NewReader(`{"name":"Phones","slug":"phones"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO `categories`").
+			WillReturnError(&mysqldriver.MySQLError{Number: 1062, Message: "Duplicate entry 'phones' for key 'idx_categories_slug'"})
+		mock.ExpectRollback()
+
+		err := handler.Create(c)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusConflict, err.(*echo.HTTPError).Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("父分类不存在时创建失败", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/categories", strings.NewReader(`{"name":"Orphan","parent_id":99}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO `categories`").WillReturnResult(sqlmock.NewResult(3, 1))
+		mock.ExpectExec("INSERT INTO category_closure").
+			WithArgs(3, 99).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		require.NoError(t, handler.Create(c))
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+		assert.Contains(t, rec.Body.String(), "parent category 99 not found")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("移动子树到新父分类", func(t *testing.T) {
+		c, rec := newMoveContext("2", `{"parent_id":5}`)
+
+		mock.ExpectBegin()
+		expectCategory(2, 1)
+		mock.ExpectQuery("SELECT `descendant_id` FROM `category_closure` WHERE ancestor_id = \\? FOR UPDATE").
+			WithArgs(2).
+			WillReturnRows(sqlmock.NewRows([]string{"descendant_id"}).AddRow(2).AddRow(3))
+		expectCategory(5, nil)
+		mock.ExpectQuery("SELECT `ancestor_id` FROM `category_closure` WHERE descendant_id = \\? FOR UPDATE").
+			WithArgs(5).
+			WillReturnRows(sqlmock.NewRows([]string{"ancestor_id"}).AddRow(5))
+		mock.ExpectExec("DELETE FROM `category_closure` WHERE descendant_id IN \\(\\?,\\?\\) AND ancestor_id NOT IN \\(\\?,\\?\\)").
+			WithArgs(2, 3, 2, 3).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectExec("INSERT INTO category_closure .+ FROM category_closure p CROSS JOIN category_closure s WHERE p.descendant_id = \\? AND s.ancestor_id = \\?").
+			WithArgs(5, 2).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectExec("UPDATE `categories` SET `parent_id`=\\?,`updated_at`=\\? WHERE `id` = \\?").
+			WithArgs(5, sqlmock.AnyArg(), 2).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		redisMock.ExpectDel("categories:2").SetVal(1)
+
+		require.NoError(t, handler.Move(c))
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var response Category
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		require.NotNil(t, response.ParentID)
+		assert.Equal(t, uint(5), *response.ParentID)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("不能移动到自身子树下", func(t *testing.T) {
+		c, _ := newMoveContext("2", `{"parent_id":3}`)
+
+		mock.ExpectBegin()
+		expectCategory(2, 1)
+		mock.ExpectQuery("SELECT `descendant_id` FROM `category_closure` WHERE ancestor_id = \\? FOR UPDATE").
+			WithArgs(2).
+			WillReturnRows(sqlmock.NewRows([]string{"descendant_id"}).AddRow(2).AddRow(3))
+		mock.ExpectRollback()
+
+		err := handler.Move(c)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusConflict, err.(*echo.HTTPError).Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("并发移动后新父分类已在子树下", func(t *testing.T) {
+		c, _ := newMoveContext("2", `{"parent_id":5}`)
+
+		mock.ExpectBegin()
+		expectCategory(2, 1)
+		mock.ExpectQuery("SELECT `descendant_id` FROM `category_closure` WHERE ancestor_id = \\? FOR UPDATE").
+			WithArgs(2).
+			WillReturnRows(sqlmock.NewRows([]string{"descendant_id"}).AddRow(2))
+		expectCategory(5, 2)
+		// 加锁读取到并发事务已提交的 5 -> 2 关系
+		mock.ExpectQuery("SELECT `ancestor_id` FROM `category_closure` WHERE descendant_id = \\? FOR UPDATE").
+			WithArgs(5).
+			WillReturnRows(sqlmock.NewRows([]string{"ancestor_id"}).AddRow(5).AddRow(2))
+		mock.ExpectRollback()
+
+		err := handler.Move(c)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusConflict, err.(*echo.HTTPError).Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("移动为根分类", func(t *testing.T) {
+		c, rec := newMoveContext("2", `{"parent_id":null}`)
+
+		mock.ExpectBegin()
+		expectCategory(2, 1)
+		mock.ExpectQuery("SELECT `descendant_id` FROM `category_closure` .+ FOR UPDATE").
+			WillReturnRows(sqlmock.NewRows([]string{"descendant_id"}).AddRow(2))
+		mock.ExpectExec("DELETE FROM `category_closure`").
+			WithArgs(2, 2).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("UPDATE `categories` SET `parent_id`=\\?").
+			WithArgs(nil, sqlmock.AnyArg(), 2).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		redisMock.ExpectDel("categories:2").SetVal(1)
+
+		require.NoError(t, handler.Move(c))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("分类树", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/categories/tree", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mock.ExpectQuery("SELECT \\* FROM `categories` WHERE deleted_at IS NULL ORDER BY name").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "parent_id"}).
+				AddRow(1, "Electronics", nil).
+				AddRow(3, "Laptops", 1).
+				AddRow(2, "Phones", 1).
+				AddRow(4, "Smart", 2))
+
+		require.NoError(t, handler.Tree(c))
+		var roots []Category
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &roots))
+		require.Len(t, roots, 1)
+		require.Len(t, roots[0].Children, 2)
+		assert.Equal(t, "Laptops", roots[0].Children[0].Name)
+		assert.Equal(t, "Smart", roots[0].Children[1].Children[0].Name)
+	})
+
+	t.Run("分类下产品包含子分类", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetPath("/categories/:id/products")
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+
+		mock.ExpectQuery("SELECT \\* FROM `products` WHERE category_id IN \\(SELECT `descendant_id` FROM `category_closure` WHERE ancestor_id = \\?\\) AND deleted_at IS NULL").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "category_id"}).AddRow(10, "Phone", 2))
+
+		require.NoError(t, handler.Products(c))
+		var products []Product
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &products))
+		require.Len(t, products, 1)
+		assert.Equal(t, uint(2), *products[0].CategoryID)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestProductCategoryAndTags(t *testing.T) {
+	e, handler, mock, redisMock := setupProductTest(t)
+	var changes []Change[Product]
+	handler.OnChange(func(ctx context.Context, change Change[Product]) {
+		changes = append(changes, change)
+	})
+
+	t.Run("按分类与标签过滤列表", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/products?category=1&tag=Sale,+new,sale", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mock.ExpectQuery("SELECT \\* FROM `products` WHERE deleted_at IS NULL AND category_id IN \\(SELECT `descendant_id` FROM `category_closure` WHERE ancestor_id = \\?\\) "+
+			"AND id IN \\(SELECT product_tags.product_id FROM `product_tags` JOIN tags ON tags.id = product_tags.tag_id WHERE tags.name IN \\(\\?,\\?\\) AND tags.deleted_at IS NULL\\)").
+			WithArgs(1, "sale", "new").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "Phone"))
+
+		require.NoError(t, handler.List(c))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("非法分类参数", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/products?category=abc", nil)
+		c := e.NewContext(req, httptest.NewRecorder())
+
+		err := handler.List(c)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	})
+
+	t.Run("替换产品标签并创建新标签", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"tags":["Sale"," new ","sale"]}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetPath("/products/:id/tags")
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+
+		now := time.Now()
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT count\\(\\*\\) FROM `products`").
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectQuery("SELECT \\* FROM `tags` WHERE name IN \\(\\?,\\?\\)").
+			WithArgs("sale", "new").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "created_at", "updated_at"}).AddRow(7, "sale", now, now))
+		mock.ExpectExec("INSERT INTO `tags`").
+			WithArgs("new", sqlmock.AnyArg(), sqlmock.AnyArg(), nil).
+			WillReturnResult(sqlmock.NewResult(8, 1))
+		mock.ExpectExec("UPDATE `products` SET `updated_at`=\\? WHERE `id` = \\?").
+			WithArgs(sqlmock.AnyArg(), 1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO `tags`").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("INSERT INTO `product_tags` \\(`product_id`,`tag_id`\\)").
+			WithArgs(1, 7, 1, 8).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectExec("DELETE FROM `product_tags` WHERE `product_tags`\\.`product_id` = \\? AND `product_tags`\\.`tag_id` NOT IN \\(\\?,\\?\\)").
+			WithArgs(1, 7, 8).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		redisMock.ExpectDel("products:1").SetVal(1)
+
+		require.NoError(t, handler.SetTags(c))
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var tags []Tag
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &tags))
+		require.Len(t, tags, 2)
+		assert.Equal(t, "new", tags[1].Name)
+		assert.Equal(t, []Change[Product]{{Type: ChangeUpdated, ID: 1}}, changes)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("已删除的标签不能关联", func(t *testing.T) {
+		changes = nil
+		req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"tags":["sale"]}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		c := e.NewContext(req, httptest.NewRecorder())
+		c.SetPath("/products/:id/tags")
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+
+		now := time.Now()
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT count\\(\\*\\) FROM `products`").
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectQuery("SELECT \\* FROM `tags` WHERE name IN \\(\\?\\)").
+			WithArgs("sale").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "created_at", "updated_at", "deleted_at"}).AddRow(7, "sale", now, now, now))
+		mock.ExpectRollback()
+
+		err := handler.SetTags(c)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusConflict, err.(*echo.HTTPError).Code)
+		assert.Empty(t, changes)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
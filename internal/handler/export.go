@@ -0,0 +1,259 @@
+package handler
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	exportFlushRows = 500
+	redactedValue   = "[REDACTED]"
+)
+
+// RedactedModel 可选接口，声明导出时需要脱敏的 JSON 字段
+type RedactedModel interface {
+	RedactedFields() []string
+}
+
+// exportWriter 导出格式的行写入器
+type exportWriter interface {
+	WriteHeader(columns []string) error
+	WriteRow(values []interface{}) error
+	Close() error
+}
+
+// exportFormats 支持的导出格式及其 Content-Type 与文件扩展名
+var exportFormats = map[string]struct {
+	contentType string
+	newWriter   func(w io.Writer, sheet string) exportWriter
+}{
+	"csv": {
+		contentType: "text/csv; charset=utf-8",
+		newWriter:   func(w io.Writer, _ string) exportWriter { return &csvExportWriter{w: csv.NewWriter(w)} },
+	},
+	"ndjson": {
+		contentType: "application/x-ndjson",
+		newWriter:   func(w io.Writer, _ string) exportWriter { return &ndjsonExportWriter{enc: json.NewEncoder(w)} },
+	},
+	"xlsx": {
+		contentType: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+		newWriter:   func(w io.Writer, sheet string) exportWriter { return newXLSXWriter(w, sheet) },
+	},
+}
+
+// Export 通用导出方法，按 List 的过滤条件从数据库流式读取并输出 csv、ndjson 或 xlsx
+func (h *BaseHandler[T]) Export(c echo.Context) error {
+	ctx := c.Request().Context()
+	tracer := otel.Tracer("api-service")
+	ctx, span := tracer.Start(ctx, "BaseHandler.Export")
+	span.SetAttributes(attribute.String("Request-ID", c.Response().Header().Get("X-Request-ID")))
+	defer span.End()
+
+	format := c.QueryParam("format")
+	if format == "" {
+		format = "csv"
+	}
+	spec, ok := exportFormats[format]
+	if !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, "format must be one of csv, ndjson, xlsx")
+	}
+
+	fields, err := h.exportFields(c.QueryParam("columns"))
+	if err != nil {
+		return err
+	}
+	redacted := make(map[string]bool)
+	var model T
+	if rm, ok := any(model).(RedactedModel); ok {
+		for _, name := range rm.RedactedFields() {
+			redacted[name] = true
+		}
+	}
+
+	columns := make([]string, len(fields))
+	names := make([]string, len(fields))
+	for i, f := range fields {
+		columns[i] = f.Column
+		names[i] = f.JSONName
+	}
+
+	db := h.db.WithContext(ctx)
+	query, err := h.listQuery(c, db.Model(&model))
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+	rows, err := query.Select(columns).Rows()
+	if err != nil {
+		span.RecordError(err)
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	defer rows.Close()
+
+	resp := c.Response()
+	resp.Header().Set(echo.HeaderContentType, spec.contentType)
+	resp.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s.%s"`, model.TableName(), format))
+	resp.WriteHeader(http.StatusOK)
+
+	w := spec.newWriter(resp, model.TableName())
+	if err := w.WriteHeader(names); err != nil {
+		span.RecordError(err)
+		return nil
+	}
+
+	// 响应头已发送，之后的错误只能记录并中止输出
+	count := 0
+	values := make([]interface{}, len(fields))
+	for rows.Next() {
+		var row T
+		if err := db.ScanRows(rows, &row); err != nil {
+			span.RecordError(err)
+			return nil
+		}
+		v := reflect.ValueOf(row)
+		for i, f := range fields {
+			if redacted[f.JSONName] {
+				values[i] = redactedValue
+				continue
+			}
+			values[i] = v.FieldByIndex(f.Index).Interface()
+		}
+		if err := w.WriteRow(values); err != nil {
+			span.RecordError(err)
+			return nil
+		}
+		count++
+		if count%exportFlushRows == 0 {
+			resp.Flush()
+		}
+	}
+	if err := rows.Err(); err != nil {
+		span.RecordError(err)
+		return nil
+	}
+	if err := w.Close(); err != nil {
+		span.RecordError(err)
+		return nil
+	}
+	span.SetAttributes(attribute.Int("export.rows", count))
+	return nil
+}
+
+// exportFields 解析 columns 查询参数，默认导出全部字段
+func (h *BaseHandler[T]) exportFields(param string) ([]modelField, error) {
+	list, err := modelFieldList[T](h.db)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	if param == "" {
+		return list, nil
+	}
+
+	byName := make(map[string]modelField, len(list))
+	for _, f := range list {
+		byName[f.JSONName] = f
+	}
+	var fields []modelField
+	for _, name := range splitParam(param) {
+		f, ok := byName[name]
+		if !ok {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unknown column %q", name))
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// exportText 将字段值格式化为文本
+func exportText(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		return val.Format(time.RFC3339)
+	case *time.Time:
+		if val == nil {
+			return ""
+		}
+		return val.Format(time.RFC3339)
+	case string:
+		return val
+	default:
+		// 可空列以指针表示
+		if rv := reflect.ValueOf(v); rv.Kind() == reflect.Ptr {
+			if rv.IsNil() {
+				return ""
+			}
+			return exportText(rv.Elem().Interface())
+		}
+		return fmt.Sprint(val)
+	}
+}
+
+// exportCell 格式化表格单元格。以 = + - @ 等开头的文本会被电子表格当作公式执行，
+// 加上 ' 前缀按文本显示，导入时去掉该前缀
+func exportCell(v interface{}) string {
+	text := exportText(v)
+	if rv := reflect.Indirect(reflect.ValueOf(v)); rv.Kind() == reflect.String && isFormula(text) {
+		return "'" + text
+	}
+	return text
+}
+
+// isFormula 判断文本是否会被电子表格解析为公式
+func isFormula(text string) bool {
+	return text != "" && strings.ContainsRune("=+-@\t\r", rune(text[0]))
+}
+
+type csvExportWriter struct {
+	w *csv.Writer
+}
+
+func (w *csvExportWriter) WriteHeader(columns []string) error {
+	return w.w.Write(columns)
+}
+
+func (w *csvExportWriter) WriteRow(values []interface{}) error {
+	record := make([]string, len(values))
+	for i, v := range values {
+		record[i] = exportCell(v)
+	}
+	return w.w.Write(record)
+}
+
+func (w *csvExportWriter) Close() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+type ndjsonExportWriter struct {
+	enc     *json.Encoder
+	columns []string
+}
+
+func (w *ndjsonExportWriter) WriteHeader(columns []string) error {
+	w.columns = columns
+	return nil
+}
+
+func (w *ndjsonExportWriter) WriteRow(values []interface{}) error {
+	record := make(map[string]interface{}, len(values))
+	for i, v := range values {
+		record[w.columns[i]] = v
+	}
+	return w.enc.Encode(record)
+}
+
+func (w *ndjsonExportWriter) Close() error {
+	return nil
+}
@@ -0,0 +1,224 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// WritableModel 可选接口，声明客户端允许写入的 JSON 字段
+// 未实现该接口的模型默认允许写入除 readOnlyFields 以外的全部字段
+type WritableModel interface {
+	WritableFields() []string
+}
+
+// CreatableModel 可选接口，声明只能在创建时写入、之后只读的 JSON 字段
+type CreatableModel interface {
+	CreatableFields() []string
+}
+
+// readOnlyFields 任何模型都不允许客户端写入的字段
+var readOnlyFields = map[string]bool{
+	"id":         true,
+	"created_at": true,
+	"updated_at": true,
+	"deleted_at": true,
+}
+
+var schemaCache = &sync.Map{}
+
+// modelField 描述模型字段的 JSON 名称与数据库列的对应关系
+type modelField struct {
+	JSONName string
+	Column   string
+	Index    []int
+	Type     reflect.Type
+	Unique   bool
+	Writable bool
+	// Creatable 创建时可以写入，包括 Writable 的字段与 CreatableFields 声明的字段
+	Creatable bool
+	// Default 数据库默认值，整体替换时未提供的字段重置为该值
+	Default interface{}
+}
+
+// modelFields 解析模型字段，返回以 JSON 名称为键的字段表
+func modelFields[T Model](db *gorm.DB) (map[string]modelField, error) {
+	list, err := modelFieldList[T](db)
+	if err != nil {
+		return nil, err
+	}
+	fields := make(map[string]modelField, len(list))
+	for _, f := range list {
+		fields[f.JSONName] = f
+	}
+	return fields, nil
+}
+
+// modelFieldList 按结构体声明顺序返回模型字段
+func modelFieldList[T Model](db *gorm.DB) ([]modelField, error) {
+	var model T
+	s, err := schema.Parse(&model, schemaCache, db.NamingStrategy)
+	if err != nil {
+		return nil, err
+	}
+
+	var writable map[string]bool
+	if wm, ok := any(model).(WritableModel); ok {
+		writable = make(map[string]bool)
+		for _, name := range wm.WritableFields() {
+			writable[name] = true
+		}
+	}
+
+	creatable := make(map[string]bool)
+	if cm, ok := any(model).(CreatableModel); ok {
+		for _, name := range cm.CreatableFields() {
+			creatable[name] = true
+		}
+	}
+
+	fields := make([]modelField, 0, len(s.Fields))
+	for _, f := range s.Fields {
+		if f.DBName == "" {
+			continue
+		}
+		name := jsonName(f.StructField)
+		if name == "-" {
+			continue
+		}
+		canWrite := !readOnlyFields[name]
+		if writable != nil {
+			canWrite = canWrite && writable[name]
+		}
+		fields = append(fields, modelField{
+			JSONName:  name,
+			Column:    f.DBName,
+			Index:     f.StructField.Index,
+			Type:      f.StructField.Type,
+			Unique:    f.PrimaryKey || f.Unique,
+			Writable:  canWrite,
+			Creatable: canWrite || creatable[name],
+			Default:   f.DefaultValueInterface,
+		})
+	}
+	return fields, nil
+}
+
+// jsonName 返回结构体字段序列化后的 JSON 名称
+func jsonName(sf reflect.StructField) string {
+	name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+	if name == "" {
+		return sf.Name
+	}
+	return name
+}
+
+// checkWritable 校验更新请求体中的字段，拒绝未知字段与只读字段
+func checkWritable(fields map[string]modelField, body map[string]json.RawMessage) error {
+	return checkFields(fields, body, false)
+}
+
+// checkCreatable 校验创建请求体中的字段，允许只能在创建时写入的字段
+func checkCreatable(fields map[string]modelField, body map[string]json.RawMessage) error {
+	return checkFields(fields, body, true)
+}
+
+func checkFields(fields map[string]modelField, body map[string]json.RawMessage, create bool) error {
+	var unknown, readOnly []string
+	for name := range body {
+		f, ok := fields[name]
+		switch {
+		case !ok:
+			unknown = append(unknown, name)
+		case !f.Writable && !(create && f.Creatable):
+			readOnly = append(readOnly, name)
+		}
+	}
+	if len(unknown) == 0 && len(readOnly) == 0 {
+		return nil
+	}
+
+	sort.Strings(unknown)
+	sort.Strings(readOnly)
+	resp := map[string]interface{}{
+		"error": "request body contains fields that cannot be written",
+	}
+	if len(unknown) > 0 {
+		resp["unknown_fields"] = unknown
+	}
+	if len(readOnly) > 0 {
+		resp["readonly_fields"] = readOnly
+	}
+	return echo.NewHTTPError(http.StatusBadRequest, resp)
+}
+
+// assignFields 将 changes 写入 model，返回需要持久化的列名
+// replace 为 true 时按整体替换处理，未提供的可写字段重置为数据库默认值，没有默认值时重置为零值
+func assignFields(fields map[string]modelField, model interface{}, changes map[string]json.RawMessage, replace bool) ([]string, error) {
+	v := reflect.ValueOf(model).Elem()
+	var columns []string
+	for name, f := range fields {
+		_, changed := changes[name]
+		if !f.Writable || (!replace && !changed) {
+			continue
+		}
+		fv := v.FieldByIndex(f.Index)
+		fv.Set(reflect.Zero(fv.Type()))
+		if !changed && f.Default != nil {
+			if dv := reflect.ValueOf(f.Default); dv.CanConvert(fv.Type()) {
+				fv.Set(dv.Convert(fv.Type()))
+			}
+		}
+		columns = append(columns, f.Column)
+	}
+	sort.Strings(columns)
+
+	data, err := json.Marshal(changes)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err := json.Unmarshal(data, model); err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return columns, nil
+}
+
+// validateModel 对实现了 Validator 接口的模型进行校验
+func validateModel(model interface{}) error {
+	if v, ok := model.(Validator); ok {
+		if err := v.Validate(); err != nil {
+			return echo.NewHTTPError(http.StatusUnprocessableEntity, err.Error())
+		}
+	}
+	return nil
+}
+
+// validateStatus 校验通用的 status 字段。创建时空值使用数据库默认值，
+// 整体替换时未提供的 status 由 assignFields 重置为默认值
+func validateStatus(status string) error {
+	switch status {
+	case "", "active", "inactive":
+		return nil
+	}
+	return fmt.Errorf("status must be one of active, inactive")
+}
+
+// decodeObject 将请求体解析为 JSON 对象
+func decodeObject(data []byte) (map[string]json.RawMessage, error) {
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(data, &body); err != nil {
+		return nil, fmt.Errorf("request body must be a JSON object: %w", err)
+	}
+	if body == nil {
+		return nil, fmt.Errorf("request body must be a JSON object")
+	}
+	return body, nil
+}
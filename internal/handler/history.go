@@ -0,0 +1,429 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 500
+)
+
+// versionBaseline 开启版本记录前已存在的记录在首次变更时补写的基线版本，保存变更前的状态，
+// 创建时间取记录的创建时间，使 as_of 能还原开启版本记录之前的状态
+const versionBaseline ChangeType = "baseline"
+
+// Version 资源的一次变更记录，Snapshot 为变更后的完整状态，Diff 为相对上一版本的字段差异
+type Version struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	ResourceType string     `json:"resource_type" gorm:"size:64;not null"`
+	ResourceID   uint       `json:"resource_id" gorm:"not null"`
+	ChangeType   ChangeType `json:"change_type" gorm:"size:16;not null"`
+	Actor        string     `json:"actor"`
+	RequestID    string     `json:"request_id"`
+	Diff         JSONValue  `json:"diff"`
+	Snapshot     JSONValue  `json:"-"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// TableName 指定版本表名
+func (Version) TableName() string {
+	return "resource_versions"
+}
+
+// JSONValue 原样存取的 JSON 列
+type JSONValue []byte
+
+// Scan 实现 sql.Scanner 接口
+func (v *JSONValue) Scan(value interface{}) error {
+	switch data := value.(type) {
+	case nil:
+		*v = nil
+	case []byte:
+		*v = append(JSONValue(nil), data...)
+	case string:
+		*v = JSONValue(data)
+	default:
+		return fmt.Errorf("cannot scan %T into JSONValue", value)
+	}
+	return nil
+}
+
+// Value 实现 driver.Valuer 接口
+func (v JSONValue) Value() (driver.Value, error) {
+	if len(v) == 0 {
+		return nil, nil
+	}
+	return string(v), nil
+}
+
+// MarshalJSON 原样输出，空值输出 null
+func (v JSONValue) MarshalJSON() ([]byte, error) {
+	if len(v) == 0 {
+		return []byte("null"), nil
+	}
+	return v, nil
+}
+
+// GormDataType 数据库列类型
+func (JSONValue) GormDataType() string {
+	return "json"
+}
+
+// FieldChange 单个字段的变更前后值，新建时 From 为 null
+type FieldChange struct {
+	From json.RawMessage `json:"from"`
+	To   json.RawMessage `json:"to"`
+}
+
+// requestInfoKey 请求信息在 context 中的键
+type requestInfoKey struct{}
+
+// requestInfo 发起变更的操作者、客户端 IP 与请求 ID
+type requestInfo struct {
+	Actor     string
+	IP        string
+	RequestID string
+}
+
+// RequestInfo 将当前操作者、客户端 IP 与请求 ID 写入请求 context，供变更回调等拿不到
+// echo.Context 的代码使用，需注册在 JWT 中间件之后
+func RequestInfo() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			ctx := WithRequestInfo(c.Request().Context(), currentActor(c), c.RealIP(), c.Response().Header().Get(echo.HeaderXRequestID))
+			c.SetRequest(c.Request().WithContext(ctx))
+			return next(c)
+		}
+	}
+}
+
+// WithRequestInfo 将操作者、客户端 IP 与请求 ID 写入 context，gRPC 等非 Echo 入口使用
+func WithRequestInfo(ctx context.Context, actor, ip, requestID string) context.Context {
+	return context.WithValue(ctx, requestInfoKey{}, requestInfo{Actor: actor, IP: ip, RequestID: requestID})
+}
+
+// requestInfoFrom 读取 context 中的请求信息，后台任务等没有请求的场景记为 system
+func requestInfoFrom(ctx context.Context) requestInfo {
+	if info, ok := ctx.Value(requestInfoKey{}).(requestInfo); ok {
+		return info
+	}
+	return requestInfo{Actor: "system"}
+}
+
+// EnableHistory 为资源开启版本记录：每次变更时在同一事务中保存完整快照与字段差异，
+// 并启用 History 接口与 Get 的 as_of 参数
+func (h *BaseHandler[T]) EnableHistory() {
+	if h.history {
+		return
+	}
+	h.history = true
+	h.OnChangeTx(h.saveVersion)
+}
+
+// saveVersion 事务内回调，重新读取完整记录并与上一版本比较，无字段变化的更新不产生版本，
+// 写入失败时变更一起回滚。记录与上一版本都以加锁读取，同一记录的并发变更依次计算差异
+func (h *BaseHandler[T]) saveVersion(tx *gorm.DB, change Change[T]) error {
+	locked := tx.Clauses(clause.Locking{Strength: "UPDATE"})
+
+	// 回调中的 After 可能缺少字段或为 nil（如库存变更、删除），统一以数据库为准
+	var model T
+	err := locked.First(&model, change.ID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) && change.Type == ChangeDeleted {
+		// 物理删除后没有可保存的状态
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	snapshot, err := snapshotOf(model)
+	if err != nil {
+		return err
+	}
+
+	var prev Version
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("snapshot").
+		Where("resource_type = ? AND resource_id = ?", model.TableName(), change.ID).
+		Order("id DESC").Limit(1).Find(&prev).Error; err != nil {
+		return err
+	}
+	if len(prev.Snapshot) == 0 && change.Type != ChangeCreated {
+		if prev.Snapshot, err = h.saveBaseline(tx, model.TableName(), change, snapshot); err != nil {
+			return err
+		}
+	}
+
+	diff, err := diffSnapshots(prev.Snapshot, snapshot)
+	if err != nil {
+		return err
+	}
+	if len(diff) == 0 && change.Type == ChangeUpdated {
+		return nil
+	}
+	diffJSON, err := json.Marshal(diff)
+	if err != nil {
+		return err
+	}
+
+	info := requestInfoFrom(tx.Statement.Context)
+	return tx.Create(&Version{
+		ResourceType: model.TableName(),
+		ResourceID:   change.ID,
+		ChangeType:   change.Type,
+		Actor:        info.Actor,
+		RequestID:    info.RequestID,
+		Diff:         JSONValue(diffJSON),
+		Snapshot:     snapshot,
+	}).Error
+}
+
+// saveBaseline 为开启版本记录前已存在的记录写入基线版本并返回其快照。变更前的状态取自回调的
+// Before，软删除时由当前状态去掉 deleted_at 得到；无法得到时不写入，返回 nil
+func (h *BaseHandler[T]) saveBaseline(tx *gorm.DB, resourceType string, change Change[T], current JSONValue) (JSONValue, error) {
+	var baseline JSONValue
+	switch {
+	case change.Before != nil:
+		data, err := snapshotOf(*change.Before)
+		if err != nil {
+			return nil, err
+		}
+		baseline = data
+	case change.Type == ChangeDeleted:
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(current, &fields); err != nil {
+			return nil, err
+		}
+		delete(fields, "deleted_at")
+		data, err := json.Marshal(fields)
+		if err != nil {
+			return nil, err
+		}
+		baseline = data
+	default:
+		return nil, nil
+	}
+
+	var state versionState
+	if err := json.Unmarshal(baseline, &state); err != nil {
+		return nil, err
+	}
+	if state.CreatedAt == nil || state.CreatedAt.IsZero() {
+		return nil, nil
+	}
+	err := tx.Create(&Version{
+		ResourceType: resourceType,
+		ResourceID:   change.ID,
+		ChangeType:   versionBaseline,
+		Actor:        systemActor,
+		Snapshot:     baseline,
+		CreatedAt:    *state.CreatedAt,
+	}).Error
+	return baseline, err
+}
+
+// versionState 快照中决定记录在某一时间点是否存在的字段
+type versionState struct {
+	CreatedAt *time.Time `json:"created_at"`
+	DeletedAt *time.Time `json:"deleted_at"`
+}
+
+// snapshotOf 序列化记录，去掉需要脱敏的字段
+func snapshotOf[T Model](model T) (JSONValue, error) {
+	data, err := json.Marshal(model)
+	if err != nil {
+		return nil, err
+	}
+	rm, ok := any(model).(RedactedModel)
+	if !ok {
+		return data, nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	for _, name := range rm.RedactedFields() {
+		delete(fields, name)
+	}
+	return json.Marshal(fields)
+}
+
+// diffSnapshots 比较两个快照的顶层字段，updated_at 每次都会变化，不计入差异
+func diffSnapshots(before, after JSONValue) (map[string]FieldChange, error) {
+	var old, cur map[string]json.RawMessage
+	if len(before) > 0 {
+		if err := json.Unmarshal(before, &old); err != nil {
+			return nil, err
+		}
+	}
+	if err := json.Unmarshal(after, &cur); err != nil {
+		return nil, err
+	}
+
+	diff := make(map[string]FieldChange)
+	for name, value := range cur {
+		if name == "updated_at" {
+			continue
+		}
+		if prev, ok := old[name]; !ok || !bytes.Equal(prev, value) {
+			diff[name] = FieldChange{From: old[name], To: value}
+		}
+	}
+	for name, prev := range old {
+		if _, ok := cur[name]; !ok && name != "updated_at" {
+			diff[name] = FieldChange{From: prev}
+		}
+	}
+	return diff, nil
+}
+
+// History 返回记录的变更历史，最新的在前，可用 before 指定版本 ID 向前翻页
+func (h *BaseHandler[T]) History(c echo.Context) error {
+	ctx := c.Request().Context()
+	tracer := otel.Tracer("api-service")
+	ctx, span := tracer.Start(ctx, "BaseHandler.History")
+	span.SetAttributes(attribute.String("Request-ID", c.Response().Header().Get("X-Request-ID")))
+	defer span.End()
+
+	if !h.history {
+		return echo.NewHTTPError(http.StatusNotFound, "history is not enabled for this resource")
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid ID")
+	}
+	limit := defaultHistoryLimit
+	if v := c.QueryParam("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 || limit > maxHistoryLimit {
+			return echo.NewHTTPError(http.StatusBadRequest, "limit must be between 1 and 500")
+		}
+	}
+
+	var model T
+	var count int64
+	if err := h.db.WithContext(ctx).Model(&model).Where("id = ?", id).Count(&count).Error; err != nil {
+		span.RecordError(err)
+		return httpError(err)
+	}
+	if count == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, "Record not found")
+	}
+
+	query := h.db.WithContext(ctx).
+		Omit("snapshot").
+		Where("resource_type = ? AND resource_id = ?", model.TableName(), id)
+	if v := c.QueryParam("before"); v != "" {
+		before, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "before must be a version id")
+		}
+		query = query.Where("id < ?", before)
+	}
+
+	versions := []Version{}
+	if err := query.Order("id DESC").Limit(limit).Find(&versions).Error; err != nil {
+		span.RecordError(err)
+		return httpError(err)
+	}
+	return c.JSON(http.StatusOK, versions)
+}
+
+// getAsOf 用指定时间点之前最近的版本快照还原记录，当时不存在或已删除时返回 404。
+// 没有更早的版本且记录从未变更过时，当前状态即为当时的状态
+func (h *BaseHandler[T]) getAsOf(ctx context.Context, c echo.Context, id, asOf string) error {
+	if !h.history {
+		return echo.NewHTTPError(http.StatusBadRequest, "as_of is not supported for this resource")
+	}
+	at, err := time.Parse(time.RFC3339, asOf)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "as_of must be an RFC 3339 timestamp")
+	}
+	intID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid ID")
+	}
+
+	var model T
+	var version Version
+	err = h.db.WithContext(ctx).
+		Where("resource_type = ? AND resource_id = ? AND created_at <= ?", model.TableName(), intID, at).
+		Order("id DESC").First(&version).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return h.getUnversioned(ctx, c, uint(intID), at)
+	}
+	if err != nil {
+		return httpError(err)
+	}
+
+	var state versionState
+	if err := json.Unmarshal(version.Snapshot, &state); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	if state.DeletedAt != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "Record was deleted at the requested time")
+	}
+	if err := json.Unmarshal(version.Snapshot, &model); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	c.Response().Header().Set("X-Resource-Version", strconv.FormatUint(uint64(version.ID), 10))
+	return h.presentOne(ctx, c, model)
+}
+
+// getUnversioned 时间点之前没有版本时，从未变更过的记录以当前状态作答
+func (h *BaseHandler[T]) getUnversioned(ctx context.Context, c echo.Context, id uint, at time.Time) error {
+	var model T
+	err := h.db.WithContext(ctx).First(&model, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, "Record did not exist at the requested time")
+	}
+	if err != nil {
+		return httpError(err)
+	}
+	snapshot, err := snapshotOf(model)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	var state versionState
+	if err := json.Unmarshal(snapshot, &state); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	if state.CreatedAt == nil || state.CreatedAt.After(at) {
+		return echo.NewHTTPError(http.StatusNotFound, "Record did not exist at the requested time")
+	}
+
+	var count int64
+	if err := h.db.WithContext(ctx).Model(&Version{}).
+		Where("resource_type = ? AND resource_id = ?", model.TableName(), id).Count(&count).Error; err != nil {
+		return httpError(err)
+	}
+	if count > 0 {
+		return echo.NewHTTPError(http.StatusNotFound, "History does not cover the requested time")
+	}
+	if state.DeletedAt != nil && !state.DeletedAt.After(at) {
+		return echo.NewHTTPError(http.StatusNotFound, "Record was deleted at the requested time")
+	}
+	return h.presentOne(ctx, c, model)
+}
+
+// presentOne 经输出回调调整后返回单条记录
+func (h *BaseHandler[T]) presentOne(ctx context.Context, c echo.Context, model T) error {
+	models := []T{model}
+	if err := h.present(ctx, c, models); err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, models[0])
+}
@@ -0,0 +1,237 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/songfei1983/play-go-api/internal/money"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestProductHistory(t *testing.T) {
+	e, products, mock, _ := setupProductTest(t)
+	products.EnableHistory()
+
+	productColumns := []string{"id", "name", "price", "currency", "stock", "status", "created_at", "updated_at", "deleted_at"}
+	created := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	expectReload := func(price string, stock int, deletedAt interface{}) {
+		mock.ExpectQuery("SELECT \\* FROM `products` WHERE `products`\\.`id` = \\? ORDER BY `products`\\.`id` LIMIT \\? FOR UPDATE").
+			WithArgs(1, 1).
+			WillReturnRows(sqlmock.NewRows(productColumns).
+				AddRow(1, "Mug", price, "USD", stock, "active", created, time.Now(), deletedAt))
+	}
+	expectPrevious := func(snapshot interface{}) {
+		rows := sqlmock.NewRows([]string{"snapshot"})
+		if snapshot != nil {
+			rows.AddRow(snapshot)
+		}
+		mock.ExpectQuery("SELECT `snapshot` FROM `resource_versions` WHERE resource_type = \\? AND resource_id = \\? ORDER BY id DESC LIMIT \\? FOR UPDATE").
+			WithArgs("products", 1, 1).
+			WillReturnRows(rows)
+	}
+	snapshot := func(price string, stock int) string {
+		data, err := snapshotOf(Product{ID: 1, Name: "Mug", Price: money.MustParse(price), Currency: "USD", Stock: stock, Status: "active", CreatedAt: created})
+		require.NoError(t, err)
+		return string(data)
+	}
+	// saveVersion 在变更所在的事务中执行
+	saveVersion := func(change Change[Product]) error {
+		ctx := context.WithValue(context.Background(), requestInfoKey{}, requestInfo{Actor: "alice", RequestID: "req-1"})
+		return products.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			return products.saveVersion(tx, change)
+		})
+	}
+
+	t.Run("中间件记录操作者与请求ID", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set("user", &jwt.Token{Claims: jwt.MapClaims{"username": "alice"}})
+		c.Response().Header().Set(echo.HeaderXRequestID, "req-1")
+
+		var info requestInfo
+		err := RequestInfo()(func(c echo.Context) error {
+			info = requestInfoFrom(c.Request().Context())
+			return nil
+		})(c)
+		require.NoError(t, err)
+		assert.Equal(t, requestInfo{Actor: "alice", IP: "192.0.2.1", RequestID: "req-1"}, info)
+		assert.Equal(t, "system", requestInfoFrom(context.Background()).Actor)
+	})
+
+	t.Run("价格变更记录差异", func(t *testing.T) {
+		mock.ExpectBegin()
+		expectReload("12.50", 3, nil)
+		expectPrevious(snapshot("10.00", 3))
+		mock.ExpectExec("INSERT INTO `resource_versions`").
+			WithArgs("products", 1, ChangeUpdated, "alice", "req-1",
+				`{"price":{"from":"10.00","to":"12.50"}}`, sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(2, 1))
+		mock.ExpectCommit()
+
+		require.NoError(t, saveVersion(Change[Product]{Type: ChangeUpdated, ID: 1}))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("字段没有变化时不产生版本", func(t *testing.T) {
+		mock.ExpectBegin()
+		expectReload("12.50", 3, nil)
+		expectPrevious(snapshot("12.50", 3))
+		mock.ExpectCommit()
+
+		require.NoError(t, saveVersion(Change[Product]{Type: ChangeUpdated, ID: 1}))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("写入版本失败时变更回滚", func(t *testing.T) {
+		mock.ExpectBegin()
+		expectReload("12.50", 3, nil)
+		expectPrevious(snapshot("10.00", 3))
+		mock.ExpectExec("INSERT INTO `resource_versions`").WillReturnError(errors.New("versions unavailable"))
+		mock.ExpectRollback()
+
+		require.Error(t, saveVersion(Change[Product]{Type: ChangeUpdated, ID: 1}))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("开启版本记录前的记录首次变更时补写基线", func(t *testing.T) {
+		before := Product{ID: 1, Name: "Mug", Price: money.MustParse("10.00"), Currency: "USD", Stock: 3, Status: "active", CreatedAt: created}
+		mock.ExpectBegin()
+		expectReload("12.50", 3, nil)
+		expectPrevious(nil)
+		mock.ExpectExec("INSERT INTO `resource_versions`").
+			WithArgs("products", 1, versionBaseline, "system", "", nil, snapshot("10.00", 3), created).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("INSERT INTO `resource_versions`").
+			WithArgs("products", 1, ChangeUpdated, "alice", "req-1",
+				`{"price":{"from":"10.00","to":"12.50"}}`, sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(2, 1))
+		mock.ExpectCommit()
+
+		require.NoError(t, saveVersion(Change[Product]{Type: ChangeUpdated, ID: 1, Before: &before}))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("首次变更为删除时以删除前的状态作为基线", func(t *testing.T) {
+		mock.ExpectBegin()
+		expectReload("10.00", 3, time.Now())
+		expectPrevious(nil)
+		mock.ExpectExec("INSERT INTO `resource_versions`").
+			WithArgs("products", 1, versionBaseline, "system", "", nil, sqlmock.AnyArg(), created).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("INSERT INTO `resource_versions`").
+			WithArgs("products", 1, ChangeDeleted, "alice", "req-1", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(2, 1))
+		mock.ExpectCommit()
+
+		require.NoError(t, saveVersion(Change[Product]{Type: ChangeDeleted, ID: 1}))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("查询变更历史", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/?limit=10&before=5", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+
+		mock.ExpectQuery("SELECT count\\(\\*\\) FROM `products` WHERE id = \\?").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectQuery("SELECT `resource_versions`\\.`id`,.* FROM `resource_versions` WHERE \\(resource_type = \\? AND resource_id = \\?\\) AND id < \\? ORDER BY id DESC LIMIT \\?").
+			WithArgs("products", 1, 5, 10).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "resource_type", "resource_id", "change_type", "actor", "request_id", "diff", "created_at"}).
+				AddRow(2, "products", 1, ChangeUpdated, "alice", "req-1", `{"price":{"from":"10.00","to":"12.50"}}`, time.Now()))
+
+		require.NoError(t, products.History(c))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var versions []map[string]interface{}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &versions))
+		require.Len(t, versions, 1)
+		assert.Equal(t, "alice", versions[0]["actor"])
+		assert.Equal(t, map[string]interface{}{"from": "10.00", "to": "12.50"}, versions[0]["diff"].(map[string]interface{})["price"])
+		assert.NotContains(t, versions[0], "snapshot")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("按时间点还原记录", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/?as_of=2026-02-01T00:00:00Z", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+
+		mock.ExpectQuery("SELECT \\* FROM `resource_versions` WHERE resource_type = \\? AND resource_id = \\? AND created_at <= \\? ORDER BY id DESC,`resource_versions`\\.`id` LIMIT \\?").
+			WithArgs("products", 1, time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC), 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "resource_type", "resource_id", "snapshot"}).
+				AddRow(1, "products", 1, snapshot("10.00", 3)))
+
+		require.NoError(t, products.Get(c))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "1", rec.Header().Get("X-Resource-Version"))
+		assert.Contains(t, rec.Body.String(), `"price":"10.00"`)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("没有版本的记录以当前状态作答", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/?as_of=2026-02-01T00:00:00Z", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+
+		mock.ExpectQuery("SELECT \\* FROM `resource_versions`").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		mock.ExpectQuery("SELECT \\* FROM `products` WHERE `products`\\.`id` = \\?").
+			WithArgs(1, 1).
+			WillReturnRows(sqlmock.NewRows(productColumns).AddRow(1, "Mug", "10.00", "USD", 3, "active", created, created, nil))
+		mock.ExpectQuery("SELECT count\\(\\*\\) FROM `resource_versions` WHERE resource_type = \\? AND resource_id = \\?").
+			WithArgs("products", 1).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+		require.NoError(t, products.Get(c))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Empty(t, rec.Header().Get("X-Resource-Version"))
+		assert.Contains(t, rec.Body.String(), `"price":"10.00"`)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("时间点之前不存在的记录", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/?as_of=2020-01-01T00:00:00Z", nil)
+		c := e.NewContext(req, httptest.NewRecorder())
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+
+		mock.ExpectQuery("SELECT \\* FROM `resource_versions`").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		mock.ExpectQuery("SELECT \\* FROM `products` WHERE `products`\\.`id` = \\?").
+			WithArgs(1, 1).
+			WillReturnRows(sqlmock.NewRows(productColumns).AddRow(1, "Mug", "10.00", "USD", 3, "active", created, created, nil))
+
+		err := products.Get(c)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusNotFound, err.(*echo.HTTPError).Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("as_of格式错误", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/?as_of=yesterday", nil)
+		c := e.NewContext(req, httptest.NewRecorder())
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+
+		err := products.Get(c)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	})
+}
@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// ChangeType 资源变更类型
+type ChangeType string
+
+const (
+	ChangeCreated  ChangeType = "created"
+	ChangeUpdated  ChangeType = "updated"
+	ChangeDeleted  ChangeType = "deleted"
+	ChangeRestored ChangeType = "restored"
+)
+
+// Change 描述一次资源变更，无法获得的 Before/After 为 nil
+type Change[T Model] struct {
+	Type   ChangeType
+	ID     uint
+	Before *T
+	After  *T
+}
+
+// ChangeHook 资源变更回调，在写入提交后同步调用
+type ChangeHook[T Model] func(ctx context.Context, change Change[T])
+
+// OnChange 注册资源变更回调
+func (h *BaseHandler[T]) OnChange(hook ChangeHook[T]) {
+	h.hooks = append(h.hooks, hook)
+}
+
+// notify 依次调用已注册的变更回调
+func (h *BaseHandler[T]) notify(ctx context.Context, changes ...Change[T]) {
+	for _, change := range changes {
+		for _, hook := range h.hooks {
+			hook(ctx, change)
+		}
+	}
+}
+
+// TxChangeHook 在写入事务内调用的变更回调，返回错误时整个事务回滚
+type TxChangeHook[T Model] func(tx *gorm.DB, change Change[T]) error
+
+// OnChangeTx 注册事务内的变更回调
+func (h *BaseHandler[T]) OnChangeTx(hook TxChangeHook[T]) {
+	h.txHooks = append(h.txHooks, hook)
+}
+
+// notifyTx 在事务内依次调用已注册的变更回调，遇到错误立即返回
+func (h *BaseHandler[T]) notifyTx(tx *gorm.DB, changes ...Change[T]) error {
+	for _, change := range changes {
+		for _, hook := range h.txHooks {
+			if err := hook(tx, change); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Presenter 在读取接口输出前调整记录（如币种换算），不影响缓存内容；
+// 返回的错误直接作为响应
+type Presenter[T Model] func(ctx context.Context, c echo.Context, models []T) error
+
+// OnPresent 注册输出前的调整回调
+func (h *BaseHandler[T]) OnPresent(presenter Presenter[T]) {
+	h.presenters = append(h.presenters, presenter)
+}
+
+// present 依次调用已注册的输出回调
+func (h *BaseHandler[T]) present(ctx context.Context, c echo.Context, models []T) error {
+	for _, presenter := range h.presenters {
+		if err := presenter(ctx, c, models); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListFilter 根据查询参数为 List 与 Export 追加过滤条件，返回的错误直接作为响应
+type ListFilter func(c echo.Context, query *gorm.DB) (*gorm.DB, error)
+
+// OnList 注册列表过滤条件
+func (h *BaseHandler[T]) OnList(filter ListFilter) {
+	h.filters = append(h.filters, filter)
+}
+
+// ModelValidator 在模型自身的 Validate 之后执行的校验，用于依赖处理器配置的规则；
+// 返回的错误作为 422 响应
+type ModelValidator[T Model] func(model T) error
+
+// OnValidate 注册写入前的校验回调，创建、更新、批量操作与导入共用
+func (h *BaseHandler[T]) OnValidate(validator ModelValidator[T]) {
+	h.validators = append(h.validators, validator)
+}
+
+// validate 依次执行模型的 Validate 与已注册的校验回调
+func (h *BaseHandler[T]) validate(model T) error {
+	if err := validateModel(model); err != nil {
+		return err
+	}
+	for _, validator := range h.validators {
+		if err := validator(model); err != nil {
+			return echo.NewHTTPError(http.StatusUnprocessableEntity, err.Error())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,517 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// ImportModeInsert 只插入新记录，键冲突时整体失败
+	ImportModeInsert = "insert"
+	// ImportModeUpsert 键已存在时只更新文件中出现的列
+	ImportModeUpsert = "upsert"
+	// ImportModeReplace 键已存在时整体替换全部可写列
+	ImportModeReplace = "replace"
+
+	importMaxRows     = 100000
+	importMaxErrors   = 100
+	importBatchSize   = 500
+	importJobTTL      = 24 * time.Hour
+	importUploadLimit = 64 << 20
+	importMaxJobs     = 4
+)
+
+// importSyncRows 超过该行数的导入转为后台任务执行
+var importSyncRows = 1000
+
+// importWorkers 限制同时运行的后台导入任务数，所有资源共用
+var importWorkers = make(chan struct{}, importMaxJobs)
+
+// ImportRowError 单行校验错误
+type ImportRowError struct {
+	Row   int         `json:"row"`
+	Error interface{} `json:"error"`
+}
+
+// ImportReport 导入校验报告
+type ImportReport struct {
+	Mode    string           `json:"mode"`
+	Key     string           `json:"key,omitempty"`
+	DryRun  bool             `json:"dry_run"`
+	Total   int              `json:"total"`
+	Valid   int              `json:"valid"`
+	Invalid int              `json:"invalid"`
+	Errors  []ImportRowError `json:"errors,omitempty"`
+}
+
+// ImportJob 后台导入任务状态
+type ImportJob struct {
+	ID        string        `json:"id"`
+	Status    string        `json:"status"`
+	Total     int           `json:"total"`
+	Processed int           `json:"processed"`
+	Report    *ImportReport `json:"report"`
+	Error     string        `json:"error,omitempty"`
+	CreatedAt time.Time     `json:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at"`
+}
+
+// importJobKey 获取导入任务在 Redis 中的键
+func (h *BaseHandler[T]) importJobKey(id string) string {
+	var model T
+	return fmt.Sprintf("%s:import:%s", model.TableName(), id)
+}
+
+// Import 通用导入方法，支持 csv 与 ndjson，逐行校验后按 mode 写入
+func (h *BaseHandler[T]) Import(c echo.Context) error {
+	ctx := c.Request().Context()
+	tracer := otel.Tracer("api-service")
+	ctx, span := tracer.Start(ctx, "BaseHandler.Import")
+	span.SetAttributes(attribute.String("Request-ID", c.Response().Header().Get("X-Request-ID")))
+	defer span.End()
+
+	report := &ImportReport{
+		Mode:   c.QueryParam("mode"),
+		Key:    c.QueryParam("key"),
+		DryRun: c.QueryParam("dry_run") == "true",
+	}
+	if report.Mode == "" {
+		report.Mode = ImportModeInsert
+	}
+	switch report.Mode {
+	case ImportModeInsert:
+		report.Key = ""
+	case ImportModeUpsert, ImportModeReplace:
+		if report.Key == "" {
+			report.Key = "id"
+		}
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, "mode must be one of insert, upsert, replace")
+	}
+
+	fields, err := modelFields[T](h.db)
+	if err != nil {
+		span.RecordError(err)
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	if report.Key != "" && !fields[report.Key].Unique {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("key %q is not a unique field", report.Key))
+	}
+
+	src, format, err := importSource(c)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	rows, err := parseImport(src, format, fields)
+	if err != nil {
+		span.RecordError(err)
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	span.SetAttributes(
+		attribute.String("import.mode", report.Mode),
+		attribute.Int("import.rows", len(rows)),
+	)
+
+	models, columns := h.validateImport(fields, rows, report)
+	if report.DryRun {
+		return c.JSON(http.StatusOK, report)
+	}
+	if report.Invalid > 0 {
+		return c.JSON(http.StatusUnprocessableEntity, report)
+	}
+
+	if len(models) > importSyncRows {
+		select {
+		case importWorkers <- struct{}{}:
+		default:
+			return echo.NewHTTPError(http.StatusTooManyRequests, "too many import jobs are running, try again later")
+		}
+		job := &ImportJob{
+			ID:        uuid.New().String(),
+			Status:    "pending",
+			Total:     len(models),
+			Report:    report,
+			CreatedAt: time.Now(),
+		}
+		h.saveImportJob(ctx, job)
+		// 后台任务保留链路信息，但不随请求结束而取消
+		go h.runImportJob(context.WithoutCancel(ctx), job, models, columns)
+
+		c.Response().Header().Set(echo.HeaderLocation, c.Request().URL.Path+"/"+job.ID)
+		return c.JSON(http.StatusAccepted, job)
+	}
+
+	if err := h.writeImport(ctx, report, models, columns, nil); err != nil {
+		span.RecordError(err)
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, report)
+}
+
+// ImportStatus 查询后台导入任务进度
+func (h *BaseHandler[T]) ImportStatus(c echo.Context) error {
+	ctx := c.Request().Context()
+	tracer := otel.Tracer("api-service")
+	ctx, span := tracer.Start(ctx, "BaseHandler.ImportStatus")
+	defer span.End()
+
+	data, err := h.redis.Get(ctx, h.importJobKey(c.Param("job_id"))).Result()
+	if err != nil {
+		span.RecordError(err)
+		return echo.NewHTTPError(http.StatusNotFound, "Import job not found")
+	}
+
+	var job ImportJob
+	if err := json.Unmarshal([]byte(data), &job); err != nil {
+		span.RecordError(err)
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, job)
+}
+
+// runImportJob 在后台执行导入并记录进度
+func (h *BaseHandler[T]) runImportJob(ctx context.Context, job *ImportJob, models []T, columns []string) {
+	tracer := otel.Tracer("api-service")
+	ctx, span := tracer.Start(ctx, "BaseHandler.runImportJob")
+	span.SetAttributes(attribute.String("import.job_id", job.ID))
+	defer span.End()
+	defer func() { <-importWorkers }()
+
+	job.Status = "running"
+	h.saveImportJob(ctx, job)
+
+	err := h.writeImport(ctx, job.Report, models, columns, func(processed int) {
+		job.Processed = processed
+		h.saveImportJob(ctx, job)
+	})
+	if err != nil {
+		span.RecordError(err)
+		job.Status = "failed"
+		job.Error = err.Error()
+		job.Processed = 0
+	} else {
+		job.Status = "completed"
+	}
+	h.saveImportJob(ctx, job)
+}
+
+func (h *BaseHandler[T]) saveImportJob(ctx context.Context, job *ImportJob) {
+	job.UpdatedAt = time.Now()
+	if data, err := json.Marshal(job); err == nil {
+		h.redis.Set(ctx, h.importJobKey(job.ID), string(data), importJobTTL)
+	}
+}
+
+// validateImport 逐行校验并转换为模型，返回可写入的模型和需要更新的列
+func (h *BaseHandler[T]) validateImport(fields map[string]modelField, rows []map[string]json.RawMessage, report *ImportReport) ([]T, []string) {
+	report.Total = len(rows)
+	models := make([]T, 0, len(rows))
+	present := make(map[string]bool)
+
+	fail := func(row int, err error) {
+		report.Invalid++
+		if len(report.Errors) >= importMaxErrors {
+			return
+		}
+		var msg interface{} = err.Error()
+		var httpErr *echo.HTTPError
+		if errors.As(err, &httpErr) {
+			msg = httpErr.Message
+		}
+		report.Errors = append(report.Errors, ImportRowError{Row: row, Error: msg})
+	}
+
+	for i, row := range rows {
+		// 键字段即使只读（如 id）也允许出现在导入文件中
+		body := make(map[string]json.RawMessage, len(row))
+		for name, value := range row {
+			if name != report.Key {
+				body[name] = value
+			}
+		}
+		if report.Key != "" {
+			if v, ok := row[report.Key]; !ok || string(v) == "null" {
+				fail(i+1, fmt.Errorf("key %q is required", report.Key))
+				continue
+			}
+		}
+		// upsert 可能更新已有记录，只能在创建时写入的字段只允许在 insert 模式出现
+		check := checkWritable
+		if report.Mode == ImportModeInsert {
+			check = checkCreatable
+		}
+		if err := check(fields, body); err != nil {
+			fail(i+1, err)
+			continue
+		}
+
+		data, err := json.Marshal(row)
+		if err != nil {
+			fail(i+1, err)
+			continue
+		}
+		var model T
+		if err := json.Unmarshal(data, &model); err != nil {
+			fail(i+1, err)
+			continue
+		}
+		if err := h.validate(model); err != nil {
+			fail(i+1, err)
+			continue
+		}
+		for name := range body {
+			present[name] = true
+		}
+		models = append(models, model)
+	}
+	report.Valid = len(models)
+
+	var columns []string
+	for name, f := range fields {
+		if f.Writable && (report.Mode == ImportModeReplace || present[name]) {
+			columns = append(columns, f.Column)
+		}
+	}
+	sort.Strings(columns)
+	if f, ok := fields["updated_at"]; ok {
+		columns = append(columns, f.Column)
+	}
+	return models, columns
+}
+
+// writeImport 在事务中分批写入，progress 在每批完成后回调
+func (h *BaseHandler[T]) writeImport(ctx context.Context, report *ImportReport, models []T, columns []string, progress func(int)) error {
+	// upsert 无法区分新增与更新，统一按更新通知且不提供 Before
+	changeType := ChangeUpdated
+	if report.Mode == ImportModeInsert {
+		changeType = ChangeCreated
+	}
+
+	var keys []string
+	ids := make([]uint, len(models))
+	err := h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		insert := tx
+		if report.Mode != ImportModeInsert {
+			insert = tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: report.Key}},
+				DoUpdates: clause.AssignmentColumns(columns),
+			}).Session(&gorm.Session{})
+		}
+		for start := 0; start < len(models); start += importBatchSize {
+			end := min(start+importBatchSize, len(models))
+			batch := models[start:end]
+			if err := insert.Create(&batch).Error; err != nil {
+				return err
+			}
+			for i, m := range batch {
+				ids[start+i] = m.GetID()
+			}
+			if report.Mode != ImportModeInsert && report.Key != "id" {
+				if err := h.resolveIDs(tx, report.Key, batch, ids[start:end]); err != nil {
+					return err
+				}
+			}
+			for i := start; i < end; i++ {
+				if report.Mode != ImportModeInsert && ids[i] != 0 {
+					keys = append(keys, h.getCacheKey(strconv.FormatUint(uint64(ids[i]), 10)))
+				}
+				if err := h.notifyTx(tx, Change[T]{Type: changeType, ID: ids[i], After: &models[i]}); err != nil {
+					return err
+				}
+			}
+			if progress != nil {
+				progress(end)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// 更新过的记录可能已被缓存
+	for start := 0; start < len(keys); start += importBatchSize {
+		h.redis.Del(ctx, keys[start:min(start+importBatchSize, len(keys))]...)
+	}
+
+	for i := range models {
+		h.notify(ctx, Change[T]{Type: changeType, ID: ids[i], After: &models[i]})
+	}
+	return nil
+}
+
+// resolveIDs 按导入键查回 upsert 后的记录 ID，更新已有记录时数据库不会返回 ID
+func (h *BaseHandler[T]) resolveIDs(tx *gorm.DB, key string, batch []T, ids []uint) error {
+	fields, err := modelFields[T](tx)
+	if err != nil {
+		return err
+	}
+	field := fields[key]
+	values := make([]interface{}, len(batch))
+	for i := range batch {
+		values[i] = reflect.ValueOf(batch[i]).FieldByIndex(field.Index).Interface()
+	}
+
+	var found []T
+	if err := tx.Select("id", field.Column).Where(field.Column+" IN ?", values).Find(&found).Error; err != nil {
+		return err
+	}
+	byKey := make(map[string]uint, len(found))
+	for _, m := range found {
+		byKey[fmt.Sprint(reflect.ValueOf(m).FieldByIndex(field.Index).Interface())] = m.GetID()
+	}
+	for i, v := range values {
+		ids[i] = byKey[fmt.Sprint(v)]
+	}
+	return nil
+}
+
+// importSource 从 multipart 文件字段或原始请求体读取导入数据，并确定格式
+func importSource(c echo.Context) (io.ReadCloser, string, error) {
+	format := c.QueryParam("format")
+	req := c.Request()
+	req.Body = http.MaxBytesReader(c.Response(), req.Body, importUploadLimit)
+
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get(echo.HeaderContentType))
+	if mediaType == echo.MIMEMultipartForm {
+		fh, err := c.FormFile("file")
+		if err != nil {
+			return nil, "", echo.NewHTTPError(http.StatusBadRequest, "file is required")
+		}
+		if format == "" {
+			format = strings.TrimPrefix(filepath.Ext(fh.Filename), ".")
+		}
+		f, err := fh.Open()
+		if err != nil {
+			return nil, "", echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		mediaType = fh.Header.Get(echo.HeaderContentType)
+		return f, importFormat(format, mediaType), nil
+	}
+	return req.Body, importFormat(format, mediaType), nil
+}
+
+func importFormat(format, mediaType string) string {
+	if format != "" {
+		return format
+	}
+	switch mediaType {
+	case "application/x-ndjson", "application/ndjson":
+		return "ndjson"
+	default:
+		return "csv"
+	}
+}
+
+// parseImport 将 csv 或 ndjson 解析为 JSON 对象列表
+func parseImport(r io.Reader, format string, fields map[string]modelField) ([]map[string]json.RawMessage, error) {
+	var rows []map[string]json.RawMessage
+	switch format {
+	case "ndjson":
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), 1<<20)
+		for line := 1; scanner.Scan(); line++ {
+			text := strings.TrimSpace(scanner.Text())
+			if text == "" {
+				continue
+			}
+			row, err := decodeObject([]byte(text))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			rows = append(rows, row)
+			if len(rows) > importMaxRows {
+				return nil, fmt.Errorf("at most %d rows are allowed", importMaxRows)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	case "csv":
+		cr := csv.NewReader(r)
+		header, err := cr.Read()
+		if err != nil {
+			return nil, fmt.Errorf("missing CSV header: %w", err)
+		}
+		for line := 2; ; line++ {
+			record, err := cr.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			row := make(map[string]json.RawMessage, len(header))
+			for i, name := range header {
+				row[name] = csvValue(record[i], fields[name].Type)
+			}
+			rows = append(rows, row)
+			if len(rows) > importMaxRows {
+				return nil, fmt.Errorf("at most %d rows are allowed", importMaxRows)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("format must be one of csv, ndjson")
+	}
+	return rows, nil
+}
+
+// csvValue 根据字段类型将 CSV 单元格转换为 JSON 值，无法转换时保留为字符串交由校验报错
+func csvValue(cell string, typ reflect.Type) json.RawMessage {
+	if typ != nil && typ.Kind() == reflect.Ptr {
+		if cell == "" {
+			return json.RawMessage("null")
+		}
+		typ = typ.Elem()
+	}
+	if typ != nil {
+		// 数字重新编码，+5、.5、NaN、0x1p3 等 Go 能解析但不是合法 JSON 的写法不会原样写入
+		switch typ.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if n, err := strconv.ParseInt(cell, 10, 64); err == nil {
+				return json.RawMessage(strconv.FormatInt(n, 10))
+			}
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if n, err := strconv.ParseUint(cell, 10, 64); err == nil {
+				return json.RawMessage(strconv.FormatUint(n, 10))
+			}
+		case reflect.Float32, reflect.Float64:
+			if f, err := strconv.ParseFloat(cell, 64); err == nil && !math.IsNaN(f) && !math.IsInf(f, 0) {
+				return json.RawMessage(strconv.FormatFloat(f, 'g', -1, 64))
+			}
+		case reflect.Bool:
+			if b, err := strconv.ParseBool(cell); err == nil {
+				return json.RawMessage(strconv.FormatBool(b))
+			}
+		}
+	}
+	// 导出时为防止公式执行加上的前缀
+	if strings.HasPrefix(cell, "'") && isFormula(cell[1:]) {
+		cell = cell[1:]
+	}
+	data, _ := json.Marshal(cell)
+	return data
+}
@@ -0,0 +1,441 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/songfei1983/play-go-api/internal/events"
+	"github.com/songfei1983/play-go-api/internal/metrics"
+	"github.com/songfei1983/play-go-api/internal/money"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/net/websocket"
+	"gorm.io/gorm"
+)
+
+const (
+	inventoryWriteTimeout = 10 * time.Second
+	inventoryMaxMessage   = 16 << 10
+)
+
+// 实时库存消息类型
+const (
+	inventoryUpdate       = "update"
+	inventorySubscribed   = "subscribed"
+	inventoryUnsubscribed = "unsubscribed"
+	inventoryPong         = "pong"
+	inventoryError        = "error"
+)
+
+// InventoryUpdate 产品的库存与价格，客户端可用 UpdatedAt 丢弃比已知状态更旧的消息
+type InventoryUpdate struct {
+	Type      string        `json:"type"`
+	ProductID uint          `json:"product_id"`
+	Stock     int           `json:"stock"`
+	Price     money.Decimal `json:"price"`
+	Currency  string        `json:"currency"`
+	Deleted   bool          `json:"deleted,omitempty"`
+	UpdatedAt time.Time     `json:"updated_at"`
+}
+
+// same 判断两次更新的库存与价格是否相同
+func (u InventoryUpdate) same(other InventoryUpdate) bool {
+	return u.Stock == other.Stock && u.Price.String() == other.Price.String() &&
+		u.Currency == other.Currency && u.Deleted == other.Deleted
+}
+
+// inventoryUpdateOf 由产品生成库存消息
+func inventoryUpdateOf(p Product) InventoryUpdate {
+	return InventoryUpdate{
+		Type:      inventoryUpdate,
+		ProductID: p.ID,
+		Stock:     p.Stock,
+		Price:     p.Price,
+		Currency:  p.Currency,
+		Deleted:   p.DeletedAt != nil,
+		UpdatedAt: p.UpdatedAt,
+	}
+}
+
+// inventoryRequest 客户端消息：subscribe、unsubscribe 或 ping
+type inventoryRequest struct {
+	Action     string `json:"action"`
+	ProductIDs []uint `json:"product_ids"`
+}
+
+// inventoryReply 对客户端消息的应答，订阅成功时附带当前库存
+type inventoryReply struct {
+	Type       string            `json:"type"`
+	ProductIDs []uint            `json:"product_ids,omitempty"`
+	NotFound   []uint            `json:"not_found,omitempty"`
+	Snapshot   []InventoryUpdate `json:"snapshot,omitempty"`
+	Error      string            `json:"error,omitempty"`
+}
+
+// inventoryConn 单个连接的订阅与待发送的更新。同一产品只保留最新一条未发送的更新，
+// 客户端读取过慢时旧状态被新状态覆盖，内存占用不超过订阅数
+type inventoryConn struct {
+	mu      sync.Mutex
+	subs    map[uint]bool
+	pending map[uint]InventoryUpdate
+	wake    chan struct{}
+}
+
+func newInventoryConn() *inventoryConn {
+	return &inventoryConn{
+		subs:    make(map[uint]bool),
+		pending: make(map[uint]InventoryUpdate),
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// offer 放入一条更新并唤醒发送协程，不会阻塞
+func (c *inventoryConn) offer(update InventoryUpdate) {
+	c.mu.Lock()
+	if _, ok := c.pending[update.ProductID]; ok {
+		metrics.WebSocketUpdatesCoalesced.Inc()
+	}
+	c.pending[update.ProductID] = update
+	c.mu.Unlock()
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// drain 取出所有待发送的更新，按产品 ID 排序
+func (c *inventoryConn) drain() []InventoryUpdate {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	updates := make([]InventoryUpdate, 0, len(c.pending))
+	for id, update := range c.pending {
+		updates = append(updates, update)
+		delete(c.pending, id)
+	}
+	sort.Slice(updates, func(i, j int) bool { return updates[i].ProductID < updates[j].ProductID })
+	return updates
+}
+
+// writeLoop 发送待发送的更新，写超时或连接断开时返回
+func (c *inventoryConn) writeLoop(ctx context.Context, ws *websocket.Conn) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.wake:
+			for _, update := range c.drain() {
+				if err := sendInventory(ws, update.Type, update); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+// sendInventory 带写超时发送一条消息
+func sendInventory(ws *websocket.Conn, kind string, v interface{}) error {
+	if err := ws.SetWriteDeadline(time.Now().Add(inventoryWriteTimeout)); err != nil {
+		return err
+	}
+	if err := websocket.JSON.Send(ws, v); err != nil {
+		return err
+	}
+	metrics.WebSocketMessagesSent.WithLabelValues(kind).Inc()
+	return nil
+}
+
+// InventoryHub 从变更流读取产品事件，分发给订阅了该产品的连接；
+// 每个实例一个，多实例部署时各自从同一 Redis stream 读取
+type InventoryHub struct {
+	feed *events.RedisFeed
+
+	mu       sync.Mutex
+	watchers map[uint]map[*inventoryConn]struct{}
+	// last 记录已分发的最新状态，只改了名称等字段的更新不再推送
+	last map[uint]InventoryUpdate
+}
+
+// NewInventoryHub 创建实时库存分发器
+func NewInventoryHub(feed *events.RedisFeed) *InventoryHub {
+	return &InventoryHub{
+		feed:     feed,
+		watchers: make(map[uint]map[*inventoryConn]struct{}),
+		last:     make(map[uint]InventoryUpdate),
+	}
+}
+
+// Run 分发变更流中的产品事件，落后过多被变更流断开时重新订阅，直到 ctx 取消
+func (h *InventoryHub) Run(ctx context.Context) {
+	for ctx.Err() == nil {
+		entries, unsubscribe := h.feed.Subscribe()
+		h.consume(ctx, entries)
+		unsubscribe()
+	}
+}
+
+func (h *InventoryHub) consume(ctx context.Context, entries <-chan events.FeedEntry) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case entry, ok := <-entries:
+			if !ok {
+				fmt.Printf("Live inventory fell behind the event feed, resubscribing\n")
+				return
+			}
+			h.handle(entry.Event)
+		}
+	}
+}
+
+// handle 把产品事件转换为库存消息，发给订阅了该产品的连接
+func (h *InventoryHub) handle(event events.Event) {
+	if event.AggregateType != "Product" {
+		return
+	}
+	id, err := strconv.ParseUint(event.AggregateID, 10, 64)
+	if err != nil {
+		return
+	}
+	productID := uint(id)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	watchers := h.watchers[productID]
+	if len(watchers) == 0 {
+		return
+	}
+
+	var product Product
+	if len(event.Payload) > 0 {
+		if err := json.Unmarshal(event.Payload, &product); err != nil {
+			fmt.Printf("Error decoding product event %s: %v\n", event.ID, err)
+			return
+		}
+	}
+	if product.ID == 0 {
+		// 记录已不存在，只能告知已删除
+		product.ID = productID
+		now := event.OccurredAt
+		product.DeletedAt = &now
+		product.UpdatedAt = event.OccurredAt
+	}
+	update := inventoryUpdateOf(product)
+	if prev, ok := h.last[productID]; ok && prev.same(update) {
+		return
+	}
+	h.last[productID] = update
+	for conn := range watchers {
+		conn.offer(update)
+	}
+}
+
+// subscribe 为连接订阅产品，超过 limit 时不做任何修改并返回错误，返回新增的产品
+func (h *InventoryHub) subscribe(conn *inventoryConn, ids []uint, limit int) ([]uint, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+
+	var added []uint
+	for _, id := range ids {
+		if !conn.subs[id] {
+			added = append(added, id)
+		}
+	}
+	if len(conn.subs)+len(added) > limit {
+		return nil, fmt.Errorf("subscription limit of %d products exceeded", limit)
+	}
+	for _, id := range added {
+		conn.subs[id] = true
+		if h.watchers[id] == nil {
+			h.watchers[id] = make(map[*inventoryConn]struct{})
+		}
+		h.watchers[id][conn] = struct{}{}
+	}
+	metrics.WebSocketSubscriptions.Add(float64(len(added)))
+	return added, nil
+}
+
+// unsubscribe 取消连接对产品的订阅
+func (h *InventoryHub) unsubscribe(conn *inventoryConn, ids []uint) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+
+	for _, id := range ids {
+		if !conn.subs[id] {
+			continue
+		}
+		delete(conn.subs, id)
+		delete(conn.pending, id)
+		delete(h.watchers[id], conn)
+		if len(h.watchers[id]) == 0 {
+			delete(h.watchers, id)
+			delete(h.last, id)
+		}
+		metrics.WebSocketSubscriptions.Dec()
+	}
+}
+
+// remove 连接关闭时取消其全部订阅
+func (h *InventoryHub) remove(conn *inventoryConn) {
+	conn.mu.Lock()
+	ids := make([]uint, 0, len(conn.subs))
+	for id := range conn.subs {
+		ids = append(ids, id)
+	}
+	conn.mu.Unlock()
+	h.unsubscribe(conn, ids)
+}
+
+// InventoryHandler 实时库存 WebSocket 处理器
+type InventoryHandler struct {
+	db               *gorm.DB
+	hub              *InventoryHub
+	maxSubscriptions int
+}
+
+// NewInventoryHandler 创建实时库存处理器，maxSubscriptions 为单个连接最多订阅的产品数
+func NewInventoryHandler(db *gorm.DB, hub *InventoryHub, maxSubscriptions int) *InventoryHandler {
+	return &InventoryHandler{db: db, hub: hub, maxSubscriptions: maxSubscriptions}
+}
+
+// Live 升级为 WebSocket 连接，客户端发送 {"action":"subscribe","product_ids":[1,2]} 订阅产品，
+// 订阅后立即收到当前库存，之后每次库存或价格变化收到一条 update 消息
+func (h *InventoryHandler) Live(c echo.Context) error {
+	ctx := c.Request().Context()
+	tracer := otel.Tracer("api-service")
+	ctx, span := tracer.Start(ctx, "InventoryHandler.Live")
+	span.SetAttributes(attribute.String("Request-ID", c.Response().Header().Get("X-Request-ID")))
+	defer span.End()
+
+	if _, err := currentUserID(c); err != nil {
+		return err
+	}
+
+	server := websocket.Server{
+		// 与 REST 接口的 CORS 策略一致，不限制 Origin，身份由 JWT 校验
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler: func(ws *websocket.Conn) {
+			h.serve(ctx, ws)
+		},
+	}
+	server.ServeHTTP(c.Response(), c.Request())
+	return nil
+}
+
+// serve 处理一个连接：当前协程读取客户端消息，另一个协程发送库存更新
+func (h *InventoryHandler) serve(ctx context.Context, ws *websocket.Conn) {
+	ws.MaxPayloadBytes = inventoryMaxMessage
+	metrics.WebSocketConnectionsTotal.Inc()
+	metrics.WebSocketConnections.Inc()
+	defer metrics.WebSocketConnections.Dec()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	conn := newInventoryConn()
+	defer h.hub.remove(conn)
+
+	// 发送失败说明客户端过慢或已断开，关闭连接使读取结束
+	go func() {
+		conn.writeLoop(ctx, ws)
+		ws.Close() // nolint: errcheck
+	}()
+	defer ws.Close() // nolint: errcheck
+
+	for {
+		var req inventoryRequest
+		err := websocket.JSON.Receive(ws, &req)
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+			if sendInventory(ws, inventoryError, inventoryReply{Type: inventoryError, Error: "invalid message"}) != nil {
+				return
+			}
+			continue
+		}
+		if err != nil {
+			return
+		}
+		reply := h.handle(ctx, conn, req)
+		if sendInventory(ws, reply.Type, reply) != nil {
+			return
+		}
+	}
+}
+
+// handle 处理一条客户端消息并返回应答
+func (h *InventoryHandler) handle(ctx context.Context, conn *inventoryConn, req inventoryRequest) inventoryReply {
+	switch req.Action {
+	case "ping":
+		return inventoryReply{Type: inventoryPong}
+	case "subscribe", "unsubscribe":
+	default:
+		return inventoryReply{Type: inventoryError, Error: fmt.Sprintf("unknown action %q", req.Action)}
+	}
+
+	ids := make([]uint, 0, len(req.ProductIDs))
+	seen := make(map[uint]bool, len(req.ProductIDs))
+	for _, id := range req.ProductIDs {
+		if id != 0 && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return inventoryReply{Type: inventoryError, Error: "product_ids must list at least one product ID"}
+	}
+
+	if req.Action == "unsubscribe" {
+		h.hub.unsubscribe(conn, ids)
+		return inventoryReply{Type: inventoryUnsubscribed, ProductIDs: ids}
+	}
+
+	// 先订阅再读取当前库存，读取期间的变化不会遗漏
+	added, err := h.hub.subscribe(conn, ids, h.maxSubscriptions)
+	if err != nil {
+		return inventoryReply{Type: inventoryError, Error: err.Error()}
+	}
+	if len(added) == 0 {
+		return inventoryReply{Type: inventorySubscribed, ProductIDs: ids}
+	}
+	var products []Product
+	if err := h.db.WithContext(ctx).Where("id IN ? AND deleted_at IS NULL", added).Order("id").Find(&products).Error; err != nil {
+		h.hub.unsubscribe(conn, added)
+		return inventoryReply{Type: inventoryError, Error: err.Error()}
+	}
+
+	reply := inventoryReply{Type: inventorySubscribed}
+	found := make(map[uint]bool, len(products))
+	for _, p := range products {
+		found[p.ID] = true
+		reply.Snapshot = append(reply.Snapshot, inventoryUpdateOf(p))
+	}
+	// 新订阅中不存在或已删除的产品取消订阅，此前已订阅的保持不变
+	missing := make(map[uint]bool)
+	for _, id := range added {
+		if !found[id] {
+			missing[id] = true
+			reply.NotFound = append(reply.NotFound, id)
+		}
+	}
+	if len(reply.NotFound) > 0 {
+		h.hub.unsubscribe(conn, reply.NotFound)
+	}
+	for _, id := range ids {
+		if !missing[id] {
+			reply.ProductIDs = append(reply.ProductIDs, id)
+		}
+	}
+	return reply
+}
@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-redis/redismock/v8"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/songfei1983/play-go-api/internal/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/websocket"
+)
+
+func TestInventoryHub(t *testing.T) {
+	client, _ := redismock.NewClientMock()
+	productEvent := func(id string, payload string) events.Event {
+		return events.Event{ID: "1", Type: "ProductUpdated", AggregateType: "Product", AggregateID: id, Payload: []byte(payload)}
+	}
+
+	t.Run("未读取的更新只保留最新一条", func(t *testing.T) {
+		hub := NewInventoryHub(events.NewRedisFeed(client, "events:feed", 0))
+		conn := newInventoryConn()
+		_, err := hub.subscribe(conn, []uint{1, 2}, 10)
+		require.NoError(t, err)
+
+		hub.handle(productEvent("2", `{"id":2,"stock":3,"price":"1.00","currency":"USD"}`))
+		hub.handle(productEvent("1", `{"id":1,"stock":5,"price":"9.99","currency":"USD"}`))
+		hub.handle(productEvent("1", `{"id":1,"stock":4,"price":"9.99","currency":"USD"}`))
+		hub.handle(productEvent("3", `{"id":3,"stock":1,"price":"1.00","currency":"USD"}`))
+		hub.handle(events.Event{AggregateType: "Category", AggregateID: "1"})
+
+		updates := conn.drain()
+		require.Len(t, updates, 2)
+		assert.Equal(t, uint(1), updates[0].ProductID)
+		assert.Equal(t, 4, updates[0].Stock)
+		assert.Equal(t, uint(2), updates[1].ProductID)
+		assert.Empty(t, conn.drain())
+	})
+
+	t.Run("库存与价格不变时不推送", func(t *testing.T) {
+		hub := NewInventoryHub(events.NewRedisFeed(client, "events:feed", 0))
+		conn := newInventoryConn()
+		_, err := hub.subscribe(conn, []uint{1}, 10)
+		require.NoError(t, err)
+
+		hub.handle(productEvent("1", `{"id":1,"name":"Mug","stock":5,"price":"9.99","currency":"USD"}`))
+		require.Len(t, conn.drain(), 1)
+		hub.handle(productEvent("1", `{"id":1,"name":"Big Mug","stock":5,"price":"9.99","currency":"USD"}`))
+		assert.Empty(t, conn.drain())
+
+		hub.handle(productEvent("1", `null`))
+		updates := conn.drain()
+		require.Len(t, updates, 1)
+		assert.True(t, updates[0].Deleted)
+	})
+
+	t.Run("超过订阅上限", func(t *testing.T) {
+		hub := NewInventoryHub(events.NewRedisFeed(client, "events:feed", 0))
+		conn := newInventoryConn()
+		added, err := hub.subscribe(conn, []uint{1, 2}, 2)
+		require.NoError(t, err)
+		assert.Equal(t, []uint{1, 2}, added)
+
+		_, err = hub.subscribe(conn, []uint{2, 3}, 2)
+		assert.Error(t, err)
+		added, err = hub.subscribe(conn, []uint{2}, 2)
+		require.NoError(t, err)
+		assert.Empty(t, added)
+
+		hub.remove(conn)
+		assert.Empty(t, hub.watchers)
+	})
+}
+
+func TestInventoryLive(t *testing.T) {
+	e, products, mock, _ := setupProductTest(t)
+	client, _ := redismock.NewClientMock()
+	hub := NewInventoryHub(events.NewRedisFeed(client, "events:feed", 0))
+	handler := NewInventoryHandler(products.db, hub, 10)
+	e.GET("/api/v1/ws/inventory", handler.Live, func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set("user", &jwt.Token{Claims: jwt.MapClaims{"user_id": float64(3), "username": "carol"}})
+			return next(c)
+		}
+	})
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/api/v1/ws/inventory", "", "http://localhost")
+	require.NoError(t, err)
+	defer ws.Close()
+	require.NoError(t, ws.SetReadDeadline(time.Now().Add(5*time.Second)))
+
+	receive := func() map[string]interface{} {
+		var msg map[string]interface{}
+		require.NoError(t, websocket.JSON.Receive(ws, &msg))
+		return msg
+	}
+
+	t.Run("订阅后返回当前库存", func(t *testing.T) {
+		mock.ExpectQuery("SELECT \\* FROM `products` WHERE id IN \\(\\?,\\?\\) AND deleted_at IS NULL ORDER BY id").
+			WithArgs(1, 2).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "price", "currency", "stock"}).AddRow(1, "Mug", "9.99", "USD", 5))
+
+		require.NoError(t, websocket.JSON.Send(ws, map[string]interface{}{"action": "subscribe", "product_ids": []uint{1, 2, 1}}))
+		msg := receive()
+		assert.Equal(t, "subscribed", msg["type"])
+		assert.Equal(t, []interface{}{float64(1)}, msg["product_ids"])
+		assert.Equal(t, []interface{}{float64(2)}, msg["not_found"])
+		snapshot := msg["snapshot"].([]interface{})
+		require.Len(t, snapshot, 1)
+		assert.Equal(t, float64(5), snapshot[0].(map[string]interface{})["stock"])
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("库存变化时推送更新", func(t *testing.T) {
+		hub.handle(events.Event{AggregateType: "Product", AggregateID: "1", Payload: []byte(`{"id":1,"stock":4,"price":"9.99","currency":"USD"}`)})
+		msg := receive()
+		assert.Equal(t, "update", msg["type"])
+		assert.Equal(t, float64(1), msg["product_id"])
+		assert.Equal(t, float64(4), msg["stock"])
+		assert.Equal(t, "9.99", msg["price"])
+	})
+
+	t.Run("心跳与无效消息", func(t *testing.T) {
+		require.NoError(t, websocket.JSON.Send(ws, map[string]string{"action": "ping"}))
+		assert.Equal(t, "pong", receive()["type"])
+
+		require.NoError(t, websocket.Message.Send(ws, "not json"))
+		assert.Equal(t, "error", receive()["type"])
+
+		require.NoError(t, websocket.JSON.Send(ws, map[string]interface{}{"action": "subscribe", "product_ids": []uint{}}))
+		assert.Equal(t, "error", receive()["type"])
+	})
+
+	t.Run("取消订阅", func(t *testing.T) {
+		require.NoError(t, websocket.JSON.Send(ws, map[string]interface{}{"action": "unsubscribe", "product_ids": []uint{1}}))
+		msg := receive()
+		assert.Equal(t, "unsubscribed", msg["type"])
+		assert.Equal(t, []interface{}{float64(1)}, msg["product_ids"])
+	})
+}
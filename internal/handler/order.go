@@ -0,0 +1,739 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/songfei1983/play-go-api/internal/money"
+	"github.com/songfei1983/play-go-api/internal/payment"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 订单状态
+const (
+	OrderPending   = "pending"
+	OrderPaid      = "paid"
+	OrderShipped   = "shipped"
+	OrderCompleted = "completed"
+	OrderCancelled = "cancelled"
+)
+
+// orderTransitions 订单状态机：待支付 → 已支付 → 已发货 → 已完成，发货前可以取消
+var orderTransitions = map[string][]string{
+	OrderPending: {OrderPaid, OrderCancelled},
+	OrderPaid:    {OrderShipped, OrderCancelled},
+	OrderShipped: {OrderCompleted},
+}
+
+const cartMaxQuantity = 1000
+
+// Cart 购物车，每个用户一个
+type Cart struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"not null;uniqueIndex"`
+	Items     []CartItem `json:"items" gorm:"foreignKey:CartID"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (Cart) TableName() string {
+	return "carts"
+}
+
+// CartItem 购物车条目，按变体管理库存的产品必须指定变体
+type CartItem struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	CartID    uint      `json:"cart_id" gorm:"not null;index"`
+	ProductID uint      `json:"product_id" gorm:"not null"`
+	VariantID *uint     `json:"variant_id,omitempty"`
+	Quantity  int       `json:"quantity" gorm:"not null"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (CartItem) TableName() string {
+	return "cart_items"
+}
+
+// Order 订单，下单时扣减库存并快照商品名称与价格
+type Order struct {
+	ID          uint          `json:"id" gorm:"primaryKey"`
+	UserID      uint          `json:"user_id" gorm:"not null;index"`
+	Status      string        `json:"status" gorm:"size:16;not null;default:pending;index"`
+	Currency    string        `json:"currency" gorm:"type:char(3);not null"`
+	Total       money.Decimal `json:"total" gorm:"type:decimal(12,2);not null"`
+	PaymentID   string        `json:"payment_id,omitempty" gorm:"size:64"`
+	Items       []OrderItem   `json:"items,omitempty" gorm:"foreignKey:OrderID"`
+	PaidAt      *time.Time    `json:"paid_at,omitempty"`
+	ShippedAt   *time.Time    `json:"shipped_at,omitempty"`
+	CompletedAt *time.Time    `json:"completed_at,omitempty"`
+	CancelledAt *time.Time    `json:"cancelled_at,omitempty"`
+	CreatedAt   time.Time     `json:"created_at"`
+	UpdatedAt   time.Time     `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (Order) TableName() string {
+	return "orders"
+}
+
+// OrderItem 订单条目，价格为下单时的快照，不随产品调价变化
+type OrderItem struct {
+	ID        uint          `json:"id" gorm:"primaryKey"`
+	OrderID   uint          `json:"order_id" gorm:"not null;index"`
+	ProductID uint          `json:"product_id" gorm:"not null;index"`
+	VariantID *uint         `json:"variant_id,omitempty"`
+	Name      string        `json:"name" gorm:"not null"`
+	SKU       string        `json:"sku,omitempty" gorm:"column:sku;size:64"`
+	UnitPrice money.Decimal `json:"unit_price" gorm:"type:decimal(10,2);not null"`
+	Quantity  int           `json:"quantity" gorm:"not null"`
+	Subtotal  money.Decimal `json:"subtotal" gorm:"type:decimal(12,2);not null"`
+}
+
+// TableName 指定表名
+func (OrderItem) TableName() string {
+	return "order_items"
+}
+
+// OrderHandler 购物车、下单与订单状态处理器
+type OrderHandler struct {
+	db       *gorm.DB
+	products *ProductHandler
+	payments payment.Provider
+}
+
+// NewOrderHandler 创建订单处理器，库存变动通过 products 清除产品缓存
+func NewOrderHandler(db *gorm.DB, products *ProductHandler, payments payment.Provider) *OrderHandler {
+	return &OrderHandler{db: db, products: products, payments: payments}
+}
+
+type cartItemRequest struct {
+	ProductID uint  `json:"product_id"`
+	VariantID *uint `json:"variant_id"`
+	Quantity  int   `json:"quantity"`
+}
+
+type payRequest struct {
+	Token string `json:"token"`
+}
+
+// GetCart 获取当前用户的购物车，没有购物车时返回空购物车
+func (h *OrderHandler) GetCart(c echo.Context) error {
+	ctx := c.Request().Context()
+	tracer := otel.Tracer("api-service")
+	ctx, span := tracer.Start(ctx, "OrderHandler.GetCart")
+	span.SetAttributes(attribute.String("Request-ID", c.Response().Header().Get("X-Request-ID")))
+	defer span.End()
+
+	userID, err := currentUserID(c)
+	if err != nil {
+		return err
+	}
+	cart, err := findCart(h.db.WithContext(ctx), userID)
+	if err != nil {
+		span.RecordError(err)
+		return httpError(err)
+	}
+	return c.JSON(http.StatusOK, cart)
+}
+
+// AddCartItem 加入购物车，相同产品与变体的条目合并数量
+func (h *OrderHandler) AddCartItem(c echo.Context) error {
+	ctx := c.Request().Context()
+	tracer := otel.Tracer("api-service")
+	ctx, span := tracer.Start(ctx, "OrderHandler.AddCartItem")
+	span.SetAttributes(attribute.String("Request-ID", c.Response().Header().Get("X-Request-ID")))
+	defer span.End()
+
+	userID, err := currentUserID(c)
+	if err != nil {
+		return err
+	}
+	var req cartItemRequest
+	if err := c.Bind(&req); err != nil {
+		span.RecordError(err)
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	if req.ProductID == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "product_id is required")
+	}
+	if err := validateCartQuantity(req.Quantity); err != nil {
+		return err
+	}
+
+	var cart *Cart
+	err = h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if _, _, err := purchasable(tx, req.ProductID, req.VariantID); err != nil {
+			return err
+		}
+		var current Cart
+		if err := tx.Where(Cart{UserID: userID}).FirstOrCreate(&current).Error; err != nil {
+			return err
+		}
+
+		query := tx.Where("cart_id = ? AND product_id = ?", current.ID, req.ProductID)
+		if req.VariantID == nil {
+			query = query.Where("variant_id IS NULL")
+		} else {
+			query = query.Where("variant_id = ?", *req.VariantID)
+		}
+		var item CartItem
+		err := query.First(&item).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			item = CartItem{CartID: current.ID, ProductID: req.ProductID, VariantID: req.VariantID, Quantity: req.Quantity}
+			err = tx.Create(&item).Error
+		case err == nil:
+			if err := validateCartQuantity(item.Quantity + req.Quantity); err != nil {
+				return err
+			}
+			err = tx.Model(&item).Update("quantity", item.Quantity+req.Quantity).Error
+		}
+		if err != nil {
+			return err
+		}
+		cart, err = findCart(tx, userID)
+		return err
+	})
+	if err != nil {
+		span.RecordError(err)
+		return httpError(err)
+	}
+	return c.JSON(http.StatusOK, cart)
+}
+
+// UpdateCartItem 修改购物车条目数量
+func (h *OrderHandler) UpdateCartItem(c echo.Context) error {
+	ctx := c.Request().Context()
+	tracer := otel.Tracer("api-service")
+	ctx, span := tracer.Start(ctx, "OrderHandler.UpdateCartItem")
+	span.SetAttributes(attribute.String("Request-ID", c.Response().Header().Get("X-Request-ID")))
+	defer span.End()
+
+	userID, itemID, err := cartItemParams(c)
+	if err != nil {
+		return err
+	}
+	var req cartItemRequest
+	if err := c.Bind(&req); err != nil {
+		span.RecordError(err)
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	if err := validateCartQuantity(req.Quantity); err != nil {
+		return err
+	}
+
+	result := h.db.WithContext(ctx).Model(&CartItem{}).
+		Where("id = ? AND cart_id IN (SELECT id FROM carts WHERE user_id = ?)", itemID, userID).
+		Update("quantity", req.Quantity)
+	if result.Error != nil {
+		span.RecordError(result.Error)
+		return echo.NewHTTPError(http.StatusInternalServerError, result.Error.Error())
+	}
+	if result.RowsAffected == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, "Cart item not found")
+	}
+	cart, err := findCart(h.db.WithContext(ctx), userID)
+	if err != nil {
+		span.RecordError(err)
+		return httpError(err)
+	}
+	return c.JSON(http.StatusOK, cart)
+}
+
+// RemoveCartItem 从购物车移除条目
+func (h *OrderHandler) RemoveCartItem(c echo.Context) error {
+	ctx := c.Request().Context()
+	tracer := otel.Tracer("api-service")
+	ctx, span := tracer.Start(ctx, "OrderHandler.RemoveCartItem")
+	span.SetAttributes(attribute.String("Request-ID", c.Response().Header().Get("X-Request-ID")))
+	defer span.End()
+
+	userID, itemID, err := cartItemParams(c)
+	if err != nil {
+		return err
+	}
+	result := h.db.WithContext(ctx).
+		Where("id = ? AND cart_id IN (SELECT id FROM carts WHERE user_id = ?)", itemID, userID).
+		Delete(&CartItem{})
+	if result.Error != nil {
+		span.RecordError(result.Error)
+		return echo.NewHTTPError(http.StatusInternalServerError, result.Error.Error())
+	}
+	if result.RowsAffected == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, "Cart item not found")
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// Checkout 将购物车下单：在同一事务中扣减库存、快照价格、创建订单并清空购物车
+func (h *OrderHandler) Checkout(c echo.Context) error {
+	ctx := c.Request().Context()
+	tracer := otel.Tracer("api-service")
+	ctx, span := tracer.Start(ctx, "OrderHandler.Checkout")
+	span.SetAttributes(attribute.String("Request-ID", c.Response().Header().Get("X-Request-ID")))
+	defer span.End()
+
+	userID, err := currentUserID(c)
+	if err != nil {
+		return err
+	}
+	actor := currentActor(c)
+
+	var order Order
+	err = h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// 锁定购物车，重复提交的结算依次执行，后执行的请求读到已清空的购物车
+		cart, err := findCart(tx.Clauses(clause.Locking{Strength: "UPDATE"}), userID)
+		if err != nil {
+			return err
+		}
+		if len(cart.Items) == 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "cart is empty")
+		}
+
+		order = Order{UserID: userID, Status: OrderPending}
+		for _, item := range cart.Items {
+			product, variant, err := purchasable(tx, item.ProductID, item.VariantID)
+			if err != nil {
+				return err
+			}
+			if order.Currency == "" {
+				order.Currency = product.Currency
+			} else if order.Currency != product.Currency {
+				return echo.NewHTTPError(http.StatusUnprocessableEntity, "all items in an order must use the same currency")
+			}
+			line := OrderItem{
+				ProductID: product.ID,
+				VariantID: item.VariantID,
+				Name:      product.Name,
+				UnitPrice: product.Price,
+				Quantity:  item.Quantity,
+			}
+			if variant != nil {
+				line.SKU = variant.SKU
+				if variant.Price != nil {
+					line.UnitPrice = *variant.Price
+				}
+			}
+			line.Subtotal = line.UnitPrice.Mul(int64(line.Quantity))
+			order.Total = order.Total.Add(line.Subtotal)
+			order.Items = append(order.Items, line)
+
+			if err := decrementStock(tx, item.ProductID, item.VariantID, item.Quantity); err != nil {
+				var httpErr *echo.HTTPError
+				if errors.As(err, &httpErr) && httpErr.Code == http.StatusConflict {
+					return echo.NewHTTPError(http.StatusConflict, fmt.Sprintf("insufficient stock for %q", product.Name))
+				}
+				return err
+			}
+		}
+
+		if err := tx.Create(&order).Error; err != nil {
+			return err
+		}
+		movements := make([]StockMovement, len(order.Items))
+		for i, line := range order.Items {
+			movements[i] = StockMovement{
+				ProductID: line.ProductID,
+				VariantID: line.VariantID,
+				Delta:     -line.Quantity,
+				Reason:    StockReasonOrder,
+				Note:      orderNote(order.ID),
+				Actor:     actor,
+			}
+		}
+		if err := tx.Create(&movements).Error; err != nil {
+			return err
+		}
+		// 下单的商品必须仍在购物车中，否则说明购物车已被并发修改
+		result := tx.Where("cart_id = ?", cart.ID).Delete(&CartItem{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected < int64(len(cart.Items)) {
+			return echo.NewHTTPError(http.StatusConflict, "cart changed during checkout, please try again")
+		}
+		return h.stockChangedTx(tx, order.Items)
+	})
+	if err != nil {
+		span.RecordError(err)
+		return httpError(err)
+	}
+
+	h.stockChanged(ctx, order.Items)
+	return c.JSON(http.StatusCreated, order)
+}
+
+// ListOrders 获取当前用户的订单，可按 status 过滤
+func (h *OrderHandler) ListOrders(c echo.Context) error {
+	ctx := c.Request().Context()
+	tracer := otel.Tracer("api-service")
+	ctx, span := tracer.Start(ctx, "OrderHandler.ListOrders")
+	span.SetAttributes(attribute.String("Request-ID", c.Response().Header().Get("X-Request-ID")))
+	defer span.End()
+
+	userID, err := currentUserID(c)
+	if err != nil {
+		return err
+	}
+	query := h.db.WithContext(ctx).Where("user_id = ?", userID)
+	if status := c.QueryParam("status"); status != "" {
+		if !validOrderStatus(status) {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unknown order status %q", status))
+		}
+		query = query.Where("status = ?", status)
+	}
+	orders := []Order{}
+	if err := query.Preload("Items").Order("id DESC").Find(&orders).Error; err != nil {
+		span.RecordError(err)
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, orders)
+}
+
+// GetOrder 获取当前用户的订单
+func (h *OrderHandler) GetOrder(c echo.Context) error {
+	ctx := c.Request().Context()
+	tracer := otel.Tracer("api-service")
+	ctx, span := tracer.Start(ctx, "OrderHandler.GetOrder")
+	span.SetAttributes(attribute.String("Request-ID", c.Response().Header().Get("X-Request-ID")))
+	defer span.End()
+
+	order, err := h.ownOrder(c, h.db.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, order)
+}
+
+// PayOrder 通过支付渠道支付待支付订单，支付被拒绝时返回 402
+func (h *OrderHandler) PayOrder(c echo.Context) error {
+	ctx := c.Request().Context()
+	tracer := otel.Tracer("api-service")
+	ctx, span := tracer.Start(ctx, "OrderHandler.PayOrder")
+	span.SetAttributes(attribute.String("Request-ID", c.Response().Header().Get("X-Request-ID")))
+	defer span.End()
+
+	var req payRequest
+	if err := c.Bind(&req); err != nil {
+		span.RecordError(err)
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	order, err := h.ownOrder(c, h.db.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	if err := checkTransition(order.Status, OrderPaid); err != nil {
+		return err
+	}
+
+	// 幂等键按订单生成，客户端重试不会重复扣款
+	charge, err := h.payments.Charge(ctx, payment.ChargeRequest{
+		IdempotencyKey: fmt.Sprintf("order-%d", order.ID),
+		Amount:         order.Total,
+		Currency:       order.Currency,
+		Token:          req.Token,
+		Description:    orderNote(order.ID),
+	})
+	if errors.Is(err, payment.ErrDeclined) {
+		return echo.NewHTTPError(http.StatusPaymentRequired, err.Error())
+	}
+	if err != nil {
+		span.RecordError(err)
+		return echo.NewHTTPError(http.StatusBadGateway, err.Error())
+	}
+
+	order.PaymentID = charge.ID
+	err = transitionOrder(h.db.WithContext(ctx), order, OrderPaid, map[string]interface{}{"payment_id": charge.ID})
+	if err != nil {
+		span.RecordError(err)
+		// 订单已被并发取消，退回刚完成的扣款
+		if refundErr := h.payments.Refund(ctx, charge.ID); refundErr != nil {
+			span.RecordError(refundErr)
+		}
+		return httpError(err)
+	}
+	return c.JSON(http.StatusOK, order)
+}
+
+// ShipOrder 标记订单已发货，路由限制为管理员
+func (h *OrderHandler) ShipOrder(c echo.Context) error {
+	return h.advanceOrder(c, "OrderHandler.ShipOrder", OrderShipped)
+}
+
+// CompleteOrder 标记订单已完成，路由限制为管理员
+func (h *OrderHandler) CompleteOrder(c echo.Context) error {
+	return h.advanceOrder(c, "OrderHandler.CompleteOrder", OrderCompleted)
+}
+
+// CancelOrder 取消当前用户发货前的订单，归还库存，已支付的订单同时退款
+func (h *OrderHandler) CancelOrder(c echo.Context) error {
+	ctx := c.Request().Context()
+	tracer := otel.Tracer("api-service")
+	ctx, span := tracer.Start(ctx, "OrderHandler.CancelOrder")
+	span.SetAttributes(attribute.String("Request-ID", c.Response().Header().Get("X-Request-ID")))
+	defer span.End()
+
+	order, err := h.ownOrder(c, h.db.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	actor := currentActor(c)
+	err = h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		paymentID := order.PaymentID
+		if err := transitionOrder(tx, order, OrderCancelled, nil); err != nil {
+			return err
+		}
+		for _, line := range order.Items {
+			err := incrementStock(tx, line.ProductID, line.VariantID, line.Quantity)
+			var httpErr *echo.HTTPError
+			if errors.As(err, &httpErr) && httpErr.Code == http.StatusNotFound {
+				// 产品或变体已删除，无处归还库存
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if err := tx.Create(&StockMovement{
+				ProductID: line.ProductID,
+				VariantID: line.VariantID,
+				Delta:     line.Quantity,
+				Reason:    StockReasonRestock,
+				Note:      orderNote(order.ID),
+				Actor:     actor,
+			}).Error; err != nil {
+				return err
+			}
+		}
+		if err := h.stockChangedTx(tx, order.Items); err != nil {
+			return err
+		}
+		// 退款放在事务提交前，退款失败时订单保持原状态，可以重试
+		if paymentID != "" {
+			if err := h.payments.Refund(ctx, paymentID); err != nil {
+				return echo.NewHTTPError(http.StatusBadGateway, "refund failed: "+err.Error())
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		span.RecordError(err)
+		return httpError(err)
+	}
+
+	h.stockChanged(ctx, order.Items)
+	return c.JSON(http.StatusOK, order)
+}
+
+// advanceOrder 履约状态变更，由后台操作，不限制订单所属用户
+func (h *OrderHandler) advanceOrder(c echo.Context, spanName, status string) error {
+	ctx := c.Request().Context()
+	tracer := otel.Tracer("api-service")
+	ctx, span := tracer.Start(ctx, spanName)
+	span.SetAttributes(attribute.String("Request-ID", c.Response().Header().Get("X-Request-ID")))
+	defer span.End()
+
+	orderID, err := orderIDParam(c)
+	if err != nil {
+		return err
+	}
+	var order Order
+	if err := h.db.WithContext(ctx).Preload("Items").First(&order, orderID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "Order not found")
+		}
+		span.RecordError(err)
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	if err := transitionOrder(h.db.WithContext(ctx), &order, status, nil); err != nil {
+		span.RecordError(err)
+		return httpError(err)
+	}
+	return c.JSON(http.StatusOK, order)
+}
+
+// ownOrder 按路径参数加载当前用户的订单，其他用户的订单返回 404
+func (h *OrderHandler) ownOrder(c echo.Context, tx *gorm.DB) (*Order, error) {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return nil, err
+	}
+	orderID, err := orderIDParam(c)
+	if err != nil {
+		return nil, err
+	}
+	var order Order
+	err = tx.Preload("Items").Where("user_id = ?", userID).First(&order, orderID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "Order not found")
+	}
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return &order, nil
+}
+
+// stockChanged 清除订单涉及产品的缓存
+func (h *OrderHandler) stockChanged(ctx context.Context, items []OrderItem) {
+	if h.products == nil {
+		return
+	}
+	seen := make(map[uint]bool, len(items))
+	for _, line := range items {
+		if !seen[line.ProductID] {
+			seen[line.ProductID] = true
+			h.products.stockChanged(ctx, line.ProductID)
+		}
+	}
+}
+
+// stockChangedTx 在事务内通知订单涉及产品的库存变更
+func (h *OrderHandler) stockChangedTx(tx *gorm.DB, items []OrderItem) error {
+	if h.products == nil {
+		return nil
+	}
+	seen := make(map[uint]bool, len(items))
+	for _, line := range items {
+		if !seen[line.ProductID] {
+			seen[line.ProductID] = true
+			if err := h.products.stockChangedTx(tx, line.ProductID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// transitionOrder 条件更新订单状态并记录时间，防止并发请求重复变更
+func transitionOrder(tx *gorm.DB, order *Order, to string, updates map[string]interface{}) error {
+	if err := checkTransition(order.Status, to); err != nil {
+		return err
+	}
+	now := time.Now()
+	if updates == nil {
+		updates = map[string]interface{}{}
+	}
+	updates["status"] = to
+	switch to {
+	case OrderPaid:
+		updates["paid_at"] = now
+		order.PaidAt = &now
+	case OrderShipped:
+		updates["shipped_at"] = now
+		order.ShippedAt = &now
+	case OrderCompleted:
+		updates["completed_at"] = now
+		order.CompletedAt = &now
+	case OrderCancelled:
+		updates["cancelled_at"] = now
+		order.CancelledAt = &now
+	}
+	result := tx.Model(&Order{}).Where("id = ? AND status = ?", order.ID, order.Status).Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return echo.NewHTTPError(http.StatusConflict, "order status changed concurrently")
+	}
+	order.Status = to
+	return nil
+}
+
+func checkTransition(from, to string) error {
+	for _, next := range orderTransitions[from] {
+		if next == to {
+			return nil
+		}
+	}
+	return echo.NewHTTPError(http.StatusConflict, fmt.Sprintf("cannot change order from %s to %s", from, to))
+}
+
+func validOrderStatus(status string) bool {
+	switch status {
+	case OrderPending, OrderPaid, OrderShipped, OrderCompleted, OrderCancelled:
+		return true
+	}
+	return false
+}
+
+// purchasable 校验产品（及变体）存在且在售，返回用于快照的产品与变体
+func purchasable(tx *gorm.DB, productID uint, variantID *uint) (*Product, *ProductVariant, error) {
+	var product Product
+	err := tx.Where("deleted_at IS NULL").First(&product, productID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, echo.NewHTTPError(http.StatusNotFound, "Product not found")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if product.Status == "inactive" {
+		return nil, nil, echo.NewHTTPError(http.StatusConflict, fmt.Sprintf("product %q is not available", product.Name))
+	}
+	if variantID == nil {
+		if err := requireNoVariants(tx, productID); err != nil {
+			return nil, nil, err
+		}
+		return &product, nil, nil
+	}
+	var variant ProductVariant
+	if err := findVariant(tx, productID, *variantID, &variant); err != nil {
+		return nil, nil, err
+	}
+	return &product, &variant, nil
+}
+
+// findCart 加载用户购物车，条目按产品排序，下单时以固定顺序加锁避免死锁
+func findCart(tx *gorm.DB, userID uint) (*Cart, error) {
+	var cart Cart
+	err := tx.Preload("Items", func(db *gorm.DB) *gorm.DB {
+		return db.Order("product_id, id")
+	}).Where("user_id = ?", userID).First(&cart).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &Cart{UserID: userID, Items: []CartItem{}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &cart, nil
+}
+
+func validateCartQuantity(quantity int) error {
+	if quantity <= 0 || quantity > cartMaxQuantity {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("quantity must be between 1 and %d", cartMaxQuantity))
+	}
+	return nil
+}
+
+func cartItemParams(c echo.Context) (uint, uint, error) {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return 0, 0, err
+	}
+	itemID, err := strconv.ParseUint(c.Param("item_id"), 10, 64)
+	if err != nil || itemID == 0 {
+		return 0, 0, echo.NewHTTPError(http.StatusBadRequest, "Invalid cart item ID")
+	}
+	return userID, uint(itemID), nil
+}
+
+func orderIDParam(c echo.Context) (uint, error) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, "Invalid order ID")
+	}
+	return uint(id), nil
+}
+
+func orderNote(orderID uint) string {
+	return fmt.Sprintf("order #%d", orderID)
+}
@@ -0,0 +1,308 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/songfei1983/play-go-api/internal/payment"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrders(t *testing.T) {
+	e, products, mock, redisMock := setupProductTest(t)
+	payments := payment.NewFakeProvider()
+	handler := NewOrderHandler(products.db, products, payments)
+
+	newContext := func(method, body string, params ...string) (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(method, "/", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set("user", &jwt.Token{Claims: jwt.MapClaims{"user_id": float64(7), "username": "alice"}})
+		if len(params) > 0 {
+			c.SetParamNames("id")
+			c.SetParamValues(params...)
+		}
+		return c, rec
+	}
+	expectProduct := func(id int, name, price string) {
+		mock.ExpectQuery("SELECT \\* FROM `products` WHERE deleted_at IS NULL AND `products`\\.`id` = \\?").
+			WithArgs(id, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "price", "currency", "stock", "status"}).
+				AddRow(id, name, price, "USD", 10, "active"))
+	}
+	expectNoVariants := func(id int) {
+		mock.ExpectQuery("SELECT count\\(\\*\\) FROM `product_variants` WHERE product_id = \\?").
+			WithArgs(id).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	}
+	expectCart := func(items *sqlmock.Rows) {
+		mock.ExpectQuery("SELECT \\* FROM `carts` WHERE user_id = \\?").
+			WithArgs(7, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "user_id"}).AddRow(3, 7))
+		mock.ExpectQuery("SELECT \\* FROM `cart_items` WHERE `cart_items`\\.`cart_id` = \\? ORDER BY product_id, id").
+			WithArgs(3).
+			WillReturnRows(items)
+	}
+	expectOrder := func(status, paymentID string) {
+		mock.ExpectQuery("SELECT \\* FROM `orders` WHERE user_id = \\? AND `orders`\\.`id` = \\?").
+			WithArgs(7, 20, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "status", "currency", "total", "payment_id"}).
+				AddRow(20, 7, status, "USD", "35.50", paymentID))
+		mock.ExpectQuery("SELECT \\* FROM `order_items` WHERE `order_items`\\.`order_id` = \\?").
+			WithArgs(20).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "order_id", "product_id", "variant_id", "name", "unit_price", "quantity", "subtotal"}).
+				AddRow(1, 20, 1, nil, "Mug", "10.00", 2, "20.00"))
+	}
+	cartItemColumns := []string{"id", "cart_id", "product_id", "variant_id", "quantity"}
+
+	t.Run("未登录", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+
+		err := handler.GetCart(c)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusUnauthorized, err.(*echo.HTTPError).Code)
+	})
+
+	t.Run("加入购物车合并数量", func(t *testing.T) {
+		c, rec := newContext(http.MethodPost, `{"product_id":1,"quantity":2}`)
+
+		mock.ExpectBegin()
+		expectProduct(1, "Mug", "10.00")
+		expectNoVariants(1)
+		mock.ExpectQuery("SELECT \\* FROM `carts` WHERE `carts`\\.`user_id` = \\?").
+			WithArgs(7, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "user_id"}).AddRow(3, 7))
+		mock.ExpectQuery("SELECT \\* FROM `cart_items` WHERE \\(cart_id = \\? AND product_id = \\?\\) AND variant_id IS NULL").
+			WithArgs(3, 1, 1).
+			WillReturnRows(sqlmock.NewRows(cartItemColumns).AddRow(9, 3, 1, nil, 1))
+		mock.ExpectExec("UPDATE `cart_items` SET `quantity`=\\?,`updated_at`=\\? WHERE `id` = \\?").
+			WithArgs(3, sqlmock.AnyArg(), 9).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		expectCart(sqlmock.NewRows(cartItemColumns).AddRow(9, 3, 1, nil, 3))
+		mock.ExpectCommit()
+
+		require.NoError(t, handler.AddCartItem(c))
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var cart Cart
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &cart))
+		require.Len(t, cart.Items, 1)
+		assert.Equal(t, 3, cart.Items[0].Quantity)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("数量非法", func(t *testing.T) {
+		c, _ := newContext(http.MethodPost, `{"product_id":1,"quantity":0}`)
+
+		err := handler.AddCartItem(c)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	})
+
+	t.Run("下单扣减库存并快照价格", func(t *testing.T) {
+		c, rec := newContext(http.MethodPost, "")
+
+		mock.ExpectBegin()
+		expectCart(sqlmock.NewRows(cartItemColumns).
+			AddRow(9, 3, 1, nil, 2).
+			AddRow(10, 3, 2, 5, 1))
+		expectProduct(1, "Mug", "10.00")
+		expectNoVariants(1)
+		mock.ExpectExec("UPDATE `products` SET `stock`=stock - \\?").
+			WithArgs(2, sqlmock.AnyArg(), 1, 2).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		expectProduct(2, "Tee", "12.00")
+		mock.ExpectQuery("SELECT \\* FROM `product_variants` WHERE product_id = \\? AND `product_variants`\\.`id` = \\?").
+			WithArgs(2, 5, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "product_id", "sku", "price", "stock"}).
+				AddRow(5, 2, "TEE-M", "15.50", 4))
+		mock.ExpectExec("UPDATE `product_variants` SET `stock`=stock - \\?").
+			WithArgs(1, sqlmock.AnyArg(), 5, 2, 1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("UPDATE `products` SET `stock`=stock - \\?").
+			WithArgs(1, sqlmock.AnyArg(), 2).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO `orders`").
+			WithArgs(7, OrderPending, "USD", "35.50", "", nil, nil, nil, nil, sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(20, 1))
+		mock.ExpectExec("INSERT INTO `order_items`").
+			WithArgs(20, 1, nil, "Mug", "", "10.00", 2, "20.00",
+				20, 2, 5, "Tee", "TEE-M", "15.50", 1, "15.50").
+			WillReturnResult(sqlmock.NewResult(1, 2))
+		mock.ExpectExec("INSERT INTO `inventory_ledger`").
+			WithArgs(1, nil, nil, -2, StockReasonOrder, "order #20", "alice", sqlmock.AnyArg(),
+				2, 5, nil, -1, StockReasonOrder, "order #20", "alice", sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 2))
+		mock.ExpectExec("DELETE FROM `cart_items` WHERE cart_id = \\?").
+			WithArgs(3).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectCommit()
+		redisMock.ExpectDel("products:1").SetVal(1)
+		redisMock.ExpectDel("products:2").SetVal(1)
+
+		require.NoError(t, handler.Checkout(c))
+		assert.Equal(t, http.StatusCreated, rec.Code)
+
+		var order Order
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &order))
+		assert.Equal(t, uint(20), order.ID)
+		assert.Equal(t, "35.50", order.Total.String())
+		assert.Equal(t, OrderPending, order.Status)
+		require.Len(t, order.Items, 2)
+		assert.Equal(t, "15.50", order.Items[1].UnitPrice.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+		assert.NoError(t, redisMock.ExpectationsWereMet())
+	})
+
+	t.Run("库存不足", func(t *testing.T) {
+		c, _ := newContext(http.MethodPost, "")
+
+		mock.ExpectBegin()
+		expectCart(sqlmock.NewRows(cartItemColumns).AddRow(9, 3, 1, nil, 50))
+		expectProduct(1, "Mug", "10.00")
+		expectNoVariants(1)
+		mock.ExpectExec("UPDATE `products` SET `stock`=stock - \\?").
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery("SELECT count\\(\\*\\) FROM `products` WHERE id = \\? AND deleted_at IS NULL").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		expectNoVariants(1)
+		mock.ExpectRollback()
+
+		err := handler.Checkout(c)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusConflict, err.(*echo.HTTPError).Code)
+		assert.Contains(t, err.(*echo.HTTPError).Message, "Mug")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("结算时锁定购物车", func(t *testing.T) {
+		c, _ := newContext(http.MethodPost, "")
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT \\* FROM `carts` WHERE user_id = \\? ORDER BY `carts`\\.`id` LIMIT \\? FOR UPDATE").
+			WithArgs(7, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "user_id"}).AddRow(3, 7))
+		mock.ExpectQuery("SELECT \\* FROM `cart_items`").
+			WithArgs(3).
+			WillReturnRows(sqlmock.NewRows(cartItemColumns).AddRow(9, 3, 1, nil, 2))
+		expectProduct(1, "Mug", "10.00")
+		expectNoVariants(1)
+		mock.ExpectExec("UPDATE `products` SET `stock`=stock - \\?").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO `orders`").WillReturnResult(sqlmock.NewResult(21, 1))
+		mock.ExpectExec("INSERT INTO `order_items`").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("INSERT INTO `inventory_ledger`").WillReturnResult(sqlmock.NewResult(1, 1))
+		// 商品已被并发结算从购物车中删除
+		mock.ExpectExec("DELETE FROM `cart_items` WHERE cart_id = \\?").
+			WithArgs(3).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		err := handler.Checkout(c)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusConflict, err.(*echo.HTTPError).Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("空购物车", func(t *testing.T) {
+		c, _ := newContext(http.MethodPost, "")
+
+		mock.ExpectBegin()
+		expectCart(sqlmock.NewRows(cartItemColumns))
+		mock.ExpectRollback()
+
+		err := handler.Checkout(c)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("支付被拒绝", func(t *testing.T) {
+		c, _ := newContext(http.MethodPost, `{"token":"`+payment.DeclinedToken+`"}`, "20")
+
+		expectOrder(OrderPending, "")
+
+		err := handler.PayOrder(c)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusPaymentRequired, err.(*echo.HTTPError).Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	var chargeID string
+
+	t.Run("支付订单", func(t *testing.T) {
+		c, rec := newContext(http.MethodPost, `{"token":"tok_visa"}`, "20")
+
+		expectOrder(OrderPending, "")
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE `orders` SET `paid_at`=\\?,`payment_id`=\\?,`status`=\\?,`updated_at`=\\? WHERE id = \\? AND status = \\?").
+			WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), OrderPaid, sqlmock.AnyArg(), 20, OrderPending).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		require.NoError(t, handler.PayOrder(c))
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var order Order
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &order))
+		assert.Equal(t, OrderPaid, order.Status)
+		assert.NotNil(t, order.PaidAt)
+		chargeID = order.PaymentID
+		charge, ok := payments.Lookup(chargeID)
+		require.True(t, ok)
+		assert.Equal(t, "35.50", charge.Amount.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("非法状态变更", func(t *testing.T) {
+		c, _ := newContext(http.MethodPost, "", "20")
+
+		mock.ExpectQuery("SELECT \\* FROM `orders` WHERE `orders`\\.`id` = \\?").
+			WithArgs(20, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "status"}).AddRow(20, 7, OrderPending))
+		mock.ExpectQuery("SELECT \\* FROM `order_items`").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "order_id"}))
+
+		err := handler.CompleteOrder(c)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusConflict, err.(*echo.HTTPError).Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("取消已支付订单退款并归还库存", func(t *testing.T) {
+		c, rec := newContext(http.MethodPost, "", "20")
+
+		expectOrder(OrderPaid, chargeID)
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE `orders` SET `cancelled_at`=\\?,`status`=\\?,`updated_at`=\\? WHERE id = \\? AND status = \\?").
+			WithArgs(sqlmock.AnyArg(), OrderCancelled, sqlmock.AnyArg(), 20, OrderPaid).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("UPDATE `products` SET `stock`=stock \\+ \\?").
+			WithArgs(2, sqlmock.AnyArg(), 1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO `inventory_ledger`").
+			WithArgs(1, nil, nil, 2, StockReasonRestock, "order #20", "alice", sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(3, 1))
+		mock.ExpectCommit()
+		redisMock.ExpectDel("products:1").SetVal(1)
+
+		require.NoError(t, handler.CancelOrder(c))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"status":"cancelled"`)
+
+		charge, ok := payments.Lookup(chargeID)
+		require.True(t, ok)
+		assert.Equal(t, payment.StatusRefunded, charge.Status)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+
+	"github.com/songfei1983/play-go-api/internal/events"
+	"gorm.io/gorm"
+)
+
+// eventSuffixes 变更类型对应的事件名后缀，如 Product + Created
+var eventSuffixes = map[ChangeType]string{
+	ChangeCreated:  "Created",
+	ChangeUpdated:  "Updated",
+	ChangeDeleted:  "Deleted",
+	ChangeRestored: "Restored",
+}
+
+// PublishEvents 在每次变更的写入事务中追加领域事件（如 ProductCreated、UserDeleted）
+// 到 outbox 表，事务回滚时事件一并丢弃，由 events.Relay 异步发布
+func (h *BaseHandler[T]) PublishEvents() {
+	h.OnChangeTx(appendEvent[T])
+}
+
+// appendEvent 事务内变更回调，事件内容为事务内重新读取的完整记录，记录已不存在时为 null
+func appendEvent[T Model](tx *gorm.DB, change Change[T]) error {
+	var model T
+	aggregate := reflect.TypeOf(model).Name()
+
+	var payload JSONValue
+	err := tx.First(&model, change.ID).Error
+	switch {
+	case err == nil:
+		if payload, err = snapshotOf(model); err != nil {
+			return err
+		}
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return err
+	}
+
+	info := requestInfoFrom(tx.Statement.Context)
+	metadata := map[string]string{"actor": info.Actor}
+	if info.RequestID != "" {
+		metadata["request_id"] = info.RequestID
+	}
+	return events.Append(tx, aggregate, strconv.FormatUint(uint64(change.ID), 10),
+		aggregate+eventSuffixes[change.Type], payload, metadata)
+}
@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublishEvents(t *testing.T) {
+	e, products, mock, _ := setupProductTest(t)
+	products.PublishEvents()
+	ctx := context.WithValue(context.Background(), requestInfoKey{}, requestInfo{Actor: "alice", RequestID: "req-1"})
+	productColumns := []string{"id", "name", "description", "price", "stock", "status", "created_at", "updated_at", "deleted_at"}
+
+	newCreate := func() (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodPost, "/products", strings.NewReader(`{"name":"Lamp","price":10}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req = req.WithContext(ctx)
+		rec := httptest.NewRecorder()
+		return e.NewContext(req, rec), rec
+	}
+
+	t.Run("创建时在同一事务中写入事件", func(t *testing.T) {
+		c, rec := newCreate()
+
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO `products`").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectQuery("SELECT \\* FROM `products` WHERE `products`\\.`id` = \\?").
+			WithArgs(1, 1).
+			WillReturnRows(sqlmock.NewRows(productColumns).AddRow(1, "Lamp", "", 10, 5, "active", time.Now(), time.Now(), nil))
+		mock.ExpectExec("INSERT INTO `outbox_events`").
+			WithArgs("Product", "1", "ProductCreated", sqlmock.AnyArg(), `{"actor":"alice","request_id":"req-1"}`, sqlmock.AnyArg(), nil, nil, 0, "").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		require.NoError(t, products.Create(c))
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("写入事件失败时回滚变更", func(t *testing.T) {
+		c, rec := newCreate()
+
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO `products`").WillReturnResult(sqlmock.NewResult(2, 1))
+		mock.ExpectQuery("SELECT \\* FROM `products` WHERE `products`\\.`id` = \\?").
+			WithArgs(2, 1).
+			WillReturnRows(sqlmock.NewRows(productColumns).AddRow(2, "Lamp", "", 10, 5, "active", time.Now(), time.Now(), nil))
+		mock.ExpectExec("INSERT INTO `outbox_events`").WillReturnError(errors.New("outbox unavailable"))
+		mock.ExpectRollback()
+
+		require.NoError(t, products.Create(c))
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,206 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/songfei1983/play-go-api/internal/money"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ProductPrice 产品在指定币种下的固定价格，优先于汇率换算
+type ProductPrice struct {
+	ID        uint          `json:"-" gorm:"primaryKey"`
+	ProductID uint          `json:"-" gorm:"not null;uniqueIndex:idx_product_prices_product_currency"`
+	Currency  string        `json:"currency" gorm:"type:char(3);not null;uniqueIndex:idx_product_prices_product_currency"`
+	Amount    money.Decimal `json:"amount" gorm:"type:decimal(10,2);not null"`
+	CreatedAt time.Time     `json:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (ProductPrice) TableName() string {
+	return "product_prices"
+}
+
+type priceRequest struct {
+	Amount *money.Decimal `json:"amount"`
+}
+
+// UseExchangeRates 替换汇率表，产品只能使用汇率表中的币种
+func (h *ProductHandler) UseExchangeRates(rates *money.Rates) {
+	h.rates = rates
+}
+
+// validateCurrency 产品的币种必须在汇率表中，空币种在保存时使用默认币种
+func (h *ProductHandler) validateCurrency(p Product) error {
+	if p.Currency != "" && !h.rates.Supports(p.Currency) {
+		return errors.New("unsupported currency, supported: " + strings.Join(h.rates.Currencies(), ", "))
+	}
+	return nil
+}
+
+// ListPrices 获取产品的多币种价格表
+func (h *ProductHandler) ListPrices(c echo.Context) error {
+	ctx := c.Request().Context()
+	tracer := otel.Tracer("api-service")
+	ctx, span := tracer.Start(ctx, "ProductHandler.ListPrices")
+	span.SetAttributes(attribute.String("Request-ID", c.Response().Header().Get("X-Request-ID")))
+	defer span.End()
+
+	productID, err := productIDParam(c)
+	if err != nil {
+		return err
+	}
+	if err := productExists(h.db.WithContext(ctx), productID); err != nil {
+		return httpError(err)
+	}
+
+	prices := []ProductPrice{}
+	if err := h.db.WithContext(ctx).Where("product_id = ?", productID).Order("currency").Find(&prices).Error; err != nil {
+		span.RecordError(err)
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, prices)
+}
+
+// SetPrice 设置产品在指定币种下的固定价格
+func (h *ProductHandler) SetPrice(c echo.Context) error {
+	ctx := c.Request().Context()
+	tracer := otel.Tracer("api-service")
+	ctx, span := tracer.Start(ctx, "ProductHandler.SetPrice")
+	span.SetAttributes(attribute.String("Request-ID", c.Response().Header().Get("X-Request-ID")))
+	defer span.End()
+
+	productID, currency, err := h.priceParams(c)
+	if err != nil {
+		return err
+	}
+	var req priceRequest
+	if err := c.Bind(&req); err != nil {
+		span.RecordError(err)
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	if req.Amount == nil || req.Amount.IsNegative() {
+		return echo.NewHTTPError(http.StatusBadRequest, "amount must be a non-negative decimal")
+	}
+	if !req.Amount.InRange() {
+		return echo.NewHTTPError(http.StatusBadRequest, "amount must be at most "+maxPrice)
+	}
+
+	price := ProductPrice{ProductID: productID, Currency: currency, Amount: *req.Amount}
+	err = h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := productExists(tx, productID); err != nil {
+			return err
+		}
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "product_id"}, {Name: "currency"}},
+			DoUpdates: clause.AssignmentColumns([]string{"amount", "updated_at"}),
+		}).Create(&price).Error
+	})
+	if err != nil {
+		span.RecordError(err)
+		return httpError(err)
+	}
+
+	h.redis.Del(ctx, h.getCacheKey(strconv.FormatUint(uint64(productID), 10)))
+	return c.JSON(http.StatusOK, price)
+}
+
+// DeletePrice 删除固定价格，之后该币种按汇率换算
+func (h *ProductHandler) DeletePrice(c echo.Context) error {
+	ctx := c.Request().Context()
+	tracer := otel.Tracer("api-service")
+	ctx, span := tracer.Start(ctx, "ProductHandler.DeletePrice")
+	span.SetAttributes(attribute.String("Request-ID", c.Response().Header().Get("X-Request-ID")))
+	defer span.End()
+
+	productID, currency, err := h.priceParams(c)
+	if err != nil {
+		return err
+	}
+	result := h.db.WithContext(ctx).Where("product_id = ? AND currency = ?", productID, currency).Delete(&ProductPrice{})
+	if result.Error != nil {
+		span.RecordError(result.Error)
+		return echo.NewHTTPError(http.StatusInternalServerError, result.Error.Error())
+	}
+	if result.RowsAffected == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, "Price not found")
+	}
+
+	h.redis.Del(ctx, h.getCacheKey(strconv.FormatUint(uint64(productID), 10)))
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h *ProductHandler) priceParams(c echo.Context) (uint, string, error) {
+	productID, err := productIDParam(c)
+	if err != nil {
+		return 0, "", err
+	}
+	currency := strings.ToUpper(c.Param("currency"))
+	if !h.rates.Supports(currency) {
+		return 0, "", echo.NewHTTPError(http.StatusBadRequest, "unsupported currency")
+	}
+	return productID, currency, nil
+}
+
+// presentCurrency 按 currency 查询参数输出价格：优先使用固定价格，否则按汇率换算
+func (h *ProductHandler) presentCurrency(ctx context.Context, c echo.Context, products []Product) error {
+	currency := strings.ToUpper(c.QueryParam("currency"))
+	if currency == "" {
+		return nil
+	}
+	if !h.rates.Supports(currency) {
+		return echo.NewHTTPError(http.StatusBadRequest, "unsupported currency, supported: "+strings.Join(h.rates.Currencies(), ", "))
+	}
+
+	var ids []uint
+	for _, p := range products {
+		if p.ID != 0 && p.Currency != currency {
+			ids = append(ids, p.ID)
+		}
+	}
+	fixed := make(map[uint]money.Decimal)
+	if len(ids) > 0 {
+		var prices []ProductPrice
+		if err := h.db.WithContext(ctx).Where("product_id IN ? AND currency = ?", ids, currency).Find(&prices).Error; err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		for _, price := range prices {
+			fixed[price.ProductID] = price.Amount
+		}
+	}
+
+	for i := range products {
+		p := &products[i]
+		if p.Currency == currency {
+			continue
+		}
+		if amount, ok := fixed[p.ID]; ok {
+			p.Price = amount
+		} else {
+			from := p.Currency
+			if from == "" {
+				from = money.DefaultCurrency
+			}
+			converted, err := h.rates.Convert(p.Price, from, currency)
+			if errors.Is(err, money.ErrUnknownCurrency) {
+				return echo.NewHTTPError(http.StatusUnprocessableEntity, err.Error())
+			}
+			if err != nil {
+				return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+			}
+			p.Price = converted
+		}
+		p.Currency = currency
+	}
+	return nil
+}
@@ -1,23 +1,32 @@
 package handler
 
 import (
+	"errors"
 	"time"
 
 	"github.com/go-redis/redis/v8"
+	"github.com/songfei1983/play-go-api/internal/money"
+	"github.com/songfei1983/play-go-api/internal/search"
 	"gorm.io/gorm"
 )
 
 // Product 产品模型
 type Product struct {
-	ID          uint       `json:"id" gorm:"primaryKey"`
-	Name        string     `json:"name" gorm:"not null"`
-	Description string     `json:"description"`
-	Price       float64    `json:"price" gorm:"not null"`
-	Stock       int        `json:"stock" gorm:"not null"`
-	Status      string     `json:"status" gorm:"default:active"`
-	CreatedAt   time.Time  `json:"created_at"`
-	UpdatedAt   time.Time  `json:"updated_at"`
-	DeletedAt   *time.Time `json:"deleted_at,omitempty" gorm:"index"`
+	ID          uint             `json:"id" gorm:"primaryKey"`
+	Name        string           `json:"name" gorm:"not null"`
+	Description string           `json:"description"`
+	Price       money.Decimal    `json:"price" gorm:"type:decimal(10,2);not null"`
+	Currency    string           `json:"currency" gorm:"type:char(3);not null;default:USD"`
+	Stock       int              `json:"stock" gorm:"not null"`
+	Status      string           `json:"status" gorm:"default:active"`
+	CategoryID  *uint            `json:"category_id" gorm:"index"`
+	CreatedAt   time.Time        `json:"created_at"`
+	UpdatedAt   time.Time        `json:"updated_at"`
+	DeletedAt   *time.Time       `json:"deleted_at,omitempty" gorm:"index"`
+	Prices      []ProductPrice   `json:"prices,omitempty" gorm:"foreignKey:ProductID"`
+	Category    *Category        `json:"category,omitempty"`
+	Tags        []Tag            `json:"tags,omitempty" gorm:"many2many:product_tags"`
+	Variants    []ProductVariant `json:"variants,omitempty" gorm:"foreignKey:ProductID"`
 }
 
 // GetID 实现 Model 接口
@@ -30,14 +39,78 @@ func (p Product) TableName() string {
 	return "products"
 }
 
+// WritableFields 实现 WritableModel 接口。stock 的变动都经过库存调整、预留或订单并写入库存流水
+func (p Product) WritableFields() []string {
+	return []string{"name", "description", "price", "currency", "status", "category_id"}
+}
+
+// CreatableFields 实现 CreatableModel 接口，单条创建、批量创建与 insert 模式导入都可以指定初始库存
+func (p Product) CreatableFields() []string {
+	return []string{"stock"}
+}
+
+// Includes 实现 IncludableModel 接口
+func (p Product) Includes() []string {
+	return []string{"prices", "category", "tags", "variants"}
+}
+
+// FieldDependencies 实现 DependentModel 接口，价格换算需要原币种
+func (p Product) FieldDependencies() map[string][]string {
+	return map[string][]string{"price": {"currency"}}
+}
+
+// Validate 实现 Validator 接口
+func (p Product) Validate() error {
+	if p.Name == "" {
+		return errors.New("name is required")
+	}
+	if p.Price.IsNegative() {
+		return errors.New("price must not be negative")
+	}
+	if !p.Price.InRange() {
+		return errors.New("price must be at most " + maxPrice)
+	}
+	if p.Currency != "" && !money.ValidCurrency(p.Currency) {
+		return errors.New("currency must be a three letter ISO 4217 code")
+	}
+	if p.Stock < 0 {
+		return errors.New("stock must not be negative")
+	}
+	return validateStatus(p.Status)
+}
+
+// BeforeSave 未指定币种时使用默认币种，PUT 整体替换也不会写入空币种
+func (p *Product) BeforeSave(tx *gorm.DB) error {
+	if p.Currency == "" {
+		p.Currency = money.DefaultCurrency
+	}
+	return nil
+}
+
+// maxPrice DECIMAL(10,2) 价格列能存储的最大值
+const maxPrice = "99999999.99"
+
 // ProductHandler 产品处理器
 type ProductHandler struct {
 	*BaseHandler[Product]
+	searcher search.Backend
+	rates    *money.Rates
+	variants *BaseHandler[ProductVariant]
 }
 
-// NewProductHandler 创建产品处理器
+// NewProductHandler 创建产品处理器，默认使用 MySQL 全文检索
 func NewProductHandler(db *gorm.DB, redis *redis.Client) *ProductHandler {
-	return &ProductHandler{
+	h := &ProductHandler{
 		BaseHandler: NewBaseHandler[Product](db, redis),
+		searcher:    search.NewMySQLBackend(db, Product{}.TableName()),
+		variants:    NewBaseHandler[ProductVariant](db, redis),
 	}
+	rates, _ := money.NewRates(money.DefaultCurrency, nil)
+	h.UseExchangeRates(rates)
+	h.OnChange(h.syncSearchIndex)
+	h.OnChangeTx(recordInitialStock)
+	h.OnValidate(h.validateCurrency)
+	h.OnPresent(h.presentCurrency)
+	h.OnList(filterProducts)
+	return h
 }
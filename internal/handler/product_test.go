@@ -1,16 +1,27 @@
 package handler
 
 import (
+	"archive/zip"
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/go-redis/redismock/v8"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/labstack/echo/v4"
+	"github.com/songfei1983/play-go-api/internal/money"
+	"github.com/songfei1983/play-go-api/internal/search"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"gorm.io/driver/mysql"
@@ -60,6 +71,10 @@ func TestProductCRUD(t *testing.T) {
 
 		mock.ExpectBegin()
 		mock.ExpectExec("INSERT INTO `products`").WillReturnResult(sqlmock.NewResult(1, 1))
+		// 初始库存写入库存流水
+		mock.ExpectExec("INSERT INTO `inventory_ledger`").
+			WithArgs(1, nil, nil, 100, StockReasonInitial, "", "system", sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
 		mock.ExpectCommit()
 
 		err := handler.Create(c)
@@ -73,6 +88,16 @@ func TestProductCRUD(t *testing.T) {
 		assert.Equal(t, "Test Product", response.Name)
 	})
 
+	t.Run("创建时校验失败", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/products", strings.NewReader(`{"name":"Test Product","price":"1.00","currency":"JPY"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		c := e.NewContext(req, httptest.NewRecorder())
+
+		err := handler.Create(c)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusUnprocessableEntity, err.(*echo.HTTPError).Code)
+	})
+
 	t.Run("获取产品列表", func(t *testing.T) {
 		req := httptest.NewRequest(http.MethodGet, "/products", nil)
 		rec := httptest.NewRecorder()
@@ -131,7 +156,7 @@ func TestProductCRUD(t *testing.T) {
 			"name": "Updated Product",
 			"description": "Updated Description",
 			"price": 149.99,
-			"stock": 75
+			"status": "active"
 		}`
 
 		req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(productJSON))
@@ -145,7 +170,7 @@ func TestProductCRUD(t *testing.T) {
 		rows := sqlmock.NewRows([]string{"id", "name", "description", "price", "stock", "status"}).
 			AddRow(1, "Test Product", "Test Description", 99.99, 100, "active")
 
-		mock.ExpectQuery("SELECT \\* FROM `products` WHERE `products`\\.`id` = \\? ORDER BY `products`\\.`id` LIMIT \\?").
+		mock.ExpectQuery("SELECT \\* FROM `products` WHERE deleted_at IS NULL AND `products`\\.`id` = \\? ORDER BY `products`\\.`id` LIMIT \\?").
 			WithArgs(1, 1).
 			WillReturnRows(rows)
 
@@ -161,6 +186,24 @@ func TestProductCRUD(t *testing.T) {
 		assert.Equal(t, http.StatusOK, rec.Code)
 	})
 
+	t.Run("已删除的产品不能更新", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPatch, "/", strings.NewReader(`{"name":"Renamed"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		c := e.NewContext(req, httptest.NewRecorder())
+		c.SetPath("/products/:id")
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+
+		mock.ExpectQuery("SELECT \\* FROM `products` WHERE deleted_at IS NULL AND `products`\\.`id` = \\? ORDER BY `products`\\.`id` LIMIT \\?").
+			WithArgs(1, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+		err := handler.Update(c)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusNotFound, err.(*echo.HTTPError).Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
 	t.Run("软删除产品", func(t *testing.T) {
 		req := httptest.NewRequest(http.MethodDelete, "/", nil)
 		rec := httptest.NewRecorder()
@@ -170,7 +213,7 @@ func TestProductCRUD(t *testing.T) {
 		c.SetParamValues("1")
 
 		mock.ExpectBegin()
-		mock.ExpectExec("UPDATE `products` SET `deleted_at`=(.+),`updated_at`=(.+) WHERE id = \\?").
+		mock.ExpectExec("UPDATE `products` SET `deleted_at`=(.+),`updated_at`=(.+) WHERE id = \\? AND deleted_at IS NULL").
 			WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), 1).
 			WillReturnResult(sqlmock.NewResult(1, 1))
 		mock.ExpectCommit()
@@ -183,6 +226,28 @@ func TestProductCRUD(t *testing.T) {
 		assert.Equal(t, http.StatusNoContent, rec.Code)
 	})
 
+	t.Run("重复删除返回404且不触发变更", func(t *testing.T) {
+		var changes []Change[Product]
+		handler.OnChange(func(ctx context.Context, change Change[Product]) {
+			changes = append(changes, change)
+		})
+		c := e.NewContext(httptest.NewRequest(http.MethodDelete, "/", nil), httptest.NewRecorder())
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE `products` SET `deleted_at`=(.+),`updated_at`=(.+) WHERE id = \\? AND deleted_at IS NULL").
+			WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), 1).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		err := handler.Delete(c)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusNotFound, err.(*echo.HTTPError).Code)
+		assert.Empty(t, changes)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
 	t.Run("恢复已删除产品", func(t *testing.T) {
 		req := httptest.NewRequest(http.MethodPost, "/", nil)
 		rec := httptest.NewRecorder()
@@ -192,8 +257,8 @@ func TestProductCRUD(t *testing.T) {
 		c.SetParamValues("1")
 
 		mock.ExpectBegin()
-		mock.ExpectExec("UPDATE `products` SET `deleted_at`=NULL,`updated_at`=(.+) WHERE id = \\?").
-			WithArgs(sqlmock.AnyArg(), 1).
+		mock.ExpectExec("UPDATE `products` SET `deleted_at`=\\?,`updated_at`=\\? WHERE id = \\? AND deleted_at IS NOT NULL").
+			WithArgs(nil, sqlmock.AnyArg(), 1).
 			WillReturnResult(sqlmock.NewResult(1, 1))
 		mock.ExpectCommit()
 
@@ -201,4 +266,1071 @@ func TestProductCRUD(t *testing.T) {
 		assert.NoError(t, err)
 		assert.Equal(t, http.StatusOK, rec.Code)
 	})
+
+	t.Run("恢复未删除的产品返回404", func(t *testing.T) {
+		c := e.NewContext(httptest.NewRequest(http.MethodPost, "/", nil), httptest.NewRecorder())
+		c.SetPath("/products/:id/restore")
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE `products` SET `deleted_at`=\\?,`updated_at`=\\? WHERE id = \\? AND deleted_at IS NOT NULL").
+			WithArgs(nil, sqlmock.AnyArg(), 1).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		err := handler.Restore(c)
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusNotFound, err.(*echo.HTTPError).Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestProductUpdateFields(t *testing.T) {
+	e, handler, mock, redisMock := setupProductTest(t)
+
+	newUpdateContext := func(method, body string) echo.Context {
+		req := httptest.NewRequest(method, "/", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		c := e.NewContext(req, httptest.NewRecorder())
+		c.SetPath("/products/:id")
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+		return c
+	}
+
+	expectFind := func() {
+		rows := sqlmock.NewRows([]string{"id", "name", "description", "price", "stock", "status"}).
+			AddRow(1, "Test Product", "Test Description", 99.99, 100, "active")
+		mock.ExpectQuery("SELECT \\* FROM `products` WHERE deleted_at IS NULL AND `products`\\.`id` = \\? ORDER BY `products`\\.`id` LIMIT \\?").
+			WithArgs(1, 1).
+			WillReturnRows(rows)
+	}
+
+	t.Run("拒绝只读字段", func(t *testing.T) {
+		c := newUpdateContext(http.MethodPatch, `{"id": 2, "deleted_at": null, "price": 10}`)
+		expectFind()
+
+		err := handler.Update(c)
+		require.Error(t, err)
+		httpErr := err.(*echo.HTTPError)
+		assert.Equal(t, http.StatusBadRequest, httpErr.Code)
+		assert.Equal(t, []string{"deleted_at", "id"}, httpErr.Message.(map[string]interface{})["readonly_fields"])
+	})
+
+	t.Run("拒绝未知字段", func(t *testing.T) {
+		c := newUpdateContext(http.MethodPut, `{"name": "x", "is_admin": true}`)
+		expectFind()
+
+		err := handler.Update(c)
+		require.Error(t, err)
+		httpErr := err.(*echo.HTTPError)
+		assert.Equal(t, http.StatusBadRequest, httpErr.Code)
+		assert.Equal(t, []string{"is_admin"}, httpErr.Message.(map[string]interface{})["unknown_fields"])
+	})
+
+	t.Run("PATCH只更新提供的字段", func(t *testing.T) {
+		c := newUpdateContext(http.MethodPatch, `{"price": 10.5}`)
+		expectFind()
+
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE `products` SET `price`=\\?,`updated_at`=\\? WHERE `id` = \\?").
+			WithArgs("10.50", sqlmock.AnyArg(), 1).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		redisMock.ExpectDel("products:1").SetVal(1)
+
+		err := handler.Update(c)
+		assert.NoError(t, err)
+	})
+
+	t.Run("PUT整体替换可写字段", func(t *testing.T) {
+		c := newUpdateContext(http.MethodPut, `{"name": "Replaced", "price": 1}`)
+		expectFind()
+
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE `products` SET `name`=\\?,`description`=\\?,`price`=\\?,`currency`=\\?,`status`=\\?,`category_id`=\\?,`updated_at`=\\? WHERE `id` = \\?").
+			WithArgs("Replaced", "", "1.00", "USD", "active", nil, sqlmock.AnyArg(), 1).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		redisMock.ExpectDel("products:1").SetVal(1)
+
+		err := handler.Update(c)
+		assert.NoError(t, err)
+	})
+
+	t.Run("库存只能通过库存接口修改", func(t *testing.T) {
+		c := newUpdateContext(http.MethodPatch, `{"stock": 5}`)
+		expectFind()
+
+		err := handler.Update(c)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+		assert.Contains(t, fmt.Sprint(err.(*echo.HTTPError).Message), "readonly_fields:[stock]")
+	})
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestProductPatch(t *testing.T) {
+	e, handler, mock, redisMock := setupProductTest(t)
+
+	newPatchContext := func(contentType, body string) echo.Context {
+		req := httptest.NewRequest(http.MethodPatch, "/", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, contentType)
+		c := e.NewContext(req, httptest.NewRecorder())
+		c.SetPath("/products/:id")
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+		return c
+	}
+
+	expectFind := func() {
+		rows := sqlmock.NewRows([]string{"id", "name", "description", "price", "stock", "status"}).
+			AddRow(1, "Test Product", "Test Description", 99.99, 100, "active")
+		mock.ExpectQuery("SELECT \\* FROM `products` WHERE deleted_at IS NULL AND `products`\\.`id` = \\? ORDER BY `products`\\.`id` LIMIT \\?").
+			WithArgs(1, 1).
+			WillReturnRows(rows)
+	}
+
+	t.Run("JSON Merge Patch", func(t *testing.T) {
+		c := newPatchContext(MIMEMergePatch, `{"description": null, "status": "inactive", "id": 1}`)
+		expectFind()
+
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE `products` SET `description`=\\?,`status`=\\?,`updated_at`=\\? WHERE `id` = \\?").
+			WithArgs("", "inactive", sqlmock.AnyArg(), 1).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		redisMock.ExpectDel("products:1").SetVal(1)
+
+		err := handler.Update(c)
+		require.NoError(t, err)
+
+		var response Product
+		require.NoError(t, json.Unmarshal(c.Response().Writer.(*httptest.ResponseRecorder).Body.Bytes(), &response))
+		assert.Equal(t, "", response.Description)
+		assert.Equal(t, "inactive", response.Status)
+		assert.Equal(t, 100, response.Stock)
+		assert.Equal(t, "Test Product", response.Name)
+	})
+
+	t.Run("JSON Patch 条件更新", func(t *testing.T) {
+		c := newPatchContext(MIMEJSONPatch, `[
+			{"op": "test", "path": "/name", "value": "Test Product"},
+			{"op": "replace", "path": "/name", "value": "Renamed"}
+		]`)
+		expectFind()
+
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE `products` SET `name`=\\?,`updated_at`=\\? WHERE `id` = \\?").
+			WithArgs("Renamed", sqlmock.AnyArg(), 1).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		redisMock.ExpectDel("products:1").SetVal(1)
+
+		assert.NoError(t, handler.Update(c))
+	})
+
+	t.Run("JSON Patch test失败", func(t *testing.T) {
+		c := newPatchContext(MIMEJSONPatch, `[
+			{"op": "test", "path": "/name", "value": "Other"},
+			{"op": "replace", "path": "/name", "value": "Renamed"}
+		]`)
+		expectFind()
+
+		err := handler.Update(c)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusConflict, err.(*echo.HTTPError).Code)
+	})
+
+	t.Run("JSON Patch 修改只读字段", func(t *testing.T) {
+		c := newPatchContext(MIMEJSONPatch, `[{"op": "replace", "path": "/id", "value": 2}]`)
+		expectFind()
+
+		err := handler.Update(c)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	})
+
+	t.Run("补丁结果校验失败", func(t *testing.T) {
+		c := newPatchContext(MIMEMergePatch, `{"price": -1}`)
+		expectFind()
+
+		err := handler.Update(c)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusUnprocessableEntity, err.(*echo.HTTPError).Code)
+	})
+
+	t.Run("价格超出DECIMAL(10,2)范围", func(t *testing.T) {
+		c := newPatchContext(MIMEMergePatch, `{"price": "100000000"}`)
+		expectFind()
+
+		err := handler.Update(c)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusUnprocessableEntity, err.(*echo.HTTPError).Code)
+		assert.Equal(t, "price must be at most 99999999.99", err.(*echo.HTTPError).Message)
+	})
+
+	t.Run("币种不在汇率表中", func(t *testing.T) {
+		c := newPatchContext(MIMEMergePatch, `{"currency": "EUR"}`)
+		expectFind()
+
+		err := handler.Update(c)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusUnprocessableEntity, err.(*echo.HTTPError).Code)
+		assert.Equal(t, "unsupported currency, supported: USD", err.(*echo.HTTPError).Message)
+	})
+
+	t.Run("不支持的Content-Type", func(t *testing.T) {
+		c := newPatchContext(echo.MIMETextPlain, `price=1`)
+		expectFind()
+
+		err := handler.Update(c)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusUnsupportedMediaType, err.(*echo.HTTPError).Code)
+	})
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestProductBulk(t *testing.T) {
+	e, handler, mock, redisMock := setupProductTest(t)
+
+	newBulkContext := func(body string) (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodPost, "/products/bulk", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		return e.NewContext(req, rec), rec
+	}
+
+	expectFind := func(id int) {
+		rows := sqlmock.NewRows([]string{"id", "name", "description", "price", "stock", "status"}).
+			AddRow(id, "Test Product", "Test Description", 99.99, 100, "active")
+		mock.ExpectQuery("SELECT \\* FROM `products` WHERE deleted_at IS NULL AND `products`\\.`id` = \\? ORDER BY `products`\\.`id` LIMIT \\?").
+			WithArgs(id, 1).
+			WillReturnRows(rows)
+	}
+
+	t.Run("事务模式全部成功", func(t *testing.T) {
+		c, rec := newBulkContext(`{"operations": [
+			{"op": "create", "data": {"name": "A", "price": 1}},
+			{"op": "create", "data": {"name": "B", "price": 2}},
+			{"op": "update", "id": 1, "data": {"status": "inactive"}},
+			{"op": "delete", "id": 2}
+		]}`)
+
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO `products` (.+) VALUES \\(.+\\),\\(.+\\)").
+			WillReturnResult(sqlmock.NewResult(10, 2))
+		expectFind(1)
+		mock.ExpectExec("UPDATE `products` SET `status`=\\?,`updated_at`=\\? WHERE `id` = \\?").
+			WithArgs("inactive", sqlmock.AnyArg(), 1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery("SELECT `id` FROM `products` WHERE id IN \\(\\?\\) AND deleted_at IS NULL").
+			WithArgs(2).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+		mock.ExpectExec("UPDATE `products` SET `deleted_at`=\\?,`updated_at`=\\? WHERE id IN \\(\\?\\)").
+			WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), 2).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		redisMock.ExpectDel("products:1", "products:2").SetVal(2)
+
+		require.NoError(t, handler.Bulk(c))
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var response BulkResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		assert.Equal(t, 4, response.Succeeded)
+		assert.Equal(t, 0, response.Failed)
+		assert.Equal(t, uint(10), response.Results[0].ID)
+		assert.Equal(t, uint(11), response.Results[1].ID)
+		assert.Equal(t, http.StatusCreated, response.Results[0].Status)
+		assert.Equal(t, http.StatusOK, response.Results[2].Status)
+		assert.Equal(t, http.StatusNoContent, response.Results[3].Status)
+	})
+
+	t.Run("批量创建可以指定初始库存", func(t *testing.T) {
+		c, rec := newBulkContext(`{"operations": [{"op": "create", "data": {"name": "A", "price": 1, "stock": 5}}]}`)
+
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO `products`").WillReturnResult(sqlmock.NewResult(12, 1))
+		mock.ExpectExec("INSERT INTO `inventory_ledger`").
+			WithArgs(12, nil, nil, 5, StockReasonInitial, "", "system", sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		require.NoError(t, handler.Bulk(c))
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("批量更新不能修改库存", func(t *testing.T) {
+		c, rec := newBulkContext(`{"operations": [{"op": "update", "id": 1, "data": {"stock": 5}}]}`)
+
+		mock.ExpectBegin()
+		expectFind(1)
+		mock.ExpectRollback()
+
+		require.NoError(t, handler.Bulk(c))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("事务模式失败回滚", func(t *testing.T) {
+		c, rec := newBulkContext(`{"operations": [
+			{"op": "update", "id": 1, "data": {"status": "inactive"}},
+			{"op": "delete", "id": 404}
+		]}`)
+
+		mock.ExpectBegin()
+		expectFind(1)
+		mock.ExpectExec("UPDATE `products`").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery("SELECT `id` FROM `products`").
+			WithArgs(404).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		mock.ExpectRollback()
+
+		require.NoError(t, handler.Bulk(c))
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+
+		var response BulkResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		assert.Equal(t, 0, response.Succeeded)
+		assert.Equal(t, 2, response.Failed)
+		assert.Equal(t, http.StatusFailedDependency, response.Results[0].Status)
+		assert.Equal(t, http.StatusNotFound, response.Results[1].Status)
+	})
+
+	t.Run("批量插入失败时定位到失败的操作", func(t *testing.T) {
+		c, rec := newBulkContext(`{"operations": [
+			{"op": "create", "data": {"name": "A", "price": 1}},
+			{"op": "create", "data": {"name": "B", "price": 2}}
+		]}`)
+
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO `products` (.+) VALUES \\(.+\\),\\(.+\\)").
+			WillReturnError(errors.New("Duplicate entry 'B'"))
+		mock.ExpectExec("INSERT INTO `products`").WillReturnResult(sqlmock.NewResult(30, 1))
+		mock.ExpectExec("INSERT INTO `products`").WillReturnError(errors.New("Duplicate entry 'B'"))
+		mock.ExpectRollback()
+
+		require.NoError(t, handler.Bulk(c))
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+
+		var response BulkResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		assert.Equal(t, http.StatusFailedDependency, response.Results[0].Status)
+		assert.Equal(t, uint(0), response.Results[0].ID)
+		assert.Equal(t, http.StatusInternalServerError, response.Results[1].Status)
+		assert.Equal(t, "Duplicate entry 'B'", response.Results[1].Error)
+	})
+
+	t.Run("重复的删除只产生一次变更", func(t *testing.T) {
+		var deleted []uint
+		handler.OnChange(func(ctx context.Context, change Change[Product]) {
+			if change.Type == ChangeDeleted {
+				deleted = append(deleted, change.ID)
+			}
+		})
+		c, rec := newBulkContext(`{"operations": [{"op": "delete", "id": 5}, {"op": "delete", "id": 5}]}`)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT `id` FROM `products` WHERE id IN \\(\\?\\) AND deleted_at IS NULL").
+			WithArgs(5).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+		mock.ExpectExec("UPDATE `products` SET `deleted_at`=\\?,`updated_at`=\\? WHERE id IN \\(\\?\\)").
+			WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), 5).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		redisMock.ExpectDel("products:5").SetVal(1)
+
+		require.NoError(t, handler.Bulk(c))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, []uint{5}, deleted)
+	})
+
+	t.Run("逐条模式部分成功", func(t *testing.T) {
+		c, rec := newBulkContext(`{"mode": "partial", "operations": [
+			{"op": "create", "data": {"name": "A", "price": 1}},
+			{"op": "create", "data": {"name": "B", "id": 7}},
+			{"op": "update", "id": 3, "data": {"price": -1}}
+		]}`)
+
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO `products`").WillReturnResult(sqlmock.NewResult(20, 1))
+		mock.ExpectCommit()
+		mock.ExpectBegin()
+		mock.ExpectRollback()
+		mock.ExpectBegin()
+		expectFind(3)
+		mock.ExpectRollback()
+
+		require.NoError(t, handler.Bulk(c))
+		assert.Equal(t, http.StatusMultiStatus, rec.Code)
+
+		var response BulkResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		assert.Equal(t, 1, response.Succeeded)
+		assert.Equal(t, 2, response.Failed)
+		assert.Equal(t, uint(20), response.Results[0].ID)
+		assert.Equal(t, http.StatusBadRequest, response.Results[1].Status)
+		assert.Equal(t, http.StatusUnprocessableEntity, response.Results[2].Status)
+	})
+
+	t.Run("不支持的操作", func(t *testing.T) {
+		c, _ := newBulkContext(`{"mode": "sometimes", "operations": [{"op": "delete", "id": 1}]}`)
+
+		err := handler.Bulk(c)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	})
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.NoError(t, redisMock.ExpectationsWereMet())
+}
+
+func TestProductExport(t *testing.T) {
+	e, handler, mock, _ := setupProductTest(t)
+
+	newExportContext := func(query string) (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodGet, "/products/export?"+query, nil)
+		rec := httptest.NewRecorder()
+		return e.NewContext(req, rec), rec
+	}
+
+	t.Run("导出CSV", func(t *testing.T) {
+		c, rec := newExportContext("format=csv&columns=id,name,price")
+
+		rows := sqlmock.NewRows([]string{"id", "name", "price"}).
+			AddRow(1, "Product, 1", 99.99).
+			AddRow(2, "Product 2", 199.5)
+		mock.ExpectQuery("^SELECT `id`,`name`,`price` FROM `products` WHERE deleted_at IS NULL$").WillReturnRows(rows)
+
+		require.NoError(t, handler.Export(c))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "text/csv; charset=utf-8", rec.Header().Get(echo.HeaderContentType))
+		assert.Contains(t, rec.Header().Get(echo.HeaderContentDisposition), `filename="products.csv"`)
+		assert.Equal(t, "id,name,price\n1,\"Product, 1\",99.99\n2,Product 2,199.50\n", rec.Body.String())
+	})
+
+	t.Run("公式单元格按文本导出", func(t *testing.T) {
+		c, rec := newExportContext("format=csv&columns=id,name,stock")
+
+		rows := sqlmock.NewRows([]string{"id", "name", "stock"}).
+			AddRow(1, "=HYPERLINK(\"http://evil\")", -1).
+			AddRow(2, "@SUM(A1)", 0)
+		mock.ExpectQuery("^SELECT `id`,`name`,`stock` FROM `products`").WillReturnRows(rows)
+
+		require.NoError(t, handler.Export(c))
+		assert.Equal(t, "id,name,stock\n1,\"'=HYPERLINK(\"\"http://evil\"\")\",-1\n2,'@SUM(A1),0\n", rec.Body.String())
+		assert.JSONEq(t, `"=SUM(A1)"`, string(csvValue("'=SUM(A1)", reflect.TypeOf(""))))
+		assert.JSONEq(t, `"'quoted"`, string(csvValue("'quoted", reflect.TypeOf(""))))
+	})
+
+	t.Run("导出NDJSON包含已删除", func(t *testing.T) {
+		c, rec := newExportContext("format=ndjson&columns=id,stock&include_deleted=true")
+
+		rows := sqlmock.NewRows([]string{"id", "stock"}).AddRow(1, 10).AddRow(2, 0)
+		mock.ExpectQuery("^SELECT `id`,`stock` FROM `products`$").WillReturnRows(rows)
+
+		require.NoError(t, handler.Export(c))
+		assert.Equal(t, "{\"id\":1,\"stock\":10}\n{\"id\":2,\"stock\":0}\n", rec.Body.String())
+	})
+
+	t.Run("导出XLSX", func(t *testing.T) {
+		c, rec := newExportContext("format=xlsx&columns=name,stock")
+
+		rows := sqlmock.NewRows([]string{"name", "stock"}).AddRow("A & B", 3)
+		mock.ExpectQuery("^SELECT `name`,`stock` FROM `products`").WillReturnRows(rows)
+
+		require.NoError(t, handler.Export(c))
+
+		zr, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+		require.NoError(t, err)
+		var sheet string
+		for _, f := range zr.File {
+			if f.Name == "xl/worksheets/sheet1.xml" {
+				r, err := f.Open()
+				require.NoError(t, err)
+				data, err := io.ReadAll(r)
+				require.NoError(t, err)
+				sheet = string(data)
+			}
+		}
+		assert.Contains(t, sheet, `<t xml:space="preserve">A &amp; B</t>`)
+		assert.Contains(t, sheet, `<c t="n"><v>3</v></c>`)
+	})
+
+	t.Run("未知列", func(t *testing.T) {
+		c, _ := newExportContext("columns=id,secret")
+
+		err := handler.Export(c)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	})
+
+	t.Run("不支持的格式", func(t *testing.T) {
+		c, _ := newExportContext("format=pdf")
+
+		err := handler.Export(c)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	})
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestProductImport(t *testing.T) {
+	e, handler, mock, redisMock := setupProductTest(t)
+
+	newImportContext := func(query, contentType, body string) (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodPost, "/products/import?"+query, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, contentType)
+		rec := httptest.NewRecorder()
+		return e.NewContext(req, rec), rec
+	}
+
+	t.Run("试运行返回校验报告", func(t *testing.T) {
+		csvData := "name,price,status\nA,1.5,active\nB,abc,active\n,2,active\nD,3,archived\n"
+		c, rec := newImportContext("dry_run=true", "text/csv", csvData)
+
+		require.NoError(t, handler.Import(c))
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var report ImportReport
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+		assert.True(t, report.DryRun)
+		assert.Equal(t, 4, report.Total)
+		assert.Equal(t, 1, report.Valid)
+		assert.Equal(t, 3, report.Invalid)
+		require.Len(t, report.Errors, 3)
+		assert.Equal(t, 2, report.Errors[0].Row)
+		assert.Equal(t, "name is required", report.Errors[1].Error)
+		assert.Equal(t, "status must be one of active, inactive", report.Errors[2].Error)
+	})
+
+	t.Run("存在无效行时不写入", func(t *testing.T) {
+		c, rec := newImportContext("", "application/x-ndjson", `{"name":"A","price":1}`+"\n"+`{"id":5,"name":"B"}`+"\n")
+
+		require.NoError(t, handler.Import(c))
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	})
+
+	t.Run("插入NDJSON", func(t *testing.T) {
+		c, rec := newImportContext("mode=insert", "application/x-ndjson", `{"name":"A","price":1}`+"\n\n"+`{"name":"B","price":2}`+"\n")
+
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO `products` (.+) VALUES \\(.+\\),\\(.+\\)$").
+			WillReturnResult(sqlmock.NewResult(1, 2))
+		mock.ExpectCommit()
+
+		require.NoError(t, handler.Import(c))
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var report ImportReport
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+		assert.Equal(t, 2, report.Valid)
+	})
+
+	t.Run("插入模式可以指定初始库存", func(t *testing.T) {
+		c, rec := newImportContext("mode=insert", "text/csv", "name,price,stock\nA,1,5\n")
+
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO `products`").WillReturnResult(sqlmock.NewResult(3, 1))
+		mock.ExpectExec("INSERT INTO `inventory_ledger`").
+			WithArgs(3, nil, nil, 5, StockReasonInitial, "", "system", sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		require.NoError(t, handler.Import(c))
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("upsert模式不能写入库存", func(t *testing.T) {
+		c, rec := newImportContext("mode=upsert&key=id", "text/csv", "id,name,stock\n1,A,5\n")
+
+		require.NoError(t, handler.Import(c))
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		assert.Contains(t, rec.Body.String(), "stock")
+	})
+
+	t.Run("按id上传文件更新", func(t *testing.T) {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		fw, err := mw.CreateFormFile("file", "products.csv")
+		require.NoError(t, err)
+		_, err = fw.Write([]byte("id,name,price\n1,A,9.5\n"))
+		require.NoError(t, err)
+		require.NoError(t, mw.Close())
+
+		c, rec := newImportContext("mode=upsert&key=id", mw.FormDataContentType(), body.String())
+
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO `products` (.+) ON DUPLICATE KEY UPDATE `name`=VALUES\\(`name`\\),`price`=VALUES\\(`price`\\),`updated_at`=VALUES\\(`updated_at`\\)$").
+			WillReturnResult(sqlmock.NewResult(1, 2))
+		mock.ExpectCommit()
+		redisMock.ExpectDel("products:1").SetVal(1)
+
+		require.NoError(t, handler.Import(c))
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("非唯一键", func(t *testing.T) {
+		c, _ := newImportContext("mode=upsert&key=name", "text/csv", "name\nA\n")
+
+		err := handler.Import(c)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	})
+
+	t.Run("数字单元格重新编码为合法JSON", func(t *testing.T) {
+		intType, floatType := reflect.TypeOf(0), reflect.TypeOf(0.0)
+		assert.Equal(t, "5", string(csvValue("+5", intType)))
+		assert.Equal(t, `"0x10"`, string(csvValue("0x10", intType)))
+		assert.Equal(t, "0.5", string(csvValue(".5", floatType)))
+		assert.Equal(t, "8", string(csvValue("0x1p3", floatType)))
+		assert.Equal(t, `"NaN"`, string(csvValue("NaN", floatType)))
+		assert.Equal(t, `"Inf"`, string(csvValue("Inf", floatType)))
+		for _, cell := range []string{"+5", ".5", "0x1p3", "NaN", "-Inf", "1e400"} {
+			assert.True(t, json.Valid(csvValue(cell, floatType)), cell)
+		}
+	})
+
+	t.Run("后台任务达到上限时拒绝", func(t *testing.T) {
+		defer func(rows int) { importSyncRows = rows }(importSyncRows)
+		importSyncRows = 0
+		for i := 0; i < importMaxJobs; i++ {
+			importWorkers <- struct{}{}
+		}
+		defer func() {
+			for i := 0; i < importMaxJobs; i++ {
+				<-importWorkers
+			}
+		}()
+
+		c, _ := newImportContext("mode=insert", "application/x-ndjson", `{"name":"A","price":1}`+"\n")
+		err := handler.Import(c)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusTooManyRequests, err.(*echo.HTTPError).Code)
+	})
+
+	t.Run("查询后台任务进度", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetPath("/products/import/:job_id")
+		c.SetParamNames("job_id")
+		c.SetParamValues("abc")
+
+		redisMock.ExpectGet("products:import:abc").SetVal(`{"id":"abc","status":"running","total":5000,"processed":1500}`)
+
+		require.NoError(t, handler.ImportStatus(c))
+		var job ImportJob
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &job))
+		assert.Equal(t, "running", job.Status)
+		assert.Equal(t, 1500, job.Processed)
+	})
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.NoError(t, redisMock.ExpectationsWereMet())
+}
+
+func TestProductFields(t *testing.T) {
+	e, handler, mock, _ := setupProductTest(t)
+
+	t.Run("获取单个产品指定字段", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/?fields=id,name,price", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetPath("/products/:id")
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+
+		rows := sqlmock.NewRows([]string{"id", "name", "price", "currency"}).AddRow(1, "Test Product", 99.99, "USD")
+		mock.ExpectQuery("SELECT `id`,`name`,`price`,`currency` FROM `products` WHERE deleted_at IS NULL AND `products`\\.`id` = \\? ORDER BY `products`\\.`id` LIMIT \\?").
+			WithArgs(1, 1).
+			WillReturnRows(rows)
+
+		require.NoError(t, handler.Get(c))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"id":1,"name":"Test Product","price":"99.99"}`, rec.Body.String())
+	})
+
+	t.Run("获取产品列表指定字段", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/products?fields=name", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		rows := sqlmock.NewRows([]string{"name"}).AddRow("Product 1").AddRow("Product 2")
+		mock.ExpectQuery("^SELECT `name` FROM `products` WHERE deleted_at IS NULL$").WillReturnRows(rows)
+
+		require.NoError(t, handler.List(c))
+		assert.JSONEq(t, `[{"name":"Product 1"},{"name":"Product 2"}]`, rec.Body.String())
+	})
+
+	t.Run("未知字段", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/products?fields=name,cost", nil)
+		c := e.NewContext(req, httptest.NewRecorder())
+
+		err := handler.List(c)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	})
+
+	t.Run("未声明的关联", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/products?include=owner", nil)
+		c := e.NewContext(req, httptest.NewRecorder())
+
+		err := handler.List(c)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	})
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestProductSearch(t *testing.T) {
+	e, handler, mock, redisMock := setupProductTest(t)
+	handler.UseSearchBackend(search.NewMemoryBackend())
+
+	t.Run("创建产品后可被检索", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/products", strings.NewReader(`{"name":"Wireless Keyboard","description":"Compact","price":45}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		c := e.NewContext(req, httptest.NewRecorder())
+
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO `products`").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		require.NoError(t, handler.Create(c))
+
+		req = httptest.NewRequest(http.MethodGet, "/products/search?q=keybaord&fuzzy=true", nil)
+		rec := httptest.NewRecorder()
+		c = e.NewContext(req, rec)
+
+		rows := sqlmock.NewRows([]string{"id", "name", "description", "price", "stock", "status"}).
+			AddRow(1, "Wireless Keyboard", "Compact", 45, 10, "active")
+		mock.ExpectQuery("SELECT \\* FROM `products` WHERE id IN \\(\\?\\) AND deleted_at IS NULL").
+			WithArgs(1).
+			WillReturnRows(rows)
+
+		require.NoError(t, handler.Search(c))
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var resp SearchResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		assert.Equal(t, 1, resp.Total)
+		assert.Equal(t, 1, resp.Page)
+		assert.Equal(t, 20, resp.PerPage)
+		require.Len(t, resp.Items, 1)
+		assert.Equal(t, "Wireless Keyboard", resp.Items[0].Product.Name)
+		assert.Equal(t, []string{"Wireless <em>Keyboard</em>"}, resp.Items[0].Highlights["name"])
+		assert.Equal(t, []search.FacetBucket{{Key: "0-50", Count: 1}, {Key: "50-100"}, {Key: "100-500"}, {Key: "500+"}}, resp.Facets.Price)
+	})
+
+	t.Run("删除产品后不再命中", func(t *testing.T) {
+		c := e.NewContext(httptest.NewRequest(http.MethodDelete, "/", nil), httptest.NewRecorder())
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE `products` SET `deleted_at`").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		redisMock.ExpectDel("products:1").SetVal(1)
+		require.NoError(t, handler.Delete(c))
+
+		rec := httptest.NewRecorder()
+		c = e.NewContext(httptest.NewRequest(http.MethodGet, "/products/search?q=keyboard", nil), rec)
+		require.NoError(t, handler.Search(c))
+		assert.JSONEq(t, `{"total":0,"page":1,"per_page":20,"items":[],"facets":{"status":[],"price":[{"key":"0-50","count":0},{"key":"50-100","count":0},{"key":"100-500","count":0},{"key":"500+","count":0}]}}`, rec.Body.String())
+	})
+
+	t.Run("参数校验", func(t *testing.T) {
+		for _, query := range []string{"", "?q=a&per_page=500", "?q=a&page=0", "?q=a&min_price=x", "?q=a&fuzzy=maybe"} {
+			c := e.NewContext(httptest.NewRequest(http.MethodGet, "/products/search"+query, nil), httptest.NewRecorder())
+			err := handler.Search(c)
+			require.Error(t, err, query)
+			assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code, query)
+		}
+	})
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestProductStock(t *testing.T) {
+	e, handler, mock, redisMock := setupProductTest(t)
+
+	newContext := func(body string) (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+		return c, rec
+	}
+
+	t.Run("预留库存", func(t *testing.T) {
+		c, rec := newContext(`{"quantity":2,"ttl_seconds":60}`)
+
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE `products` SET `stock`=stock - \\?,`updated_at`=\\? WHERE id = \\? AND deleted_at IS NULL AND stock >= \\?").
+			WithArgs(2, sqlmock.AnyArg(), 1, 2).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO `stock_reservations`").WillReturnResult(sqlmock.NewResult(7, 1))
+		mock.ExpectExec("INSERT INTO `inventory_ledger`").
+			WithArgs(1, nil, 7, -2, "reserve", "", "anonymous", sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		redisMock.ExpectDel("products:1").SetVal(1)
+
+		require.NoError(t, handler.ReserveStock(c))
+		assert.Equal(t, http.StatusCreated, rec.Code)
+
+		var reservation StockReservation
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &reservation))
+		assert.Equal(t, uint(7), reservation.ID)
+		assert.Equal(t, ReservationPending, reservation.Status)
+		assert.WithinDuration(t, time.Now().Add(time.Minute), reservation.ExpiresAt, 5*time.Second)
+	})
+
+	t.Run("库存不足", func(t *testing.T) {
+		c, _ := newContext(`{"quantity":500}`)
+
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE `products` SET `stock`=stock - \\?").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery("SELECT count\\(\\*\\) FROM `products` WHERE id = \\? AND deleted_at IS NULL").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectQuery("SELECT count\\(\\*\\) FROM `product_variants` WHERE product_id = \\?").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+		mock.ExpectRollback()
+
+		err := handler.ReserveStock(c)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusConflict, err.(*echo.HTTPError).Code)
+	})
+
+	t.Run("提交预留", func(t *testing.T) {
+		c, rec := newContext(`{"reservation_id":7}`)
+
+		rows := sqlmock.NewRows([]string{"id", "product_id", "quantity", "status", "actor", "expires_at"}).
+			AddRow(7, 1, 2, ReservationPending, "anonymous", time.Now().Add(time.Minute))
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT \\* FROM `stock_reservations` WHERE id = \\? AND product_id = \\?").
+			WithArgs(7, 1, 1).
+			WillReturnRows(rows)
+		mock.ExpectExec("UPDATE `stock_reservations` SET `status`=\\?,`updated_at`=\\? WHERE status = \\? AND `id` = \\?").
+			WithArgs(ReservationCommitted, sqlmock.AnyArg(), ReservationPending, 7).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO `inventory_ledger`").
+			WithArgs(1, nil, 7, 0, "commit", "", "anonymous", sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(2, 1))
+		mock.ExpectCommit()
+
+		require.NoError(t, handler.CommitStock(c))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"status":"committed"`)
+	})
+
+	t.Run("重复释放已提交的预留", func(t *testing.T) {
+		c, _ := newContext(`{"reservation_id":7}`)
+
+		rows := sqlmock.NewRows([]string{"id", "product_id", "quantity", "status", "actor", "expires_at"}).
+			AddRow(7, 1, 2, ReservationCommitted, "anonymous", time.Now().Add(time.Minute))
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT \\* FROM `stock_reservations`").WillReturnRows(rows)
+		mock.ExpectRollback()
+
+		err := handler.ReleaseStock(c)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusConflict, err.(*echo.HTTPError).Code)
+	})
+
+	t.Run("不能释放他人的预留", func(t *testing.T) {
+		c, _ := newContext(`{"reservation_id":7}`)
+		c.Set("user", &jwt.Token{Claims: jwt.MapClaims{"user_id": float64(3), "username": "mallory"}})
+
+		rows := sqlmock.NewRows([]string{"id", "product_id", "quantity", "status", "actor", "expires_at"}).
+			AddRow(7, 1, 2, ReservationPending, "alice", time.Now().Add(time.Minute))
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT \\* FROM `stock_reservations`").WillReturnRows(rows)
+		mock.ExpectRollback()
+
+		err := handler.ReleaseStock(c)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusForbidden, err.(*echo.HTTPError).Code)
+	})
+
+	t.Run("调整库存", func(t *testing.T) {
+		c, rec := newContext(`{"delta":10,"reason":"restock"}`)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT count\\(\\*\\) FROM `product_variants` WHERE product_id = \\?").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+		mock.ExpectExec("UPDATE `products` SET `stock`=stock \\+ \\?,`updated_at`=\\? WHERE id = \\? AND deleted_at IS NULL").
+			WithArgs(10, sqlmock.AnyArg(), 1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO `inventory_ledger`").
+			WithArgs(1, nil, nil, 10, "adjust", "restock", "anonymous", sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(3, 1))
+		mock.ExpectQuery("SELECT `stock` FROM `products` WHERE id = \\?").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"stock"}).AddRow(108))
+		mock.ExpectCommit()
+		redisMock.ExpectDel("products:1").SetVal(1)
+
+		require.NoError(t, handler.AdjustStock(c))
+		assert.JSONEq(t, `{"product_id":1,"stock":108}`, rec.Body.String())
+	})
+
+	t.Run("调整库存缺少原因", func(t *testing.T) {
+		c, _ := newContext(`{"delta":-1}`)
+		err := handler.AdjustStock(c)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	})
+
+	t.Run("释放过期预留", func(t *testing.T) {
+		rows := sqlmock.NewRows([]string{"id", "product_id", "quantity", "status", "expires_at"}).
+			AddRow(8, 1, 3, ReservationPending, time.Now().Add(-time.Minute))
+		mock.ExpectQuery("SELECT \\* FROM `stock_reservations` WHERE status = \\? AND expires_at <= \\? ORDER BY id LIMIT \\?").
+			WithArgs(ReservationPending, sqlmock.AnyArg(), 100).
+			WillReturnRows(rows)
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE `stock_reservations` SET `status`=\\?").
+			WithArgs(ReservationExpired, sqlmock.AnyArg(), ReservationPending, 8).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("UPDATE `products` SET `stock`=stock \\+ \\?").
+			WithArgs(3, sqlmock.AnyArg(), 1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO `inventory_ledger`").
+			WithArgs(1, nil, 8, 3, "expire", "", "system", sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(4, 1))
+		mock.ExpectCommit()
+		redisMock.ExpectDel("products:1").SetVal(1)
+
+		released, err := handler.ReleaseExpiredReservations(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 1, released)
+	})
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestProductCurrency(t *testing.T) {
+	e, handler, mock, redisMock := setupProductTest(t)
+	rates, err := money.NewRates("USD", map[string]string{"EUR": "0.92"})
+	require.NoError(t, err)
+	handler.UseExchangeRates(rates)
+
+	productRows := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "name", "price", "currency", "stock", "status"}).
+			AddRow(1, "Product 1", "99.99", "USD", 1, "active").
+			AddRow(2, "Product 2", "10.00", "USD", 1, "active")
+	}
+
+	t.Run("批量创建校验币种", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/products/bulk", strings.NewReader(`{"operations": [{"op": "create", "data": {"name": "A", "price": 1, "currency": "GBP"}}]}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+
+		mock.ExpectBegin()
+		mock.ExpectRollback()
+
+		require.NoError(t, handler.Bulk(e.NewContext(req, rec)))
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		assert.Contains(t, rec.Body.String(), "unsupported currency, supported: EUR, USD")
+	})
+
+	t.Run("汇率表只影响所属的处理器", func(t *testing.T) {
+		_, other, _, _ := setupProductTest(t)
+		assert.NoError(t, handler.validate(Product{Name: "A", Currency: "EUR"}))
+		assert.Error(t, other.validate(Product{Name: "A", Currency: "EUR"}))
+		assert.NoError(t, Product{Name: "A", Currency: "GBP"}.Validate())
+	})
+
+	t.Run("按汇率换算价格", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/?currency=eur", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+
+		redisMock.ExpectGet("products:1").RedisNil()
+		mock.ExpectQuery("SELECT \\* FROM `products` WHERE deleted_at IS NULL AND `products`\\.`id` = \\?").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "price", "currency"}).AddRow(1, "Product 1", "99.99", "USD"))
+		redisMock.Regexp().ExpectSet("products:1", `"price":"99.99"`, time.Hour).SetVal("OK")
+		mock.ExpectQuery("SELECT \\* FROM `product_prices` WHERE product_id IN \\(\\?\\) AND currency = \\?").
+			WithArgs(1, "EUR").
+			WillReturnRows(sqlmock.NewRows([]string{"product_id", "currency", "amount"}))
+
+		require.NoError(t, handler.Get(c))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"price":"91.99"`)
+		assert.Contains(t, rec.Body.String(), `"currency":"EUR"`)
+	})
+
+	t.Run("固定价格优先于汇率", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/products?currency=EUR", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mock.ExpectQuery("SELECT \\* FROM `products` WHERE deleted_at IS NULL").WillReturnRows(productRows())
+		mock.ExpectQuery("SELECT \\* FROM `product_prices` WHERE product_id IN \\(\\?,\\?\\) AND currency = \\?").
+			WithArgs(1, 2, "EUR").
+			WillReturnRows(sqlmock.NewRows([]string{"product_id", "currency", "amount"}).AddRow(2, "EUR", "9.50"))
+
+		require.NoError(t, handler.List(c))
+		var products []Product
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &products))
+		require.Len(t, products, 2)
+		assert.Equal(t, "91.99", products[0].Price.String())
+		assert.Equal(t, "9.50", products[1].Price.String())
+		assert.Equal(t, "EUR", products[1].Currency)
+	})
+
+	t.Run("不支持的币种", func(t *testing.T) {
+		c := e.NewContext(httptest.NewRequest(http.MethodGet, "/products?currency=GBP", nil), httptest.NewRecorder())
+		mock.ExpectQuery("SELECT \\* FROM `products`").WillReturnRows(productRows())
+
+		err := handler.List(c)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	})
+
+	t.Run("设置固定价格", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"amount":"9.50"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id", "currency")
+		c.SetParamValues("2", "eur")
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT count\\(\\*\\) FROM `products`").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectExec("INSERT INTO `product_prices` (.+) ON DUPLICATE KEY UPDATE `amount`=VALUES\\(`amount`\\),`updated_at`=VALUES\\(`updated_at`\\)").
+			WithArgs(2, "EUR", "9.50", sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		redisMock.ExpectDel("products:2").SetVal(1)
+
+		require.NoError(t, handler.SetPrice(c))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"amount":"9.50"`)
+	})
+
+	t.Run("金额精度超出两位小数", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"amount":9.999}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		c := e.NewContext(req, httptest.NewRecorder())
+		c.SetParamNames("id", "currency")
+		c.SetParamValues("2", "EUR")
+
+		err := handler.SetPrice(c)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	})
+
+	assert.NoError(t, mock.ExpectationsWereMet())
 }
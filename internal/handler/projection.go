@@ -0,0 +1,163 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// IncludableModel 可选接口，声明允许通过 include 参数预加载的关联（JSON 名称）
+type IncludableModel interface {
+	Includes() []string
+}
+
+// DependentModel 可选接口，声明输出某字段时还需要查询的其他字段（JSON 名称），
+// 如价格换算依赖币种
+type DependentModel interface {
+	FieldDependencies() map[string][]string
+}
+
+// projection 描述 fields 与 include 查询参数指定的字段投影
+type projection struct {
+	fields   []string // 需要输出的 JSON 字段，为空表示全部
+	columns  []string // 需要查询的数据库列，为空表示全部
+	preloads []string // 需要预加载的关联字段名
+	includes []string // 需要输出的关联 JSON 名称
+}
+
+// parseProjection 解析 fields 与 include 查询参数，均未指定时返回 nil
+func (h *BaseHandler[T]) parseProjection(c echo.Context) (*projection, error) {
+	fieldsParam := c.QueryParam("fields")
+	includeParam := c.QueryParam("include")
+	if fieldsParam == "" && includeParam == "" {
+		return nil, nil
+	}
+
+	var model T
+	s, err := schema.Parse(&model, schemaCache, h.db.NamingStrategy)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	p := &projection{}
+
+	selected := make(map[string]bool)
+	if fieldsParam != "" {
+		fields, err := modelFields[T](h.db)
+		if err != nil {
+			return nil, echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		var deps map[string][]string
+		if dm, ok := any(model).(DependentModel); ok {
+			deps = dm.FieldDependencies()
+		}
+		for _, name := range splitParam(fieldsParam) {
+			f, ok := fields[name]
+			if !ok {
+				return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unknown field %q", name))
+			}
+			p.fields = append(p.fields, name)
+			for _, col := range append([]string{f.Column}, dependentColumns(fields, deps[name])...) {
+				if !selected[col] {
+					selected[col] = true
+					p.columns = append(p.columns, col)
+				}
+			}
+		}
+	}
+
+	if includeParam != "" {
+		allowed := make(map[string]bool)
+		if im, ok := any(model).(IncludableModel); ok {
+			for _, name := range im.Includes() {
+				allowed[name] = true
+			}
+		}
+		relations := make(map[string]*schema.Relationship)
+		for _, rel := range s.Relationships.Relations {
+			relations[jsonName(rel.Field.StructField)] = rel
+		}
+
+		for _, name := range splitParam(includeParam) {
+			rel, ok := relations[name]
+			if !ok || !allowed[name] {
+				return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("relation %q cannot be included", name))
+			}
+			p.includes = append(p.includes, name)
+			p.preloads = append(p.preloads, rel.Name)
+
+			// 预加载依赖主键或外键列，即使未在 fields 中请求也需要查询
+			if len(p.columns) == 0 {
+				continue
+			}
+			for _, ref := range rel.References {
+				var column string
+				switch {
+				case ref.OwnPrimaryKey:
+					column = ref.PrimaryKey.DBName
+				case rel.Type == schema.BelongsTo:
+					column = ref.ForeignKey.DBName
+				}
+				if column != "" && !selected[column] {
+					selected[column] = true
+					p.columns = append(p.columns, column)
+				}
+			}
+		}
+	}
+	return p, nil
+}
+
+// apply 将列选择与预加载应用到查询
+func (p *projection) apply(query *gorm.DB) *gorm.DB {
+	if len(p.columns) > 0 {
+		query = query.Select(p.columns)
+	}
+	for _, name := range p.preloads {
+		query = query.Preload(name)
+	}
+	return query
+}
+
+// render 按投影过滤输出字段
+func (p *projection) render(model interface{}) (interface{}, error) {
+	if len(p.fields) == 0 {
+		return model, nil
+	}
+	doc, err := toDocument(model)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]interface{}, len(p.fields)+len(p.includes))
+	for _, name := range p.fields {
+		out[name] = doc[name]
+	}
+	for _, name := range p.includes {
+		out[name] = doc[name]
+	}
+	return out, nil
+}
+
+// dependentColumns 将依赖字段的 JSON 名称转换为列名
+func dependentColumns(fields map[string]modelField, names []string) []string {
+	columns := make([]string, 0, len(names))
+	for _, name := range names {
+		if f, ok := fields[name]; ok {
+			columns = append(columns, f.Column)
+		}
+	}
+	return columns
+}
+
+func splitParam(param string) []string {
+	var values []string
+	for _, v := range strings.Split(param, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
@@ -0,0 +1,292 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Operation 资源的标准操作
+type Operation string
+
+const (
+	OpList    Operation = "list"
+	OpCreate  Operation = "create"
+	OpGet     Operation = "get"
+	OpReplace Operation = "replace"
+	OpUpdate  Operation = "update"
+	OpDelete  Operation = "delete"
+	OpRestore Operation = "restore"
+)
+
+// AllOperations 全部标准操作，OpRestore 只对软删除资源开放
+var AllOperations = []Operation{OpList, OpCreate, OpGet, OpReplace, OpUpdate, OpDelete, OpRestore}
+
+// Permission 在操作执行前检查当前用户的权限，返回的错误直接作为响应；
+// 登录由全局 JWT 中间件保证
+type Permission func(c echo.Context, op Operation) error
+
+// AdminOnly 只允许管理员执行 ops 中的操作，未指定 ops 时限制全部操作
+func AdminOnly(admins Admins, ops ...Operation) Permission {
+	return func(c echo.Context, op Operation) error {
+		if len(ops) > 0 && !containsOperation(ops, op) {
+			return nil
+		}
+		if _, err := currentUserID(c); err != nil {
+			return err
+		}
+		if !admins.IsAdmin(c) {
+			return echo.NewHTTPError(http.StatusForbidden, "this operation is restricted to administrators")
+		}
+		return nil
+	}
+}
+
+// SelfOrAdmin 用户资源的权限：ops 中的操作只允许路径参数 :id 对应的用户本人或管理员执行，
+// 未指定 ops 时限制全部操作
+func SelfOrAdmin(admins Admins, ops ...Operation) Permission {
+	admin := AdminOnly(admins)
+	return func(c echo.Context, op Operation) error {
+		if len(ops) > 0 && !containsOperation(ops, op) {
+			return nil
+		}
+		userID, err := currentUserID(c)
+		if err != nil {
+			return err
+		}
+		if id, err := strconv.ParseUint(c.Param("id"), 10, 64); err == nil && uint(id) == userID {
+			return nil
+		}
+		return admin(c, op)
+	}
+}
+
+// AllOf 依次执行多个权限检查，全部通过才允许操作
+func AllOf(perms ...Permission) Permission {
+	return func(c echo.Context, op Operation) error {
+		for _, perm := range perms {
+			if err := perm(c, op); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// RequireAdmin 只允许管理员访问的路由中间件，用于注册表以外的路由
+func RequireAdmin(admins Admins) echo.MiddlewareFunc {
+	return permissionMiddleware(AdminOnly(admins))
+}
+
+// RequireSelfOrAdmin 只允许 :id 对应的用户本人或管理员访问的路由中间件
+func RequireSelfOrAdmin(admins Admins) echo.MiddlewareFunc {
+	return permissionMiddleware(SelfOrAdmin(admins))
+}
+
+func permissionMiddleware(perm Permission) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return withPermission(perm, "", next)
+	}
+}
+
+func containsOperation(ops []Operation, op Operation) bool {
+	for _, o := range ops {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
+
+// ResourceOptions 注册资源时的选项
+type ResourceOptions struct {
+	// Name 路径段与 OpenAPI 标签，如 "products"，默认为表名
+	Name string
+	// Singular 单数名称，用于接口摘要，默认为 Name 去掉结尾的 s
+	Singular string
+	// Description OpenAPI 中的资源说明
+	Description string
+	// Operations 开放的操作，为空时开放全部标准操作
+	Operations []Operation
+	// Permission 每次操作前调用，为空时所有登录用户都可以执行
+	Permission Permission
+	// SoftDelete 为 true 时 DELETE 写入 deleted_at 并开放 restore，否则物理删除
+	SoftDelete bool
+	// CacheTTL 单条记录的缓存有效期，为 0 时使用默认值
+	CacheTTL time.Duration
+	// Handlers 覆盖标准操作的处理函数，如用户接口使用独立的缓存键
+	Handlers map[Operation]echo.HandlerFunc
+}
+
+// Route 已注册路由的元数据，生成 OpenAPI 文档时使用
+type Route struct {
+	Method    string
+	Path      string
+	Operation Operation
+	Summary   string
+}
+
+// Resource 已注册的资源
+type Resource struct {
+	Name        string
+	Description string
+	// Model 资源模型的类型，用于生成请求与响应的 schema
+	Model    reflect.Type
+	Writable []string
+	// Creatable 只能在创建时写入的字段
+	Creatable  []string
+	SoftDelete bool
+	Routes     []Route
+}
+
+// Registry 资源注册表，为每个模型生成一致的 REST 路由：
+//
+//	GET    /{name}              list
+//	POST   /{name}              create
+//	GET    /{name}/:id          get
+//	PUT    /{name}/:id          replace
+//	PATCH  /{name}/:id          update
+//	DELETE /{name}/:id          delete
+//	POST   /{name}/:id/restore  restore
+//
+// 并为集合与单条记录路径注册返回 Allow 头的 OPTIONS
+type Registry struct {
+	group     *echo.Group
+	prefix    string
+	resources []Resource
+}
+
+// NewRegistry 创建资源注册表，prefix 为 group 的路径前缀，用于记录完整路径
+func NewRegistry(group *echo.Group, prefix string) *Registry {
+	return &Registry{group: group, prefix: prefix}
+}
+
+// Resources 返回已注册的资源，按名称排序
+func (r *Registry) Resources() []Resource {
+	out := make([]Resource, len(r.resources))
+	copy(out, r.resources)
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// routeSpec 标准操作对应的方法、路径与接口摘要
+type routeSpec struct {
+	op      Operation
+	method  string
+	path    string
+	summary string
+}
+
+var standardRoutes = []routeSpec{
+	{OpList, http.MethodGet, "", "List %s"},
+	{OpCreate, http.MethodPost, "", "Create a %s"},
+	{OpGet, http.MethodGet, "/:id", "Get a %s by ID"},
+	{OpReplace, http.MethodPut, "/:id", "Replace a %s"},
+	{OpUpdate, http.MethodPatch, "/:id", "Partially update a %s"},
+	{OpDelete, http.MethodDelete, "/:id", "Delete a %s"},
+	{OpRestore, http.MethodPost, "/:id/restore", "Restore a soft-deleted %s"},
+}
+
+// Register 为模型注册标准 REST 路由，返回资源的路由组，用于追加资源特有的路由
+func Register[T Model](r *Registry, h *BaseHandler[T], opts ResourceOptions) *echo.Group {
+	var model T
+	name := opts.Name
+	if name == "" {
+		name = model.TableName()
+	}
+	singular := opts.Singular
+	if singular == "" {
+		singular = strings.TrimSuffix(name, "s")
+	}
+	ops := opts.Operations
+	if len(ops) == 0 {
+		ops = AllOperations
+	}
+	if opts.CacheTTL > 0 {
+		h.UseCacheTTL(opts.CacheTTL)
+	}
+
+	defaults := map[Operation]echo.HandlerFunc{
+		OpList:    h.List,
+		OpCreate:  h.Create,
+		OpGet:     h.Get,
+		OpReplace: h.Update,
+		OpUpdate:  h.Update,
+		OpDelete:  h.Destroy,
+		OpRestore: h.Restore,
+	}
+	if opts.SoftDelete {
+		defaults[OpDelete] = h.Delete
+	}
+
+	resource := Resource{
+		Name:        name,
+		Description: opts.Description,
+		Model:       reflect.TypeOf(model),
+		SoftDelete:  opts.SoftDelete,
+	}
+	if w, ok := any(model).(WritableModel); ok {
+		resource.Writable = w.WritableFields()
+	}
+	if cm, ok := any(model).(CreatableModel); ok {
+		resource.Creatable = cm.CreatableFields()
+	}
+
+	group := r.group.Group("/" + name)
+	allow := map[string][]string{}
+	for _, spec := range standardRoutes {
+		if !containsOperation(ops, spec.op) || (spec.op == OpRestore && !opts.SoftDelete) {
+			continue
+		}
+		handle := defaults[spec.op]
+		if custom, ok := opts.Handlers[spec.op]; ok {
+			handle = custom
+		}
+		group.Add(spec.method, spec.path, withPermission(opts.Permission, spec.op, handle))
+		allow[spec.path] = append(allow[spec.path], spec.method)
+		noun := singular
+		if spec.op == OpList {
+			noun = name
+		}
+		resource.Routes = append(resource.Routes, Route{
+			Method:    spec.method,
+			Path:      r.prefix + "/" + name + spec.path,
+			Operation: spec.op,
+			Summary:   fmt.Sprintf(spec.summary, noun),
+		})
+	}
+	for path, methods := range allow {
+		group.OPTIONS(path, allowOptions(methods))
+	}
+
+	r.resources = append(r.resources, resource)
+	return group
+}
+
+// withPermission 在处理函数前执行权限检查
+func withPermission(perm Permission, op Operation, next echo.HandlerFunc) echo.HandlerFunc {
+	if perm == nil {
+		return next
+	}
+	return func(c echo.Context) error {
+		if err := perm(c, op); err != nil {
+			return err
+		}
+		return next(c)
+	}
+}
+
+// allowOptions 返回路径支持的方法，CORS 预检由 CORS 中间件处理
+func allowOptions(methods []string) echo.HandlerFunc {
+	allow := strings.Join(append(append([]string{}, methods...), http.MethodOptions), ", ")
+	return func(c echo.Context) error {
+		c.Response().Header().Set(echo.HeaderAllow, allow)
+		return c.NoContent(http.StatusNoContent)
+	}
+}
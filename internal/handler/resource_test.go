@@ -0,0 +1,163 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry(t *testing.T) {
+	e, handler, mock, redisMock := setupProductTest(t)
+	registry := NewRegistry(e.Group("/api/v1"), "/api/v1")
+	// 管理员由用户 ID 决定，与用户名无关
+	admins := NewAdmins([]uint{9})
+	userIDs := map[string]float64{"alice": 1, "admin": 9}
+
+	Register(registry, handler.BaseHandler, ResourceOptions{SoftDelete: true})
+	Register(registry, handler.BaseHandler, ResourceOptions{
+		Name:       "archive",
+		Operations: []Operation{OpGet, OpDelete, OpRestore},
+		Permission: AdminOnly(admins, OpDelete),
+	})
+	e.GET("/api/v1/reports", func(c echo.Context) error { return c.NoContent(http.StatusOK) }, RequireAdmin(admins))
+	e.PUT("/api/v1/users/:id/avatar", func(c echo.Context) error { return c.NoContent(http.StatusOK) }, RequireSelfOrAdmin(admins))
+
+	// serve 经路由分发请求，username 不为空时模拟 JWT 中间件写入的用户
+	serve := func(method, path, username string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(method, path, nil), rec)
+		if username != "" {
+			c.Set("user", &jwt.Token{Claims: jwt.MapClaims{"user_id": userIDs[username], "username": username}})
+		}
+		e.Router().Find(method, path, c)
+		if err := c.Handler()(c); err != nil {
+			e.HTTPErrorHandler(err, c)
+		}
+		return rec
+	}
+
+	t.Run("记录资源与路由元数据", func(t *testing.T) {
+		resources := registry.Resources()
+		require.Len(t, resources, 2)
+		assert.Equal(t, "archive", resources[0].Name)
+		assert.Equal(t, "products", resources[1].Name)
+		assert.True(t, resources[1].SoftDelete)
+		assert.Equal(t, "Product", resources[1].Model.Name())
+		assert.Contains(t, resources[1].Writable, "name")
+
+		routes := resources[1].Routes
+		require.Len(t, routes, len(AllOperations))
+		assert.Equal(t, Route{Method: http.MethodGet, Path: "/api/v1/products", Operation: OpList, Summary: "List products"}, routes[0])
+		assert.Equal(t, Route{Method: http.MethodPost, Path: "/api/v1/products/:id/restore", Operation: OpRestore, Summary: "Restore a soft-deleted product"}, routes[6])
+	})
+
+	t.Run("未开放的操作与非软删除资源的恢复不注册", func(t *testing.T) {
+		routes := registry.Resources()[0].Routes
+		require.Len(t, routes, 2)
+		assert.Equal(t, OpGet, routes[0].Operation)
+		assert.Equal(t, OpDelete, routes[1].Operation)
+
+		for _, route := range e.Routes() {
+			assert.NotEqual(t, "/api/v1/archive/:id/restore", route.Path)
+		}
+		// /archive/:id 已注册，未开放的方法返回 405
+		rec := serve(http.MethodPut, "/api/v1/archive/1", "")
+		assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	})
+
+	t.Run("OPTIONS 返回支持的方法", func(t *testing.T) {
+		rec := serve(http.MethodOptions, "/api/v1/products", "")
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.Equal(t, "GET, POST, OPTIONS", rec.Header().Get(echo.HeaderAllow))
+
+		rec = serve(http.MethodOptions, "/api/v1/archive/1", "")
+		assert.Equal(t, "GET, DELETE, OPTIONS", rec.Header().Get(echo.HeaderAllow))
+	})
+
+	t.Run("非管理员不能执行受限操作", func(t *testing.T) {
+		rec := serve(http.MethodDelete, "/api/v1/archive/1", "alice")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		assert.Contains(t, rec.Body.String(), "restricted to administrators")
+
+		rec = serve(http.MethodDelete, "/api/v1/archive/1", "")
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+
+	t.Run("注册表以外的管理员路由", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, serve(http.MethodGet, "/api/v1/reports", "alice").Code)
+		assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/api/v1/reports", "admin").Code)
+	})
+
+	t.Run("用户名为admin的普通用户不是管理员", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(http.MethodGet, "/api/v1/reports", nil), rec)
+		c.Set("user", &jwt.Token{Claims: jwt.MapClaims{"user_id": float64(2), "username": "admin"}})
+		e.Router().Find(http.MethodGet, "/api/v1/reports", c)
+		err := c.Handler()(c)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusForbidden, err.(*echo.HTTPError).Code)
+	})
+
+	t.Run("只允许本人或管理员的路由", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, serve(http.MethodPut, "/api/v1/users/1/avatar", "alice").Code)
+		assert.Equal(t, http.StatusForbidden, serve(http.MethodPut, "/api/v1/users/2/avatar", "alice").Code)
+		assert.Equal(t, http.StatusOK, serve(http.MethodPut, "/api/v1/users/2/avatar", "admin").Code)
+	})
+
+	t.Run("组合权限", func(t *testing.T) {
+		perm := AllOf(SelfOrAdmin(admins, OpUpdate, OpDelete), AdminOnly(admins, OpRestore))
+		check := func(op Operation, id, username string) error {
+			c := e.NewContext(httptest.NewRequest(http.MethodPost, "/", nil), httptest.NewRecorder())
+			c.Set("user", &jwt.Token{Claims: jwt.MapClaims{"user_id": userIDs[username], "username": username}})
+			c.SetParamNames("id")
+			c.SetParamValues(id)
+			return perm(c, op)
+		}
+		assert.NoError(t, check(OpUpdate, "1", "alice"))
+		assert.NoError(t, check(OpGet, "2", "alice"))
+		assert.Error(t, check(OpDelete, "2", "alice"))
+		assert.Error(t, check(OpRestore, "1", "alice"))
+		assert.NoError(t, check(OpRestore, "2", "admin"))
+	})
+
+	t.Run("非软删除资源物理删除", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec("DELETE FROM `products` WHERE id = \\?").
+			WithArgs(1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		redisMock.ExpectDel("products:1").SetVal(1)
+
+		rec := serve(http.MethodDelete, "/api/v1/archive/1", "admin")
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("物理删除不存在的记录", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec("DELETE FROM `products` WHERE id = \\?").
+			WithArgs(2).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		req := httptest.NewRequest(http.MethodDelete, "/", nil)
+		c := e.NewContext(req, httptest.NewRecorder())
+		c.SetParamNames("id")
+		c.SetParamValues("2")
+
+		err := handler.Destroy(c)
+		var httpErr *echo.HTTPError
+		require.True(t, errors.As(err, &httpErr))
+		assert.Equal(t, http.StatusNotFound, httpErr.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	assert.NoError(t, redisMock.ExpectationsWereMet())
+}
@@ -0,0 +1,169 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/songfei1983/play-go-api/internal/search"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	searchDefaultPerPage = 20
+	searchMaxPerPage     = 100
+)
+
+// SearchItem 检索结果中的单个产品
+type SearchItem struct {
+	Product    Product             `json:"product"`
+	Score      float64             `json:"score"`
+	Highlights map[string][]string `json:"highlights,omitempty"`
+}
+
+// SearchResponse 产品检索响应
+type SearchResponse struct {
+	Total   int           `json:"total"`
+	Page    int           `json:"page"`
+	PerPage int           `json:"per_page"`
+	Items   []SearchItem  `json:"items"`
+	Facets  search.Facets `json:"facets"`
+}
+
+// ProductDocument 将产品转换为检索文档
+func ProductDocument(p Product) search.Document {
+	return search.Document{
+		ID:          p.ID,
+		Name:        p.Name,
+		Description: p.Description,
+		Status:      p.Status,
+		Price:       p.Price.Float64(),
+	}
+}
+
+// UseSearchBackend 替换检索后端
+func (h *ProductHandler) UseSearchBackend(b search.Backend) {
+	h.searcher = b
+}
+
+// Search 产品全文检索，按相关度排序并返回高亮与分面
+func (h *ProductHandler) Search(c echo.Context) error {
+	ctx := c.Request().Context()
+	tracer := otel.Tracer("api-service")
+	ctx, span := tracer.Start(ctx, "ProductHandler.Search")
+	span.SetAttributes(attribute.String("Request-ID", c.Response().Header().Get("X-Request-ID")))
+	defer span.End()
+
+	q, page, perPage, err := parseSearchQuery(c)
+	if err != nil {
+		return err
+	}
+
+	result, err := h.searcher.Search(ctx, q)
+	if err != nil {
+		span.RecordError(err)
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	span.SetAttributes(attribute.Int("search.total", result.Total))
+
+	resp := SearchResponse{Total: result.Total, Page: page, PerPage: perPage, Items: []SearchItem{}, Facets: result.Facets}
+	if len(result.Hits) == 0 {
+		return c.JSON(http.StatusOK, resp)
+	}
+
+	ids := make([]uint, len(result.Hits))
+	for i, hit := range result.Hits {
+		ids[i] = hit.ID
+	}
+	var products []Product
+	if err := h.db.WithContext(ctx).Where("id IN ? AND deleted_at IS NULL", ids).Find(&products).Error; err != nil {
+		span.RecordError(err)
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	if err := h.present(ctx, c, products); err != nil {
+		return err
+	}
+	byID := make(map[uint]Product, len(products))
+	for _, p := range products {
+		byID[p.ID] = p
+	}
+	// 按相关度顺序输出，跳过索引与数据库之间短暂不一致的记录
+	for _, hit := range result.Hits {
+		if p, ok := byID[hit.ID]; ok {
+			resp.Items = append(resp.Items, SearchItem{Product: p, Score: hit.Score, Highlights: hit.Highlights})
+		}
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// parseSearchQuery 解析检索参数
+func parseSearchQuery(c echo.Context) (search.Query, int, int, error) {
+	q := search.Query{Text: c.QueryParam("q"), Status: c.QueryParam("status")}
+	if q.Text == "" {
+		return q, 0, 0, echo.NewHTTPError(http.StatusBadRequest, "q is required")
+	}
+
+	page, perPage := 1, searchDefaultPerPage
+	if v := c.QueryParam("page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return q, 0, 0, echo.NewHTTPError(http.StatusBadRequest, "page must be a positive integer")
+		}
+		page = n
+	}
+	if v := c.QueryParam("per_page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > searchMaxPerPage {
+			return q, 0, 0, echo.NewHTTPError(http.StatusBadRequest, "per_page must be between 1 and 100")
+		}
+		perPage = n
+	}
+	q.Offset = (page - 1) * perPage
+	q.Limit = perPage
+
+	for name, dst := range map[string]**float64{"min_price": &q.MinPrice, "max_price": &q.MaxPrice} {
+		if v := c.QueryParam(name); v != "" {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return q, 0, 0, echo.NewHTTPError(http.StatusBadRequest, name+" must be a number")
+			}
+			*dst = &f
+		}
+	}
+	if v := c.QueryParam("fuzzy"); v != "" {
+		fuzzy, err := strconv.ParseBool(v)
+		if err != nil {
+			return q, 0, 0, echo.NewHTTPError(http.StatusBadRequest, "fuzzy must be a boolean")
+		}
+		q.Fuzzy = fuzzy
+	}
+	return q, page, perPage, nil
+}
+
+// syncSearchIndex 在产品变更后同步需要应用维护的检索索引
+func (h *ProductHandler) syncSearchIndex(ctx context.Context, change Change[Product]) {
+	idx, ok := h.searcher.(search.Indexer)
+	if !ok {
+		return
+	}
+
+	var err error
+	switch {
+	case change.Type == ChangeDeleted:
+		err = idx.Delete(ctx, change.ID)
+	case change.Type == ChangeRestored, change.After == nil, change.Before == nil && change.Type == ChangeUpdated:
+		// 恢复与导入更新无法获得完整记录，从数据库重新加载
+		var p Product
+		if err = h.db.WithContext(ctx).Where("deleted_at IS NULL").First(&p, change.ID).Error; err == nil {
+			err = idx.Index(ctx, ProductDocument(p))
+		}
+	default:
+		err = idx.Index(ctx, ProductDocument(*change.After))
+	}
+	if err != nil {
+		trace.SpanFromContext(ctx).RecordError(err)
+	}
+}
@@ -0,0 +1,535 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 预留状态
+const (
+	ReservationPending   = "pending"
+	ReservationCommitted = "committed"
+	ReservationReleased  = "released"
+	ReservationExpired   = "expired"
+)
+
+// 库存流水原因
+const (
+	StockReasonReserve = "reserve"
+	StockReasonCommit  = "commit"
+	StockReasonRelease = "release"
+	StockReasonExpire  = "expire"
+	StockReasonAdjust  = "adjust"
+	StockReasonOrder   = "order"
+	StockReasonRestock = "order_cancel"
+	StockReasonInitial = "initial"
+)
+
+const (
+	reservationDefaultTTL = 15 * time.Minute
+	reservationMaxTTL     = 24 * time.Hour
+	reservationSweepBatch = 100
+	systemActor           = "system"
+)
+
+// StockReservation 库存预留，预留时即扣减库存，过期未提交的预留自动释放
+// 按变体管理库存的产品必须指定 VariantID
+type StockReservation struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	ProductID uint      `json:"product_id" gorm:"not null;index"`
+	VariantID *uint     `json:"variant_id,omitempty" gorm:"index"`
+	Quantity  int       `json:"quantity" gorm:"not null"`
+	Status    string    `json:"status" gorm:"not null;default:pending;index"`
+	Actor     string    `json:"actor"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"index"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (StockReservation) TableName() string {
+	return "stock_reservations"
+}
+
+// StockMovement 库存流水，记录每一次库存变动
+type StockMovement struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	ProductID     uint      `json:"product_id" gorm:"not null;index"`
+	VariantID     *uint     `json:"variant_id,omitempty" gorm:"index"`
+	ReservationID *uint     `json:"reservation_id,omitempty" gorm:"index"`
+	Delta         int       `json:"delta" gorm:"not null"`
+	Reason        string    `json:"reason" gorm:"not null"`
+	Note          string    `json:"note,omitempty"`
+	Actor         string    `json:"actor"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// TableName 指定表名
+func (StockMovement) TableName() string {
+	return "inventory_ledger"
+}
+
+// StockLevel 库存调整后的库存量，指定变体时 VariantStock 为变体库存
+type StockLevel struct {
+	ProductID    uint  `json:"product_id"`
+	Stock        int   `json:"stock"`
+	VariantID    *uint `json:"variant_id,omitempty"`
+	VariantStock *int  `json:"variant_stock,omitempty"`
+}
+
+type reserveRequest struct {
+	VariantID  *uint `json:"variant_id"`
+	Quantity   int   `json:"quantity"`
+	TTLSeconds int   `json:"ttl_seconds"`
+}
+
+type reservationRequest struct {
+	ReservationID uint `json:"reservation_id"`
+}
+
+type adjustRequest struct {
+	VariantID *uint  `json:"variant_id"`
+	Delta     int    `json:"delta"`
+	Reason    string `json:"reason"`
+}
+
+// ReserveStock 预留库存，库存不足时返回 409
+func (h *ProductHandler) ReserveStock(c echo.Context) error {
+	ctx := c.Request().Context()
+	tracer := otel.Tracer("api-service")
+	ctx, span := tracer.Start(ctx, "ProductHandler.ReserveStock")
+	span.SetAttributes(attribute.String("Request-ID", c.Response().Header().Get("X-Request-ID")))
+	defer span.End()
+
+	productID, err := productIDParam(c)
+	if err != nil {
+		return err
+	}
+	var req reserveRequest
+	if err := c.Bind(&req); err != nil {
+		span.RecordError(err)
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	if req.Quantity <= 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "quantity must be positive")
+	}
+	ttl := reservationDefaultTTL
+	if req.TTLSeconds != 0 {
+		ttl = time.Duration(req.TTLSeconds) * time.Second
+		if ttl <= 0 || ttl > reservationMaxTTL {
+			return echo.NewHTTPError(http.StatusBadRequest, "ttl_seconds must be between 1 and 86400")
+		}
+	}
+
+	reservation := StockReservation{
+		ProductID: productID,
+		VariantID: req.VariantID,
+		Quantity:  req.Quantity,
+		Status:    ReservationPending,
+		Actor:     currentActor(c),
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	err = h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := decrementStock(tx, productID, req.VariantID, req.Quantity); err != nil {
+			return err
+		}
+		if err := tx.Create(&reservation).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&StockMovement{
+			ProductID:     productID,
+			VariantID:     req.VariantID,
+			ReservationID: &reservation.ID,
+			Delta:         -req.Quantity,
+			Reason:        StockReasonReserve,
+			Actor:         reservation.Actor,
+		}).Error; err != nil {
+			return err
+		}
+		return h.stockChangedTx(tx, productID)
+	})
+	if err != nil {
+		span.RecordError(err)
+		return httpError(err)
+	}
+
+	h.stockChanged(ctx, productID)
+	return c.JSON(http.StatusCreated, reservation)
+}
+
+// CommitStock 提交预留，库存已在预留时扣减，只有预留的创建者可以提交
+func (h *ProductHandler) CommitStock(c echo.Context) error {
+	return h.closeReservationRequest(c, "ProductHandler.CommitStock", ReservationCommitted)
+}
+
+// ReleaseStock 释放预留并归还库存，只有预留的创建者可以释放
+func (h *ProductHandler) ReleaseStock(c echo.Context) error {
+	return h.closeReservationRequest(c, "ProductHandler.ReleaseStock", ReservationReleased)
+}
+
+func (h *ProductHandler) closeReservationRequest(c echo.Context, spanName, status string) error {
+	ctx := c.Request().Context()
+	tracer := otel.Tracer("api-service")
+	ctx, span := tracer.Start(ctx, spanName)
+	span.SetAttributes(attribute.String("Request-ID", c.Response().Header().Get("X-Request-ID")))
+	defer span.End()
+
+	productID, err := productIDParam(c)
+	if err != nil {
+		return err
+	}
+	var req reservationRequest
+	if err := c.Bind(&req); err != nil {
+		span.RecordError(err)
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	if req.ReservationID == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "reservation_id is required")
+	}
+
+	var reservation StockReservation
+	err = h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ? AND product_id = ?", req.ReservationID, productID).First(&reservation).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return echo.NewHTTPError(http.StatusNotFound, "Reservation not found")
+			}
+			return err
+		}
+		if reservation.Actor != currentActor(c) {
+			return echo.NewHTTPError(http.StatusForbidden, "reservation belongs to another user")
+		}
+		if reservation.Status == ReservationPending && !reservation.ExpiresAt.After(time.Now()) {
+			return echo.NewHTTPError(http.StatusConflict, "reservation has expired")
+		}
+		if err := closeReservation(tx, &reservation, status, currentActor(c)); err != nil {
+			return err
+		}
+		if status == ReservationCommitted {
+			return nil
+		}
+		return h.stockChangedTx(tx, productID)
+	})
+	if err != nil {
+		span.RecordError(err)
+		return httpError(err)
+	}
+
+	if status != ReservationCommitted {
+		h.stockChanged(ctx, productID)
+	}
+	return c.JSON(http.StatusOK, reservation)
+}
+
+// AdjustStock 按 delta 调整库存（盘点、入库、损耗等），调整后库存不能为负
+// 路由只对管理员开放
+func (h *ProductHandler) AdjustStock(c echo.Context) error {
+	ctx := c.Request().Context()
+	tracer := otel.Tracer("api-service")
+	ctx, span := tracer.Start(ctx, "ProductHandler.AdjustStock")
+	span.SetAttributes(attribute.String("Request-ID", c.Response().Header().Get("X-Request-ID")))
+	defer span.End()
+
+	productID, err := productIDParam(c)
+	if err != nil {
+		return err
+	}
+	var req adjustRequest
+	if err := c.Bind(&req); err != nil {
+		span.RecordError(err)
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	if req.Delta == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "delta must not be zero")
+	}
+	if req.Reason == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "reason is required")
+	}
+
+	level := StockLevel{ProductID: productID, VariantID: req.VariantID}
+	err = h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		switch {
+		case req.Delta < 0:
+			err = decrementStock(tx, productID, req.VariantID, -req.Delta)
+		case req.VariantID == nil:
+			if err = requireNoVariants(tx, productID); err == nil {
+				err = incrementStock(tx, productID, nil, req.Delta)
+			}
+		default:
+			err = incrementStock(tx, productID, req.VariantID, req.Delta)
+		}
+		if err != nil {
+			return err
+		}
+		if err := tx.Create(&StockMovement{
+			ProductID: productID,
+			VariantID: req.VariantID,
+			Delta:     req.Delta,
+			Reason:    StockReasonAdjust,
+			Note:      req.Reason,
+			Actor:     currentActor(c),
+		}).Error; err != nil {
+			return err
+		}
+		if req.VariantID != nil {
+			level.VariantStock = new(int)
+			if err := tx.Model(&ProductVariant{}).Where("id = ?", *req.VariantID).Pluck("stock", level.VariantStock).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(&Product{}).Where("id = ?", productID).Pluck("stock", &level.Stock).Error; err != nil {
+			return err
+		}
+		return h.stockChangedTx(tx, productID)
+	})
+	if err != nil {
+		span.RecordError(err)
+		return httpError(err)
+	}
+
+	h.stockChanged(ctx, productID)
+	return c.JSON(http.StatusOK, level)
+}
+
+// ReleaseExpiredReservations 释放已过期的预留，返回释放数量
+func (h *ProductHandler) ReleaseExpiredReservations(ctx context.Context) (int, error) {
+	released := 0
+	for {
+		var expired []StockReservation
+		if err := h.db.WithContext(ctx).
+			Where("status = ? AND expires_at <= ?", ReservationPending, time.Now()).
+			Order("id").Limit(reservationSweepBatch).Find(&expired).Error; err != nil {
+			return released, err
+		}
+		for i := range expired {
+			err := h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+				if err := closeReservation(tx, &expired[i], ReservationExpired, systemActor); err != nil {
+					return err
+				}
+				return h.stockChangedTx(tx, expired[i].ProductID)
+			})
+			var httpErr *echo.HTTPError
+			if errors.As(err, &httpErr) && httpErr.Code == http.StatusConflict {
+				// 已被并发提交或释放
+				continue
+			}
+			if err != nil {
+				return released, err
+			}
+			released++
+			h.stockChanged(ctx, expired[i].ProductID)
+		}
+		if len(expired) < reservationSweepBatch {
+			return released, nil
+		}
+	}
+}
+
+// RunReservationSweeper 定期释放过期预留，直到 ctx 取消
+func (h *ProductHandler) RunReservationSweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := h.ReleaseExpiredReservations(ctx); err != nil && ctx.Err() == nil {
+				fmt.Printf("Error releasing expired reservations: %v\n", err)
+			}
+		}
+	}
+}
+
+// closeReservation 将待处理的预留置为终态，释放与过期会归还库存
+func closeReservation(tx *gorm.DB, reservation *StockReservation, status, actor string) error {
+	if reservation.Status != ReservationPending {
+		return echo.NewHTTPError(http.StatusConflict, fmt.Sprintf("reservation is already %s", reservation.Status))
+	}
+	// 条件更新防止并发请求重复处理同一预留
+	result := tx.Model(reservation).Where("status = ?", ReservationPending).Update("status", status)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return echo.NewHTTPError(http.StatusConflict, "reservation is no longer pending")
+	}
+
+	movement := StockMovement{
+		ProductID:     reservation.ProductID,
+		VariantID:     reservation.VariantID,
+		ReservationID: &reservation.ID,
+		Actor:         actor,
+	}
+	switch status {
+	case ReservationCommitted:
+		movement.Reason = StockReasonCommit
+	case ReservationReleased, ReservationExpired:
+		if err := incrementStock(tx, reservation.ProductID, reservation.VariantID, reservation.Quantity); err != nil {
+			return err
+		}
+		movement.Delta = reservation.Quantity
+		movement.Reason = StockReasonRelease
+		if status == ReservationExpired {
+			movement.Reason = StockReasonExpire
+		}
+	}
+	return tx.Create(&movement).Error
+}
+
+// decrementStock 条件扣减库存，库存不足时返回 409
+// 指定变体时扣减变体库存，产品库存作为变体库存之和同步扣减；
+// 未指定变体时只能扣减没有变体的产品
+func decrementStock(tx *gorm.DB, productID uint, variantID *uint, quantity int) error {
+	if variantID != nil {
+		result := tx.Model(&ProductVariant{}).
+			Where("id = ? AND product_id = ? AND stock >= ?", *variantID, productID, quantity).
+			Update("stock", gorm.Expr("stock - ?", quantity))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			var variant ProductVariant
+			if err := findVariant(tx, productID, *variantID, &variant); err != nil {
+				return err
+			}
+			return echo.NewHTTPError(http.StatusConflict, "insufficient stock")
+		}
+		return updateProductStock(tx, productID, gorm.Expr("stock - ?", quantity))
+	}
+
+	result := tx.Model(&Product{}).
+		Where("id = ? AND deleted_at IS NULL AND stock >= ? AND "+
+			"NOT EXISTS (SELECT 1 FROM product_variants WHERE product_variants.product_id = products.id)", productID, quantity).
+		Update("stock", gorm.Expr("stock - ?", quantity))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		if err := productExists(tx, productID); err != nil {
+			return err
+		}
+		if err := requireNoVariants(tx, productID); err != nil {
+			return err
+		}
+		return echo.NewHTTPError(http.StatusConflict, "insufficient stock")
+	}
+	return nil
+}
+
+// incrementStock 增加库存，指定变体时同步增加变体库存
+func incrementStock(tx *gorm.DB, productID uint, variantID *uint, quantity int) error {
+	if variantID != nil {
+		result := tx.Model(&ProductVariant{}).
+			Where("id = ? AND product_id = ?", *variantID, productID).
+			Update("stock", gorm.Expr("stock + ?", quantity))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return echo.NewHTTPError(http.StatusNotFound, "Variant not found")
+		}
+	}
+	return updateProductStock(tx, productID, gorm.Expr("stock + ?", quantity))
+}
+
+func updateProductStock(tx *gorm.DB, productID uint, expr clause.Expr) error {
+	result := tx.Model(&Product{}).
+		Where("id = ? AND deleted_at IS NULL", productID).
+		Update("stock", expr)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, "Product not found")
+	}
+	return nil
+}
+
+// requireNoVariants 按变体管理库存的产品必须指定变体
+func requireNoVariants(tx *gorm.DB, productID uint) error {
+	ok, err := hasVariants(tx, productID)
+	if err != nil {
+		return err
+	}
+	if ok {
+		return echo.NewHTTPError(http.StatusBadRequest, "variant_id is required for products with variants")
+	}
+	return nil
+}
+
+func productExists(tx *gorm.DB, productID uint) error {
+	var count int64
+	if err := tx.Model(&Product{}).Where("id = ? AND deleted_at IS NULL", productID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, "Product not found")
+	}
+	return nil
+}
+
+// recordInitialStock 事务内回调，为创建时指定的初始库存写入流水
+func recordInitialStock(tx *gorm.DB, change Change[Product]) error {
+	if change.Type != ChangeCreated || change.After == nil || change.After.Stock == 0 {
+		return nil
+	}
+	return tx.Create(&StockMovement{
+		ProductID: change.ID,
+		Delta:     change.After.Stock,
+		Reason:    StockReasonInitial,
+		Actor:     requestInfoFrom(tx.Statement.Context).Actor,
+	}).Error
+}
+
+// stockChanged 清除产品缓存并通知变更
+func (h *ProductHandler) stockChanged(ctx context.Context, productID uint) {
+	h.redis.Del(ctx, h.getCacheKey(strconv.FormatUint(uint64(productID), 10)))
+	h.notify(ctx, Change[Product]{Type: ChangeUpdated, ID: productID})
+}
+
+// stockChangedTx 在库存变更的事务内通知，与 stockChanged 成对使用
+func (h *ProductHandler) stockChangedTx(tx *gorm.DB, productID uint) error {
+	return h.notifyTx(tx, Change[Product]{Type: ChangeUpdated, ID: productID})
+}
+
+func productIDParam(c echo.Context) (uint, error) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, "Invalid product ID")
+	}
+	return uint(id), nil
+}
+
+// httpError 将事务错误转换为 HTTP 错误
+func httpError(err error) error {
+	err = duplicateKeyError(err)
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr
+	}
+	return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+}
+
+// mysqlDuplicateEntry MySQL 唯一索引冲突的错误码
+const mysqlDuplicateEntry = 1062
+
+// duplicateKeyError 将唯一索引冲突转换为 409，其他错误原样返回
+func duplicateKeyError(err error) error {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlDuplicateEntry {
+		return echo.NewHTTPError(http.StatusConflict, mysqlErr.Message)
+	}
+	return err
+}
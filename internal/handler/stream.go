@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/songfei1983/play-go-api/internal/events"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// sseRetry 建议客户端断线后的重连间隔（毫秒）
+const sseRetry = 3000
+
+// EventStreamHandler 以 Server-Sent Events 推送资源变更
+type EventStreamHandler struct {
+	feed      *events.RedisFeed
+	admins    Admins
+	heartbeat time.Duration
+}
+
+// NewEventStreamHandler 创建变更推送处理器，admins 可以收到所有用户的变更，
+// heartbeat 为空闲时发送注释行的间隔，防止代理断开空闲连接
+func NewEventStreamHandler(feed *events.RedisFeed, admins Admins, heartbeat time.Duration) *EventStreamHandler {
+	return &EventStreamHandler{feed: feed, admins: admins, heartbeat: heartbeat}
+}
+
+// eventFilter 单个连接的事件过滤条件
+type eventFilter struct {
+	userID uint
+	admin  bool
+	types  map[string]bool
+}
+
+// allows 判断连接能否收到事件：types 可以是事件名（ProductUpdated）或聚合名（Product）；
+// 用户事件只推送给本人与管理员，其余资源对所有登录用户可见
+func (f *eventFilter) allows(event events.Event) bool {
+	if len(f.types) > 0 && !f.types[event.Type] && !f.types[event.AggregateType] {
+		return false
+	}
+	if event.AggregateType == "User" && !f.admin {
+		return event.AggregateID == strconv.FormatUint(uint64(f.userID), 10)
+	}
+	return true
+}
+
+// Stream 推送资源变更事件。请求头 Last-Event-ID（或 last_event_id 参数）指定时先补发此后的事件，
+// 补发范围受 stream 长度限制；订阅者处理过慢时连接会被关闭，客户端重连后自动续传
+func (h *EventStreamHandler) Stream(c echo.Context) error {
+	ctx := c.Request().Context()
+	tracer := otel.Tracer("api-service")
+	ctx, span := tracer.Start(ctx, "EventStreamHandler.Stream")
+	span.SetAttributes(attribute.String("Request-ID", c.Response().Header().Get("X-Request-ID")))
+	defer span.End()
+
+	userID, err := currentUserID(c)
+	if err != nil {
+		return err
+	}
+	filter := &eventFilter{userID: userID, admin: h.admins.Has(userID)}
+	if v := c.QueryParam("types"); v != "" {
+		filter.types = make(map[string]bool)
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				filter.types[name] = true
+			}
+		}
+	}
+	lastID := c.Request().Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = c.QueryParam("last_event_id")
+	}
+	if lastID != "" && !events.ValidFeedID(lastID) {
+		return echo.NewHTTPError(http.StatusBadRequest, "Last-Event-ID must be an event stream ID")
+	}
+
+	// 先订阅再补发，补发期间到达的事件按 ID 去重，不会遗漏
+	live, unsubscribe := h.feed.Subscribe()
+	defer unsubscribe()
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	res.Header().Set(echo.HeaderConnection, "keep-alive")
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+	if _, err := fmt.Fprintf(res, "retry: %d\n\n", sseRetry); err != nil {
+		return nil
+	}
+	res.Flush()
+
+	for lastID != "" {
+		entries, err := h.feed.Since(ctx, lastID)
+		if err != nil {
+			span.RecordError(err)
+			return nil
+		}
+		for _, entry := range entries {
+			if err := h.send(res, filter, entry); err != nil {
+				return nil
+			}
+			lastID = entry.ID
+		}
+		if len(entries) < events.FeedPageSize {
+			break
+		}
+	}
+
+	ticker := time.NewTicker(h.heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if _, err := fmt.Fprint(res, ": ping\n\n"); err != nil {
+				return nil
+			}
+			res.Flush()
+		case entry, ok := <-live:
+			if !ok {
+				return nil
+			}
+			if lastID != "" && !events.FeedIDAfter(entry.ID, lastID) {
+				continue
+			}
+			if err := h.send(res, filter, entry); err != nil {
+				return nil
+			}
+			lastID = entry.ID
+		}
+	}
+}
+
+// send 写出一条允许推送的事件
+func (h *EventStreamHandler) send(res *echo.Response, filter *eventFilter, entry events.FeedEntry) error {
+	if !filter.allows(entry.Event) {
+		return nil
+	}
+	data, err := json.Marshal(entry.Event)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(res, "id: %s\nevent: %s\ndata: %s\n\n", entry.ID, entry.Event.Type, data); err != nil {
+		return err
+	}
+	res.Flush()
+	return nil
+}
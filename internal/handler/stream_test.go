@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/go-redis/redismock/v8"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/songfei1983/play-go-api/internal/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventStream(t *testing.T) {
+	e := echo.New()
+	client, mock := redismock.NewClientMock()
+	feed := events.NewRedisFeed(client, "events:feed", 0)
+	handler := NewEventStreamHandler(feed, NewAdmins([]uint{1}), time.Hour)
+
+	message := func(id, data string) redis.XMessage {
+		return redis.XMessage{ID: id, Values: map[string]interface{}{"event": data}}
+	}
+	backlog := []redis.XMessage{
+		message("2-0", `{"id":"11","type":"ProductUpdated","aggregate_type":"Product","aggregate_id":"1"}`),
+		message("3-0", `{"id":"12","type":"UserUpdated","aggregate_type":"User","aggregate_id":"4"}`),
+		message("4-0", `{"id":"13","type":"UserUpdated","aggregate_type":"User","aggregate_id":"3"}`),
+		message("5-0", `{"id":"14","type":"CategoryCreated","aggregate_type":"Category","aggregate_id":"2"}`),
+	}
+
+	// stream 发起一次推送请求，在 timeout 后断开连接
+	stream := func(username, query, lastID string) (*httptest.ResponseRecorder, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/events?"+query, nil).WithContext(ctx)
+		if lastID != "" {
+			req.Header.Set("Last-Event-ID", lastID)
+		}
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		userID := float64(3)
+		if username == "admin" {
+			userID = 1
+		}
+		c.Set("user", &jwt.Token{Claims: jwt.MapClaims{"user_id": userID, "username": username}})
+		return rec, handler.Stream(c)
+	}
+
+	t.Run("续传时只推送有权查看的事件", func(t *testing.T) {
+		mock.ExpectXRangeN("events:feed", "(1-0", "+", events.FeedPageSize).SetVal(backlog)
+
+		rec, err := stream("carol", "", "1-0")
+		require.NoError(t, err)
+		assert.Equal(t, "text/event-stream", rec.Header().Get(echo.HeaderContentType))
+		body := rec.Body.String()
+		assert.True(t, strings.HasPrefix(body, "retry: 3000\n\n"))
+		assert.Contains(t, body, "id: 2-0\nevent: ProductUpdated\n")
+		assert.NotContains(t, body, "id: 3-0")
+		assert.Contains(t, body, "id: 4-0\nevent: UserUpdated\n")
+		assert.Contains(t, body, "id: 5-0\nevent: CategoryCreated\n")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("按事件名或聚合过滤", func(t *testing.T) {
+		mock.ExpectXRangeN("events:feed", "(1-0", "+", events.FeedPageSize).SetVal(backlog)
+
+		rec, err := stream("admin", "types=Category,UserUpdated", "1-0")
+		require.NoError(t, err)
+		body := rec.Body.String()
+		assert.NotContains(t, body, "id: 2-0")
+		assert.Contains(t, body, "id: 3-0")
+		assert.Contains(t, body, "id: 4-0")
+		assert.Contains(t, body, "id: 5-0")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("无效的 Last-Event-ID", func(t *testing.T) {
+		_, err := stream("carol", "", "latest")
+		require.Error(t, err)
+		assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	})
+}
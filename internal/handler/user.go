@@ -1,11 +1,14 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math/rand"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -14,6 +17,7 @@ import (
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
 	"gorm.io/gorm"
 )
 
@@ -41,6 +45,28 @@ func (u User) TableName() string {
 	return "users"
 }
 
+// WritableFields 实现 WritableModel 接口
+func (u User) WritableFields() []string {
+	return []string{"username", "password", "email", "first_name", "last_name", "phone", "status"}
+}
+
+// RedactedFields 实现 RedactedModel 接口
+func (u User) RedactedFields() []string {
+	return []string{"password"}
+}
+
+// Validate 实现 Validator 接口。与 Register 一致，用户名、密码与邮箱不能为空，
+// 否则整体替换或导入时省略密码会产生空密码即可登录的账户
+func (u User) Validate() error {
+	if u.Username == "" || u.Password == "" || u.Email == "" {
+		return errors.New("username, password and email are required")
+	}
+	if !strings.Contains(u.Email, "@") {
+		return errors.New("email is invalid")
+	}
+	return validateStatus(u.Status)
+}
+
 type LoginRequest struct {
 	Username string `json:"username" validate:"required"`
 	Password string `json:"password" validate:"required"`
@@ -54,6 +80,8 @@ type Claims struct {
 
 type UserHandler struct {
 	*BaseHandler[User]
+	auditor *Auditor
+	admins  Admins
 }
 
 func NewUserHandler(db *gorm.DB, redis *redis.Client) *UserHandler {
@@ -62,6 +90,36 @@ func NewUserHandler(db *gorm.DB, redis *redis.Client) *UserHandler {
 	}
 }
 
+// UseAuditor 将用户变更与登录事件写入审计日志
+func (h *UserHandler) UseAuditor(auditor *Auditor) {
+	h.auditor = auditor
+	h.OnChange(AuditChanges[User](auditor))
+}
+
+// UseAdmins 设置管理员名单，只有管理员可以修改用户名与状态
+func (h *UserHandler) UseAdmins(admins Admins) {
+	h.admins = admins
+}
+
+// checkAdminFields 用户名与状态只有管理员可以修改，整体替换时提供原值不视为修改
+func checkAdminFields(before, after User, admin bool) error {
+	if admin || (before.Username == after.Username && before.Status == after.Status) {
+		return nil
+	}
+	return echo.NewHTTPError(http.StatusForbidden, "username and status can only be changed by administrators")
+}
+
+// auditLogin 记录登录成功或失败，操作者为尝试登录的用户名
+func (h *UserHandler) auditLogin(ctx context.Context, username string, userID uint, action string) {
+	if h.auditor == nil {
+		return
+	}
+	entry := &AuditLog{Actor: username, Action: action, ResourceType: User{}.TableName(), ResourceID: userID}
+	if err := h.auditor.Record(ctx, entry); err != nil {
+		trace.SpanFromContext(ctx).RecordError(err)
+	}
+}
+
 // Register 用户注册方法
 func (h *UserHandler) Register(c echo.Context) error {
 	ctx := c.Request().Context()
@@ -81,12 +139,19 @@ func (h *UserHandler) Register(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Username, password and email are required"})
 	}
 
-	result := h.db.WithContext(ctx).Create(&user)
-	if result.Error != nil {
-		span.RecordError(result.Error)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": result.Error.Error()})
+	err := h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		return h.notifyTx(tx, Change[User]{Type: ChangeCreated, ID: user.ID, After: &user})
+	})
+	if err != nil {
+		span.RecordError(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
 
+	h.notify(ctx, Change[User]{Type: ChangeCreated, ID: user.ID, After: &user})
+
 	// 只返回必要的信息
 	return c.JSON(http.StatusCreated, map[string]interface{}{
 		"id":       user.ID,
@@ -109,55 +174,46 @@ func (h *UserHandler) GetUser(c echo.Context) error {
 	id := c.Param("id")
 	span.SetAttributes(attribute.String("user_id", id))
 
-	// Try to get from cache first
-	cacheKey := fmt.Sprintf("user:%s", id)
-	userJSON, err := h.redis.Get(ctx, cacheKey).Result()
-	if err != nil && err != redis.Nil {
-		span.RecordError(err)
-	}
-	if err == nil {
-		var user User
-		if err = json.Unmarshal([]byte(userJSON), &user); err != nil {
-			span.RecordError(err)
-			span.SetAttributes(semconv.HTTPResponseStatusCode(http.StatusInternalServerError))
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Cache unmarshal error"})
-		}
-		// 添加数据来源标记：来自缓存
-		span.SetAttributes(attribute.String("data_source", "cache"))
-		span.SetAttributes(semconv.HTTPResponseStatusCode(http.StatusOK))
-		return c.JSON(http.StatusOK, user)
-	}
-
-	var user User
-	intID, err := strconv.Atoi(id)
+	intID, err := strconv.ParseUint(id, 10, 64)
 	if err != nil {
 		span.RecordError(err)
 		span.SetAttributes(semconv.HTTPResponseStatusCode(http.StatusBadRequest))
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid user ID"})
 	}
-	if err = h.db.WithContext(ctx).Where("deleted_at IS NULL").First(&user, intID).Error; err != nil {
+	user, err := h.FindUser(ctx, uint(intID))
+	if err != nil {
 		span.RecordError(err)
 		span.SetAttributes(semconv.HTTPResponseStatusCode(http.StatusNotFound))
 		return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
 	}
 
-	// 添加数据来源标记：来自MySQL
-	span.SetAttributes(attribute.String("data_source", "mysql"))
-
-	// Cache the user
-	userByte, err := json.Marshal(user)
-	if err != nil {
-		span.RecordError(err)
-	} else {
-		if err := h.redis.Set(ctx, cacheKey, string(userByte), time.Hour).Err(); err != nil {
-			span.RecordError(err)
-		}
-	}
-
 	span.SetAttributes(semconv.HTTPResponseStatusCode(http.StatusOK))
 	return c.JSON(http.StatusOK, user)
 }
 
+// userCacheKey 用户接口使用的缓存键，与通用资源的 users:<id> 不同
+func userCacheKey(id uint) string {
+	return fmt.Sprintf("user:%d", id)
+}
+
+// FindUser 读取未删除的用户，优先读取缓存
+func (h *UserHandler) FindUser(ctx context.Context, id uint) (User, error) {
+	return h.findRecord(ctx, id, userCacheKey(id))
+}
+
+// UpdateUserFields 按字段名更新用户并清除用户缓存，规则与 PUT/PATCH /users/:id 相同；
+// admin 为 false 时不能修改用户名与状态
+func (h *UserHandler) UpdateUserFields(ctx context.Context, id uint, body map[string]json.RawMessage, replace, admin bool) (User, error) {
+	return h.updateRecord(ctx, id, body, replace, userCacheKey(id), func(before, after User) error {
+		return checkAdminFields(before, after, admin)
+	})
+}
+
+// DeleteUser 软删除用户并清除用户缓存，用户不存在或已删除时返回 gorm.ErrRecordNotFound
+func (h *UserHandler) DeleteUser(ctx context.Context, id uint) error {
+	return h.deleteRecord(ctx, id, userCacheKey(id))
+}
+
 func (h *UserHandler) GetUsers(c echo.Context) error {
 	ctx := c.Request().Context()
 	tracer := otel.Tracer("api-service")
@@ -195,31 +251,33 @@ func (h *UserHandler) UpdateUser(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "Invalid user ID")
 	}
 
-	if err := h.db.WithContext(ctx).First(&user, intID).Error; err != nil {
+	if err := h.db.WithContext(ctx).Where("deleted_at IS NULL").First(&user, intID).Error; err != nil {
 		span.RecordError(err)
 		return echo.NewHTTPError(http.StatusNotFound, "User not found")
 	}
 
-	// Handle both PUT (full update) and PATCH (partial update)
-	if c.Request().Method == "PUT" {
-		if err := c.Bind(&user); err != nil {
-			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
-		}
-	} else {
-		// For PATCH, only update provided fields
-		updates := make(map[string]interface{})
-		if err := c.Bind(&updates); err != nil {
-			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
-		}
-		if err := h.db.Model(&user).Updates(updates).Error; err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
-		}
+	// Handle both PUT (full replacement) and PATCH (partial update)
+	before := user
+	columns, err := h.prepareUpdate(c, &user)
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+	if err := checkAdminFields(before, user, h.admins.IsAdmin(c)); err != nil {
+		span.RecordError(err)
+		return err
+	}
+	if err := h.saveUpdate(ctx, &user, before, columns); err != nil {
+		span.RecordError(err)
+		return err
 	}
 
 	// Clear cache
 	cacheKey := fmt.Sprintf("user:%s", id)
 	h.redis.Del(ctx, cacheKey)
 
+	h.notify(ctx, Change[User]{Type: ChangeUpdated, ID: user.ID, Before: &before, After: &user})
+
 	return c.JSON(http.StatusOK, user)
 }
 
@@ -237,15 +295,14 @@ func (h *UserHandler) SoftDeleteUser(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "Invalid user ID")
 	}
 
-	if err := h.db.WithContext(ctx).Model(&User{}).Unscoped().Where("id = ?", intID).Update("deleted_at", time.Now()).Error; err != nil {
+	if err := h.DeleteUser(ctx, uint(intID)); err != nil {
 		span.RecordError(err)
-		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "User not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
 
-	// Clear cache
-	cacheKey := fmt.Sprintf("user:%s", id)
-	h.redis.Del(ctx, cacheKey)
-
 	return c.NoContent(http.StatusNoContent)
 }
 
@@ -257,8 +314,17 @@ func (h *UserHandler) RestoreUser(c echo.Context) error {
 
 	id := c.Param("id")
 
-	if err := h.db.WithContext(ctx).Model(&User{}).Unscoped().Where("id = ?", id).Update("deleted_at", nil).Error; err != nil {
+	intID, err := strconv.Atoi(id)
+	if err != nil {
+		span.RecordError(err)
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid user ID")
+	}
+
+	if err := h.RestoreRecord(ctx, uint(intID)); err != nil {
 		span.RecordError(err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "User not found")
+		}
 		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
 
@@ -278,14 +344,30 @@ func (h *UserHandler) Login(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
-	var user User
-	if err := h.db.WithContext(ctx).Where("username = ?", req.Username).First(&user).Error; err != nil {
+	tokenString, err := h.Authenticate(ctx, req.Username, req.Password)
+	if err != nil {
 		span.RecordError(err)
-		return echo.NewHTTPError(http.StatusUnauthorized, "invalid credentials")
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"token": tokenString,
+	})
+}
+
+// Authenticate 校验用户名与密码并签发 24 小时有效的 JWT，登录结果写入审计日志；
+// 凭据错误时返回 401
+func (h *UserHandler) Authenticate(ctx context.Context, username, password string) (string, error) {
+	var user User
+	if err := h.db.WithContext(ctx).Where("username = ?", username).First(&user).Error; err != nil {
+		trace.SpanFromContext(ctx).RecordError(err)
+		h.auditLogin(ctx, username, 0, AuditLoginFailed)
+		return "", echo.NewHTTPError(http.StatusUnauthorized, "invalid credentials")
 	}
 
-	if user.Password != req.Password {
-		return echo.NewHTTPError(http.StatusUnauthorized, "invalid credentials")
+	if user.Password != password {
+		h.auditLogin(ctx, username, user.ID, AuditLoginFailed)
+		return "", echo.NewHTTPError(http.StatusUnauthorized, "invalid credentials")
 	}
 
 	// Create claims with user data
@@ -304,13 +386,10 @@ func (h *UserHandler) Login(c echo.Context) error {
 	// Generate signed token
 	tokenString, err := token.SignedString([]byte("your-secret-key"))
 	if err != nil {
-		span.RecordError(err)
-		return echo.NewHTTPError(http.StatusInternalServerError, "could not generate token")
+		return "", echo.NewHTTPError(http.StatusInternalServerError, "could not generate token")
 	}
-
-	return c.JSON(http.StatusOK, map[string]string{
-		"token": tokenString,
-	})
+	h.auditLogin(ctx, user.Username, user.ID, AuditLoginSucceeded)
+	return tokenString, nil
 }
 
 func (h *UserHandler) GetCurrentUser(c echo.Context) error {
@@ -336,3 +415,34 @@ func (h *UserHandler) GetCurrentUser(c echo.Context) error {
 
 	return c.JSON(http.StatusOK, user)
 }
+
+// currentActor 返回 JWT 中的用户名，未认证时返回 "anonymous"
+func currentActor(c echo.Context) string {
+	token, ok := c.Get("user").(*jwt.Token)
+	if !ok {
+		return "anonymous"
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return "anonymous"
+	}
+	if name, ok := claims["username"].(string); ok && name != "" {
+		return name
+	}
+	if id, ok := claims["user_id"].(float64); ok {
+		return fmt.Sprintf("user:%d", uint(id))
+	}
+	return "anonymous"
+}
+
+// currentUserID 返回 JWT 中的用户 ID，未认证时返回 401
+func currentUserID(c echo.Context) (uint, error) {
+	if token, ok := c.Get("user").(*jwt.Token); ok {
+		if claims, ok := token.Claims.(jwt.MapClaims); ok {
+			if id, ok := claims["user_id"].(float64); ok && id > 0 {
+				return uint(id), nil
+			}
+		}
+	}
+	return 0, echo.NewHTTPError(http.StatusUnauthorized, "authentication required")
+}
@@ -11,6 +11,7 @@ import (
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/go-redis/redismock/v8"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -320,7 +321,7 @@ func TestUpdateUser(t *testing.T) {
 
 	t.Run("成功更新用户", func(t *testing.T) {
 		// 准备请求数据
-		updateJSON := `{"first_name":"Updated","last_name":"Name"}`
+		updateJSON := `{"username":"testuser","password":"password123","email":"test@example.com","first_name":"Updated","last_name":"Name"}`
 
 		// 创建请求
 		req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(updateJSON))
@@ -335,7 +336,7 @@ func TestUpdateUser(t *testing.T) {
 		rows := sqlmock.NewRows([]string{"id", "username", "password", "email", "first_name", "last_name", "phone", "status", "created_at", "updated_at", "deleted_at"}).
 			AddRow(1, "testuser", "password123", "test@example.com", "Test", "User", "1234567890", "active", time.Now(), time.Now(), nil)
 
-		mock.ExpectQuery("SELECT \\* FROM `users` WHERE `users`\\.`id` = \\? ORDER BY `users`\\.`id` LIMIT \\?").
+		mock.ExpectQuery("SELECT \\* FROM `users` WHERE deleted_at IS NULL AND `users`\\.`id` = \\? ORDER BY `users`\\.`id` LIMIT \\?").
 			WithArgs(1, 1).
 			WillReturnRows(rows)
 
@@ -355,6 +356,25 @@ func TestUpdateUser(t *testing.T) {
 		assert.Equal(t, http.StatusOK, rec.Code)
 	})
 
+	t.Run("整体替换省略必填字段", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"username":"testuser","email":"test@example.com"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		c := e.NewContext(req, httptest.NewRecorder())
+		c.SetPath("/users/:id")
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+
+		rows := sqlmock.NewRows([]string{"id", "username", "password", "email", "status"}).
+			AddRow(1, "testuser", "password123", "test@example.com", "active")
+		mock.ExpectQuery("SELECT \\* FROM `users` WHERE deleted_at IS NULL AND `users`\\.`id` = \\? ORDER BY `users`\\.`id` LIMIT \\?").
+			WithArgs(1, 1).
+			WillReturnRows(rows)
+
+		err := handler.UpdateUser(c)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusUnprocessableEntity, err.(*echo.HTTPError).Code)
+	})
+
 	t.Run("用户不存在", func(t *testing.T) {
 		// 准备请求数据
 		updateJSON := `{"first_name":"Updated","last_name":"Name"}`
@@ -380,6 +400,54 @@ func TestUpdateUser(t *testing.T) {
 	})
 }
 
+// TestUpdateUserAdminFields 测试只有管理员可以修改用户名与状态
+func TestUpdateUserAdminFields(t *testing.T) {
+	e, handler, mock, redisMock := setupTest(t)
+	handler.UseAdmins(NewAdmins([]uint{9}))
+	patchAs := func(userID float64, body string) echo.Context {
+		req := httptest.NewRequest(http.MethodPatch, "/", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		c := e.NewContext(req, httptest.NewRecorder())
+		c.SetPath("/users/:id")
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+		c.Set("user", &jwt.Token{Claims: jwt.MapClaims{"user_id": userID, "username": "testuser"}})
+		return c
+	}
+	expectFind := func() {
+		rows := sqlmock.NewRows([]string{"id", "username", "password", "email", "status"}).
+			AddRow(1, "testuser", "password123", "test@example.com", "active")
+		mock.ExpectQuery("SELECT \\* FROM `users` WHERE deleted_at IS NULL AND `users`\\.`id` = \\? ORDER BY `users`\\.`id` LIMIT \\?").
+			WithArgs(1, 1).
+			WillReturnRows(rows)
+	}
+
+	t.Run("用户本人不能修改用户名与状态", func(t *testing.T) {
+		for _, body := range []string{`{"username":"root"}`, `{"status":"inactive"}`} {
+			expectFind()
+			err := handler.UpdateUser(patchAs(1, body))
+			require.Error(t, err)
+			assert.Equal(t, http.StatusForbidden, err.(*echo.HTTPError).Code)
+		}
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("管理员可以修改用户状态", func(t *testing.T) {
+		expectFind()
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE `users` SET `status`=\\?,`updated_at`=\\? WHERE `id` = \\?").
+			WithArgs("inactive", sqlmock.AnyArg(), 1).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		redisMock.ExpectDel("user:1").SetVal(1)
+
+		c := patchAs(9, `{"status":"inactive"}`)
+		require.NoError(t, handler.UpdateUser(c))
+		assert.Equal(t, http.StatusOK, c.Response().Status)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
 // TestSoftDeleteUser 测试软删除用户功能
 func TestSoftDeleteUser(t *testing.T) {
 	// 设置测试环境
@@ -471,9 +539,9 @@ func TestRestoreUser(t *testing.T) {
 		c.SetParamNames("id")
 		c.SetParamValues("999")
 
-		// 设置数据库期望（返回错误，表示用户不存在）
+		// 设置数据库期望（没有已删除的行被更新，表示用户不存在或未被删除）
 		mock.ExpectBegin()
-		mock.ExpectExec("^UPDATE `users` SET (.+) WHERE (.+)$").WillReturnError(gorm.ErrRecordNotFound)
+		mock.ExpectExec("^UPDATE `users` SET (.+) WHERE id = \\? AND deleted_at IS NOT NULL").WillReturnResult(sqlmock.NewResult(0, 0))
 		mock.ExpectRollback()
 
 		// 执行请求
@@ -481,7 +549,8 @@ func TestRestoreUser(t *testing.T) {
 
 		// 断言结果
 		assert.Error(t, err)
-		assert.Equal(t, http.StatusInternalServerError, err.(*echo.HTTPError).Code)
+		assert.Equal(t, http.StatusNotFound, err.(*echo.HTTPError).Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
 	})
 }
 
@@ -573,3 +642,50 @@ func TestLogin(t *testing.T) {
 		assert.Contains(t, err.(*echo.HTTPError).Message, "invalid credentials")
 	})
 }
+
+// TestExportUsers 测试导出用户时脱敏敏感字段
+func TestExportUsers(t *testing.T) {
+	// 设置测试环境
+	e, handler, mock, _ := setupTest(t)
+
+	t.Run("密码字段脱敏", func(t *testing.T) {
+		// 创建请求
+		req := httptest.NewRequest(http.MethodGet, "/users/export?format=csv&columns=id,username,password", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		// 设置数据库期望
+		rows := sqlmock.NewRows([]string{"id", "username", "password"}).
+			AddRow(1, "user1", "password1")
+		mock.ExpectQuery("^SELECT `id`,`username`,`password` FROM `users` WHERE deleted_at IS NULL$").WillReturnRows(rows)
+
+		// 执行请求
+		err := handler.Export(c)
+
+		// 断言结果
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "id,username,password\n1,user1,[REDACTED]\n", rec.Body.String())
+	})
+}
+
+// TestImportUsers 测试导入用户时与注册相同的必填校验
+func TestImportUsers(t *testing.T) {
+	e, handler, _, _ := setupTest(t)
+
+	t.Run("缺少密码的行无效", func(t *testing.T) {
+		body := "username,email,password\nbob,bob@example.com,\ncarol,carol@example.com,secret\n"
+		req := httptest.NewRequest(http.MethodPost, "/users/import?dry_run=true", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, "text/csv")
+		rec := httptest.NewRecorder()
+
+		require.NoError(t, handler.Import(e.NewContext(req, rec)))
+
+		var report ImportReport
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+		assert.Equal(t, 1, report.Valid)
+		require.Len(t, report.Errors, 1)
+		assert.Equal(t, 1, report.Errors[0].Row)
+		assert.Equal(t, "username, password and email are required", report.Errors[0].Error)
+	})
+}
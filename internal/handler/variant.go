@@ -0,0 +1,422 @@
+package handler
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/songfei1983/play-go-api/internal/money"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var skuPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// VariantOptions 变体的选项属性，如 {"size": "M", "colour": "red"}
+type VariantOptions map[string]string
+
+// Scan 实现 sql.Scanner 接口
+func (o *VariantOptions) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*o = nil
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into VariantOptions", value)
+	}
+	return json.Unmarshal(data, o)
+}
+
+// Value 实现 driver.Valuer 接口
+func (o VariantOptions) Value() (driver.Value, error) {
+	if o == nil {
+		return "{}", nil
+	}
+	data, err := json.Marshal(o)
+	return string(data), err
+}
+
+// GormDataType 数据库列类型
+func (VariantOptions) GormDataType() string {
+	return "json"
+}
+
+// equal 判断两组选项是否相同
+func (o VariantOptions) equal(other VariantOptions) bool {
+	if len(o) != len(other) {
+		return false
+	}
+	for k, v := range o {
+		if w, ok := other[k]; !ok || w != v {
+			return false
+		}
+	}
+	return true
+}
+
+// ProductVariant 产品变体（SKU），库存按变体管理，价格为空时沿用产品价格
+type ProductVariant struct {
+	ID        uint           `json:"id" gorm:"primaryKey"`
+	ProductID uint           `json:"product_id" gorm:"not null;index"`
+	SKU       string         `json:"sku" gorm:"column:sku;size:64;not null;uniqueIndex"`
+	Options   VariantOptions `json:"options" gorm:"type:json"`
+	Price     *money.Decimal `json:"price" gorm:"type:decimal(10,2)"`
+	Stock     int            `json:"stock" gorm:"not null"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+}
+
+// GetID 实现 Model 接口
+func (v ProductVariant) GetID() uint {
+	return v.ID
+}
+
+// TableName 实现 Model 接口
+func (v ProductVariant) TableName() string {
+	return "product_variants"
+}
+
+// WritableFields 实现 WritableModel 接口，变体不能移动到其他产品下
+func (v ProductVariant) WritableFields() []string {
+	return []string{"sku", "options", "price", "stock"}
+}
+
+// Validate 实现 Validator 接口
+func (v ProductVariant) Validate() error {
+	if !skuPattern.MatchString(v.SKU) {
+		return errors.New("sku must be 1-64 letters, digits, '.', '_' or '-'")
+	}
+	for name, value := range v.Options {
+		if strings.TrimSpace(name) == "" || strings.TrimSpace(value) == "" {
+			return errors.New("option names and values must not be empty")
+		}
+	}
+	if v.Price != nil && v.Price.IsNegative() {
+		return errors.New("price must not be negative")
+	}
+	if v.Price != nil && !v.Price.InRange() {
+		return errors.New("price must be at most " + maxPrice)
+	}
+	if v.Stock < 0 {
+		return errors.New("stock must not be negative")
+	}
+	return nil
+}
+
+// ListVariants 获取产品的全部变体
+func (h *ProductHandler) ListVariants(c echo.Context) error {
+	ctx := c.Request().Context()
+	tracer := otel.Tracer("api-service")
+	ctx, span := tracer.Start(ctx, "ProductHandler.ListVariants")
+	span.SetAttributes(attribute.String("Request-ID", c.Response().Header().Get("X-Request-ID")))
+	defer span.End()
+
+	productID, err := productIDParam(c)
+	if err != nil {
+		return err
+	}
+	if err := productExists(h.db.WithContext(ctx), productID); err != nil {
+		return httpError(err)
+	}
+
+	variants := []ProductVariant{}
+	if err := h.db.WithContext(ctx).Where("product_id = ?", productID).Order("id").Find(&variants).Error; err != nil {
+		span.RecordError(err)
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, variants)
+}
+
+// VariantsByProduct 一次查询多个产品的变体，按产品 ID 分组
+func (h *ProductHandler) VariantsByProduct(ctx context.Context, productIDs []uint) (map[uint][]ProductVariant, error) {
+	var variants []ProductVariant
+	if err := h.db.WithContext(ctx).Where("product_id IN ?", productIDs).Order("id").Find(&variants).Error; err != nil {
+		return nil, err
+	}
+	grouped := make(map[uint][]ProductVariant, len(productIDs))
+	for _, v := range variants {
+		grouped[v.ProductID] = append(grouped[v.ProductID], v)
+	}
+	return grouped, nil
+}
+
+// GetVariant 获取单个变体
+func (h *ProductHandler) GetVariant(c echo.Context) error {
+	ctx := c.Request().Context()
+	tracer := otel.Tracer("api-service")
+	ctx, span := tracer.Start(ctx, "ProductHandler.GetVariant")
+	span.SetAttributes(attribute.String("Request-ID", c.Response().Header().Get("X-Request-ID")))
+	defer span.End()
+
+	productID, variantID, err := variantParams(c)
+	if err != nil {
+		return err
+	}
+	var variant ProductVariant
+	if err := findVariant(h.db.WithContext(ctx), productID, variantID, &variant); err != nil {
+		return httpError(err)
+	}
+	return c.JSON(http.StatusOK, variant)
+}
+
+// CreateVariant 为产品创建变体，并重新汇总产品库存
+func (h *ProductHandler) CreateVariant(c echo.Context) error {
+	ctx := c.Request().Context()
+	tracer := otel.Tracer("api-service")
+	ctx, span := tracer.Start(ctx, "ProductHandler.CreateVariant")
+	span.SetAttributes(attribute.String("Request-ID", c.Response().Header().Get("X-Request-ID")))
+	defer span.End()
+
+	productID, err := productIDParam(c)
+	if err != nil {
+		return err
+	}
+	var variant ProductVariant
+	if err := c.Bind(&variant); err != nil {
+		span.RecordError(err)
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	variant.ID = 0
+	variant.ProductID = productID
+	if err := validateModel(variant); err != nil {
+		return err
+	}
+
+	err = h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := productExists(tx, productID); err != nil {
+			return err
+		}
+		if err := checkVariantUnique(tx, &variant); err != nil {
+			return err
+		}
+		if err := tx.Create(&variant).Error; err != nil {
+			return err
+		}
+		productDelta, err := aggregateStock(tx, productID)
+		if err != nil {
+			return err
+		}
+		if err := recordVariantStock(tx, variant, variant.Stock, productDelta, StockReasonInitial, currentActor(c)); err != nil {
+			return err
+		}
+		return h.stockChangedTx(tx, productID)
+	})
+	if err != nil {
+		span.RecordError(err)
+		return httpError(err)
+	}
+
+	h.stockChanged(ctx, productID)
+	return c.JSON(http.StatusCreated, variant)
+}
+
+// UpdateVariant 更新变体，PUT/PATCH 语义与通用更新一致
+func (h *ProductHandler) UpdateVariant(c echo.Context) error {
+	ctx := c.Request().Context()
+	tracer := otel.Tracer("api-service")
+	ctx, span := tracer.Start(ctx, "ProductHandler.UpdateVariant")
+	span.SetAttributes(attribute.String("Request-ID", c.Response().Header().Get("X-Request-ID")))
+	defer span.End()
+
+	productID, variantID, err := variantParams(c)
+	if err != nil {
+		return err
+	}
+	var variant ProductVariant
+	if err := findVariant(h.db.WithContext(ctx), productID, variantID, &variant); err != nil {
+		return httpError(err)
+	}
+
+	columns, err := h.variants.prepareUpdate(c, &variant)
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+	if len(columns) == 0 {
+		return c.JSON(http.StatusOK, variant)
+	}
+
+	err = h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := checkVariantUnique(tx, &variant); err != nil {
+			return err
+		}
+		// 以事务内锁定的当前库存计算变化量，避免与预留、订单并发时流水失真
+		var previous int
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Model(&ProductVariant{}).
+			Where("id = ?", variant.ID).Pluck("stock", &previous).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&variant).Select(columns).Updates(&variant).Error; err != nil {
+			return err
+		}
+		variantDelta := 0
+		if slices.Contains(columns, "stock") {
+			variantDelta = variant.Stock - previous
+		}
+		productDelta, err := aggregateStock(tx, productID)
+		if err != nil {
+			return err
+		}
+		if err := recordVariantStock(tx, variant, variantDelta, productDelta, StockReasonAdjust, currentActor(c)); err != nil {
+			return err
+		}
+		return h.stockChangedTx(tx, productID)
+	})
+	if err != nil {
+		span.RecordError(err)
+		return httpError(err)
+	}
+
+	h.stockChanged(ctx, productID)
+	return c.JSON(http.StatusOK, variant)
+}
+
+// DeleteVariant 删除变体，并重新汇总产品库存
+func (h *ProductHandler) DeleteVariant(c echo.Context) error {
+	ctx := c.Request().Context()
+	tracer := otel.Tracer("api-service")
+	ctx, span := tracer.Start(ctx, "ProductHandler.DeleteVariant")
+	span.SetAttributes(attribute.String("Request-ID", c.Response().Header().Get("X-Request-ID")))
+	defer span.End()
+
+	productID, variantID, err := variantParams(c)
+	if err != nil {
+		return err
+	}
+	err = h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var variant ProductVariant
+		if err := findVariant(tx.Clauses(clause.Locking{Strength: "UPDATE"}), productID, variantID, &variant); err != nil {
+			return err
+		}
+		if err := tx.Delete(&variant).Error; err != nil {
+			return err
+		}
+		productDelta, err := aggregateStock(tx, productID)
+		if err != nil {
+			return err
+		}
+		if err := recordVariantStock(tx, variant, -variant.Stock, productDelta, StockReasonAdjust, currentActor(c)); err != nil {
+			return err
+		}
+		return h.stockChangedTx(tx, productID)
+	})
+	if err != nil {
+		span.RecordError(err)
+		return httpError(err)
+	}
+
+	h.stockChanged(ctx, productID)
+	return c.NoContent(http.StatusNoContent)
+}
+
+func variantParams(c echo.Context) (uint, uint, error) {
+	productID, err := productIDParam(c)
+	if err != nil {
+		return 0, 0, err
+	}
+	variantID, err := strconv.ParseUint(c.Param("variant_id"), 10, 64)
+	if err != nil || variantID == 0 {
+		return 0, 0, echo.NewHTTPError(http.StatusBadRequest, "Invalid variant ID")
+	}
+	return productID, uint(variantID), nil
+}
+
+func findVariant(tx *gorm.DB, productID, variantID uint, variant *ProductVariant) error {
+	err := tx.Where("product_id = ?", productID).First(variant, variantID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, "Variant not found")
+	}
+	return err
+}
+
+// checkVariantUnique SKU 全局唯一，同一产品下选项组合不能重复
+func checkVariantUnique(tx *gorm.DB, variant *ProductVariant) error {
+	var count int64
+	if err := tx.Model(&ProductVariant{}).Where("sku = ? AND id <> ?", variant.SKU, variant.ID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return echo.NewHTTPError(http.StatusConflict, fmt.Sprintf("sku %q already exists", variant.SKU))
+	}
+
+	var siblings []ProductVariant
+	if err := tx.Select("id", "options").Where("product_id = ? AND id <> ?", variant.ProductID, variant.ID).Find(&siblings).Error; err != nil {
+		return err
+	}
+	for _, s := range siblings {
+		if s.Options.equal(variant.Options) {
+			return echo.NewHTTPError(http.StatusConflict, "a variant with the same options already exists")
+		}
+	}
+	return nil
+}
+
+// aggregateStock 将产品库存重新汇总为全部变体库存之和，返回产品库存的变化量
+func aggregateStock(tx *gorm.DB, productID uint) (int, error) {
+	var before, after int
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Model(&Product{}).
+		Where("id = ?", productID).Pluck("stock", &before).Error; err != nil {
+		return 0, err
+	}
+	sum := tx.Session(&gorm.Session{NewDB: true}).Model(&ProductVariant{}).
+		Select("COALESCE(SUM(stock), 0)").Where("product_id = ?", productID)
+	if err := tx.Model(&Product{}).Where("id = ?", productID).Update("stock", sum).Error; err != nil {
+		return 0, err
+	}
+	if err := tx.Model(&Product{}).Where("id = ?", productID).Pluck("stock", &after).Error; err != nil {
+		return 0, err
+	}
+	return after - before, nil
+}
+
+// recordVariantStock 为变体库存变化写入流水。产品库存的变化与变体不一致时（创建首个变体时
+// 产品原有库存被变体库存之和取代），差额记为产品级调整，保证流水合计与产品库存一致
+func recordVariantStock(tx *gorm.DB, variant ProductVariant, variantDelta, productDelta int, reason, actor string) error {
+	movements := []StockMovement{}
+	if variantDelta != 0 {
+		movements = append(movements, StockMovement{
+			ProductID: variant.ProductID,
+			VariantID: &variant.ID,
+			Delta:     variantDelta,
+			Reason:    reason,
+			Note:      "variant " + variant.SKU,
+			Actor:     actor,
+		})
+	}
+	if rest := productDelta - variantDelta; rest != 0 {
+		movements = append(movements, StockMovement{
+			ProductID: variant.ProductID,
+			Delta:     rest,
+			Reason:    StockReasonAdjust,
+			Note:      "product stock replaced by variant stock",
+			Actor:     actor,
+		})
+	}
+	if len(movements) == 0 {
+		return nil
+	}
+	return tx.Create(&movements).Error
+}
+
+// hasVariants 判断产品是否按变体管理库存
+func hasVariants(tx *gorm.DB, productID uint) (bool, error) {
+	var count int64
+	err := tx.Model(&ProductVariant{}).Where("product_id = ?", productID).Count(&count).Error
+	return count > 0, err
+}
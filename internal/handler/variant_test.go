@@ -0,0 +1,229 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProductVariants(t *testing.T) {
+	e, handler, mock, redisMock := setupProductTest(t)
+
+	newContext := func(method, contentType, body string, params ...string) (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(method, "/", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, contentType)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		names := []string{"id", "variant_id"}
+		c.SetParamNames(names[:len(params)]...)
+		c.SetParamValues(params...)
+		return c, rec
+	}
+
+	expectProductExists := func() {
+		mock.ExpectQuery("SELECT count\\(\\*\\) FROM `products` WHERE id = \\? AND deleted_at IS NULL").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	}
+	expectUnique := func(variantID int, siblings *sqlmock.Rows) {
+		mock.ExpectQuery("SELECT count\\(\\*\\) FROM `product_variants` WHERE sku = \\? AND id <> \\?").
+			WithArgs(sqlmock.AnyArg(), variantID).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+		mock.ExpectQuery("SELECT `id`,`options` FROM `product_variants` WHERE product_id = \\? AND id <> \\?").
+			WithArgs(1, variantID).
+			WillReturnRows(siblings)
+	}
+	expectAggregate := func(before, after int) {
+		mock.ExpectQuery("SELECT `stock` FROM `products` WHERE id = \\? FOR UPDATE").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"stock"}).AddRow(before))
+		mock.ExpectExec("UPDATE `products` SET `stock`=\\(SELECT COALESCE\\(SUM\\(stock\\), 0\\) FROM `product_variants` WHERE product_id = \\?\\),`updated_at`=\\? WHERE id = \\?").
+			WithArgs(1, sqlmock.AnyArg(), 1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery("SELECT `stock` FROM `products` WHERE id = \\?$").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"stock"}).AddRow(after))
+	}
+
+	t.Run("创建变体并汇总库存", func(t *testing.T) {
+		c, rec := newContext(http.MethodPost, echo.MIMEApplicationJSON,
+			`{"sku":"TEE-M-RED","options":{"size":"M","colour":"red"},"price":"21.50","stock":5}`, "1")
+
+		mock.ExpectBegin()
+		expectProductExists()
+		expectUnique(0, sqlmock.NewRows([]string{"id", "options"}).AddRow(1, `{"size":"S","colour":"red"}`))
+		mock.ExpectExec("INSERT INTO `product_variants`").
+			WithArgs(1, "TEE-M-RED", `{"colour":"red","size":"M"}`, "21.50", 5, sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(2, 1))
+		expectAggregate(4, 9)
+		mock.ExpectExec("INSERT INTO `inventory_ledger`").
+			WithArgs(1, 2, nil, 5, StockReasonInitial, "variant TEE-M-RED", "anonymous", sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		redisMock.ExpectDel("products:1").SetVal(1)
+
+		require.NoError(t, handler.CreateVariant(c))
+		assert.Equal(t, http.StatusCreated, rec.Code)
+
+		var variant ProductVariant
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &variant))
+		assert.Equal(t, uint(2), variant.ID)
+		assert.Equal(t, "21.50", variant.Price.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("首个变体取代产品库存时记录差额", func(t *testing.T) {
+		c, _ := newContext(http.MethodPost, echo.MIMEApplicationJSON, `{"sku":"TEE-S-RED","options":{"size":"S"},"stock":2}`, "1")
+
+		mock.ExpectBegin()
+		expectProductExists()
+		expectUnique(0, sqlmock.NewRows([]string{"id", "options"}))
+		mock.ExpectExec("INSERT INTO `product_variants`").WillReturnResult(sqlmock.NewResult(1, 1))
+		expectAggregate(7, 2)
+		mock.ExpectExec("INSERT INTO `inventory_ledger`").
+			WithArgs(1, 1, nil, 2, StockReasonInitial, "variant TEE-S-RED", "anonymous", sqlmock.AnyArg(),
+				1, nil, nil, -7, StockReasonAdjust, "product stock replaced by variant stock", "anonymous", sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 2))
+		mock.ExpectCommit()
+		redisMock.ExpectDel("products:1").SetVal(1)
+
+		require.NoError(t, handler.CreateVariant(c))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("选项组合重复", func(t *testing.T) {
+		c, _ := newContext(http.MethodPost, echo.MIMEApplicationJSON,
+			`{"sku":"TEE-M-RED-2","options":{"colour":"red","size":"M"}}`, "1")
+
+		mock.ExpectBegin()
+		expectProductExists()
+		expectUnique(0, sqlmock.NewRows([]string{"id", "options"}).AddRow(2, `{"size":"M","colour":"red"}`))
+		mock.ExpectRollback()
+
+		err := handler.CreateVariant(c)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusConflict, err.(*echo.HTTPError).Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("非法SKU", func(t *testing.T) {
+		c, _ := newContext(http.MethodPost, echo.MIMEApplicationJSON, `{"sku":"bad sku"}`, "1")
+
+		err := handler.CreateVariant(c)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusUnprocessableEntity, err.(*echo.HTTPError).Code)
+	})
+
+	t.Run("合并补丁更新变体库存", func(t *testing.T) {
+		c, rec := newContext(http.MethodPatch, MIMEMergePatch, `{"stock":9,"price":null}`, "1", "2")
+
+		mock.ExpectQuery("SELECT \\* FROM `product_variants` WHERE product_id = \\? AND `product_variants`\\.`id` = \\?").
+			WithArgs(1, 2, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "product_id", "sku", "options", "price", "stock"}).
+				AddRow(2, 1, "TEE-M-RED", `{"size":"M","colour":"red"}`, "21.50", 5))
+		mock.ExpectBegin()
+		expectUnique(2, sqlmock.NewRows([]string{"id", "options"}))
+		mock.ExpectQuery("SELECT `stock` FROM `product_variants` WHERE id = \\? FOR UPDATE").
+			WithArgs(2).
+			WillReturnRows(sqlmock.NewRows([]string{"stock"}).AddRow(6))
+		mock.ExpectExec("UPDATE `product_variants` SET `price`=\\?,`stock`=\\?,`updated_at`=\\? WHERE `id` = \\?").
+			WithArgs(nil, 9, sqlmock.AnyArg(), 2).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		expectAggregate(10, 13)
+		mock.ExpectExec("INSERT INTO `inventory_ledger`").
+			WithArgs(1, 2, nil, 3, StockReasonAdjust, "variant TEE-M-RED", "anonymous", sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(2, 1))
+		mock.ExpectCommit()
+		redisMock.ExpectDel("products:1").SetVal(1)
+
+		require.NoError(t, handler.UpdateVariant(c))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"price":null`)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("删除变体并记录库存流水", func(t *testing.T) {
+		c, rec := newContext(http.MethodDelete, echo.MIMEApplicationJSON, "", "1", "2")
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT \\* FROM `product_variants` WHERE product_id = \\? AND `product_variants`\\.`id` = \\? ORDER BY `product_variants`\\.`id` LIMIT \\? FOR UPDATE").
+			WithArgs(1, 2, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "product_id", "sku", "stock"}).AddRow(2, 1, "TEE-M-RED", 9))
+		mock.ExpectExec("DELETE FROM `product_variants` WHERE `product_variants`\\.`id` = \\?").
+			WithArgs(2).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		expectAggregate(13, 4)
+		mock.ExpectExec("INSERT INTO `inventory_ledger`").
+			WithArgs(1, 2, nil, -9, StockReasonAdjust, "variant TEE-M-RED", "anonymous", sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(3, 1))
+		mock.ExpectCommit()
+		redisMock.ExpectDel("products:1").SetVal(1)
+
+		require.NoError(t, handler.DeleteVariant(c))
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("删除不存在的变体", func(t *testing.T) {
+		c, _ := newContext(http.MethodDelete, echo.MIMEApplicationJSON, "", "1", "99")
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT \\* FROM `product_variants` WHERE product_id = \\?").
+			WithArgs(1, 99, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		mock.ExpectRollback()
+
+		err := handler.DeleteVariant(c)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusNotFound, err.(*echo.HTTPError).Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("按变体预留库存", func(t *testing.T) {
+		c, rec := newContext(http.MethodPost, echo.MIMEApplicationJSON, `{"variant_id":2,"quantity":3}`, "1")
+
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE `product_variants` SET `stock`=stock - \\?,`updated_at`=\\? WHERE id = \\? AND product_id = \\? AND stock >= \\?").
+			WithArgs(3, sqlmock.AnyArg(), 2, 1, 3).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("UPDATE `products` SET `stock`=stock - \\?,`updated_at`=\\? WHERE id = \\? AND deleted_at IS NULL").
+			WithArgs(3, sqlmock.AnyArg(), 1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO `stock_reservations`").WillReturnResult(sqlmock.NewResult(11, 1))
+		mock.ExpectExec("INSERT INTO `inventory_ledger`").
+			WithArgs(1, 2, 11, -3, "reserve", "", "anonymous", sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		redisMock.ExpectDel("products:1").SetVal(1)
+
+		require.NoError(t, handler.ReserveStock(c))
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"variant_id":2`)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("有变体的产品必须指定变体", func(t *testing.T) {
+		c, _ := newContext(http.MethodPost, echo.MIMEApplicationJSON, `{"quantity":1}`, "1")
+
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE `products` SET `stock`=stock - \\?").
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		expectProductExists()
+		mock.ExpectQuery("SELECT count\\(\\*\\) FROM `product_variants` WHERE product_id = \\?").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+		mock.ExpectRollback()
+
+		err := handler.ReserveStock(c)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,846 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/songfei1983/play-go-api/internal/events"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"gorm.io/gorm"
+)
+
+// webhook 投递状态
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// webhook 请求头，签名为 HMAC-SHA256(secret, "<timestamp>.<body>") 的十六进制，
+// 接收方应同时校验时间戳，拒绝过旧的请求以防重放
+const (
+	HeaderWebhookID        = "X-Webhook-ID"
+	HeaderWebhookEvent     = "X-Webhook-Event"
+	HeaderWebhookTimestamp = "X-Webhook-Timestamp"
+	HeaderWebhookSignature = "X-Webhook-Signature"
+)
+
+const (
+	webhookTimeout       = 10 * time.Second
+	webhookBatch         = 50
+	webhookResponseLimit = 1024
+	webhookSecretBytes   = 32
+	webhookMinSecret     = 16
+	webhookRetryBase     = 30 * time.Second
+	webhookRetryMax      = 6 * time.Hour
+)
+
+var webhookEventPattern = regexp.MustCompile(`^(\*|[A-Z][A-Za-z]*)$`)
+
+// WebhookPolicy 重试与自动停用策略：单次投递最多尝试 MaxAttempts 次，
+// 订阅连续失败 DisableAfter 次后自动停用
+type WebhookPolicy struct {
+	MaxAttempts  int
+	DisableAfter int
+}
+
+// EventTypes 订阅的事件类型列表，"*" 表示全部事件
+type EventTypes []string
+
+// Scan 实现 sql.Scanner 接口
+func (t *EventTypes) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*t = nil
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into EventTypes", value)
+	}
+	return json.Unmarshal(data, t)
+}
+
+// Value 实现 driver.Valuer 接口
+func (t EventTypes) Value() (driver.Value, error) {
+	if t == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal(t)
+	return string(data), err
+}
+
+// GormDataType 数据库列类型
+func (EventTypes) GormDataType() string {
+	return "json"
+}
+
+// matches 判断事件类型是否在订阅范围内
+func (t EventTypes) matches(eventType string) bool {
+	for _, name := range t {
+		if name == "*" || name == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookSubscription webhook 订阅，属于创建它的用户；Secret 只在创建时返回
+type WebhookSubscription struct {
+	ID                  uint       `json:"id" gorm:"primaryKey"`
+	UserID              uint       `json:"user_id" gorm:"not null;index"`
+	URL                 string     `json:"url" gorm:"column:url;size:2048;not null"`
+	EventTypes          EventTypes `json:"event_types"`
+	Secret              string     `json:"-" gorm:"size:128;not null"`
+	Active              bool       `json:"active" gorm:"not null;default:true"`
+	ConsecutiveFailures int        `json:"consecutive_failures" gorm:"not null;default:0"`
+	DisabledAt          *time.Time `json:"disabled_at,omitempty"`
+	DisabledReason      string     `json:"disabled_reason,omitempty"`
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (WebhookSubscription) TableName() string {
+	return "webhook_subscriptions"
+}
+
+// WebhookDelivery 一次事件投递及其最近一次尝试的结果，手动重投会新建一条并指向原投递。
+// 响应体只保存在数据库中供排查，不返回给订阅方，避免把投递地址的响应内容回显出去
+type WebhookDelivery struct {
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	SubscriptionID uint       `json:"subscription_id" gorm:"not null;index"`
+	EventID        string     `json:"event_id" gorm:"size:64;not null;index"`
+	EventType      string     `json:"event_type" gorm:"size:128;not null"`
+	Payload        JSONValue  `json:"payload" gorm:"type:longtext"`
+	Status         string     `json:"status" gorm:"size:16;not null;default:pending"`
+	Attempts       int        `json:"attempts" gorm:"not null;default:0"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at,omitempty"`
+	LastAttemptAt  *time.Time `json:"last_attempt_at,omitempty"`
+	ResponseStatus int        `json:"response_status,omitempty"`
+	ResponseBody   string     `json:"-"`
+	LastError      string     `json:"last_error,omitempty"`
+	RedeliveryOf   *uint      `json:"redelivery_of,omitempty"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (WebhookDelivery) TableName() string {
+	return "webhook_deliveries"
+}
+
+// webhookBody 发送给订阅方的请求体
+type webhookBody struct {
+	ID            string            `json:"id"`
+	Type          string            `json:"type"`
+	AggregateType string            `json:"aggregate_type"`
+	AggregateID   string            `json:"aggregate_id"`
+	OccurredAt    time.Time         `json:"occurred_at"`
+	Data          json.RawMessage   `json:"data"`
+	Metadata      map[string]string `json:"metadata,omitempty"`
+}
+
+// SignWebhook 计算 webhook 签名，接收方用同样的方式校验
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookAddressAllowed 判断投递地址是否可以连接，拒绝本机、内网与链路本地地址
+func webhookAddressAllowed(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified())
+}
+
+// webhookHostAllowed 注册时检查 URL 中的主机，域名在投递时解析后再检查
+func webhookHostAllowed(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return false
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return webhookAddressAllowed(ip)
+	}
+	return true
+}
+
+// webhookDialControl 在解析出的地址上检查，域名解析到内网地址（包括 DNS 重绑定）时拒绝连接
+func webhookDialControl(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !webhookAddressAllowed(ip) {
+		return fmt.Errorf("webhook address %s is not allowed", host)
+	}
+	return nil
+}
+
+// webhookClient 创建投递用的 HTTP 客户端：不跟随重定向，不经过环境变量中的代理，
+// control 在每次拨号时检查目标地址
+func webhookClient(control func(network, address string, c syscall.RawConn) error) *http.Client {
+	dialer := &net.Dialer{Timeout: webhookTimeout, Control: control}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   webhookTimeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// WebhookDispatcher 作为 events.Broker 由 outbox Relay 调用，为匹配的订阅生成投递记录，
+// 并在后台按退避策略发送
+type WebhookDispatcher struct {
+	db     *gorm.DB
+	client *http.Client
+	policy WebhookPolicy
+	admins Admins
+}
+
+// NewWebhookDispatcher 创建 webhook 投递器，admins 的订阅可以收到所有用户的变更，
+// 其他用户只能收到自己的用户变更
+func NewWebhookDispatcher(db *gorm.DB, policy WebhookPolicy, admins Admins) *WebhookDispatcher {
+	return &WebhookDispatcher{db: db, client: webhookClient(webhookDialControl), policy: policy, admins: admins}
+}
+
+// Publish 实现 events.Broker 接口。Relay 可能重复发布同一事件，已为该事件生成过投递的订阅会被跳过
+func (d *WebhookDispatcher) Publish(ctx context.Context, event events.Event) error {
+	var subs []WebhookSubscription
+	if err := d.db.WithContext(ctx).Where("active = ?", true).Find(&subs).Error; err != nil {
+		return err
+	}
+	var matched []WebhookSubscription
+	for _, sub := range subs {
+		if sub.EventTypes.matches(event.Type) {
+			matched = append(matched, sub)
+		}
+	}
+	matched, err := d.visible(ctx, event, matched)
+	if err != nil {
+		return err
+	}
+	if len(matched) == 0 {
+		return nil
+	}
+
+	var existing []uint
+	if err := d.db.WithContext(ctx).Model(&WebhookDelivery{}).
+		Where("event_id = ? AND redelivery_of IS NULL", event.ID).
+		Pluck("subscription_id", &existing).Error; err != nil {
+		return err
+	}
+	seen := make(map[uint]bool, len(existing))
+	for _, id := range existing {
+		seen[id] = true
+	}
+
+	body, err := json.Marshal(webhookBody{
+		ID:            event.ID,
+		Type:          event.Type,
+		AggregateType: event.AggregateType,
+		AggregateID:   event.AggregateID,
+		OccurredAt:    event.OccurredAt,
+		Data:          event.Payload,
+		Metadata:      event.Metadata,
+	})
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	var deliveries []WebhookDelivery
+	for _, sub := range matched {
+		if seen[sub.ID] {
+			continue
+		}
+		deliveries = append(deliveries, WebhookDelivery{
+			SubscriptionID: sub.ID,
+			EventID:        event.ID,
+			EventType:      event.Type,
+			Payload:        JSONValue(body),
+			Status:         DeliveryPending,
+			NextAttemptAt:  &now,
+		})
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+	return d.db.WithContext(ctx).Create(&deliveries).Error
+}
+
+// visible 过滤订阅方无权查看的事件：用户的变更只投递给本人与管理员的订阅，与变更推送一致
+func (d *WebhookDispatcher) visible(ctx context.Context, event events.Event, subs []WebhookSubscription) ([]WebhookSubscription, error) {
+	if event.AggregateType != "User" {
+		return subs, nil
+	}
+	var candidates []uint
+	for _, sub := range subs {
+		if strconv.FormatUint(uint64(sub.UserID), 10) != event.AggregateID && d.admins.Has(sub.UserID) {
+			candidates = append(candidates, sub.UserID)
+		}
+	}
+	// 已删除的管理员账户不再接收他人的变更
+	admin := make(map[uint]bool)
+	if len(candidates) > 0 {
+		var active []uint
+		if err := d.db.WithContext(ctx).Model(&User{}).
+			Where("id IN ? AND deleted_at IS NULL", candidates).Pluck("id", &active).Error; err != nil {
+			return nil, err
+		}
+		for _, id := range active {
+			admin[id] = true
+		}
+	}
+
+	var allowed []WebhookSubscription
+	for _, sub := range subs {
+		if strconv.FormatUint(uint64(sub.UserID), 10) == event.AggregateID || admin[sub.UserID] {
+			allowed = append(allowed, sub)
+		}
+	}
+	return allowed, nil
+}
+
+// Run 定期发送到期的投递，积压时连续处理，直到 ctx 取消
+func (d *WebhookDispatcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for ctx.Err() == nil {
+				n, err := d.DeliverDue(ctx)
+				if err != nil {
+					if ctx.Err() == nil {
+						fmt.Printf("Error delivering webhooks: %v\n", err)
+					}
+					break
+				}
+				if n < webhookBatch {
+					break
+				}
+			}
+		}
+	}
+}
+
+// DeliverDue 发送一批到期的投递，返回本批读取的数量。已停用订阅的投递保持待发送，重新启用后继续
+func (d *WebhookDispatcher) DeliverDue(ctx context.Context) (int, error) {
+	now := time.Now()
+	var due []WebhookDelivery
+	if err := d.db.WithContext(ctx).
+		Where("status = ? AND next_attempt_at <= ?", DeliveryPending, now).
+		Where("subscription_id IN (SELECT id FROM webhook_subscriptions WHERE active = ?)", true).
+		Order("next_attempt_at, id").Limit(webhookBatch).Find(&due).Error; err != nil {
+		return 0, err
+	}
+
+	subs := make(map[uint]*WebhookSubscription)
+	var errs []error
+	for i := range due {
+		delivery := &due[i]
+		claimed, err := d.claim(ctx, delivery)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+		sub, ok := subs[delivery.SubscriptionID]
+		if !ok {
+			sub = &WebhookSubscription{}
+			if err := d.db.WithContext(ctx).First(sub, delivery.SubscriptionID).Error; err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			subs[delivery.SubscriptionID] = sub
+		}
+		if !sub.Active {
+			continue
+		}
+		if err := d.attempt(ctx, sub, delivery); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return len(due), errors.Join(errs...)
+}
+
+// claim 把下次尝试时间推到请求超时之后，多个实例同时运行时只有一个能领取同一投递
+func (d *WebhookDispatcher) claim(ctx context.Context, delivery *WebhookDelivery) (bool, error) {
+	lease := time.Now().Add(2 * webhookTimeout)
+	result := d.db.WithContext(ctx).Model(&WebhookDelivery{}).
+		Where("id = ? AND status = ? AND next_attempt_at = ?", delivery.ID, DeliveryPending, delivery.NextAttemptAt).
+		Update("next_attempt_at", lease)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// attempt 发送一次并记录结果：成功后清零订阅的连续失败次数；失败时按指数退避安排重试，
+// 达到最大次数后标记为失败，订阅连续失败达到阈值后自动停用
+func (d *WebhookDispatcher) attempt(ctx context.Context, sub *WebhookSubscription, delivery *WebhookDelivery) error {
+	status, body, sendErr := d.send(ctx, sub, delivery)
+
+	now := time.Now()
+	delivery.Attempts++
+	delivery.LastAttemptAt = &now
+	delivery.ResponseStatus = status
+	delivery.ResponseBody = body
+	delivery.LastError = ""
+	if sendErr != nil {
+		delivery.LastError = sendErr.Error()
+	}
+	updates := map[string]interface{}{
+		"attempts":        delivery.Attempts,
+		"last_attempt_at": now,
+		"response_status": status,
+		"response_body":   body,
+		"last_error":      delivery.LastError,
+	}
+	switch {
+	case sendErr == nil:
+		delivery.Status = DeliverySucceeded
+		delivery.DeliveredAt = &now
+		delivery.NextAttemptAt = nil
+		updates["delivered_at"] = now
+	case delivery.Attempts >= d.policy.MaxAttempts:
+		delivery.Status = DeliveryFailed
+		delivery.NextAttemptAt = nil
+	default:
+		next := now.Add(webhookBackoff(delivery.Attempts))
+		delivery.NextAttemptAt = &next
+	}
+	updates["status"] = delivery.Status
+	updates["next_attempt_at"] = delivery.NextAttemptAt
+
+	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(delivery).Updates(updates).Error; err != nil {
+			return err
+		}
+		if sendErr == nil {
+			if sub.ConsecutiveFailures == 0 {
+				return nil
+			}
+			sub.ConsecutiveFailures = 0
+			return tx.Model(sub).Update("consecutive_failures", 0).Error
+		}
+
+		sub.ConsecutiveFailures++
+		subUpdates := map[string]interface{}{"consecutive_failures": gorm.Expr("consecutive_failures + 1")}
+		if d.policy.DisableAfter > 0 && sub.ConsecutiveFailures >= d.policy.DisableAfter {
+			reason := fmt.Sprintf("disabled after %d consecutive failed deliveries", sub.ConsecutiveFailures)
+			sub.Active = false
+			sub.DisabledAt = &now
+			sub.DisabledReason = reason
+			subUpdates["active"] = false
+			subUpdates["disabled_at"] = now
+			subUpdates["disabled_reason"] = reason
+		}
+		return tx.Model(sub).Updates(subUpdates).Error
+	})
+}
+
+// send 发送签名后的请求，返回响应状态码与截断后的响应体，非 2xx 响应视为失败
+func (d *WebhookDispatcher) send(ctx context.Context, sub *WebhookSubscription, delivery *WebhookDelivery) (int, string, error) {
+	timestamp := time.Now().Unix()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderWebhookID, strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set(HeaderWebhookEvent, delivery.EventType)
+	req.Header.Set(HeaderWebhookTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderWebhookSignature, SignWebhook(sub.Secret, timestamp, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close() // nolint: errcheck
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, webhookResponseLimit))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, string(body), fmt.Errorf("endpoint responded %s", resp.Status)
+	}
+	return resp.StatusCode, string(body), nil
+}
+
+// webhookBackoff 第 n 次失败后的等待时间：30s、1m、2m…，最长 6 小时
+func webhookBackoff(attempts int) time.Duration {
+	delay := webhookRetryBase
+	for i := 1; i < attempts && delay < webhookRetryMax; i++ {
+		delay *= 2
+	}
+	if delay > webhookRetryMax {
+		delay = webhookRetryMax
+	}
+	return delay
+}
+
+// Redeliver 以原投递的内容新建一条待发送的投递
+func (d *WebhookDispatcher) Redeliver(ctx context.Context, original *WebhookDelivery) (*WebhookDelivery, error) {
+	now := time.Now()
+	delivery := &WebhookDelivery{
+		SubscriptionID: original.SubscriptionID,
+		EventID:        original.EventID,
+		EventType:      original.EventType,
+		Payload:        original.Payload,
+		Status:         DeliveryPending,
+		NextAttemptAt:  &now,
+		RedeliveryOf:   &original.ID,
+	}
+	if err := d.db.WithContext(ctx).Create(delivery).Error; err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+// WebhookHandler webhook 订阅与投递记录处理器，用户只能管理自己的订阅
+type WebhookHandler struct {
+	db         *gorm.DB
+	dispatcher *WebhookDispatcher
+}
+
+// NewWebhookHandler 创建 webhook 处理器
+func NewWebhookHandler(db *gorm.DB, dispatcher *WebhookDispatcher) *WebhookHandler {
+	return &WebhookHandler{db: db, dispatcher: dispatcher}
+}
+
+type webhookRequest struct {
+	URL        *string   `json:"url"`
+	EventTypes *[]string `json:"event_types"`
+	Secret     *string   `json:"secret"`
+	Active     *bool     `json:"active"`
+}
+
+// webhookCreated 创建订阅的响应，附带签名密钥
+type webhookCreated struct {
+	WebhookSubscription
+	Secret string `json:"secret"`
+}
+
+// validate 校验请求中出现的字段，create 为 true 时 url 与 event_types 必填
+func (r *webhookRequest) validate(create bool) error {
+	if r.URL != nil || create {
+		if r.URL == nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "url is required")
+		}
+		u, err := url.Parse(*r.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "url must be an absolute http or https URL")
+		}
+		if !webhookHostAllowed(u.Hostname()) {
+			return echo.NewHTTPError(http.StatusBadRequest, "url must not point to a loopback, private or link-local address")
+		}
+	}
+	if r.EventTypes != nil || create {
+		if r.EventTypes == nil || len(*r.EventTypes) == 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "event_types must list at least one event type")
+		}
+		for _, name := range *r.EventTypes {
+			if !webhookEventPattern.MatchString(name) {
+				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid event type %q", name))
+			}
+		}
+	}
+	if r.Secret != nil && len(*r.Secret) < webhookMinSecret {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("secret must be at least %d characters", webhookMinSecret))
+	}
+	return nil
+}
+
+// CreateWebhook 创建订阅，未提供 secret 时随机生成；secret 只在此时返回
+func (h *WebhookHandler) CreateWebhook(c echo.Context) error {
+	ctx := c.Request().Context()
+	tracer := otel.Tracer("api-service")
+	ctx, span := tracer.Start(ctx, "WebhookHandler.CreateWebhook")
+	span.SetAttributes(attribute.String("Request-ID", c.Response().Header().Get("X-Request-ID")))
+	defer span.End()
+
+	userID, err := currentUserID(c)
+	if err != nil {
+		return err
+	}
+	var req webhookRequest
+	if err := c.Bind(&req); err != nil {
+		span.RecordError(err)
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	if err := req.validate(true); err != nil {
+		return err
+	}
+
+	sub := WebhookSubscription{
+		UserID:     userID,
+		URL:        *req.URL,
+		EventTypes: EventTypes(*req.EventTypes),
+		Active:     true,
+	}
+	if req.Active != nil {
+		sub.Active = *req.Active
+	}
+	if req.Secret != nil {
+		sub.Secret = *req.Secret
+	} else {
+		key := make([]byte, webhookSecretBytes)
+		if _, err := rand.Read(key); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		sub.Secret = hex.EncodeToString(key)
+	}
+	if err := h.db.WithContext(ctx).Create(&sub).Error; err != nil {
+		span.RecordError(err)
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusCreated, webhookCreated{WebhookSubscription: sub, Secret: sub.Secret})
+}
+
+// ListWebhooks 获取当前用户的订阅
+func (h *WebhookHandler) ListWebhooks(c echo.Context) error {
+	ctx := c.Request().Context()
+	tracer := otel.Tracer("api-service")
+	ctx, span := tracer.Start(ctx, "WebhookHandler.ListWebhooks")
+	span.SetAttributes(attribute.String("Request-ID", c.Response().Header().Get("X-Request-ID")))
+	defer span.End()
+
+	userID, err := currentUserID(c)
+	if err != nil {
+		return err
+	}
+	subs := []WebhookSubscription{}
+	if err := h.db.WithContext(ctx).Where("user_id = ?", userID).Order("id").Find(&subs).Error; err != nil {
+		span.RecordError(err)
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, subs)
+}
+
+// GetWebhook 获取单个订阅
+func (h *WebhookHandler) GetWebhook(c echo.Context) error {
+	ctx := c.Request().Context()
+	tracer := otel.Tracer("api-service")
+	ctx, span := tracer.Start(ctx, "WebhookHandler.GetWebhook")
+	span.SetAttributes(attribute.String("Request-ID", c.Response().Header().Get("X-Request-ID")))
+	defer span.End()
+
+	sub, err := h.loadSubscription(h.db.WithContext(ctx), c)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, sub)
+}
+
+// UpdateWebhook 修改订阅的地址、事件类型或密钥；重新启用时清零连续失败次数
+func (h *WebhookHandler) UpdateWebhook(c echo.Context) error {
+	ctx := c.Request().Context()
+	tracer := otel.Tracer("api-service")
+	ctx, span := tracer.Start(ctx, "WebhookHandler.UpdateWebhook")
+	span.SetAttributes(attribute.String("Request-ID", c.Response().Header().Get("X-Request-ID")))
+	defer span.End()
+
+	var req webhookRequest
+	if err := c.Bind(&req); err != nil {
+		span.RecordError(err)
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	if err := req.validate(false); err != nil {
+		return err
+	}
+
+	var sub *WebhookSubscription
+	err := h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		if sub, err = h.loadSubscription(tx, c); err != nil {
+			return err
+		}
+		updates := map[string]interface{}{}
+		if req.URL != nil {
+			sub.URL = *req.URL
+			updates["url"] = sub.URL
+		}
+		if req.EventTypes != nil {
+			sub.EventTypes = EventTypes(*req.EventTypes)
+			updates["event_types"] = sub.EventTypes
+		}
+		if req.Secret != nil {
+			sub.Secret = *req.Secret
+			updates["secret"] = sub.Secret
+		}
+		if req.Active != nil && *req.Active != sub.Active {
+			sub.Active = *req.Active
+			updates["active"] = sub.Active
+			if sub.Active {
+				sub.ConsecutiveFailures = 0
+				sub.DisabledAt = nil
+				sub.DisabledReason = ""
+				updates["consecutive_failures"] = 0
+				updates["disabled_at"] = nil
+				updates["disabled_reason"] = ""
+			}
+		}
+		if len(updates) == 0 {
+			return nil
+		}
+		return tx.Model(sub).Updates(updates).Error
+	})
+	if err != nil {
+		span.RecordError(err)
+		return httpError(err)
+	}
+	return c.JSON(http.StatusOK, sub)
+}
+
+// DeleteWebhook 删除订阅及其投递记录
+func (h *WebhookHandler) DeleteWebhook(c echo.Context) error {
+	ctx := c.Request().Context()
+	tracer := otel.Tracer("api-service")
+	ctx, span := tracer.Start(ctx, "WebhookHandler.DeleteWebhook")
+	span.SetAttributes(attribute.String("Request-ID", c.Response().Header().Get("X-Request-ID")))
+	defer span.End()
+
+	err := h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		sub, err := h.loadSubscription(tx, c)
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("subscription_id = ?", sub.ID).Delete(&WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(sub).Error
+	})
+	if err != nil {
+		span.RecordError(err)
+		return httpError(err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// ListDeliveries 获取订阅的投递记录，最新的在前，可按 status 过滤并用 before 翻页
+func (h *WebhookHandler) ListDeliveries(c echo.Context) error {
+	ctx := c.Request().Context()
+	tracer := otel.Tracer("api-service")
+	ctx, span := tracer.Start(ctx, "WebhookHandler.ListDeliveries")
+	span.SetAttributes(attribute.String("Request-ID", c.Response().Header().Get("X-Request-ID")))
+	defer span.End()
+
+	sub, err := h.loadSubscription(h.db.WithContext(ctx), c)
+	if err != nil {
+		return err
+	}
+	query := h.db.WithContext(ctx).Where("subscription_id = ?", sub.ID)
+	if status := c.QueryParam("status"); status != "" {
+		switch status {
+		case DeliveryPending, DeliverySucceeded, DeliveryFailed:
+			query = query.Where("status = ?", status)
+		default:
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unknown delivery status %q", status))
+		}
+	}
+	if v := c.QueryParam("before"); v != "" {
+		before, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "before must be a delivery id")
+		}
+		query = query.Where("id < ?", before)
+	}
+	limit := defaultHistoryLimit
+	if v := c.QueryParam("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 || limit > maxHistoryLimit {
+			return echo.NewHTTPError(http.StatusBadRequest, "limit must be between 1 and 500")
+		}
+	}
+
+	deliveries := []WebhookDelivery{}
+	if err := query.Order("id DESC").Limit(limit).Find(&deliveries).Error; err != nil {
+		span.RecordError(err)
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, deliveries)
+}
+
+// RedeliverWebhook 手动重投一条投递，新投递会在下一轮发送
+func (h *WebhookHandler) RedeliverWebhook(c echo.Context) error {
+	ctx := c.Request().Context()
+	tracer := otel.Tracer("api-service")
+	ctx, span := tracer.Start(ctx, "WebhookHandler.RedeliverWebhook")
+	span.SetAttributes(attribute.String("Request-ID", c.Response().Header().Get("X-Request-ID")))
+	defer span.End()
+
+	sub, err := h.loadSubscription(h.db.WithContext(ctx), c)
+	if err != nil {
+		return err
+	}
+	deliveryID, err := strconv.ParseUint(c.Param("delivery_id"), 10, 64)
+	if err != nil || deliveryID == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid delivery ID")
+	}
+	var original WebhookDelivery
+	err = h.db.WithContext(ctx).Where("subscription_id = ?", sub.ID).First(&original, deliveryID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, "Delivery not found")
+	}
+	if err != nil {
+		span.RecordError(err)
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	delivery, err := h.dispatcher.Redeliver(ctx, &original)
+	if err != nil {
+		span.RecordError(err)
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusAccepted, delivery)
+}
+
+// loadSubscription 读取路径中的订阅，不属于当前用户时返回 404
+func (h *WebhookHandler) loadSubscription(db *gorm.DB, c echo.Context) (*WebhookSubscription, error) {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return nil, err
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "Invalid webhook ID")
+	}
+	var sub WebhookSubscription
+	err = db.Where("user_id = ?", userID).First(&sub, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "Webhook not found")
+	}
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return &sub, nil
+}
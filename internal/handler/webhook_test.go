@@ -0,0 +1,267 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/songfei1983/play-go-api/internal/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhooks(t *testing.T) {
+	e, products, mock, _ := setupProductTest(t)
+	dispatcher := NewWebhookDispatcher(products.db, WebhookPolicy{MaxAttempts: 3, DisableAfter: 2}, NewAdmins([]uint{5}))
+	// 测试服务器监听在本机，投递测试不检查目标地址
+	dispatcher.client = webhookClient(nil)
+	handler := NewWebhookHandler(products.db, dispatcher)
+	ctx := context.Background()
+
+	subColumns := []string{"id", "user_id", "url", "event_types", "secret", "active", "consecutive_failures"}
+	deliveryColumns := []string{"id", "subscription_id", "event_id", "event_type", "payload", "status", "attempts", "next_attempt_at"}
+	due := time.Now().Add(-time.Second)
+
+	// expectDue 返回一条到期投递并领取成功，随后读取其订阅
+	expectDue := func(attempts int, subscription *sqlmock.Rows) {
+		mock.ExpectQuery("SELECT \\* FROM `webhook_deliveries` WHERE \\(status = \\? AND next_attempt_at <= \\?\\) AND subscription_id IN \\(SELECT id FROM webhook_subscriptions WHERE active = \\?\\) ORDER BY next_attempt_at, id LIMIT \\?").
+			WithArgs(DeliveryPending, sqlmock.AnyArg(), true, webhookBatch).
+			WillReturnRows(sqlmock.NewRows(deliveryColumns).AddRow(9, 1, "7", "ProductCreated", `{"id":"7"}`, DeliveryPending, attempts, due))
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE `webhook_deliveries` SET `next_attempt_at`=\\?,`updated_at`=\\? WHERE id = \\? AND status = \\? AND next_attempt_at = \\?").
+			WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), 9, DeliveryPending, due).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		mock.ExpectQuery("SELECT \\* FROM `webhook_subscriptions` WHERE `webhook_subscriptions`\\.`id` = \\?").
+			WithArgs(1, 1).
+			WillReturnRows(subscription)
+	}
+
+	newContext := func(method, body string, params ...string) (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(method, "/", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set("user", &jwt.Token{Claims: jwt.MapClaims{"user_id": float64(3), "username": "carol"}})
+		var names, values []string
+		for i := 0; i+1 < len(params); i += 2 {
+			names = append(names, params[i])
+			values = append(values, params[i+1])
+		}
+		c.SetParamNames(names...)
+		c.SetParamValues(values...)
+		return c, rec
+	}
+
+	t.Run("为匹配的订阅生成投递并跳过已生成的", func(t *testing.T) {
+		mock.ExpectQuery("SELECT \\* FROM `webhook_subscriptions` WHERE active = \\?").
+			WithArgs(true).
+			WillReturnRows(sqlmock.NewRows(subColumns).
+				AddRow(1, 3, "http://a.example", `["ProductCreated"]`, "s1", true, 0).
+				AddRow(2, 3, "http://b.example", `["*"]`, "s2", true, 0).
+				AddRow(3, 4, "http://c.example", `["UserDeleted"]`, "s3", true, 0))
+		mock.ExpectQuery("SELECT `subscription_id` FROM `webhook_deliveries` WHERE event_id = \\? AND redelivery_of IS NULL").
+			WithArgs("7").
+			WillReturnRows(sqlmock.NewRows([]string{"subscription_id"}).AddRow(2))
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO `webhook_deliveries` (.+) VALUES \\([^)]+\\)$").
+			WithArgs(1, "7", "ProductCreated", sqlmock.AnyArg(), DeliveryPending, 0, sqlmock.AnyArg(), nil, 0, "", "", nil, nil, sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		err := dispatcher.Publish(ctx, events.Event{ID: "7", Type: "ProductCreated", AggregateType: "Product", AggregateID: "1", Payload: []byte(`{"id":1}`)})
+		require.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("用户变更只投递给本人与管理员", func(t *testing.T) {
+		mock.ExpectQuery("SELECT \\* FROM `webhook_subscriptions` WHERE active = \\?").
+			WithArgs(true).
+			WillReturnRows(sqlmock.NewRows(subColumns).
+				AddRow(1, 3, "http://a.example", `["*"]`, "s1", true, 0).
+				AddRow(2, 4, "http://b.example", `["*"]`, "s2", true, 0).
+				AddRow(3, 5, "http://c.example", `["UserUpdated"]`, "s3", true, 0))
+		mock.ExpectQuery("SELECT `id` FROM `users` WHERE id IN \\(\\?\\) AND deleted_at IS NULL").
+			WithArgs(5).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+		mock.ExpectQuery("SELECT `subscription_id` FROM `webhook_deliveries` WHERE event_id = \\? AND redelivery_of IS NULL").
+			WithArgs("8").
+			WillReturnRows(sqlmock.NewRows([]string{"subscription_id"}))
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO `webhook_deliveries` (.+) VALUES \\([^)]+\\),\\([^)]+\\)$").
+			WithArgs(1, "8", "UserUpdated", sqlmock.AnyArg(), DeliveryPending, 0, sqlmock.AnyArg(), nil, 0, "", "", nil, nil, sqlmock.AnyArg(), sqlmock.AnyArg(),
+				3, "8", "UserUpdated", sqlmock.AnyArg(), DeliveryPending, 0, sqlmock.AnyArg(), nil, 0, "", "", nil, nil, sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 2))
+		mock.ExpectCommit()
+
+		err := dispatcher.Publish(ctx, events.Event{ID: "8", Type: "UserUpdated", AggregateType: "User", AggregateID: "3", Payload: []byte(`{"id":3}`)})
+		require.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("拒绝连接本机与内网地址且不跟随重定向", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "http://169.254.169.254/latest/meta-data/", http.StatusFound)
+		}))
+		defer server.Close()
+
+		sub := &WebhookSubscription{URL: server.URL, Secret: "topsecret"}
+		delivery := &WebhookDelivery{ID: 9, EventType: "ProductCreated", Payload: JSONValue(`{}`)}
+		_, _, err := NewWebhookDispatcher(products.db, WebhookPolicy{}, nil).send(ctx, sub, delivery)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "webhook address 127.0.0.1 is not allowed")
+
+		status, _, err := dispatcher.send(ctx, sub, delivery)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusFound, status)
+	})
+
+	t.Run("发送带签名的请求并记录成功", func(t *testing.T) {
+		var received *http.Request
+		var body []byte
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			received = r
+			body, _ = io.ReadAll(r.Body)
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+
+		expectDue(0, sqlmock.NewRows(subColumns).AddRow(1, 3, server.URL, `["*"]`, "topsecret", true, 1))
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE `webhook_deliveries` SET (.+)`status`=\\?").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("UPDATE `webhook_subscriptions` SET `consecutive_failures`=\\?,`updated_at`=\\? WHERE `id` = \\?").
+			WithArgs(0, sqlmock.AnyArg(), 1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		n, err := dispatcher.DeliverDue(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+		require.NotNil(t, received)
+		assert.Equal(t, `{"id":"7"}`, string(body))
+		assert.Equal(t, "9", received.Header.Get(HeaderWebhookID))
+		assert.Equal(t, "ProductCreated", received.Header.Get(HeaderWebhookEvent))
+		ts, err := strconv.ParseInt(received.Header.Get(HeaderWebhookTimestamp), 10, 64)
+		require.NoError(t, err)
+		assert.Equal(t, SignWebhook("topsecret", ts, body), received.Header.Get(HeaderWebhookSignature))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("失败后安排重试并在连续失败后停用订阅", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "boom", http.StatusBadGateway)
+		}))
+		defer server.Close()
+
+		expectDue(1, sqlmock.NewRows(subColumns).AddRow(1, 3, server.URL, `["*"]`, "topsecret", true, 1))
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE `webhook_deliveries` SET `attempts`=\\?,`last_attempt_at`=\\?,`last_error`=\\?,`next_attempt_at`=\\?,`response_body`=\\?,`response_status`=\\?,`status`=\\?,`updated_at`=\\? WHERE `id` = \\?").
+			WithArgs(2, sqlmock.AnyArg(), "endpoint responded 502 Bad Gateway", sqlmock.AnyArg(), "boom\n", http.StatusBadGateway, DeliveryPending, sqlmock.AnyArg(), 9).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("UPDATE `webhook_subscriptions` SET `active`=\\?,`consecutive_failures`=consecutive_failures \\+ 1,`disabled_at`=\\?,`disabled_reason`=\\?,`updated_at`=\\? WHERE `id` = \\?").
+			WithArgs(false, sqlmock.AnyArg(), "disabled after 2 consecutive failed deliveries", sqlmock.AnyArg(), 1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		n, err := dispatcher.DeliverDue(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("退避时间指数增长并有上限", func(t *testing.T) {
+		assert.Equal(t, 30*time.Second, webhookBackoff(1))
+		assert.Equal(t, 2*time.Minute, webhookBackoff(3))
+		assert.Equal(t, webhookRetryMax, webhookBackoff(20))
+	})
+
+	t.Run("创建订阅时校验并返回生成的密钥", func(t *testing.T) {
+		c, _ := newContext(http.MethodPost, `{"url":"ftp://example.com","event_types":["ProductCreated"]}`)
+		err := handler.CreateWebhook(c)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+
+		for _, target := range []string{"http://localhost:8080/hook", "http://127.0.0.1/hook", "http://10.0.0.5/hook", "http://[::1]/hook", "http://169.254.169.254/latest"} {
+			c, _ := newContext(http.MethodPost, `{"url":"`+target+`","event_types":["ProductCreated"]}`)
+			err := handler.CreateWebhook(c)
+			require.Error(t, err, target)
+			assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code, target)
+		}
+
+		c, rec := newContext(http.MethodPost, `{"url":"https://example.com/hook","event_types":["ProductCreated","ProductUpdated"]}`)
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO `webhook_subscriptions`").
+			WithArgs(3, "https://example.com/hook", `["ProductCreated","ProductUpdated"]`, sqlmock.AnyArg(), true, 0, nil, "", sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(5, 1))
+		mock.ExpectCommit()
+
+		require.NoError(t, handler.CreateWebhook(c))
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		var resp map[string]interface{}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		assert.Equal(t, float64(5), resp["id"])
+		assert.Len(t, resp["secret"], 2*webhookSecretBytes)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("重新启用订阅清零失败次数", func(t *testing.T) {
+		c, rec := newContext(http.MethodPatch, `{"active":true}`, "id", "1")
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT \\* FROM `webhook_subscriptions` WHERE user_id = \\? AND `webhook_subscriptions`\\.`id` = \\?").
+			WithArgs(3, 1, 1).
+			WillReturnRows(sqlmock.NewRows(append(subColumns, "disabled_reason")).AddRow(1, 3, "http://a.example", `["*"]`, "s1", false, 20, "too many failures"))
+		mock.ExpectExec("UPDATE `webhook_subscriptions` SET `active`=\\?,`consecutive_failures`=\\?,`disabled_at`=\\?,`disabled_reason`=\\?,`updated_at`=\\? WHERE `id` = \\?").
+			WithArgs(true, 0, nil, "", sqlmock.AnyArg(), 1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		require.NoError(t, handler.UpdateWebhook(c))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.NotContains(t, rec.Body.String(), "s1")
+		assert.Contains(t, rec.Body.String(), `"active":true`)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("手动重投新建投递", func(t *testing.T) {
+		c, rec := newContext(http.MethodPost, "", "id", "1", "delivery_id", "9")
+		mock.ExpectQuery("SELECT \\* FROM `webhook_subscriptions` WHERE user_id = \\? AND `webhook_subscriptions`\\.`id` = \\?").
+			WithArgs(3, 1, 1).
+			WillReturnRows(sqlmock.NewRows(subColumns).AddRow(1, 3, "http://a.example", `["*"]`, "s1", true, 0))
+		mock.ExpectQuery("SELECT \\* FROM `webhook_deliveries` WHERE subscription_id = \\? AND `webhook_deliveries`\\.`id` = \\?").
+			WithArgs(1, 9, 1).
+			WillReturnRows(sqlmock.NewRows(append(deliveryColumns, "last_error")).AddRow(9, 1, "7", "ProductCreated", `{"id":"7"}`, DeliveryFailed, 3, nil, "timeout"))
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO `webhook_deliveries`").
+			WithArgs(1, "7", "ProductCreated", `{"id":"7"}`, DeliveryPending, 0, sqlmock.AnyArg(), nil, 0, "", "", 9, nil, sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(10, 1))
+		mock.ExpectCommit()
+
+		require.NoError(t, handler.RedeliverWebhook(c))
+		assert.Equal(t, http.StatusAccepted, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"redelivery_of":9`)
+		assert.NotContains(t, rec.Body.String(), "response_body")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("其他用户的订阅返回404", func(t *testing.T) {
+		c, _ := newContext(http.MethodGet, "", "id", "8")
+		mock.ExpectQuery("SELECT \\* FROM `webhook_subscriptions` WHERE user_id = \\? AND `webhook_subscriptions`\\.`id` = \\?").
+			WithArgs(3, 8, 1).
+			WillReturnRows(sqlmock.NewRows(subColumns))
+
+		err := handler.GetWebhook(c)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusNotFound, err.(*echo.HTTPError).Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
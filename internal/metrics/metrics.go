@@ -32,4 +32,54 @@ var (
 			Help: "Current CPU usage of the application",
 		},
 	)
+
+	// WebSocketConnections tracks the number of open live inventory connections
+	WebSocketConnections = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "websocket_connections",
+			Help: "Current number of open live inventory WebSocket connections",
+		},
+	)
+
+	// WebSocketConnectionsTotal tracks accepted live inventory connections
+	WebSocketConnectionsTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "websocket_connections_total",
+			Help: "Total number of accepted live inventory WebSocket connections",
+		},
+	)
+
+	// WebSocketSubscriptions tracks product subscriptions across open connections
+	WebSocketSubscriptions = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "websocket_subscriptions",
+			Help: "Current number of product subscriptions across live inventory connections",
+		},
+	)
+
+	// WebSocketMessagesSent tracks messages written to live inventory connections
+	WebSocketMessagesSent = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "websocket_messages_sent_total",
+			Help: "Total number of messages sent to live inventory WebSocket connections",
+		},
+		[]string{"type"},
+	)
+
+	// WebSocketUpdatesCoalesced tracks updates replaced by a newer one before a slow client read them
+	WebSocketUpdatesCoalesced = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "websocket_updates_coalesced_total",
+			Help: "Total number of inventory updates superseded before being sent to a slow client",
+		},
+	)
+
+	// OpenAPIResponseViolations tracks responses that do not match the OpenAPI document
+	OpenAPIResponseViolations = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "openapi_response_violations_total",
+			Help: "Total number of responses that do not match the OpenAPI document",
+		},
+		[]string{"method", "path", "status"},
+	)
 )
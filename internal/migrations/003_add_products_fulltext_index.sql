@@ -0,0 +1,7 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied.
+CREATE FULLTEXT INDEX idx_products_fulltext ON products(name, description) WITH PARSER ngram;
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back.
+DROP INDEX idx_products_fulltext ON products;
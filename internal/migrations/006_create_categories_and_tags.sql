@@ -0,0 +1,64 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied.
+CREATE TABLE IF NOT EXISTS categories (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    slug VARCHAR(191),
+    description TEXT,
+    parent_id BIGINT UNSIGNED NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP NULL,
+    CONSTRAINT fk_categories_parent FOREIGN KEY (parent_id) REFERENCES categories(id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE UNIQUE INDEX idx_categories_slug ON categories(slug);
+CREATE INDEX idx_categories_parent_id ON categories(parent_id);
+CREATE INDEX idx_categories_deleted_at ON categories(deleted_at);
+
+-- 闭包表：每对祖先与后代一行，包含 depth 为 0 的自身行
+CREATE TABLE IF NOT EXISTS category_closure (
+    ancestor_id BIGINT UNSIGNED NOT NULL,
+    descendant_id BIGINT UNSIGNED NOT NULL,
+    depth INT NOT NULL,
+    PRIMARY KEY (ancestor_id, descendant_id),
+    CONSTRAINT fk_category_closure_ancestor FOREIGN KEY (ancestor_id) REFERENCES categories(id),
+    CONSTRAINT fk_category_closure_descendant FOREIGN KEY (descendant_id) REFERENCES categories(id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE INDEX idx_category_closure_descendant_id ON category_closure(descendant_id);
+
+CREATE TABLE IF NOT EXISTS tags (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(191) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE UNIQUE INDEX idx_tags_name ON tags(name);
+CREATE INDEX idx_tags_deleted_at ON tags(deleted_at);
+
+CREATE TABLE IF NOT EXISTS product_tags (
+    product_id BIGINT UNSIGNED NOT NULL,
+    tag_id BIGINT UNSIGNED NOT NULL,
+    PRIMARY KEY (product_id, tag_id),
+    CONSTRAINT fk_product_tags_product FOREIGN KEY (product_id) REFERENCES products(id),
+    CONSTRAINT fk_product_tags_tag FOREIGN KEY (tag_id) REFERENCES tags(id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE INDEX idx_product_tags_tag_id ON product_tags(tag_id);
+
+ALTER TABLE products ADD COLUMN category_id BIGINT UNSIGNED NULL AFTER status;
+ALTER TABLE products ADD CONSTRAINT fk_products_category FOREIGN KEY (category_id) REFERENCES categories(id);
+CREATE INDEX idx_products_category_id ON products(category_id);
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back.
+ALTER TABLE products DROP FOREIGN KEY fk_products_category;
+ALTER TABLE products DROP INDEX idx_products_category_id;
+ALTER TABLE products DROP COLUMN category_id;
+DROP TABLE IF EXISTS product_tags;
+DROP TABLE IF EXISTS tags;
+DROP TABLE IF EXISTS category_closure;
+DROP TABLE IF EXISTS categories;
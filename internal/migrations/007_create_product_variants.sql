@@ -0,0 +1,30 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied.
+CREATE TABLE IF NOT EXISTS product_variants (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    product_id BIGINT UNSIGNED NOT NULL,
+    sku VARCHAR(64) NOT NULL,
+    options JSON,
+    price DECIMAL(10,2) NULL,
+    stock INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    CONSTRAINT fk_product_variants_product FOREIGN KEY (product_id) REFERENCES products(id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE UNIQUE INDEX idx_product_variants_sku ON product_variants(sku);
+CREATE INDEX idx_product_variants_product_id ON product_variants(product_id);
+
+-- 预留与流水只记录变体 ID，不加外键，删除变体后历史记录仍然保留
+ALTER TABLE stock_reservations ADD COLUMN variant_id BIGINT UNSIGNED NULL AFTER product_id;
+CREATE INDEX idx_stock_reservations_variant_id ON stock_reservations(variant_id);
+ALTER TABLE inventory_ledger ADD COLUMN variant_id BIGINT UNSIGNED NULL AFTER product_id;
+CREATE INDEX idx_inventory_ledger_variant_id ON inventory_ledger(variant_id);
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back.
+ALTER TABLE inventory_ledger DROP INDEX idx_inventory_ledger_variant_id;
+ALTER TABLE inventory_ledger DROP COLUMN variant_id;
+ALTER TABLE stock_reservations DROP INDEX idx_stock_reservations_variant_id;
+ALTER TABLE stock_reservations DROP COLUMN variant_id;
+DROP TABLE IF EXISTS product_variants;
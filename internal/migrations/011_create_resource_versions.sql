@@ -0,0 +1,18 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied.
+CREATE TABLE IF NOT EXISTS resource_versions (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    resource_type VARCHAR(64) NOT NULL,
+    resource_id BIGINT UNSIGNED NOT NULL,
+    change_type VARCHAR(16) NOT NULL,
+    actor VARCHAR(255),
+    request_id VARCHAR(64),
+    diff JSON,
+    snapshot JSON,
+    created_at TIMESTAMP(6) DEFAULT CURRENT_TIMESTAMP(6),
+    KEY idx_resource_versions_resource (resource_type, resource_id, created_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back.
+DROP TABLE IF EXISTS resource_versions;
@@ -0,0 +1,12 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied.
+ALTER TABLE outbox_events ADD COLUMN dead_at TIMESTAMP(6) NULL AFTER published_at;
+
+DROP INDEX idx_outbox_events_published_at ON outbox_events;
+CREATE INDEX idx_outbox_events_pending ON outbox_events(published_at, dead_at, id);
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back.
+DROP INDEX idx_outbox_events_pending ON outbox_events;
+CREATE INDEX idx_outbox_events_published_at ON outbox_events(published_at, id);
+ALTER TABLE outbox_events DROP COLUMN dead_at;
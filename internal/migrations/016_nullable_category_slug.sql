@@ -0,0 +1,8 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied.
+-- 未设置 slug 的分类保存为 NULL，唯一索引不再把空字符串视为重复
+UPDATE categories SET slug = NULL WHERE slug = '';
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back.
+-- NULL 与空字符串含义相同，回滚时保持 NULL
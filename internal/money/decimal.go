@@ -0,0 +1,251 @@
+// Package money 提供定点金额类型与多币种汇率换算
+package money
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Scale 金额的小数位数，与数据库 DECIMAL(10,2) 一致
+const Scale = 2
+
+// Precision 金额的总位数，与数据库 DECIMAL(10,2) 一致
+const Precision = 10
+
+const unitsPerWhole = 100
+
+// maxUnits DECIMAL(Precision, Scale) 能存储的最大绝对值，以最小单位表示
+const maxUnits = 9999999999
+
+// Decimal 两位小数的定点金额，以最小单位整数存储，避免浮点误差。
+// JSON 中序列化为字符串，如 "99.99"
+type Decimal struct {
+	units int64
+}
+
+// Zero 零金额
+var Zero = Decimal{}
+
+// FromUnits 由最小单位（分）构造金额
+func FromUnits(units int64) Decimal {
+	return Decimal{units: units}
+}
+
+// Parse 解析十进制字符串，有效小数位超过 Scale 时返回错误而不是舍入
+func Parse(s string) (Decimal, error) {
+	str := strings.TrimSpace(s)
+	neg := false
+	if str != "" && (str[0] == '-' || str[0] == '+') {
+		neg = str[0] == '-'
+		str = str[1:]
+	}
+	whole, frac, _ := strings.Cut(str, ".")
+	frac = strings.TrimRight(frac, "0")
+	if whole == "" && frac == "" || !isDigits(whole) || !isDigits(frac) {
+		return Zero, fmt.Errorf("invalid decimal %q", s)
+	}
+	if len(frac) > Scale {
+		return Zero, fmt.Errorf("decimal %q has more than %d fractional digits", s, Scale)
+	}
+	frac += strings.Repeat("0", Scale-len(frac))
+	if whole == "" {
+		whole = "0"
+	}
+	units, err := strconv.ParseInt(whole+frac, 10, 64)
+	if err != nil {
+		return Zero, fmt.Errorf("decimal %q is out of range", s)
+	}
+	if neg {
+		units = -units
+	}
+	return Decimal{units: units}, nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// MustParse 解析十进制字符串，失败时 panic，仅用于常量与测试
+func MustParse(s string) Decimal {
+	d, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// fromRat 将有理数按四舍五入（远离零）转换为金额
+func fromRat(r *big.Rat) (Decimal, error) {
+	scaled := new(big.Rat).Mul(r, big.NewRat(unitsPerWhole, 1))
+	num, den := scaled.Num(), scaled.Denom()
+	q, m := new(big.Int).QuoRem(num, den, new(big.Int))
+	// |m| * 2 >= den 时进位
+	if m.Abs(m).Lsh(m, 1).Cmp(den) >= 0 {
+		if num.Sign() < 0 {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	if !q.IsInt64() {
+		return Zero, fmt.Errorf("amount is out of range")
+	}
+	return Decimal{units: q.Int64()}, nil
+}
+
+// Units 返回最小单位（分）数量
+func (d Decimal) Units() int64 {
+	return d.units
+}
+
+// Rat 返回精确的有理数值
+func (d Decimal) Rat() *big.Rat {
+	return big.NewRat(d.units, unitsPerWhole)
+}
+
+// Float64 返回近似浮点值，仅用于排序与统计等不要求精确的场景
+func (d Decimal) Float64() float64 {
+	return float64(d.units) / unitsPerWhole
+}
+
+// IsNegative 判断是否为负数
+func (d Decimal) IsNegative() bool {
+	return d.units < 0
+}
+
+// InRange 判断金额能否存入 DECIMAL(Precision, Scale) 列而不溢出
+func (d Decimal) InRange() bool {
+	return d.units >= -maxUnits && d.units <= maxUnits
+}
+
+// IsZero 判断是否为零
+func (d Decimal) IsZero() bool {
+	return d.units == 0
+}
+
+// Cmp 比较大小，返回 -1、0 或 1
+func (d Decimal) Cmp(o Decimal) int {
+	switch {
+	case d.units < o.units:
+		return -1
+	case d.units > o.units:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Add 加法
+func (d Decimal) Add(o Decimal) Decimal {
+	return Decimal{units: d.units + o.units}
+}
+
+// Mul 乘以整数数量
+func (d Decimal) Mul(n int64) Decimal {
+	return Decimal{units: d.units * n}
+}
+
+// String 返回固定两位小数的字符串
+func (d Decimal) String() string {
+	units := d.units
+	sign := ""
+	if units < 0 {
+		sign = "-"
+		if units == math.MinInt64 {
+			return d.Rat().FloatString(Scale)
+		}
+		units = -units
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, units/unitsPerWhole, units%unitsPerWhole)
+}
+
+// MarshalJSON 序列化为字符串以保证精度
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON 接受字符串或数字字面量，数字按原文解析而不经过浮点
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	s := string(data)
+	if len(data) > 0 && data[0] == '"' {
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+	}
+	v, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*d = v
+	return nil
+}
+
+// MarshalText 实现 encoding.TextMarshaler
+func (d Decimal) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalText 实现 encoding.TextUnmarshaler
+func (d *Decimal) UnmarshalText(text []byte) error {
+	v, err := Parse(string(text))
+	if err != nil {
+		return err
+	}
+	*d = v
+	return nil
+}
+
+// Scan 实现 sql.Scanner
+func (d *Decimal) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*d = Zero
+		return nil
+	case []byte:
+		return d.UnmarshalText(v)
+	case string:
+		return d.UnmarshalText([]byte(v))
+	case int64:
+		*d = Decimal{units: v * unitsPerWhole}
+		return nil
+	case float64:
+		// 驱动返回浮点时按最短表示解析，再舍入到两位小数
+		r, ok := new(big.Rat).SetString(strconv.FormatFloat(v, 'f', -1, 64))
+		if !ok {
+			return fmt.Errorf("cannot scan %v into Decimal", v)
+		}
+		parsed, err := fromRat(r)
+		if err != nil {
+			return err
+		}
+		*d = parsed
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into Decimal", value)
+	}
+}
+
+// Value 实现 driver.Valuer，以字符串写入避免精度损失
+func (d Decimal) Value() (driver.Value, error) {
+	return d.String(), nil
+}
+
+// GormDataType 指定数据库列类型
+func (Decimal) GormDataType() string {
+	return "decimal(10,2)"
+}
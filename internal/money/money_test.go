@@ -0,0 +1,103 @@
+package money
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	for in, want := range map[string]string{
+		"12":     "12.00",
+		"12.3":   "12.30",
+		"0.1":    "0.10",
+		".5":     "0.50",
+		"-1.05":  "-1.05",
+		"+3":     "3.00",
+		"1.2300": "1.23",
+	} {
+		d, err := Parse(in)
+		require.NoError(t, err, in)
+		assert.Equal(t, want, d.String(), in)
+	}
+
+	for _, in := range []string{"", "abc", "1.234", "1e3", "1/3", "1.2.3", "-", "99999999999999999999"} {
+		_, err := Parse(in)
+		assert.Error(t, err, in)
+	}
+}
+
+func TestDecimalInRange(t *testing.T) {
+	assert.True(t, MustParse("99999999.99").InRange())
+	assert.True(t, MustParse("-99999999.99").InRange())
+	assert.False(t, MustParse("100000000").InRange())
+	assert.False(t, MustParse("-100000000").InRange())
+}
+
+func TestDecimalJSON(t *testing.T) {
+	var v struct {
+		Price Decimal `json:"price"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(`{"price":0.1}`), &v))
+	assert.Equal(t, int64(10), v.Price.Units())
+
+	require.NoError(t, json.Unmarshal([]byte(`{"price":"19.99"}`), &v))
+	data, err := json.Marshal(v)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"price":"19.99"}`, string(data))
+
+	assert.Error(t, json.Unmarshal([]byte(`{"price":0.001}`), &v))
+}
+
+func TestDecimalScan(t *testing.T) {
+	var d Decimal
+	require.NoError(t, d.Scan([]byte("10.50")))
+	assert.Equal(t, "10.50", d.String())
+	require.NoError(t, d.Scan(99.99))
+	assert.Equal(t, "99.99", d.String())
+	require.NoError(t, d.Scan(int64(7)))
+	assert.Equal(t, "7.00", d.String())
+
+	v, err := MustParse("0.30").Value()
+	require.NoError(t, err)
+	assert.Equal(t, "0.30", v)
+
+	// 浮点累加会产生误差，定点运算不会
+	sum := Zero
+	for i := 0; i < 3; i++ {
+		sum = sum.Add(MustParse("0.10"))
+	}
+	assert.Equal(t, "0.30", sum.String())
+}
+
+func TestRates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rates.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"base":"USD","rates":{"EUR":"0.92","JPY":"151.5"}}`), 0o600))
+
+	rates, err := LoadRates(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"EUR", "JPY", "USD"}, rates.Currencies())
+
+	got, err := rates.Convert(MustParse("99.99"), "USD", "EUR")
+	require.NoError(t, err)
+	assert.Equal(t, "91.99", got.String()) // 91.9908
+
+	got, err = rates.Convert(MustParse("100.00"), "EUR", "JPY")
+	require.NoError(t, err)
+	assert.Equal(t, "16467.39", got.String()) // 16467.3913...
+
+	got, err = rates.Convert(MustParse("-0.05"), "USD", "EUR")
+	require.NoError(t, err)
+	assert.Equal(t, "-0.05", got.String()) // -0.046 远离零舍入
+
+	_, err = rates.Convert(MustParse("1"), "USD", "GBP")
+	assert.ErrorIs(t, err, ErrUnknownCurrency)
+
+	_, err = NewRates("USD", map[string]string{"eur": "-1"})
+	assert.Error(t, err)
+	assert.False(t, ValidCurrency("usd"))
+}
@@ -0,0 +1,124 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+)
+
+// DefaultCurrency 未指定币种时使用的货币
+const DefaultCurrency = "USD"
+
+// ErrUnknownCurrency 汇率表中没有该币种
+var ErrUnknownCurrency = errors.New("unknown currency")
+
+// Rates 汇率表，rates[c] 表示 1 单位基准货币可兑换的 c 货币数量
+type Rates struct {
+	base  string
+	rates map[string]*big.Rat
+}
+
+// ratesFile 汇率文件格式，汇率以字符串表示以保证精度：
+//
+//	{"base": "USD", "rates": {"EUR": "0.92", "CNY": "7.24"}}
+type ratesFile struct {
+	Base  string            `json:"base"`
+	Rates map[string]string `json:"rates"`
+}
+
+// NewRates 创建汇率表，基准货币的汇率固定为 1
+func NewRates(base string, rates map[string]string) (*Rates, error) {
+	base = strings.ToUpper(base)
+	if !ValidCurrency(base) {
+		return nil, fmt.Errorf("invalid base currency %q", base)
+	}
+	r := &Rates{base: base, rates: map[string]*big.Rat{base: big.NewRat(1, 1)}}
+	for code, value := range rates {
+		code = strings.ToUpper(code)
+		if !ValidCurrency(code) {
+			return nil, fmt.Errorf("invalid currency %q", code)
+		}
+		rate, ok := new(big.Rat).SetString(value)
+		if !ok || rate.Sign() <= 0 {
+			return nil, fmt.Errorf("invalid exchange rate %q for %s", value, code)
+		}
+		if code == base && rate.Cmp(big.NewRat(1, 1)) != 0 {
+			return nil, fmt.Errorf("exchange rate of base currency %s must be 1", base)
+		}
+		r.rates[code] = rate
+	}
+	return r, nil
+}
+
+// LoadRates 从本地 JSON 文件加载汇率表
+func LoadRates(path string) (*Rates, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file ratesFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse exchange rates %s: %w", path, err)
+	}
+	if file.Base == "" {
+		file.Base = DefaultCurrency
+	}
+	return NewRates(file.Base, file.Rates)
+}
+
+// Base 返回基准货币
+func (r *Rates) Base() string {
+	return r.base
+}
+
+// Currencies 返回支持的币种，按字母排序
+func (r *Rates) Currencies() []string {
+	codes := make([]string, 0, len(r.rates))
+	for code := range r.rates {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// Supports 判断是否支持该币种
+func (r *Rates) Supports(currency string) bool {
+	_, ok := r.rates[currency]
+	return ok
+}
+
+// Convert 将金额从 from 币种换算为 to 币种，结果四舍五入到两位小数
+func (r *Rates) Convert(amount Decimal, from, to string) (Decimal, error) {
+	if from == to {
+		return amount, nil
+	}
+	fromRate, ok := r.rates[from]
+	if !ok {
+		return Zero, fmt.Errorf("%w %q", ErrUnknownCurrency, from)
+	}
+	toRate, ok := r.rates[to]
+	if !ok {
+		return Zero, fmt.Errorf("%w %q", ErrUnknownCurrency, to)
+	}
+	v := amount.Rat()
+	v.Mul(v, toRate)
+	v.Quo(v, fromRate)
+	return fromRat(v)
+}
+
+// ValidCurrency 判断是否为 ISO 4217 格式的三位大写字母币种代码
+func ValidCurrency(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for i := 0; i < len(code); i++ {
+		if code[i] < 'A' || code[i] > 'Z' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,23 @@
+package notify
+
+import (
+	"context"
+	"io"
+	"log"
+)
+
+// LogNotifier 将通知写入日志，适合开发环境或作为兜底渠道
+type LogNotifier struct {
+	logger *log.Logger
+}
+
+// NewLogNotifier 创建写入 w 的日志渠道
+func NewLogNotifier(w io.Writer) *LogNotifier {
+	return &LogNotifier{logger: log.New(w, "notify: ", log.LstdFlags)}
+}
+
+// Notify 实现 Notifier 接口
+func (l *LogNotifier) Notify(_ context.Context, msg Message) error {
+	l.logger.Printf("%s: %s", msg.Subject, msg.Body)
+	return nil
+}
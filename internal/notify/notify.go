@@ -0,0 +1,33 @@
+// Package notify 提供告警通知的可插拔发送渠道
+package notify
+
+import (
+	"context"
+	"errors"
+)
+
+// Message 通知内容，Data 为结构化数据，由支持的渠道（如 webhook）原样发送
+type Message struct {
+	Subject string      `json:"subject"`
+	Body    string      `json:"body"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// Notifier 通知渠道
+type Notifier interface {
+	Notify(ctx context.Context, msg Message) error
+}
+
+// Multi 依次通过多个渠道发送，单个渠道失败不影响其他渠道，返回合并后的错误
+type Multi []Notifier
+
+// Notify 实现 Notifier 接口
+func (m Multi) Notify(ctx context.Context, msg Message) error {
+	var errs []error
+	for _, n := range m {
+		if err := n.Notify(ctx, msg); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,121 @@
+package notify
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type failing struct{}
+
+func (failing) Notify(context.Context, Message) error { return errors.New("boom") }
+
+func TestNotifiers(t *testing.T) {
+	ctx := context.Background()
+	msg := Message{Subject: "库存预警: Mug", Body: "stock 2 <= threshold 5", Data: map[string]int{"product_id": 1}}
+
+	t.Run("日志", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, NewLogNotifier(&buf).Notify(ctx, msg))
+		assert.Contains(t, buf.String(), "库存预警: Mug: stock 2 <= threshold 5")
+	})
+
+	t.Run("webhook", func(t *testing.T) {
+		var got Message
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer srv.Close()
+
+		require.NoError(t, NewWebhookNotifier(srv.URL).Notify(ctx, msg))
+		assert.Equal(t, msg.Subject, got.Subject)
+		assert.Equal(t, map[string]interface{}{"product_id": float64(1)}, got.Data)
+	})
+
+	t.Run("webhook 失败", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer srv.Close()
+
+		assert.Error(t, NewWebhookNotifier(srv.URL).Notify(ctx, msg))
+	})
+
+	t.Run("SMTP", func(t *testing.T) {
+		addr, received := fakeSMTP(t)
+		n := NewSMTPNotifier(addr, "api@example.com", []string{"ops@example.com"})
+		require.NoError(t, n.Notify(ctx, msg))
+
+		data := <-received
+		assert.Contains(t, data, "To: ops@example.com\r\n")
+		assert.Contains(t, data, "Subject: =?utf-8?q?")
+		assert.Contains(t, data, "stock 2 <= threshold 5")
+	})
+
+	t.Run("多渠道", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := Multi{failing{}, NewLogNotifier(&buf)}.Notify(ctx, msg)
+		assert.EqualError(t, err, "boom")
+		assert.NotEmpty(t, buf.String())
+	})
+}
+
+// fakeSMTP 启动只支持最小命令集的 SMTP 服务器，返回收到的邮件内容
+func fakeSMTP(t *testing.T) (string, <-chan string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(s string) { conn.Write([]byte(s + "\r\n")) } // nolint: errcheck
+		reply("220 localhost ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			cmd := strings.ToUpper(strings.TrimSpace(line))
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 localhost")
+			case strings.HasPrefix(cmd, "DATA"):
+				reply("354 go ahead")
+				var data strings.Builder
+				for {
+					l, err := r.ReadString('\n')
+					if err != nil || l == ".\r\n" {
+						break
+					}
+					data.WriteString(l)
+				}
+				received <- data.String()
+				reply("250 ok")
+			case strings.HasPrefix(cmd, "QUIT"):
+				reply("221 bye")
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+	return ln.Addr().String(), received
+}
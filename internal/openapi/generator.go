@@ -0,0 +1,442 @@
+package openapi
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/labstack/echo/v4"
+	"github.com/songfei1983/play-go-api/internal/handler"
+)
+
+// bearerAuth 默认的认证方式，与全局 JWT 中间件一致
+const bearerAuth = "bearerAuth"
+
+// versionSegment 路径中的版本段，如 v1，不参与标签与 operationId
+var versionSegment = regexp.MustCompile(`^v\d+$`)
+
+// OperationInfo 补充路由表无法推断的接口信息
+type OperationInfo struct {
+	Summary     string
+	Description string
+	// Public 为 true 时接口不需要 JWT
+	Public     bool
+	Deprecated bool
+	// Hidden 为 true 时接口不出现在文档中
+	Hidden bool
+	// Request 请求体的零值，用于生成请求体 schema
+	Request any
+	// Response 成功响应体的零值，用于生成响应体 schema
+	Response any
+	// Status 成功时的状态码，为 0 时声明了 Response 的接口为 200，否则为 2XX
+	Status int
+}
+
+// Generator 根据 echo 路由表与资源注册表生成 OpenAPI 文档。
+// 资源的标准路由根据模型生成完整的请求与响应 schema，
+// 其他路由只生成路径参数，可以通过 Describe 补充请求与响应
+type Generator struct {
+	info       Info
+	overrides  map[reflect.Type]*Schema
+	params     map[string]*Schema
+	operations map[string]OperationInfo
+}
+
+// NewGenerator 创建文档生成器
+func NewGenerator(title, version string) *Generator {
+	return &Generator{
+		info:       Info{Title: title, Version: version},
+		overrides:  make(map[reflect.Type]*Schema),
+		params:     make(map[string]*Schema),
+		operations: make(map[string]OperationInfo),
+	}
+}
+
+// UseSchema 指定 value 类型的 schema，用于自定义 JSON 序列化的类型，如金额
+func (g *Generator) UseSchema(value any, schema *Schema) {
+	g.overrides[reflect.TypeOf(value)] = schema
+}
+
+// UseParam 指定路径参数 name 的 schema。默认 id 与以 _id 结尾的参数为正整数，其他为字符串
+func (g *Generator) UseParam(name string, schema *Schema) {
+	g.params[name] = schema
+}
+
+// Describe 补充 method 与 path（echo 路由语法，如 /api/v1/users/:id）对应接口的信息
+func (g *Generator) Describe(method, path string, info OperationInfo) {
+	g.operations[method+" "+path] = info
+}
+
+// resourceRoute 资源的标准路由
+type resourceRoute struct {
+	resource handler.Resource
+	route    handler.Route
+	model    string
+}
+
+// Generate 生成文档，routes 通常为 echo.Echo.Routes()，OPTIONS 与隐藏的路由不出现在文档中
+func (g *Generator) Generate(routes []*echo.Route, resources []handler.Resource) *Document {
+	s := newSchemas(g.overrides)
+	s.components["Error"] = errorSchema()
+	s.components["JSONPatch"] = jsonPatchSchema()
+
+	tags := make(map[string]string)
+	standard := make(map[string]resourceRoute)
+	for _, res := range resources {
+		tags[res.Name] = res.Description
+		model := s.component(res.Model)
+		s.components[model+"Input"] = inputSchema(s.components[model], res.Writable)
+		if len(res.Creatable) > 0 {
+			// 只能在创建时写入的字段单独生成创建请求的 schema
+			s.components[model+"CreateInput"] = inputSchema(s.components[model], append(append([]string{}, res.Writable...), res.Creatable...))
+		}
+		for _, route := range res.Routes {
+			standard[route.Method+" "+route.Path] = resourceRoute{resource: res, route: route, model: model}
+		}
+	}
+
+	doc := &Document{
+		OpenAPI: Version,
+		Info:    g.info,
+		Paths:   make(map[string]*PathItem),
+		Components: Components{
+			Schemas: s.components,
+			SecuritySchemes: map[string]*SecurityScheme{
+				bearerAuth: {Type: "http", Scheme: "bearer", BearerFormat: "JWT"},
+			},
+		},
+		Security: []SecurityRequirement{{bearerAuth: {}}},
+	}
+	for _, route := range routes {
+		key := route.Method + " " + route.Path
+		info := g.operations[key]
+		if info.Hidden {
+			continue
+		}
+
+		var op *Operation
+		if rr, ok := standard[key]; ok {
+			op = g.resourceOperation(rr)
+		} else {
+			op = g.routeOperation(s, route, info)
+		}
+		if info.Summary != "" {
+			op.Summary = info.Summary
+		}
+		op.Description = info.Description
+		op.Deprecated = info.Deprecated
+		if info.Public {
+			op.Security = &[]SecurityRequirement{}
+		}
+
+		path := Path(route.Path)
+		item, ok := doc.Paths[path]
+		if !ok {
+			item = &PathItem{}
+		}
+		if !item.setOperation(route.Method, op) {
+			continue
+		}
+		doc.Paths[path] = item
+		for _, tag := range op.Tags {
+			if _, ok := tags[tag]; !ok {
+				tags[tag] = ""
+			}
+		}
+	}
+
+	for name, description := range tags {
+		doc.Tags = append(doc.Tags, Tag{Name: name, Description: description})
+	}
+	sort.Slice(doc.Tags, func(i, j int) bool { return doc.Tags[i].Name < doc.Tags[j].Name })
+	return doc
+}
+
+// resourceOperation 生成资源标准路由的接口
+func (g *Generator) resourceOperation(rr resourceRoute) *Operation {
+	res := rr.resource
+	model := ref(rr.model)
+	input := ref(rr.model + "Input")
+	noun := exportedName(rr.model)
+	if rr.route.Operation == handler.OpList {
+		noun = exportedName(res.Name)
+	}
+	op := &Operation{
+		OperationID: string(rr.route.Operation) + noun,
+		Summary:     rr.route.Summary,
+		Tags:        []string{res.Name},
+		Parameters:  g.pathParams(rr.route.Path),
+		Responses: map[string]*Response{
+			"default": errorResponse("Unexpected error"),
+		},
+	}
+	if rr.route.Operation != handler.OpList && rr.route.Operation != handler.OpCreate {
+		op.Responses["400"] = errorResponse("Invalid ID or request body")
+		op.Responses["404"] = errorResponse("Record not found")
+	}
+
+	switch rr.route.Operation {
+	case handler.OpList:
+		op.Parameters = append(op.Parameters,
+			queryParam("include_deleted", "Include soft-deleted records", &Schema{Type: Types{"boolean"}}),
+			queryParam("fields", "Comma-separated fields to return", &Schema{Type: Types{"string"}}),
+			queryParam("include", "Comma-separated relations to embed", &Schema{Type: Types{"string"}}),
+		)
+		op.Responses["200"] = jsonResponse("List of "+res.Name, &Schema{Type: Types{"array"}, Items: model})
+	case handler.OpCreate:
+		if len(res.Creatable) > 0 {
+			input = ref(rr.model + "CreateInput")
+		}
+		op.RequestBody = jsonBody(input)
+		op.Responses["201"] = jsonResponse("Created", model)
+		op.Responses["400"] = errorResponse("Invalid request body")
+	case handler.OpGet:
+		op.Parameters = append(op.Parameters,
+			queryParam("fields", "Comma-separated fields to return", &Schema{Type: Types{"string"}}),
+			queryParam("include", "Comma-separated relations to embed", &Schema{Type: Types{"string"}}),
+		)
+		op.Responses["200"] = jsonResponse("Record found", model)
+	case handler.OpReplace:
+		op.RequestBody = jsonBody(input)
+		op.Responses["200"] = jsonResponse("Record replaced", model)
+	case handler.OpUpdate:
+		op.RequestBody = &RequestBody{Required: true, Content: map[string]*MediaType{
+			echo.MIMEApplicationJSON:       {Schema: input},
+			"application/merge-patch+json": {Schema: input},
+			"application/json-patch+json":  {Schema: ref("JSONPatch")},
+		}}
+		op.Responses["200"] = jsonResponse("Record updated", model)
+		op.Responses["409"] = errorResponse("A JSON Patch test operation failed")
+		op.Responses["415"] = errorResponse("Unsupported patch content type")
+		op.Responses["422"] = errorResponse("Patched record failed validation")
+	case handler.OpDelete:
+		description := "Record deleted"
+		if res.SoftDelete {
+			description = "Record soft deleted"
+		}
+		op.Responses["204"] = &Response{Description: description}
+	case handler.OpRestore:
+		op.Responses["200"] = &Response{Description: "Record restored"}
+	}
+	return op
+}
+
+// routeOperation 生成非标准路由的接口，只有通过 Describe 声明时才包含请求与响应 schema
+func (g *Generator) routeOperation(s *schemas, route *echo.Route, info OperationInfo) *Operation {
+	op := &Operation{
+		OperationID: operationID(route.Method, route.Path),
+		Summary:     summaryOf(route.Name),
+		Tags:        []string{tagOf(route.Path)},
+		Parameters:  g.pathParams(route.Path),
+		Responses: map[string]*Response{
+			"default": errorResponse("Unexpected error"),
+		},
+	}
+	if info.Request != nil {
+		op.RequestBody = jsonBody(s.of(reflect.TypeOf(info.Request)))
+	}
+	status := "2XX"
+	if info.Status != 0 {
+		status = strconv.Itoa(info.Status)
+	} else if info.Response != nil {
+		status = strconv.Itoa(http.StatusOK)
+	}
+	op.Responses[status] = &Response{Description: "Successful response"}
+	if info.Response != nil {
+		op.Responses[status] = jsonResponse("Successful response", s.of(reflect.TypeOf(info.Response)))
+	}
+	return op
+}
+
+// pathParams 生成 echo 路径中的参数，通配符 * 命名为 path
+func (g *Generator) pathParams(path string) []Parameter {
+	var params []Parameter
+	for _, segment := range strings.Split(path, "/") {
+		var name string
+		switch {
+		case strings.HasPrefix(segment, ":"):
+			name = segment[1:]
+		case segment == "*":
+			name = "path"
+		default:
+			continue
+		}
+		schema, ok := g.params[name]
+		switch {
+		case ok:
+			copied := *schema
+			schema = &copied
+		case name == "id" || strings.HasSuffix(name, "_id"):
+			one := 1.0
+			schema = &Schema{Type: Types{"integer"}, Format: "int64", Minimum: &one}
+		default:
+			schema = &Schema{Type: Types{"string"}}
+		}
+		params = append(params, Parameter{Name: name, In: "path", Required: true, Schema: schema})
+	}
+	return params
+}
+
+// Path 将 echo 路由语法转换为 OpenAPI 路径模板，如 /users/:id 转换为 /users/{id}
+func Path(echoPath string) string {
+	segments := strings.Split(echoPath, "/")
+	for i, segment := range segments {
+		switch {
+		case strings.HasPrefix(segment, ":"):
+			segments[i] = "{" + segment[1:] + "}"
+		case segment == "*":
+			segments[i] = "{path}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// staticSegments 返回路径中除 api 前缀与版本号以外的段
+func staticSegments(path string) []string {
+	var out []string
+	for _, segment := range strings.Split(path, "/") {
+		if segment == "" || (len(out) == 0 && (segment == "api" || versionSegment.MatchString(segment))) {
+			continue
+		}
+		out = append(out, segment)
+	}
+	return out
+}
+
+// tagOf 使用路径的第一段作为标签，如 /api/v1/products/search 的标签为 products
+func tagOf(path string) string {
+	segments := staticSegments(path)
+	if len(segments) == 0 {
+		return "default"
+	}
+	return segments[0]
+}
+
+// operationID 由方法与路径生成唯一的 operationId，如 POST /api/v1/products/:id/stock/reserve
+// 生成 postProductsByIdStockReserve
+func operationID(method, path string) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(method))
+	for _, segment := range staticSegments(path) {
+		switch {
+		case strings.HasPrefix(segment, ":"):
+			b.WriteString("By" + exportedName(segment[1:]))
+		case segment == "*":
+			b.WriteString("ByPath")
+		default:
+			b.WriteString(exportedName(segment))
+		}
+	}
+	return b.String()
+}
+
+// exportedName 将 audit-logs、variant_id 转换为 AuditLogs、VariantId
+func exportedName(s string) string {
+	var b strings.Builder
+	for _, word := range strings.FieldsFunc(s, func(r rune) bool { return r == '-' || r == '_' }) {
+		runes := []rune(word)
+		runes[0] = unicode.ToUpper(runes[0])
+		b.WriteString(string(runes))
+	}
+	return b.String()
+}
+
+// summaryOf 由处理函数名生成接口摘要，如 (*ProductHandler).ReserveStock-fm 生成 Reserve stock；
+// 匿名函数没有摘要
+func summaryOf(handlerName string) string {
+	name, ok := strings.CutSuffix(handlerName, "-fm")
+	if !ok {
+		return ""
+	}
+	name = name[strings.LastIndex(name, ".")+1:]
+	var b strings.Builder
+	for i, r := range name {
+		if i > 0 && unicode.IsUpper(r) {
+			b.WriteByte(' ')
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// inputSchema 模型中客户端可以写入的字段，并将模型中的其他字段标记为只读。
+// writable 为空时除 id 与时间戳以外的字段都可写
+func inputSchema(model *Schema, writable []string) *Schema {
+	allowed := make(map[string]bool)
+	for _, name := range writable {
+		allowed[name] = true
+	}
+	if len(writable) == 0 {
+		for name := range model.Properties {
+			allowed[name] = true
+		}
+		for _, name := range []string{"id", "created_at", "updated_at", "deleted_at"} {
+			delete(allowed, name)
+		}
+	}
+
+	input := &Schema{Type: Types{"object"}, Properties: make(map[string]*Schema)}
+	for name, prop := range model.Properties {
+		if allowed[name] {
+			copied := *prop
+			copied.ReadOnly = false
+			input.Properties[name] = &copied
+		} else {
+			prop.ReadOnly = true
+		}
+	}
+	return input
+}
+
+// errorSchema 错误响应，处理器返回 error 字段，echo.HTTPError 返回 message 字段
+func errorSchema() *Schema {
+	return &Schema{
+		Type: Types{"object"},
+		Properties: map[string]*Schema{
+			"error":   {},
+			"message": {},
+		},
+	}
+}
+
+// jsonPatchSchema JSON Patch（RFC 6902）文档
+func jsonPatchSchema() *Schema {
+	return &Schema{
+		Type: Types{"array"},
+		Items: &Schema{
+			Type:     Types{"object"},
+			Required: []string{"op", "path"},
+			Properties: map[string]*Schema{
+				"op":    {Type: Types{"string"}, Enum: []any{"add", "remove", "replace", "move", "copy", "test"}},
+				"path":  {Type: Types{"string"}},
+				"from":  {Type: Types{"string"}},
+				"value": {},
+			},
+		},
+	}
+}
+
+func queryParam(name, description string, schema *Schema) Parameter {
+	return Parameter{Name: name, In: "query", Description: description, Schema: schema}
+}
+
+func jsonBody(schema *Schema) *RequestBody {
+	return &RequestBody{Required: true, Content: map[string]*MediaType{
+		echo.MIMEApplicationJSON: {Schema: schema},
+	}}
+}
+
+func jsonResponse(description string, schema *Schema) *Response {
+	return &Response{Description: description, Content: map[string]*MediaType{
+		echo.MIMEApplicationJSON: {Schema: schema},
+	}}
+}
+
+func errorResponse(description string) *Response {
+	return jsonResponse(description, ref("Error"))
+}
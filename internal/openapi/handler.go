@@ -0,0 +1,44 @@
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"html"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// docsPage 文档页面模板，Redoc 固定版本加载，升级时与 docker-compose 中的 redoc 镜像一起修改
+//
+//go:embed docs.html
+var docsPage string
+
+// Marshal 以固定缩进输出文档，提交到仓库的文档使用同一格式
+func Marshal(doc *Document) ([]byte, error) {
+	out, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(out, '\n'), nil
+}
+
+// SpecHandler 返回文档 JSON
+func SpecHandler(doc *Document) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		body, err := Marshal(doc)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		return c.Blob(http.StatusOK, echo.MIMEApplicationJSONCharsetUTF8, body)
+	}
+}
+
+// DocsHandler 返回使用 Redoc 渲染 specURL 的文档页面
+func DocsHandler(specURL string) echo.HandlerFunc {
+	page := strings.ReplaceAll(docsPage, "{{SPEC_URL}}", html.EscapeString(specURL))
+	return func(c echo.Context) error {
+		return c.HTML(http.StatusOK, page)
+	}
+}
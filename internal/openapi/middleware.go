@@ -0,0 +1,115 @@
+package openapi
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ValidationOptions 校验中间件的选项
+type ValidationOptions struct {
+	// Requests 为 true 时校验请求，不符合文档时返回 400
+	Requests bool
+	// Responses 为 true 时校验响应。响应已发送给客户端，不符合文档时只调用 OnViolation，
+	// 需要缓存响应体，只应在非生产环境开启
+	Responses bool
+	// OnViolation 响应不符合文档时调用，用于记录日志与指标
+	OnViolation func(c echo.Context, errs []FieldError)
+}
+
+// Middleware 按文档校验请求与响应，文档中没有的路由不校验
+func (v *Validator) Middleware(opts ValidationOptions) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			op := v.Operation(c.Request().Method, c.Path())
+			if op == nil {
+				return next(c)
+			}
+
+			if opts.Requests {
+				if errs := v.ValidateRequest(c, op); len(errs) > 0 {
+					return echo.NewHTTPError(http.StatusBadRequest, map[string]interface{}{
+						"error":  "request does not match the API specification",
+						"fields": errs,
+					})
+				}
+			}
+			if !opts.Responses || !hasContent(op) {
+				return next(c)
+			}
+
+			res := c.Response()
+			rec := &responseRecorder{ResponseWriter: res.Writer}
+			res.Writer = rec
+			err := next(c)
+			if err != nil {
+				// 错误响应由错误处理器写入，先写入后才能校验；已提交的响应不会重复写入
+				c.Error(err)
+			}
+			res.Writer = rec.ResponseWriter
+
+			if rec.hijacked || (rec.checked && !rec.record) {
+				return err
+			}
+			if errs := v.ValidateResponse(op, res.Status, res.Header().Get(echo.HeaderContentType), rec.body.Bytes()); len(errs) > 0 && opts.OnViolation != nil {
+				opts.OnViolation(c, errs)
+			}
+			return err
+		}
+	}
+}
+
+// hasContent 判断接口是否声明了响应体，没有声明时不需要缓存响应
+func hasContent(op *Operation) bool {
+	for _, resp := range op.Responses {
+		if len(resp.Content) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// responseRecorder 在写入客户端的同时保留 JSON 响应体，SSE 等流式响应不缓存
+type responseRecorder struct {
+	http.ResponseWriter
+	body     bytes.Buffer
+	checked  bool
+	record   bool
+	hijacked bool
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if !r.checked {
+		r.checked = true
+		r.record = mediaType(r.Header().Get(echo.HeaderContentType)) == echo.MIMEApplicationJSON
+	}
+	if r.record {
+		r.body.Write(b)
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Flush 实现 http.Flusher
+func (r *responseRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack 实现 http.Hijacker
+func (r *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := r.ResponseWriter.(http.Hijacker); ok {
+		r.hijacked = true
+		return h.Hijack()
+	}
+	return nil, nil, errors.New("response writer does not support hijacking")
+}
+
+// Unwrap 供 http.ResponseController 使用
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
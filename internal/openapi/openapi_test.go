@@ -0,0 +1,123 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/songfei1983/play-go-api/internal/handler"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type widget struct {
+	ID        uint              `json:"id"`
+	Name      string            `json:"name" gorm:"size:64"`
+	Code      string            `json:"code" gorm:"type:char(3);not null"`
+	Parent    *widget           `json:"parent"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	DeletedAt *time.Time        `json:"deleted_at,omitempty"`
+	Secret    string            `json:"-"`
+}
+
+func (w widget) GetID() uint              { return w.ID }
+func (w widget) TableName() string        { return "widgets" }
+func (w widget) WritableFields() []string { return []string{"name", "code"} }
+
+func TestSchemas(t *testing.T) {
+	s := newSchemas(nil)
+	name := s.component(reflect.TypeOf(widget{}))
+	schema := s.components[name]
+
+	t.Run("按 json 标签生成属性", func(t *testing.T) {
+		assert.Equal(t, "widget", name)
+		assert.NotContains(t, schema.Properties, "Secret")
+		assert.Equal(t, Types{"string"}, schema.Properties["deleted_at"].Type)
+		assert.Equal(t, "date-time", schema.Properties["deleted_at"].Format)
+		assert.Equal(t, 64, *schema.Properties["name"].MaxLength)
+		assert.Equal(t, 3, *schema.Properties["code"].MaxLength)
+		assert.Equal(t, Types{"object"}, schema.Properties["labels"].Type)
+	})
+
+	t.Run("没有 omitempty 的指针可以为 null", func(t *testing.T) {
+		out, err := json.Marshal(schema.Properties["parent"])
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"anyOf":[{"$ref":"#/components/schemas/widget"},{"type":"null"}]}`, string(out))
+	})
+
+	t.Run("只读字段不出现在输入中", func(t *testing.T) {
+		input := inputSchema(schema, widget{}.WritableFields())
+		assert.Len(t, input.Properties, 2)
+		assert.False(t, input.Properties["name"].ReadOnly)
+		assert.True(t, schema.Properties["id"].ReadOnly)
+	})
+}
+
+func TestGenerate(t *testing.T) {
+	e := echo.New()
+	registry := handler.NewRegistry(e.Group("/api/v1"), "/api/v1")
+	handler.Register(registry, handler.NewBaseHandler[widget](nil, nil), handler.ResourceOptions{
+		Operations: []handler.Operation{handler.OpList, handler.OpGet, handler.OpDelete},
+	})
+	e.POST("/api/v1/widgets/:id/stock/reserve", (&widgetHandler{}).ReserveStock)
+	e.GET("/api/v1/import/:job_id", func(c echo.Context) error { return nil })
+	e.POST("/login", func(c echo.Context) error { return nil })
+	e.GET("/internal", func(c echo.Context) error { return nil })
+
+	g := NewGenerator("Test", "1.0.0")
+	g.UseParam("job_id", &Schema{Type: Types{"string"}})
+	g.Describe(http.MethodPost, "/login", OperationInfo{Public: true, Request: handler.LoginRequest{}, Response: map[string]string{}})
+	g.Describe(http.MethodGet, "/internal", OperationInfo{Hidden: true})
+	doc := g.Generate(e.Routes(), registry.Resources())
+
+	t.Run("资源的标准路由", func(t *testing.T) {
+		list := doc.Paths["/api/v1/widgets"].Get
+		require.NotNil(t, list)
+		assert.Equal(t, "listWidgets", list.OperationID)
+		assert.Equal(t, Types{"array"}, list.Responses["200"].Content[echo.MIMEApplicationJSON].Schema.Type)
+
+		item := doc.Paths["/api/v1/widgets/{id}"]
+		assert.Equal(t, "getWidget", item.Get.OperationID)
+		assert.Contains(t, item.Delete.Responses, "204")
+		assert.Nil(t, item.Put)
+		assert.Contains(t, doc.Components.Schemas, "widgetInput")
+	})
+
+	t.Run("其他路由", func(t *testing.T) {
+		reserve := doc.Paths["/api/v1/widgets/{id}/stock/reserve"].Post
+		assert.Equal(t, "postWidgetsByIdStockReserve", reserve.OperationID)
+		assert.Equal(t, "Reserve stock", reserve.Summary)
+		assert.Equal(t, []string{"widgets"}, reserve.Tags)
+		assert.Contains(t, reserve.Responses, "2XX")
+		assert.Equal(t, Types{"integer"}, reserve.Parameters[0].Schema.Type)
+
+		job := doc.Paths["/api/v1/import/{job_id}"].Get
+		assert.Equal(t, Types{"string"}, job.Parameters[0].Schema.Type)
+		assert.Empty(t, job.Summary)
+	})
+
+	t.Run("Describe 补充的信息", func(t *testing.T) {
+		login := doc.Paths["/login"].Post
+		require.NotNil(t, login.Security)
+		assert.Empty(t, *login.Security)
+		assert.Contains(t, login.Responses, "200")
+		assert.Equal(t, "#/components/schemas/LoginRequest", login.RequestBody.Content[echo.MIMEApplicationJSON].Schema.Ref)
+		assert.NotContains(t, doc.Paths, "/internal")
+	})
+
+	t.Run("输出为 OpenAPI 3.1", func(t *testing.T) {
+		out, err := Marshal(doc)
+		require.NoError(t, err)
+		var raw map[string]interface{}
+		require.NoError(t, json.Unmarshal(out, &raw))
+		assert.Equal(t, "3.1.0", raw["openapi"])
+		assert.Equal(t, []interface{}{map[string]interface{}{"bearerAuth": []interface{}{}}}, raw["security"])
+	})
+}
+
+type widgetHandler struct{}
+
+func (h *widgetHandler) ReserveStock(c echo.Context) error { return nil }
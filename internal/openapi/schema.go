@@ -0,0 +1,182 @@
+package openapi
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// gormSizePattern 从 gorm 标签读取字符串长度上限，如 size:191、type:char(3)、type:varchar(64)
+var gormSizePattern = regexp.MustCompile(`(?:^|;)\s*(?:size:(\d+)|type:(?:var)?char\((\d+)\))`)
+
+// schemas 由 Go 类型生成 schema，结构体生成为 components.schemas 中的命名 schema
+type schemas struct {
+	components map[string]*Schema
+	overrides  map[reflect.Type]*Schema
+	// names 已生成的结构体对应的组件名，用于处理递归引用
+	names map[reflect.Type]string
+}
+
+func newSchemas(overrides map[reflect.Type]*Schema) *schemas {
+	return &schemas{
+		components: make(map[string]*Schema),
+		overrides:  overrides,
+		names:      make(map[reflect.Type]string),
+	}
+}
+
+// ref 引用组件 name
+func ref(name string) *Schema {
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+// of 返回类型 t 的 schema，命名结构体返回组件引用
+func (s *schemas) of(t reflect.Type) *Schema {
+	if t.Kind() == reflect.Pointer {
+		return s.of(t.Elem())
+	}
+	if override, ok := s.overrides[t]; ok {
+		copied := *override
+		return &copied
+	}
+	switch {
+	case t == timeType:
+		return &Schema{Type: Types{"string"}, Format: "date-time"}
+	case t.Implements(jsonMarshalerType) || reflect.PointerTo(t).Implements(jsonMarshalerType):
+		// 自定义序列化的类型无法推断输出，需要通过 UseSchema 声明
+		return &Schema{}
+	case t.Implements(textMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType):
+		return &Schema{Type: Types{"string"}}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: Types{"boolean"}}
+	case reflect.Int, reflect.Int64:
+		return &Schema{Type: Types{"integer"}, Format: "int64"}
+	case reflect.Int8, reflect.Int16, reflect.Int32:
+		return &Schema{Type: Types{"integer"}, Format: "int32"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		zero := 0.0
+		return &Schema{Type: Types{"integer"}, Format: "int64", Minimum: &zero}
+	case reflect.Float32:
+		return &Schema{Type: Types{"number"}, Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: Types{"number"}, Format: "double"}
+	case reflect.String:
+		return &Schema{Type: Types{"string"}}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: Types{"string"}, Format: "byte"}
+		}
+		return &Schema{Type: Types{"array"}, Items: s.of(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: Types{"object"}, AdditionalProperties: s.of(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.object(t)
+		}
+		return ref(s.component(t))
+	}
+	// interface{} 等任意值
+	return &Schema{}
+}
+
+// component 生成结构体的命名 schema 并返回组件名
+func (s *schemas) component(t reflect.Type) string {
+	if name, ok := s.names[t]; ok {
+		return name
+	}
+	name := t.Name()
+	s.names[t] = name
+	// 先占位，结构体引用自身时（如分类的 children）不会无限递归
+	s.components[name] = &Schema{}
+	*s.components[name] = *s.object(t)
+	return name
+}
+
+// object 按 encoding/json 的规则生成结构体的属性，匿名嵌入的结构体展开到外层
+func (s *schemas) object(t reflect.Type) *Schema {
+	schema := &Schema{Type: Types{"object"}, Properties: make(map[string]*Schema)}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				embedded := s.object(ft)
+				for k, v := range embedded.Properties {
+					schema.Properties[k] = v
+				}
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		omitempty := strings.Contains(opts, "omitempty")
+
+		prop := s.of(f.Type)
+		if strings.Contains(opts, "string") {
+			prop = &Schema{Type: Types{"string"}}
+		}
+		if size := gormSize(f.Tag.Get("gorm")); size > 0 && prop.Type.Has("string") {
+			prop.MaxLength = &size
+		}
+		// 没有 omitempty 的指针、切片与映射为空时输出 null
+		switch f.Type.Kind() {
+		case reflect.Pointer, reflect.Slice, reflect.Map, reflect.Interface:
+			if !omitempty {
+				prop = nullable(prop)
+			}
+		}
+		schema.Properties[name] = prop
+	}
+	return schema
+}
+
+// nullable 允许 schema 取 null
+func nullable(schema *Schema) *Schema {
+	switch {
+	case schema.Ref != "":
+		return &Schema{AnyOf: []*Schema{schema, {Type: Types{"null"}}}}
+	case len(schema.Type) == 0, schema.Type.Has("null"):
+		return schema
+	}
+	schema.Type = append(append(Types{}, schema.Type...), "null")
+	return schema
+}
+
+// gormSize 读取 gorm 标签中的长度上限，没有时返回 0
+func gormSize(tag string) int {
+	m := gormSizePattern.FindStringSubmatch(tag)
+	if m == nil {
+		return 0
+	}
+	digits := m[1]
+	if digits == "" {
+		digits = m[2]
+	}
+	size, _ := strconv.Atoi(digits)
+	return size
+}
@@ -0,0 +1,330 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/labstack/echo/v4"
+)
+
+// FieldError 请求或响应中不符合文档的位置
+type FieldError struct {
+	// In 出错的位置：path、query、body
+	In string `json:"in"`
+	// Field 参数名或请求体中的字段路径，如 variants[0].sku，请求体本身为空
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) String() string {
+	if e.Field == "" {
+		return e.In + ": " + e.Message
+	}
+	return e.In + "." + e.Field + ": " + e.Message
+}
+
+// Validator 按文档校验请求与响应，只支持生成器用到的 JSON Schema 关键字
+type Validator struct {
+	doc *Document
+}
+
+// NewValidator 创建校验器
+func NewValidator(doc *Document) *Validator {
+	return &Validator{doc: doc}
+}
+
+// Operation 返回 method 与 echo 路由路径对应的接口，文档中没有时返回 nil
+func (v *Validator) Operation(method, echoPath string) *Operation {
+	item, ok := v.doc.Paths[Path(echoPath)]
+	if !ok {
+		return nil
+	}
+	return item.Operation(method)
+}
+
+// ValidateRequest 校验路径参数、查询参数与 JSON 请求体。读取后的请求体会放回请求中，
+// 未在文档中声明的媒体类型不校验，由处理器决定如何响应
+func (v *Validator) ValidateRequest(c echo.Context, op *Operation) []FieldError {
+	var errs []FieldError
+	for _, param := range op.Parameters {
+		var raw string
+		var present bool
+		switch param.In {
+		case "path":
+			name := param.Name
+			if name == "path" && c.Param(name) == "" {
+				name = "*"
+			}
+			raw, present = c.Param(name), true
+		case "query":
+			values, ok := c.QueryParams()[param.Name]
+			if ok && len(values) > 0 {
+				raw, present = values[0], true
+			}
+		default:
+			continue
+		}
+		if !present {
+			if param.Required {
+				errs = append(errs, FieldError{In: param.In, Field: param.Name, Message: "is required"})
+			}
+			continue
+		}
+		value, err := parseParam(param.Schema, raw)
+		if err != nil {
+			errs = append(errs, FieldError{In: param.In, Field: param.Name, Message: err.Error()})
+			continue
+		}
+		for _, e := range v.validate(param.Schema, value, "", false) {
+			errs = append(errs, FieldError{In: param.In, Field: param.Name, Message: e.Message})
+		}
+	}
+
+	if op.RequestBody != nil {
+		errs = append(errs, v.validateRequestBody(c, op.RequestBody)...)
+	}
+	return errs
+}
+
+func (v *Validator) validateRequestBody(c echo.Context, body *RequestBody) []FieldError {
+	req := c.Request()
+	media, ok := body.Content[mediaType(req.Header.Get(echo.HeaderContentType))]
+	if !ok && req.Header.Get(echo.HeaderContentType) == "" {
+		media, ok = body.Content[echo.MIMEApplicationJSON]
+	}
+	if !ok || media.Schema == nil {
+		return nil
+	}
+
+	var data []byte
+	if req.Body != nil {
+		var err error
+		if data, err = io.ReadAll(req.Body); err != nil {
+			return []FieldError{{In: "body", Message: "failed to read request body"}}
+		}
+		req.Body = io.NopCloser(bytes.NewReader(data))
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		if body.Required {
+			return []FieldError{{In: "body", Message: "is required"}}
+		}
+		return nil
+	}
+
+	value, err := decodeJSON(data)
+	if err != nil {
+		return []FieldError{{In: "body", Message: "is not valid JSON"}}
+	}
+	return v.validate(media.Schema, value, "", true)
+}
+
+// ValidateResponse 校验响应的状态码与 JSON 响应体
+func (v *Validator) ValidateResponse(op *Operation, status int, contentType string, body []byte) []FieldError {
+	resp := op.Responses[strconv.Itoa(status)]
+	if resp == nil {
+		resp = op.Responses[fmt.Sprintf("%dXX", status/100)]
+	}
+	if resp == nil {
+		resp = op.Responses["default"]
+	}
+	if resp == nil {
+		return []FieldError{{In: "status", Message: fmt.Sprintf("status %d is not documented", status)}}
+	}
+	if len(resp.Content) == 0 || len(bytes.TrimSpace(body)) == 0 {
+		return nil
+	}
+
+	media, ok := resp.Content[mediaType(contentType)]
+	if !ok {
+		return []FieldError{{In: "body", Message: fmt.Sprintf("content type %q is not documented", contentType)}}
+	}
+	if media.Schema == nil {
+		return nil
+	}
+	value, err := decodeJSON(body)
+	if err != nil {
+		return []FieldError{{In: "body", Message: "is not valid JSON"}}
+	}
+	return v.validate(media.Schema, value, "", false)
+}
+
+// validate 校验 value，field 为当前字段路径。request 为 true 时对象属性允许为 null，
+// 与 encoding/json 解码时忽略 null 的行为一致
+func (v *Validator) validate(schema *Schema, value any, field string, request bool) []FieldError {
+	schema = v.resolve(schema)
+	if schema == nil {
+		return nil
+	}
+	fail := func(format string, args ...any) []FieldError {
+		return []FieldError{{In: "body", Field: field, Message: fmt.Sprintf(format, args...)}}
+	}
+
+	if len(schema.AnyOf) > 0 {
+		var best []FieldError
+		for _, option := range schema.AnyOf {
+			errs := v.validate(option, value, field, request)
+			if len(errs) == 0 {
+				return nil
+			}
+			if best == nil || len(errs) < len(best) {
+				best = errs
+			}
+		}
+		return best
+	}
+
+	actual := jsonType(value)
+	if len(schema.Type) > 0 && !schema.Type.Has(actual) && !(actual == "integer" && schema.Type.Has("number")) {
+		return fail("expected %s, got %s", strings.Join(schema.Type, " or "), actual)
+	}
+	if len(schema.Enum) > 0 {
+		allowed := false
+		for _, e := range schema.Enum {
+			if fmt.Sprint(e) == fmt.Sprint(value) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fail("must be one of %v", schema.Enum)
+		}
+	}
+
+	var errs []FieldError
+	switch value := value.(type) {
+	case json.Number:
+		if schema.Minimum != nil {
+			if n, _ := value.Float64(); n < *schema.Minimum {
+				errs = append(errs, fail("must be at least %v", *schema.Minimum)...)
+			}
+		}
+	case string:
+		if schema.MaxLength != nil && utf8.RuneCountInString(value) > *schema.MaxLength {
+			errs = append(errs, fail("must be at most %d characters", *schema.MaxLength)...)
+		}
+		if schema.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339, value); err != nil {
+				errs = append(errs, fail("must be an RFC 3339 date-time")...)
+			}
+		}
+	case []any:
+		for i, item := range value {
+			errs = append(errs, v.validate(schema.Items, item, fmt.Sprintf("%s[%d]", field, i), request)...)
+		}
+	case map[string]any:
+		for _, name := range schema.Required {
+			if _, ok := value[name]; !ok {
+				errs = append(errs, FieldError{In: "body", Field: join(field, name), Message: "is required"})
+			}
+		}
+		for name, item := range value {
+			prop, ok := schema.Properties[name]
+			if !ok {
+				prop = schema.AdditionalProperties
+			}
+			if prop == nil || (request && item == nil) {
+				continue
+			}
+			errs = append(errs, v.validate(prop, item, join(field, name), request)...)
+		}
+	}
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Field < errs[j].Field })
+	return errs
+}
+
+// resolve 解析 components.schemas 中的引用
+func (v *Validator) resolve(schema *Schema) *Schema {
+	for schema != nil && schema.Ref != "" {
+		name, ok := strings.CutPrefix(schema.Ref, "#/components/schemas/")
+		if !ok {
+			return nil
+		}
+		schema = v.doc.Components.Schemas[name]
+	}
+	return schema
+}
+
+// parseParam 按参数 schema 的类型转换字符串参数
+func parseParam(schema *Schema, raw string) (any, error) {
+	switch {
+	case schema == nil:
+		return raw, nil
+	case schema.Type.Has("integer"):
+		if _, err := strconv.ParseInt(raw, 10, 64); err != nil {
+			return nil, fmt.Errorf("expected integer, got %q", raw)
+		}
+		return json.Number(raw), nil
+	case schema.Type.Has("number"):
+		if _, err := strconv.ParseFloat(raw, 64); err != nil {
+			return nil, fmt.Errorf("expected number, got %q", raw)
+		}
+		return json.Number(raw), nil
+	case schema.Type.Has("boolean"):
+		b, err := strconv.ParseBool(raw)
+		if err != nil || (raw != "true" && raw != "false") {
+			return nil, fmt.Errorf("expected true or false, got %q", raw)
+		}
+		return b, nil
+	}
+	return raw, nil
+}
+
+// jsonType 返回解码后的 JSON 值的类型名，整数返回 integer
+func jsonType(value any) string {
+	switch value := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		// 与 encoding/json 一致，带小数点或指数的数字不能解码为整数
+		if !strings.ContainsAny(string(value), ".eE") {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func decodeJSON(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var value any
+	if err := dec.Decode(&value); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("unexpected data after JSON value")
+	}
+	return value, nil
+}
+
+// mediaType 去掉 Content-Type 中的参数，如 charset
+func mediaType(contentType string) string {
+	media, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return contentType
+	}
+	return media
+}
+
+func join(field, name string) string {
+	if field == "" {
+		return name
+	}
+	return field + "." + name
+}
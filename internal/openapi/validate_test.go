@@ -0,0 +1,157 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/songfei1983/play-go-api/internal/handler"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// widgetDocument 生成包含 widgets 标准路由的文档
+func widgetDocument() *Document {
+	e := echo.New()
+	registry := handler.NewRegistry(e.Group("/api/v1"), "/api/v1")
+	handler.Register(registry, handler.NewBaseHandler[widget](nil, nil), handler.ResourceOptions{
+		Operations: []handler.Operation{handler.OpList, handler.OpCreate, handler.OpGet},
+	})
+	return NewGenerator("Test", "1.0.0").Generate(e.Routes(), registry.Resources())
+}
+
+func TestValidator(t *testing.T) {
+	v := NewValidator(widgetDocument())
+	create := v.Operation(http.MethodPost, "/api/v1/widgets")
+	get := v.Operation(http.MethodGet, "/api/v1/widgets/:id")
+	require.NotNil(t, create)
+	require.NotNil(t, get)
+	assert.Nil(t, v.Operation(http.MethodDelete, "/api/v1/widgets/:id"))
+
+	validateBody := func(body string) []FieldError {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/widgets", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		return v.ValidateRequest(echo.New().NewContext(req, httptest.NewRecorder()), create)
+	}
+
+	t.Run("合法的请求体", func(t *testing.T) {
+		assert.Empty(t, validateBody(`{"name":"bolt","code":"B01"}`))
+	})
+
+	t.Run("请求体中的 null 与解码行为一致", func(t *testing.T) {
+		assert.Empty(t, validateBody(`{"name":null}`))
+	})
+
+	t.Run("字段类型与长度", func(t *testing.T) {
+		errs := validateBody(`{"name":1,"code":"TOO LONG"}`)
+		require.Len(t, errs, 2)
+		assert.Equal(t, FieldError{In: "body", Field: "code", Message: "must be at most 3 characters"}, errs[0])
+		assert.Equal(t, FieldError{In: "body", Field: "name", Message: "expected string, got integer"}, errs[1])
+	})
+
+	t.Run("请求体不是 JSON", func(t *testing.T) {
+		assert.Equal(t, []FieldError{{In: "body", Message: "is not valid JSON"}}, validateBody(`{"name":`))
+	})
+
+	t.Run("路径参数与查询参数", func(t *testing.T) {
+		c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/api/v1/widgets/abc", nil), httptest.NewRecorder())
+		c.SetParamNames("id")
+		c.SetParamValues("abc")
+		assert.Equal(t, []FieldError{{In: "path", Field: "id", Message: `expected integer, got "abc"`}}, v.ValidateRequest(c, get))
+		c.SetParamValues("0")
+		assert.Equal(t, []FieldError{{In: "path", Field: "id", Message: "must be at least 1"}}, v.ValidateRequest(c, get))
+
+		c = echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/api/v1/widgets?include_deleted=yes", nil), httptest.NewRecorder())
+		assert.Equal(t, []FieldError{{In: "query", Field: "include_deleted", Message: `expected true or false, got "yes"`}},
+			v.ValidateRequest(c, v.Operation(http.MethodGet, "/api/v1/widgets")))
+	})
+
+	t.Run("响应", func(t *testing.T) {
+		assert.Empty(t, v.ValidateResponse(get, http.StatusOK, echo.MIMEApplicationJSONCharsetUTF8, []byte(`{"id":1,"name":"bolt","parent":null}`)))
+		assert.Empty(t, v.ValidateResponse(get, http.StatusNotFound, echo.MIMEApplicationJSON, []byte(`{"error":"not found"}`)))
+
+		errs := v.ValidateResponse(get, http.StatusOK, echo.MIMEApplicationJSON, []byte(`{"id":"1","name":null}`))
+		assert.Equal(t, []FieldError{
+			{In: "body", Field: "id", Message: "expected integer, got string"},
+			{In: "body", Field: "name", Message: "expected string, got null"},
+		}, errs)
+
+		errs = v.ValidateResponse(get, http.StatusOK, echo.MIMETextPlain, []byte(`ok`))
+		assert.Equal(t, []FieldError{{In: "body", Message: `content type "text/plain" is not documented`}}, errs)
+	})
+}
+
+func TestValidationMiddleware(t *testing.T) {
+	v := NewValidator(widgetDocument())
+	var violations []FieldError
+	e := echo.New()
+	e.Use(v.Middleware(ValidationOptions{
+		Requests:  true,
+		Responses: true,
+		OnViolation: func(c echo.Context, errs []FieldError) {
+			violations = append(violations, errs...)
+		},
+	}))
+	e.POST("/api/v1/widgets", func(c echo.Context) error {
+		var w widget
+		if err := c.Bind(&w); err != nil {
+			return err
+		}
+		return c.JSON(http.StatusCreated, w)
+	})
+	e.GET("/api/v1/widgets/:id", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, map[string]interface{}{"id": c.Param("id")})
+	})
+	e.GET("/internal", func(c echo.Context) error {
+		return c.String(http.StatusOK, "ok")
+	})
+
+	serve := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("不符合文档的请求返回 400", func(t *testing.T) {
+		violations = nil
+		rec := serve(http.MethodPost, "/api/v1/widgets", `{"code":"TOO LONG"}`)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+		var body struct {
+			Error  string       `json:"error"`
+			Fields []FieldError `json:"fields"`
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		assert.Equal(t, "request does not match the API specification", body.Error)
+		assert.Equal(t, []FieldError{{In: "body", Field: "code", Message: "must be at most 3 characters"}}, body.Fields)
+		assert.Empty(t, violations)
+	})
+
+	t.Run("校验后处理器仍可读取请求体", func(t *testing.T) {
+		violations = nil
+		rec := serve(http.MethodPost, "/api/v1/widgets", `{"name":"bolt","code":"B01"}`)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"name":"bolt"`)
+		assert.Empty(t, violations)
+	})
+
+	t.Run("不符合文档的响应只记录", func(t *testing.T) {
+		violations = nil
+		rec := serve(http.MethodGet, "/api/v1/widgets/1", "")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"id":"1"}`, rec.Body.String())
+		assert.Equal(t, []FieldError{{In: "body", Field: "id", Message: "expected integer, got string"}}, violations)
+	})
+
+	t.Run("文档中没有的路由不校验", func(t *testing.T) {
+		violations = nil
+		rec := serve(http.MethodGet, "/internal", "")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Empty(t, violations)
+	})
+}
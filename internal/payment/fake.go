@@ -0,0 +1,85 @@
+package payment
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// DeclinedToken 使用此支付凭证的扣款总是被拒绝，便于测试失败流程
+const DeclinedToken = "tok_declined"
+
+// FakeProvider 进程内模拟支付渠道，不产生真实扣款，用于开发与测试
+type FakeProvider struct {
+	mu      sync.Mutex
+	seq     int
+	charges map[string]*Charge
+	byKey   map[string]string
+}
+
+// NewFakeProvider 创建模拟支付渠道
+func NewFakeProvider() *FakeProvider {
+	return &FakeProvider{
+		charges: make(map[string]*Charge),
+		byKey:   make(map[string]string),
+	}
+}
+
+// Charge 实现 Provider 接口
+func (f *FakeProvider) Charge(ctx context.Context, req ChargeRequest) (*Charge, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if req.Token == DeclinedToken {
+		return nil, ErrDeclined
+	}
+	if req.Amount.IsNegative() || req.Amount.IsZero() {
+		return nil, fmt.Errorf("charge amount must be positive, got %s", req.Amount)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if id, ok := f.byKey[req.IdempotencyKey]; ok && req.IdempotencyKey != "" {
+		charge := *f.charges[id]
+		return &charge, nil
+	}
+	f.seq++
+	charge := &Charge{
+		ID:       fmt.Sprintf("ch_fake_%d", f.seq),
+		Amount:   req.Amount,
+		Currency: req.Currency,
+		Status:   StatusSucceeded,
+	}
+	f.charges[charge.ID] = charge
+	if req.IdempotencyKey != "" {
+		f.byKey[req.IdempotencyKey] = charge.ID
+	}
+	result := *charge
+	return &result, nil
+}
+
+// Refund 实现 Provider 接口，重复退款不报错
+func (f *FakeProvider) Refund(ctx context.Context, chargeID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	charge, ok := f.charges[chargeID]
+	if !ok {
+		return ErrChargeNotFound
+	}
+	charge.Status = StatusRefunded
+	return nil
+}
+
+// Lookup 返回扣款当前状态，供测试断言
+func (f *FakeProvider) Lookup(chargeID string) (Charge, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	charge, ok := f.charges[chargeID]
+	if !ok {
+		return Charge{}, false
+	}
+	return *charge, true
+}
@@ -0,0 +1,56 @@
+package payment
+
+import (
+	"context"
+	"testing"
+
+	"github.com/songfei1983/play-go-api/internal/money"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFakeProvider(t *testing.T) {
+	ctx := context.Background()
+	p := NewFakeProvider()
+	req := ChargeRequest{IdempotencyKey: "order-1", Amount: money.MustParse("12.50"), Currency: "USD"}
+
+	t.Run("幂等扣款", func(t *testing.T) {
+		first, err := p.Charge(ctx, req)
+		require.NoError(t, err)
+		assert.Equal(t, StatusSucceeded, first.Status)
+
+		again, err := p.Charge(ctx, req)
+		require.NoError(t, err)
+		assert.Equal(t, first.ID, again.ID)
+
+		other, err := p.Charge(ctx, ChargeRequest{IdempotencyKey: "order-2", Amount: req.Amount, Currency: "USD"})
+		require.NoError(t, err)
+		assert.NotEqual(t, first.ID, other.ID)
+	})
+
+	t.Run("拒绝支付", func(t *testing.T) {
+		declined := req
+		declined.IdempotencyKey = "order-3"
+		declined.Token = DeclinedToken
+		_, err := p.Charge(ctx, declined)
+		assert.ErrorIs(t, err, ErrDeclined)
+
+		zero := req
+		zero.IdempotencyKey = "order-4"
+		zero.Amount = money.Zero
+		_, err = p.Charge(ctx, zero)
+		assert.Error(t, err)
+	})
+
+	t.Run("退款", func(t *testing.T) {
+		charge, err := p.Charge(ctx, req)
+		require.NoError(t, err)
+		require.NoError(t, p.Refund(ctx, charge.ID))
+		require.NoError(t, p.Refund(ctx, charge.ID))
+
+		got, ok := p.Lookup(charge.ID)
+		require.True(t, ok)
+		assert.Equal(t, StatusRefunded, got.Status)
+		assert.ErrorIs(t, p.Refund(ctx, "ch_missing"), ErrChargeNotFound)
+	})
+}
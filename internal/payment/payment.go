@@ -0,0 +1,46 @@
+// Package payment 提供订单支付的可插拔支付渠道
+package payment
+
+import (
+	"context"
+	"errors"
+
+	"github.com/songfei1983/play-go-api/internal/money"
+)
+
+var (
+	// ErrDeclined 支付被渠道拒绝（余额不足、卡片无效等），调用方应提示用户更换支付方式
+	ErrDeclined = errors.New("payment declined")
+	// ErrChargeNotFound 退款时找不到对应的扣款
+	ErrChargeNotFound = errors.New("charge not found")
+)
+
+// 扣款状态
+const (
+	StatusSucceeded = "succeeded"
+	StatusRefunded  = "refunded"
+)
+
+// ChargeRequest 扣款请求，同一 IdempotencyKey 重复请求只扣款一次
+type ChargeRequest struct {
+	IdempotencyKey string
+	Amount         money.Decimal
+	Currency       string
+	// Token 客户端从支付渠道获取的一次性支付凭证
+	Token       string
+	Description string
+}
+
+// Charge 扣款结果
+type Charge struct {
+	ID       string
+	Amount   money.Decimal
+	Currency string
+	Status   string
+}
+
+// Provider 支付渠道
+type Provider interface {
+	Charge(ctx context.Context, req ChargeRequest) (*Charge, error)
+	Refund(ctx context.Context, chargeID string) error
+}
@@ -0,0 +1,219 @@
+package rpc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	apiv1 "github.com/songfei1983/play-go-api/api/proto/v1"
+	"github.com/songfei1983/play-go-api/internal/handler"
+	"github.com/songfei1983/play-go-api/internal/money"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// pageOf 解析分页参数，page_token 为上一页最后一条记录的 ID
+func pageOf(size int32, token string) (uint, int, error) {
+	limit := int(size)
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+	if token == "" {
+		return 0, limit, nil
+	}
+	after, err := strconv.ParseUint(token, 10, 64)
+	if err != nil {
+		return 0, 0, status.Error(codes.InvalidArgument, "invalid page_token")
+	}
+	return uint(after), limit, nil
+}
+
+// nextPageToken 多查询一条判断是否还有下一页，返回截断后的记录数与下一页令牌
+func nextPageToken(n, limit int, lastID func(i int) uint) (int, string) {
+	if n <= limit {
+		return n, ""
+	}
+	return limit, strconv.FormatUint(uint64(lastID(limit-1)), 10)
+}
+
+// updateBody 把消息中 update_mask 列出的字段转换为与 REST 请求体相同的 JSON 对象，
+// 交给处理器做可写字段检查与校验；未指定 update_mask 时取除 id 外所有非零值字段。
+// model 为由消息转换得到的模型，字段名与 JSON 名称一致
+func updateBody(msg proto.Message, mask *fieldmaskpb.FieldMask, model interface{}) (map[string]json.RawMessage, error) {
+	var paths []string
+	if len(mask.GetPaths()) > 0 {
+		if !mask.IsValid(msg) {
+			return nil, status.Error(codes.InvalidArgument, "update_mask contains unknown fields")
+		}
+		paths = mask.GetPaths()
+	} else {
+		msg.ProtoReflect().Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+			if fd.Name() != "id" {
+				paths = append(paths, string(fd.Name()))
+			}
+			return true
+		})
+	}
+	if len(paths) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "no fields to update")
+	}
+
+	data, err := json.Marshal(model)
+	if err != nil {
+		return nil, err
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+	body := make(map[string]json.RawMessage, len(paths))
+	for _, path := range paths {
+		if v, ok := all[path]; ok {
+			body[path] = v
+		} else {
+			body[path] = json.RawMessage("null")
+		}
+	}
+	return body, nil
+}
+
+// toStatus 将处理器返回的 HTTP 错误与数据库错误转换为 gRPC 状态
+func toStatus(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return status.Error(codes.NotFound, "record not found")
+	}
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		msg := fmt.Sprint(httpErr.Message)
+		if _, ok := httpErr.Message.(string); !ok {
+			if data, err := json.Marshal(httpErr.Message); err == nil {
+				msg = string(data)
+			}
+		}
+		return status.Error(codeOf(httpErr.Code), msg)
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+// codeOf HTTP 状态码对应的 gRPC 状态码
+func codeOf(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity, http.StatusUnsupportedMediaType:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.Aborted
+	case http.StatusPreconditionFailed:
+		return codes.FailedPrecondition
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	default:
+		return codes.Internal
+	}
+}
+
+func timestampOf(t *time.Time) *timestamppb.Timestamp {
+	if t == nil || t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
+
+// userToProto 转换为 gRPC 消息，不包含密码
+func userToProto(u handler.User) *apiv1.User {
+	return &apiv1.User{
+		Id:        uint64(u.ID),
+		Username:  u.Username,
+		Email:     u.Email,
+		FirstName: u.FirstName,
+		LastName:  u.LastName,
+		Phone:     u.Phone,
+		Status:    u.Status,
+		CreatedAt: timestampOf(&u.CreatedAt),
+		UpdatedAt: timestampOf(&u.UpdatedAt),
+		DeletedAt: timestampOf(u.DeletedAt),
+	}
+}
+
+// userFromProto 转换可写字段
+func userFromProto(u *apiv1.User) handler.User {
+	return handler.User{
+		Username:  u.GetUsername(),
+		Email:     u.GetEmail(),
+		FirstName: u.GetFirstName(),
+		LastName:  u.GetLastName(),
+		Phone:     u.GetPhone(),
+		Status:    u.GetStatus(),
+	}
+}
+
+func productToProto(p handler.Product) *apiv1.Product {
+	out := &apiv1.Product{
+		Id:          uint64(p.ID),
+		Name:        p.Name,
+		Description: p.Description,
+		Price:       p.Price.String(),
+		Currency:    p.Currency,
+		Stock:       int64(p.Stock),
+		Status:      p.Status,
+		CreatedAt:   timestampOf(&p.CreatedAt),
+		UpdatedAt:   timestampOf(&p.UpdatedAt),
+		DeletedAt:   timestampOf(p.DeletedAt),
+	}
+	if p.CategoryID != nil {
+		id := uint64(*p.CategoryID)
+		out.CategoryId = &id
+	}
+	return out
+}
+
+// productFromProto 转换可写字段，价格格式错误时返回 InvalidArgument
+func productFromProto(p *apiv1.Product) (handler.Product, error) {
+	out := handler.Product{
+		Name:        p.GetName(),
+		Description: p.GetDescription(),
+		Currency:    p.GetCurrency(),
+		Stock:       int(p.GetStock()),
+		Status:      p.GetStatus(),
+	}
+	if p.GetPrice() != "" {
+		price, err := money.Parse(p.GetPrice())
+		if err != nil {
+			return out, status.Errorf(codes.InvalidArgument, "invalid price: %v", err)
+		}
+		out.Price = price
+	}
+	if p.CategoryId != nil {
+		id := uint(p.GetCategoryId())
+		out.CategoryID = &id
+	}
+	return out, nil
+}
@@ -0,0 +1,165 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/gommon/random"
+	"github.com/songfei1983/play-go-api/internal/handler"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// requestIDHeader 请求 ID 的 metadata 键，与 REST 接口的 X-Request-ID 对应
+const requestIDHeader = "x-request-id"
+
+// publicMethods 不需要 JWT 的方法，对应 REST 的 /api/v1/login 与 /health
+var publicMethods = map[string]bool{
+	"/playapi.v1.UserService/Login": true,
+	"/grpc.health.v1.Health/Check":  true,
+	"/grpc.health.v1.Health/List":   true,
+}
+
+// metadataCarrier 让 OTel 传播器读取 gRPC metadata 中的 traceparent 等字段
+type metadataCarrier metadata.MD
+
+func (m metadataCarrier) Get(key string) string {
+	if v := metadata.MD(m).Get(key); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+func (m metadataCarrier) Set(key, value string) {
+	metadata.MD(m).Set(key, value)
+}
+
+func (m metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// tracing 为每个调用创建服务端 span，延续客户端传入的 trace 上下文
+func tracing() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, next grpc.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		ctx = otel.GetTextMapPropagator().Extract(ctx, metadataCarrier(md))
+
+		service, method := splitMethod(info.FullMethod)
+		tracer := otel.Tracer("api-service")
+		ctx, span := tracer.Start(ctx, service+"/"+method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.RPCSystemGRPC, semconv.RPCService(service), semconv.RPCMethod(method)),
+		)
+		defer span.End()
+
+		resp, err := next(ctx, req)
+		st := status.Convert(err)
+		span.SetAttributes(semconv.RPCGRPCStatusCodeKey.Int(int(st.Code())))
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(otelcodes.Error, st.Message())
+		}
+		return resp, err
+	}
+}
+
+// splitMethod 将 /package.Service/Method 拆分为服务名与方法名
+func splitMethod(fullMethod string) (string, string) {
+	service, method, _ := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+	return service, method
+}
+
+// claimsKey JWT claims 在 context 中的键
+type claimsKey struct{}
+
+// authenticate 校验 metadata authorization 中的 Bearer 令牌，与 REST 接口使用同一密钥
+func authenticate(signingKey []byte) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, next grpc.UnaryHandler) (interface{}, error) {
+		if publicMethods[info.FullMethod] {
+			return next(ctx, req)
+		}
+		md, _ := metadata.FromIncomingContext(ctx)
+		values := md.Get("authorization")
+		if len(values) == 0 {
+			return nil, status.Error(codes.Unauthenticated, "missing bearer token")
+		}
+		raw, ok := strings.CutPrefix(values[0], "Bearer ")
+		if !ok {
+			return nil, status.Error(codes.Unauthenticated, "authorization must be a bearer token")
+		}
+		token, err := jwt.Parse(raw, func(*jwt.Token) (interface{}, error) {
+			return signingKey, nil
+		}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+		if err != nil || !token.Valid {
+			return nil, status.Error(codes.Unauthenticated, "invalid or expired token")
+		}
+		return next(context.WithValue(ctx, claimsKey{}, token.Claims.(jwt.MapClaims)), req)
+	}
+}
+
+// requestInfo 写入操作者、客户端 IP 与请求 ID，变更历史、审计与 outbox 事件据此记录来源；
+// 客户端未传 x-request-id 时生成一个，并在响应头中返回
+func requestInfo() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, next grpc.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		requestID := ""
+		if v := md.Get(requestIDHeader); len(v) > 0 {
+			requestID = v[0]
+		}
+		if requestID == "" {
+			requestID = random.String(32)
+		}
+		grpc.SetHeader(ctx, metadata.Pairs(requestIDHeader, requestID)) // nolint: errcheck
+		trace.SpanFromContext(ctx).SetAttributes(attribute.String("Request-ID", requestID))
+
+		ip := ""
+		if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+			ip = p.Addr.String()
+			if host, _, err := net.SplitHostPort(ip); err == nil {
+				ip = host
+			}
+		}
+		ctx = handler.WithRequestInfo(ctx, currentActor(ctx), ip, requestID)
+		return next(ctx, req)
+	}
+}
+
+// currentActor 返回 JWT 中的用户名，未认证时返回 "anonymous"，与 REST 接口一致
+func currentActor(ctx context.Context) string {
+	claims, ok := ctx.Value(claimsKey{}).(jwt.MapClaims)
+	if !ok {
+		return "anonymous"
+	}
+	if name, ok := claims["username"].(string); ok && name != "" {
+		return name
+	}
+	if id, ok := claims["user_id"].(float64); ok {
+		return fmt.Sprintf("user:%d", uint(id))
+	}
+	return "anonymous"
+}
+
+// currentUserID 返回 JWT 中的用户 ID
+func currentUserID(ctx context.Context) (uint, error) {
+	if claims, ok := ctx.Value(claimsKey{}).(jwt.MapClaims); ok {
+		if id, ok := claims["user_id"].(float64); ok && id > 0 {
+			return uint(id), nil
+		}
+	}
+	return 0, status.Error(codes.Unauthenticated, "authentication required")
+}
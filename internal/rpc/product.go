@@ -0,0 +1,98 @@
+package rpc
+
+import (
+	"context"
+
+	apiv1 "github.com/songfei1983/play-go-api/api/proto/v1"
+	"github.com/songfei1983/play-go-api/internal/handler"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// productService 实现 ProductService，业务逻辑由 ProductHandler 提供
+type productService struct {
+	apiv1.UnimplementedProductServiceServer
+	products *handler.ProductHandler
+}
+
+func (s *productService) CreateProduct(ctx context.Context, req *apiv1.CreateProductRequest) (*apiv1.Product, error) {
+	if req.GetProduct() == nil {
+		return nil, status.Error(codes.InvalidArgument, "product is required")
+	}
+	product, err := productFromProto(req.GetProduct())
+	if err != nil {
+		return nil, err
+	}
+	if err := s.products.CreateRecord(ctx, &product); err != nil {
+		return nil, toStatus(err)
+	}
+	return productToProto(product), nil
+}
+
+func (s *productService) GetProduct(ctx context.Context, req *apiv1.GetProductRequest) (*apiv1.Product, error) {
+	if req.GetId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+	product, err := s.products.FindRecord(ctx, uint(req.GetId()))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return productToProto(product), nil
+}
+
+func (s *productService) ListProducts(ctx context.Context, req *apiv1.ListProductsRequest) (*apiv1.ListProductsResponse, error) {
+	after, limit, err := pageOf(req.GetPageSize(), req.GetPageToken())
+	if err != nil {
+		return nil, err
+	}
+	products, err := s.products.Page(ctx, after, limit+1, req.GetIncludeDeleted())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	n, next := nextPageToken(len(products), limit, func(i int) uint { return products[i].ID })
+	resp := &apiv1.ListProductsResponse{Products: make([]*apiv1.Product, n), NextPageToken: next}
+	for i := range resp.Products {
+		resp.Products[i] = productToProto(products[i])
+	}
+	return resp, nil
+}
+
+func (s *productService) UpdateProduct(ctx context.Context, req *apiv1.UpdateProductRequest) (*apiv1.Product, error) {
+	if req.GetProduct().GetId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "product.id is required")
+	}
+	model, err := productFromProto(req.GetProduct())
+	if err != nil {
+		return nil, err
+	}
+	body, err := updateBody(req.GetProduct(), req.GetUpdateMask(), model)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	product, err := s.products.UpdateRecord(ctx, uint(req.GetProduct().GetId()), body, false)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return productToProto(product), nil
+}
+
+func (s *productService) DeleteProduct(ctx context.Context, req *apiv1.DeleteProductRequest) (*emptypb.Empty, error) {
+	if req.GetId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+	if err := s.products.DeleteRecord(ctx, uint(req.GetId())); err != nil {
+		return nil, toStatus(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *productService) RestoreProduct(ctx context.Context, req *apiv1.RestoreProductRequest) (*emptypb.Empty, error) {
+	if req.GetId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+	if err := s.products.RestoreRecord(ctx, uint(req.GetId())); err != nil {
+		return nil, toStatus(err)
+	}
+	return &emptypb.Empty{}, nil
+}
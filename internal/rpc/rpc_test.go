@@ -0,0 +1,289 @@
+package rpc
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-redis/redismock/v8"
+	"github.com/golang-jwt/jwt/v5"
+	apiv1 "github.com/songfei1983/play-go-api/api/proto/v1"
+	"github.com/songfei1983/play-go-api/internal/handler"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+var testKey = []byte("test-key")
+
+// setupRPCTest 启动使用 sqlmock 与 redismock 的 gRPC 服务，返回客户端连接
+func setupRPCTest(t *testing.T) (*grpc.ClientConn, sqlmock.Sqlmock, redismock.ClientMock) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	gormDB, err := gorm.Open(mysql.New(mysql.Config{
+		Conn:                      db,
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{})
+	require.NoError(t, err)
+	redisClient, redisMock := redismock.NewClientMock()
+
+	srv := NewServer(handler.NewUserHandler(gormDB, redisClient), handler.NewProductHandler(gormDB, redisClient), testKey, handler.NewAdmins([]uint{2}))
+	lis := bufconn.Listen(1 << 20)
+	go srv.Serve(lis) // nolint: errcheck
+	t.Cleanup(func() { srv.Shutdown(context.Background()) })
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn, mock, redisMock
+}
+
+// authorized 返回携带 alice 令牌的 context
+func authorized(t *testing.T) context.Context {
+	return authorizedAs(t, 1, "alice")
+}
+
+// authorizedAs 返回携带指定用户令牌的 context
+func authorizedAs(t *testing.T, id uint, username string) context.Context {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id":  id,
+		"username": username,
+		"exp":      time.Now().Add(time.Hour).Unix(),
+	}).SignedString(testKey)
+	require.NoError(t, err)
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+}
+
+func TestUserService(t *testing.T) {
+	conn, mock, redisMock := setupRPCTest(t)
+	client := apiv1.NewUserServiceClient(conn)
+
+	expectUser := func() {
+		mock.ExpectQuery("SELECT \\* FROM `users` WHERE username = \\? ORDER BY `users`\\.`id` LIMIT \\?").
+			WithArgs("alice", 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password"}).AddRow(1, "alice", "secret"))
+	}
+
+	t.Run("登录签发的令牌可用于 REST 与 gRPC", func(t *testing.T) {
+		expectUser()
+		resp, err := client.Login(context.Background(), &apiv1.LoginRequest{Username: "alice", Password: "secret"})
+		require.NoError(t, err)
+
+		token, err := jwt.Parse(resp.Token, func(*jwt.Token) (interface{}, error) { return []byte("your-secret-key"), nil })
+		require.NoError(t, err)
+		assert.Equal(t, "alice", token.Claims.(jwt.MapClaims)["username"])
+	})
+
+	t.Run("密码错误", func(t *testing.T) {
+		expectUser()
+		_, err := client.Login(context.Background(), &apiv1.LoginRequest{Username: "alice", Password: "wrong"})
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	})
+
+	t.Run("未携带令牌", func(t *testing.T) {
+		_, err := client.GetUser(context.Background(), &apiv1.GetUserRequest{Id: 1})
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	})
+
+	t.Run("令牌签名无效", func(t *testing.T) {
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer not-a-token")
+		_, err := client.GetUser(ctx, &apiv1.GetUserRequest{Id: 1})
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	})
+
+	t.Run("只有管理员可以列出用户", func(t *testing.T) {
+		_, err := client.ListUsers(authorized(t), &apiv1.ListUsersRequest{})
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+		mock.ExpectQuery("SELECT \\* FROM `users` WHERE deleted_at IS NULL ORDER BY id LIMIT \\?").
+			WithArgs(sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "username"}).AddRow(1, "alice").AddRow(2, "root"))
+		resp, err := client.ListUsers(authorizedAs(t, 2, "root"), &apiv1.ListUsersRequest{})
+		require.NoError(t, err)
+		assert.Len(t, resp.Users, 2)
+	})
+
+	t.Run("只有本人或管理员可以修改与删除用户", func(t *testing.T) {
+		_, err := client.UpdateUser(authorized(t), &apiv1.UpdateUserRequest{
+			User:       &apiv1.User{Id: 3, Email: "mallory@example.com"},
+			UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"email"}},
+		})
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+		_, err = client.DeleteUser(authorized(t), &apiv1.DeleteUserRequest{Id: 3})
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE `users` SET `deleted_at`=\\?,`updated_at`=\\? WHERE id = \\? AND deleted_at IS NULL").
+			WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), 3).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		redisMock.ExpectDel("user:3").SetVal(1)
+		_, err = client.DeleteUser(authorizedAs(t, 2, "root"), &apiv1.DeleteUserRequest{Id: 3})
+		assert.NoError(t, err)
+	})
+
+	t.Run("用户本人不能修改状态", func(t *testing.T) {
+		mock.ExpectQuery("SELECT \\* FROM `users` WHERE deleted_at IS NULL AND `users`\\.`id` = \\? ORDER BY `users`\\.`id` LIMIT \\?").
+			WithArgs(1, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "email", "status"}).AddRow(1, "alice", "secret", "alice@example.com", "active"))
+
+		_, err := client.UpdateUser(authorized(t), &apiv1.UpdateUserRequest{
+			User:       &apiv1.User{Id: 1, Status: "inactive"},
+			UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"status"}},
+		})
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	})
+
+	t.Run("只有管理员可以恢复用户", func(t *testing.T) {
+		_, err := client.RestoreUser(authorized(t), &apiv1.RestoreUserRequest{Id: 1})
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	})
+
+	t.Run("恢复未删除的用户", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE `users` SET `deleted_at`=\\?,`updated_at`=\\? WHERE id = \\? AND deleted_at IS NOT NULL").
+			WithArgs(nil, sqlmock.AnyArg(), 1).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		_, err := client.RestoreUser(authorizedAs(t, 2, "root"), &apiv1.RestoreUserRequest{Id: 1})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	})
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.NoError(t, redisMock.ExpectationsWereMet())
+}
+
+func TestProductService(t *testing.T) {
+	conn, mock, redisMock := setupRPCTest(t)
+	client := apiv1.NewProductServiceClient(conn)
+	ctx := authorized(t)
+
+	productRows := func(ids ...int) *sqlmock.Rows {
+		rows := sqlmock.NewRows([]string{"id", "name", "price", "currency", "stock", "status"})
+		for _, id := range ids {
+			rows.AddRow(id, "Mug", "9.99", "USD", 5, "active")
+		}
+		return rows
+	}
+
+	t.Run("读取产品并返回请求 ID", func(t *testing.T) {
+		redisMock.ExpectGet("products:1").RedisNil()
+		mock.ExpectQuery("SELECT \\* FROM `products` WHERE deleted_at IS NULL AND `products`\\.`id` = \\? ORDER BY `products`\\.`id` LIMIT \\?").
+			WithArgs(1, 1).
+			WillReturnRows(productRows(1))
+		redisMock.Regexp().ExpectSet("products:1", `"name":"Mug"`, time.Hour).SetVal("OK")
+
+		var header metadata.MD
+		product, err := client.GetProduct(ctx, &apiv1.GetProductRequest{Id: 1}, grpc.Header(&header))
+		require.NoError(t, err)
+		assert.Equal(t, "Mug", product.Name)
+		assert.Equal(t, "9.99", product.Price)
+		assert.Equal(t, int64(5), product.Stock)
+		assert.Nil(t, product.CategoryId)
+		assert.Len(t, header.Get(requestIDHeader), 1)
+	})
+
+	t.Run("产品不存在", func(t *testing.T) {
+		redisMock.ExpectGet("products:2").RedisNil()
+		mock.ExpectQuery("SELECT \\* FROM `products` WHERE deleted_at IS NULL AND `products`\\.`id` = \\? ORDER BY `products`\\.`id` LIMIT \\?").
+			WithArgs(2, 1).
+			WillReturnError(gorm.ErrRecordNotFound)
+
+		_, err := client.GetProduct(ctx, &apiv1.GetProductRequest{Id: 2})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	})
+
+	t.Run("按 update_mask 更新", func(t *testing.T) {
+		mock.ExpectQuery("SELECT \\* FROM `products` WHERE deleted_at IS NULL AND `products`\\.`id` = \\? ORDER BY `products`\\.`id` LIMIT \\?").
+			WithArgs(1, 1).
+			WillReturnRows(productRows(1))
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE `products` SET `status`=\\?,`updated_at`=\\? WHERE `id` = \\?").
+			WithArgs("inactive", sqlmock.AnyArg(), 1).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		redisMock.ExpectDel("products:1").SetVal(1)
+
+		product, err := client.UpdateProduct(ctx, &apiv1.UpdateProductRequest{
+			Product:    &apiv1.Product{Id: 1, Name: "ignored", Status: "inactive"},
+			UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"status"}},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "inactive", product.Status)
+		assert.Equal(t, "Mug", product.Name)
+	})
+
+	t.Run("拒绝只读字段与未知字段", func(t *testing.T) {
+		mock.ExpectQuery("SELECT \\* FROM `products` WHERE deleted_at IS NULL AND `products`\\.`id` = \\? ORDER BY `products`\\.`id` LIMIT \\?").
+			WithArgs(1, 1).
+			WillReturnRows(productRows(1))
+		_, err := client.UpdateProduct(ctx, &apiv1.UpdateProductRequest{
+			Product:    &apiv1.Product{Id: 1},
+			UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"created_at"}},
+		})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		assert.Contains(t, status.Convert(err).Message(), "readonly_fields")
+
+		mock.ExpectQuery("SELECT \\* FROM `products` WHERE deleted_at IS NULL AND `products`\\.`id` = \\? ORDER BY `products`\\.`id` LIMIT \\?").
+			WithArgs(1, 1).
+			WillReturnRows(productRows(1))
+		_, err = client.UpdateProduct(ctx, &apiv1.UpdateProductRequest{
+			Product:    &apiv1.Product{Id: 1, Stock: 7},
+			UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"stock"}},
+		})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		assert.Contains(t, status.Convert(err).Message(), "readonly_fields")
+
+		_, err = client.UpdateProduct(ctx, &apiv1.UpdateProductRequest{
+			Product:    &apiv1.Product{Id: 1},
+			UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"password"}},
+		})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("分页", func(t *testing.T) {
+		mock.ExpectQuery("SELECT \\* FROM `products` WHERE deleted_at IS NULL ORDER BY id LIMIT \\?").
+			WithArgs(3).
+			WillReturnRows(productRows(1, 2, 3))
+		resp, err := client.ListProducts(ctx, &apiv1.ListProductsRequest{PageSize: 2})
+		require.NoError(t, err)
+		assert.Len(t, resp.Products, 2)
+		assert.Equal(t, "2", resp.NextPageToken)
+
+		mock.ExpectQuery("SELECT \\* FROM `products` WHERE deleted_at IS NULL AND id > \\? ORDER BY id LIMIT \\?").
+			WithArgs(2, 3).
+			WillReturnRows(productRows(3))
+		resp, err = client.ListProducts(ctx, &apiv1.ListProductsRequest{PageSize: 2, PageToken: resp.NextPageToken})
+		require.NoError(t, err)
+		assert.Len(t, resp.Products, 1)
+		assert.Empty(t, resp.NextPageToken)
+
+		_, err = client.ListProducts(ctx, &apiv1.ListProductsRequest{PageToken: "abc"})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("健康检查无需令牌", func(t *testing.T) {
+		resp, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{Service: "playapi.v1.ProductService"})
+		require.NoError(t, err)
+		assert.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.Status)
+	})
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.NoError(t, redisMock.ExpectationsWereMet())
+}
@@ -0,0 +1,60 @@
+package rpc
+
+import (
+	"context"
+	"net"
+
+	apiv1 "github.com/songfei1983/play-go-api/api/proto/v1"
+	"github.com/songfei1983/play-go-api/internal/handler"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Server gRPC 服务，与 REST 接口使用同一组处理器，变更回调、审计与事件发布保持一致
+type Server struct {
+	grpc   *grpc.Server
+	health *health.Server
+}
+
+// NewServer 创建 gRPC 服务并注册用户、产品与健康检查服务，signingKey 与 REST 接口的 JWT 密钥相同，
+// admins 为管理员，与 REST、GraphQL 接口一致
+func NewServer(users *handler.UserHandler, products *handler.ProductHandler, signingKey []byte, admins handler.Admins) *Server {
+	s := &Server{
+		grpc: grpc.NewServer(grpc.ChainUnaryInterceptor(
+			tracing(),
+			authenticate(signingKey),
+			requestInfo(),
+		)),
+		health: health.NewServer(),
+	}
+	apiv1.RegisterUserServiceServer(s.grpc, &userService{users: users, admins: admins})
+	apiv1.RegisterProductServiceServer(s.grpc, &productService{products: products})
+	healthpb.RegisterHealthServer(s.grpc, s.health)
+
+	for _, name := range []string{"", apiv1.UserService_ServiceDesc.ServiceName, apiv1.ProductService_ServiceDesc.ServiceName} {
+		s.health.SetServingStatus(name, healthpb.HealthCheckResponse_SERVING)
+	}
+	return s
+}
+
+// Serve 在 lis 上处理请求，直到 Shutdown
+func (s *Server) Serve(lis net.Listener) error {
+	return s.grpc.Serve(lis)
+}
+
+// Shutdown 将健康状态置为 NOT_SERVING 并等待进行中的请求结束，ctx 到期后强制关闭连接
+func (s *Server) Shutdown(ctx context.Context) {
+	s.health.Shutdown()
+
+	done := make(chan struct{})
+	go func() {
+		s.grpc.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		s.grpc.Stop()
+	}
+}
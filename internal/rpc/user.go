@@ -0,0 +1,135 @@
+package rpc
+
+import (
+	"context"
+
+	apiv1 "github.com/songfei1983/play-go-api/api/proto/v1"
+	"github.com/songfei1983/play-go-api/internal/handler"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// userService 实现 UserService，业务逻辑由 UserHandler 提供
+type userService struct {
+	apiv1.UnimplementedUserServiceServer
+	users  *handler.UserHandler
+	admins handler.Admins
+}
+
+func (s *userService) Login(ctx context.Context, req *apiv1.LoginRequest) (*apiv1.LoginResponse, error) {
+	if req.GetUsername() == "" || req.GetPassword() == "" {
+		return nil, status.Error(codes.InvalidArgument, "username and password are required")
+	}
+	token, err := s.users.Authenticate(ctx, req.GetUsername(), req.GetPassword())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &apiv1.LoginResponse{Token: token}, nil
+}
+
+func (s *userService) GetCurrentUser(ctx context.Context, _ *emptypb.Empty) (*apiv1.User, error) {
+	id, err := currentUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.users.FindUser(ctx, id)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return userToProto(user), nil
+}
+
+func (s *userService) GetUser(ctx context.Context, req *apiv1.GetUserRequest) (*apiv1.User, error) {
+	if req.GetId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+	user, err := s.users.FindUser(ctx, uint(req.GetId()))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return userToProto(user), nil
+}
+
+func (s *userService) ListUsers(ctx context.Context, req *apiv1.ListUsersRequest) (*apiv1.ListUsersResponse, error) {
+	if !s.isAdmin(ctx) {
+		return nil, status.Error(codes.PermissionDenied, "listing users is restricted to administrators")
+	}
+	after, limit, err := pageOf(req.GetPageSize(), req.GetPageToken())
+	if err != nil {
+		return nil, err
+	}
+	users, err := s.users.Page(ctx, after, limit+1, req.GetIncludeDeleted())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	n, next := nextPageToken(len(users), limit, func(i int) uint { return users[i].ID })
+	resp := &apiv1.ListUsersResponse{Users: make([]*apiv1.User, n), NextPageToken: next}
+	for i := range resp.Users {
+		resp.Users[i] = userToProto(users[i])
+	}
+	return resp, nil
+}
+
+func (s *userService) UpdateUser(ctx context.Context, req *apiv1.UpdateUserRequest) (*apiv1.User, error) {
+	if req.GetUser().GetId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "user.id is required")
+	}
+	if err := s.selfOrAdmin(ctx, req.GetUser().GetId()); err != nil {
+		return nil, err
+	}
+	model := userFromProto(req.GetUser())
+	body, err := updateBody(req.GetUser(), req.GetUpdateMask(), model)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	user, err := s.users.UpdateUserFields(ctx, uint(req.GetUser().GetId()), body, false, s.isAdmin(ctx))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return userToProto(user), nil
+}
+
+func (s *userService) DeleteUser(ctx context.Context, req *apiv1.DeleteUserRequest) (*emptypb.Empty, error) {
+	if req.GetId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+	if err := s.selfOrAdmin(ctx, req.GetId()); err != nil {
+		return nil, err
+	}
+	if err := s.users.DeleteUser(ctx, uint(req.GetId())); err != nil {
+		return nil, toStatus(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *userService) RestoreUser(ctx context.Context, req *apiv1.RestoreUserRequest) (*emptypb.Empty, error) {
+	if req.GetId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+	if !s.isAdmin(ctx) {
+		return nil, status.Error(codes.PermissionDenied, "restoring users is restricted to administrators")
+	}
+	if err := s.users.RestoreRecord(ctx, uint(req.GetId())); err != nil {
+		return nil, toStatus(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// isAdmin 判断当前调用的 JWT 用户是否为管理员
+func (s *userService) isAdmin(ctx context.Context) bool {
+	id, err := currentUserID(ctx)
+	return err == nil && s.admins.Has(id)
+}
+
+// selfOrAdmin 只允许用户本人或管理员操作指定用户
+func (s *userService) selfOrAdmin(ctx context.Context, userID uint64) error {
+	id, err := currentUserID(ctx)
+	if err != nil {
+		return err
+	}
+	if uint64(id) != userID && !s.admins.Has(id) {
+		return status.Error(codes.PermissionDenied, "you can only modify your own account")
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+package search
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+)
+
+const (
+	bm25K1    = 1.2
+	bm25B     = 0.75
+	nameBoost = 2.0
+)
+
+// posting 词在文档名称与描述中的出现次数
+type posting struct {
+	name, description int
+}
+
+// MemoryBackend 进程内倒排索引，使用 BM25 排序，支持纠错、高亮与分面
+type MemoryBackend struct {
+	mu       sync.RWMutex
+	docs     map[uint]Document
+	lengths  map[uint]posting
+	postings map[string]map[uint]posting
+	total    posting
+}
+
+// NewMemoryBackend 创建空的进程内索引
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{
+		docs:     make(map[uint]Document),
+		lengths:  make(map[uint]posting),
+		postings: make(map[string]map[uint]posting),
+	}
+}
+
+// Index 添加或替换文档
+func (m *MemoryBackend) Index(_ context.Context, docs ...Document) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, doc := range docs {
+		m.remove(doc.ID)
+
+		freq := make(map[string]posting)
+		var length posting
+		for _, t := range tokenize(doc.Name) {
+			p := freq[t.term]
+			p.name++
+			freq[t.term] = p
+			length.name++
+		}
+		for _, t := range tokenize(doc.Description) {
+			p := freq[t.term]
+			p.description++
+			freq[t.term] = p
+			length.description++
+		}
+		for term, p := range freq {
+			if m.postings[term] == nil {
+				m.postings[term] = make(map[uint]posting)
+			}
+			m.postings[term][doc.ID] = p
+		}
+		m.docs[doc.ID] = doc
+		m.lengths[doc.ID] = length
+		m.total.name += length.name
+		m.total.description += length.description
+	}
+	return nil
+}
+
+// Delete 移除文档，不存在的文档被忽略
+func (m *MemoryBackend) Delete(_ context.Context, ids ...uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, id := range ids {
+		m.remove(id)
+	}
+	return nil
+}
+
+func (m *MemoryBackend) remove(id uint) {
+	doc, ok := m.docs[id]
+	if !ok {
+		return
+	}
+	for _, term := range append(terms(doc.Name), terms(doc.Description)...) {
+		delete(m.postings[term], id)
+		if len(m.postings[term]) == 0 {
+			delete(m.postings, term)
+		}
+	}
+	length := m.lengths[id]
+	m.total.name -= length.name
+	m.total.description -= length.description
+	delete(m.docs, id)
+	delete(m.lengths, id)
+}
+
+// Search 按 BM25 相关度检索，查询词之间为 OR 关系
+func (m *MemoryBackend) Search(_ context.Context, q Query) (*Result, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	scores := make(map[uint]float64)
+	matched := make(map[uint]map[string]bool)
+	n := float64(len(m.docs))
+	for _, qt := range terms(q.Text) {
+		best := make(map[uint]float64)
+		for term, weight := range m.expand(qt, q.Fuzzy) {
+			list := m.postings[term]
+			idf := math.Log(1 + (n-float64(len(list))+0.5)/(float64(len(list))+0.5))
+			for id, p := range list {
+				length := m.lengths[id]
+				score := weight * idf * (nameBoost*bm25(p.name, length.name, m.total.name, n) +
+					bm25(p.description, length.description, m.total.description, n))
+				if score > best[id] {
+					best[id] = score
+				}
+				if matched[id] == nil {
+					matched[id] = make(map[string]bool)
+				}
+				matched[id][term] = true
+			}
+		}
+		for id, score := range best {
+			scores[id] += score
+		}
+	}
+
+	result := &Result{Hits: []Hit{}, Facets: Facets{Status: []FacetBucket{}, Price: make([]FacetBucket, len(PriceRanges))}}
+	for i, r := range PriceRanges {
+		result.Facets.Price[i].Key = r.Key()
+	}
+	status := make(map[string]int)
+	var ids []uint
+	for id := range scores {
+		doc := m.docs[id]
+		status[doc.Status]++
+		for i, r := range PriceRanges {
+			if r.Contains(doc.Price) {
+				result.Facets.Price[i].Count++
+			}
+		}
+		if q.matchFilters(doc) {
+			ids = append(ids, id)
+		}
+	}
+	result.Facets.Status = statusBuckets(status)
+
+	sort.Slice(ids, func(i, j int) bool {
+		if scores[ids[i]] != scores[ids[j]] {
+			return scores[ids[i]] > scores[ids[j]]
+		}
+		return ids[i] < ids[j]
+	})
+	result.Total = len(ids)
+	start := min(max(q.Offset, 0), len(ids))
+	end := len(ids)
+	if q.Limit > 0 {
+		end = min(start+q.Limit, len(ids))
+	}
+	for _, id := range ids[start:end] {
+		result.Hits = append(result.Hits, Hit{
+			ID:         id,
+			Score:      scores[id],
+			Highlights: highlights(m.docs[id], matched[id]),
+		})
+	}
+	return result, nil
+}
+
+// expand 返回查询词对应的索引词及权重，纠错匹配按编辑距离降低权重
+func (m *MemoryBackend) expand(term string, fuzzy bool) map[string]float64 {
+	out := make(map[string]float64)
+	if _, ok := m.postings[term]; ok {
+		out[term] = 1
+	}
+	if !fuzzy {
+		return out
+	}
+	limit := maxEdits(term)
+	if limit == 0 {
+		return out
+	}
+	for candidate := range m.postings {
+		if candidate == term {
+			continue
+		}
+		if d := editDistance(term, candidate, limit); d <= limit {
+			out[candidate] = 1 / float64(1+d)
+		}
+	}
+	return out
+}
+
+// bm25 计算单个字段的词频得分（不含 IDF）
+func bm25(tf, length, total int, n float64) float64 {
+	if tf == 0 {
+		return 0
+	}
+	avg := float64(total) / n
+	if avg == 0 {
+		avg = 1
+	}
+	f := float64(tf)
+	return f * (bm25K1 + 1) / (f + bm25K1*(1-bm25B+bm25B*float64(length)/avg))
+}
+
+// statusBuckets 按数量降序、键升序输出状态分面
+func statusBuckets(counts map[string]int) []FacetBucket {
+	buckets := make([]FacetBucket, 0, len(counts))
+	for key, count := range counts {
+		buckets = append(buckets, FacetBucket{Key: key, Count: count})
+	}
+	sort.Slice(buckets, func(i, j int) bool {
+		if buckets[i].Count != buckets[j].Count {
+			return buckets[i].Count > buckets[j].Count
+		}
+		return buckets[i].Key < buckets[j].Key
+	})
+	return buckets
+}
@@ -0,0 +1,115 @@
+package search
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestIndex(t *testing.T) *MemoryBackend {
+	idx := NewMemoryBackend()
+	require.NoError(t, idx.Index(context.Background(),
+		Document{ID: 1, Name: "Wireless Keyboard", Description: "Compact keyboard with bluetooth", Status: "active", Price: 45},
+		Document{ID: 2, Name: "Mechanical Keyboard", Description: "RGB backlight", Status: "active", Price: 120},
+		Document{ID: 3, Name: "Mouse Pad", Description: "Large pad for keyboard and mouse", Status: "inactive", Price: 15},
+		Document{ID: 4, Name: "无线鼠标", Description: "静音按键", Status: "active", Price: 80},
+	))
+	return idx
+}
+
+func TestMemorySearch(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("名称匹配排在描述匹配之前", func(t *testing.T) {
+		res, err := newTestIndex(t).Search(ctx, Query{Text: "keyboard"})
+		require.NoError(t, err)
+		require.Equal(t, 3, res.Total)
+		assert.Equal(t, uint(3), res.Hits[2].ID)
+		assert.Greater(t, res.Hits[0].Score, res.Hits[2].Score)
+	})
+
+	t.Run("高亮匹配词", func(t *testing.T) {
+		res, err := newTestIndex(t).Search(ctx, Query{Text: "bluetooth"})
+		require.NoError(t, err)
+		require.Len(t, res.Hits, 1)
+		assert.Equal(t, []string{"Compact keyboard with <em>bluetooth</em>"}, res.Hits[0].Highlights["description"])
+		assert.NotContains(t, res.Hits[0].Highlights, "name")
+	})
+
+	t.Run("中文逐字匹配", func(t *testing.T) {
+		res, err := newTestIndex(t).Search(ctx, Query{Text: "鼠标"})
+		require.NoError(t, err)
+		require.Len(t, res.Hits, 1)
+		assert.Equal(t, []string{"无线<em>鼠</em><em>标</em>"}, res.Hits[0].Highlights["name"])
+	})
+
+	t.Run("拼写纠错", func(t *testing.T) {
+		idx := newTestIndex(t)
+		res, err := idx.Search(ctx, Query{Text: "keybaord"})
+		require.NoError(t, err)
+		assert.Equal(t, 0, res.Total)
+
+		res, err = idx.Search(ctx, Query{Text: "keybaord", Fuzzy: true})
+		require.NoError(t, err)
+		assert.Equal(t, 3, res.Total)
+		assert.Equal(t, []string{"Wireless <em>Keyboard</em>"}, res.Hits[0].Highlights["name"])
+	})
+
+	t.Run("过滤与分面", func(t *testing.T) {
+		maxPrice := 100.0
+		res, err := newTestIndex(t).Search(ctx, Query{Text: "keyboard", Status: "active", MaxPrice: &maxPrice})
+		require.NoError(t, err)
+		require.Equal(t, 1, res.Total)
+		assert.Equal(t, uint(1), res.Hits[0].ID)
+
+		// 分面基于未过滤的匹配集合
+		assert.Equal(t, []FacetBucket{{Key: "active", Count: 2}, {Key: "inactive", Count: 1}}, res.Facets.Status)
+		assert.Equal(t, []FacetBucket{
+			{Key: "0-50", Count: 2},
+			{Key: "50-100", Count: 0},
+			{Key: "100-500", Count: 1},
+			{Key: "500+", Count: 0},
+		}, res.Facets.Price)
+	})
+
+	t.Run("分页", func(t *testing.T) {
+		res, err := newTestIndex(t).Search(ctx, Query{Text: "keyboard", Offset: 2, Limit: 2})
+		require.NoError(t, err)
+		assert.Equal(t, 3, res.Total)
+		require.Len(t, res.Hits, 1)
+		assert.Equal(t, uint(3), res.Hits[0].ID)
+	})
+
+	t.Run("更新与删除同步索引", func(t *testing.T) {
+		idx := newTestIndex(t)
+		require.NoError(t, idx.Index(ctx, Document{ID: 1, Name: "Wireless Trackpad", Status: "active", Price: 60}))
+		require.NoError(t, idx.Delete(ctx, 2))
+
+		res, err := idx.Search(ctx, Query{Text: "keyboard"})
+		require.NoError(t, err)
+		require.Equal(t, 1, res.Total)
+		assert.Equal(t, uint(3), res.Hits[0].ID)
+
+		res, err = idx.Search(ctx, Query{Text: "trackpad"})
+		require.NoError(t, err)
+		assert.Equal(t, 1, res.Total)
+	})
+}
+
+func TestEditDistance(t *testing.T) {
+	assert.Equal(t, 0, editDistance("keyboard", "keyboard", 2))
+	assert.Equal(t, 2, editDistance("keybaord", "keyboard", 2))
+	assert.Equal(t, 1, editDistance("mouse", "mose", 1))
+	assert.Equal(t, 2, editDistance("mouse", "pad", 1))
+}
+
+func TestHighlightSnippet(t *testing.T) {
+	text := strings.Repeat("lorem ", 40) + "target " + strings.Repeat("ipsum ", 40)
+	s := highlight(text, map[string]bool{"target": true}, true)
+	assert.Contains(t, s, "<em>target</em>")
+	assert.True(t, len([]rune(s)) < len([]rune(text)))
+	assert.Equal(t, "…", string([]rune(s)[0]))
+}
@@ -0,0 +1,153 @@
+package search
+
+import (
+	"context"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// MySQLBackend 基于 InnoDB FULLTEXT 索引 (name, description) 的检索后端。
+// 索引由数据库维护，因此不实现 Indexer。MySQL 不支持编辑距离匹配，
+// Fuzzy 时退化为布尔模式下的前缀匹配
+type MySQLBackend struct {
+	db    *gorm.DB
+	table string
+}
+
+// NewMySQLBackend 创建 MySQL 全文检索后端
+func NewMySQLBackend(db *gorm.DB, table string) *MySQLBackend {
+	return &MySQLBackend{db: db, table: table}
+}
+
+type mysqlHit struct {
+	ID          uint
+	Name        string
+	Description string
+	Status      string
+	Price       float64
+	Score       float64
+}
+
+// Search 执行全文检索，分面统计基于未应用状态与价格过滤的匹配集合
+func (b *MySQLBackend) Search(ctx context.Context, q Query) (*Result, error) {
+	result := &Result{Hits: []Hit{}, Facets: Facets{Status: []FacetBucket{}, Price: make([]FacetBucket, len(PriceRanges))}}
+	for i, r := range PriceRanges {
+		result.Facets.Price[i].Key = r.Key()
+	}
+	words := terms(q.Text)
+	if len(words) == 0 {
+		return result, nil
+	}
+
+	match, against := matchExpr(words, q.Fuzzy)
+	base := func() *gorm.DB {
+		return b.db.WithContext(ctx).Table(b.table).Where("deleted_at IS NULL").Where(match, against)
+	}
+
+	if err := base().Select("COALESCE(status, '') AS `key`, COUNT(*) AS `count`").
+		Group("`key`").Order("`count` DESC, `key`").Scan(&result.Facets.Status).Error; err != nil {
+		return nil, err
+	}
+
+	bucket, args := priceBucketExpr()
+	var prices []FacetBucket
+	if err := base().Select(bucket+" AS `key`, COUNT(*) AS `count`", args...).
+		Group("`key`").Scan(&prices).Error; err != nil {
+		return nil, err
+	}
+	for _, p := range prices {
+		for i := range result.Facets.Price {
+			if result.Facets.Price[i].Key == p.Key {
+				result.Facets.Price[i].Count = p.Count
+			}
+		}
+	}
+
+	filtered := func() *gorm.DB {
+		query := base()
+		if q.Status != "" {
+			query = query.Where("status = ?", q.Status)
+		}
+		if q.MinPrice != nil {
+			query = query.Where("price >= ?", *q.MinPrice)
+		}
+		if q.MaxPrice != nil {
+			query = query.Where("price <= ?", *q.MaxPrice)
+		}
+		return query
+	}
+
+	var total int64
+	if err := filtered().Count(&total).Error; err != nil {
+		return nil, err
+	}
+	result.Total = int(total)
+
+	query := filtered().
+		Select("id, name, COALESCE(description, '') AS description, COALESCE(status, '') AS status, price, "+match+" AS score", against).
+		Order("score DESC, id")
+	if q.Offset > 0 {
+		query = query.Offset(q.Offset)
+	}
+	if q.Limit > 0 {
+		query = query.Limit(q.Limit)
+	}
+	var rows []mysqlHit
+	if err := query.Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		doc := Document{ID: row.ID, Name: row.Name, Description: row.Description, Status: row.Status, Price: row.Price}
+		result.Hits = append(result.Hits, Hit{
+			ID:         row.ID,
+			Score:      row.Score,
+			Highlights: highlights(doc, matchedTerms(doc, words, q.Fuzzy)),
+		})
+	}
+	return result, nil
+}
+
+// matchExpr 构造 MATCH ... AGAINST 条件，Fuzzy 时使用布尔模式的前缀通配
+func matchExpr(words []string, fuzzy bool) (string, string) {
+	if !fuzzy {
+		return "MATCH(name, description) AGAINST(? IN NATURAL LANGUAGE MODE)", strings.Join(words, " ")
+	}
+	prefixed := make([]string, len(words))
+	for i, w := range words {
+		prefixed[i] = w + "*"
+	}
+	return "MATCH(name, description) AGAINST(? IN BOOLEAN MODE)", strings.Join(prefixed, " ")
+}
+
+// priceBucketExpr 构造按 PriceRanges 归类价格的 CASE 表达式
+func priceBucketExpr() (string, []interface{}) {
+	var b strings.Builder
+	var args []interface{}
+	b.WriteString("CASE")
+	for _, r := range PriceRanges {
+		if r.To == 0 {
+			b.WriteString(" WHEN price >= ? THEN ?")
+			args = append(args, r.From, r.Key())
+			continue
+		}
+		b.WriteString(" WHEN price >= ? AND price < ? THEN ?")
+		args = append(args, r.From, r.To, r.Key())
+	}
+	b.WriteString(" END")
+	return b.String(), args
+}
+
+// matchedTerms 找出文档中与查询词匹配的词，用于高亮
+func matchedTerms(doc Document, words []string, fuzzy bool) map[string]bool {
+	matched := make(map[string]bool)
+	for _, term := range append(terms(doc.Name), terms(doc.Description)...) {
+		for _, w := range words {
+			if term == w || (fuzzy && strings.HasPrefix(term, w)) {
+				matched[term] = true
+			}
+		}
+	}
+	return matched
+}
@@ -0,0 +1,44 @@
+package search
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func TestMySQLSearch(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	gormDB, err := gorm.Open(mysql.New(mysql.Config{Conn: db, SkipInitializeWithVersion: true}), &gorm.Config{})
+	require.NoError(t, err)
+	backend := NewMySQLBackend(gormDB, "products")
+
+	match := "MATCH\\(name, description\\) AGAINST\\(\\? IN BOOLEAN MODE\\)"
+	mock.ExpectQuery("SELECT COALESCE\\(status, ''\\) AS `key`, COUNT\\(\\*\\) AS `count` FROM `products` WHERE deleted_at IS NULL AND " + match + " GROUP BY `key`").
+		WithArgs("keyboard*").
+		WillReturnRows(sqlmock.NewRows([]string{"key", "count"}).AddRow("active", 2).AddRow("inactive", 1))
+	mock.ExpectQuery("SELECT CASE WHEN price >= \\? AND price < \\? THEN \\?.* END AS `key`, COUNT\\(\\*\\) AS `count` FROM `products`").
+		WillReturnRows(sqlmock.NewRows([]string{"key", "count"}).AddRow("0-50", 2).AddRow("100-500", 1))
+	mock.ExpectQuery("SELECT count\\(\\*\\) FROM `products` WHERE deleted_at IS NULL AND "+match+" AND status = \\?").
+		WithArgs("keyboard*", "active").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectQuery("SELECT id, name, .*"+match+" AS score FROM `products` .* ORDER BY score DESC, id LIMIT \\? OFFSET \\?").
+		WithArgs("keyboard*", "keyboard*", "active", 1, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "description", "status", "price", "score"}).
+			AddRow(3, "Mouse Pad", "Pad for keyboards", "active", 15, 0.4))
+
+	res, err := backend.Search(context.Background(), Query{Text: "Keyboard", Status: "active", Fuzzy: true, Offset: 1, Limit: 1})
+	require.NoError(t, err)
+	assert.Equal(t, 2, res.Total)
+	require.Len(t, res.Hits, 1)
+	assert.Equal(t, uint(3), res.Hits[0].ID)
+	assert.Equal(t, []string{"Pad for <em>keyboards</em>"}, res.Hits[0].Highlights["description"])
+	assert.Equal(t, []FacetBucket{{Key: "active", Count: 2}, {Key: "inactive", Count: 1}}, res.Facets.Status)
+	assert.Equal(t, []FacetBucket{{Key: "0-50", Count: 2}, {Key: "50-100"}, {Key: "100-500", Count: 1}, {Key: "500+"}}, res.Facets.Price)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,108 @@
+// Package search 提供产品全文检索的可插拔后端
+package search
+
+import (
+	"context"
+	"strconv"
+)
+
+// Document 被检索的产品文档
+type Document struct {
+	ID          uint
+	Name        string
+	Description string
+	Status      string
+	Price       float64
+}
+
+// Query 检索条件，Status 与价格区间只过滤结果，不影响分面统计
+type Query struct {
+	Text     string
+	Status   string
+	MinPrice *float64
+	MaxPrice *float64
+	// Fuzzy 放宽匹配：MemoryBackend 按编辑距离纠正拼写错误；MySQLBackend 只做前缀匹配，
+	// 不能纠正拼写错误
+	Fuzzy  bool
+	Offset int
+	Limit  int
+}
+
+// Hit 单条命中结果，Highlights 以字段 JSON 名为键，匹配词包裹在 <em> 中
+type Hit struct {
+	ID         uint                `json:"id"`
+	Score      float64             `json:"score"`
+	Highlights map[string][]string `json:"highlights,omitempty"`
+}
+
+// FacetBucket 分面统计桶
+type FacetBucket struct {
+	Key   string `json:"key"`
+	Count int    `json:"count"`
+}
+
+// Facets 状态与价格区间分面
+type Facets struct {
+	Status []FacetBucket `json:"status"`
+	Price  []FacetBucket `json:"price"`
+}
+
+// Result 检索结果
+type Result struct {
+	Total  int    `json:"total"`
+	Hits   []Hit  `json:"hits"`
+	Facets Facets `json:"facets"`
+}
+
+// Backend 检索后端
+type Backend interface {
+	Search(ctx context.Context, q Query) (*Result, error)
+}
+
+// Indexer 需要由应用维护索引的后端（如进程内索引）实现此接口
+type Indexer interface {
+	Index(ctx context.Context, docs ...Document) error
+	Delete(ctx context.Context, ids ...uint) error
+}
+
+// PriceRange 价格分面区间 [From, To)，To 为 0 表示无上限
+type PriceRange struct {
+	From float64
+	To   float64
+}
+
+// Key 区间的分面键，如 "50-100"、"500+"
+func (r PriceRange) Key() string {
+	from := strconv.FormatFloat(r.From, 'f', -1, 64)
+	if r.To == 0 {
+		return from + "+"
+	}
+	return from + "-" + strconv.FormatFloat(r.To, 'f', -1, 64)
+}
+
+// Contains 判断价格是否落在区间内
+func (r PriceRange) Contains(price float64) bool {
+	return price >= r.From && (r.To == 0 || price < r.To)
+}
+
+// PriceRanges 价格分面使用的区间
+var PriceRanges = []PriceRange{
+	{From: 0, To: 50},
+	{From: 50, To: 100},
+	{From: 100, To: 500},
+	{From: 500},
+}
+
+// matchFilters 判断文档是否满足状态与价格过滤条件
+func (q Query) matchFilters(doc Document) bool {
+	if q.Status != "" && doc.Status != q.Status {
+		return false
+	}
+	if q.MinPrice != nil && doc.Price < *q.MinPrice {
+		return false
+	}
+	if q.MaxPrice != nil && doc.Price > *q.MaxPrice {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,177 @@
+package search
+
+import (
+	"html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	snippetRunes  = 160
+	snippetBefore = 40
+)
+
+// token 文本中的一个词及其字节区间
+type token struct {
+	term       string
+	start, end int
+}
+
+// tokenize 按字母与数字切词并转为小写，汉字逐字成词
+func tokenize(text string) []token {
+	var tokens []token
+	start := -1
+	flush := func(end int) {
+		if start >= 0 {
+			tokens = append(tokens, token{term: strings.ToLower(text[start:end]), start: start, end: end})
+			start = -1
+		}
+	}
+	for i, r := range text {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			flush(i)
+			end := i + utf8.RuneLen(r)
+			tokens = append(tokens, token{term: text[i:end], start: i, end: end})
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if start < 0 {
+				start = i
+			}
+		default:
+			flush(i)
+		}
+	}
+	flush(len(text))
+	return tokens
+}
+
+// terms 返回文本中去重后的词
+func terms(text string) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, t := range tokenize(text) {
+		if !seen[t.term] {
+			seen[t.term] = true
+			out = append(out, t.term)
+		}
+	}
+	return out
+}
+
+// maxEdits 按词长决定允许的编辑距离，短词不做纠错
+func maxEdits(term string) int {
+	switch n := utf8.RuneCountInString(term); {
+	case n >= 8:
+		return 2
+	case n >= 4:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// editDistance 计算 Levenshtein 距离，超过 limit 时提前返回 limit+1
+func editDistance(a, b string, limit int) int {
+	ra, rb := []rune(a), []rune(b)
+	if d := len(ra) - len(rb); d > limit || -d > limit {
+		return limit + 1
+	}
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		best := curr[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			best = min(best, curr[j])
+		}
+		if best > limit {
+			return limit + 1
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+// highlight 将 text 中属于 matched 的词包裹在 <em> 中，其余文本做 HTML 转义；
+// snippet 为 true 时只保留第一个匹配附近的片段。未匹配时返回空串
+func highlight(text string, matched map[string]bool, snippet bool) string {
+	var hits []token
+	for _, t := range tokenize(text) {
+		if matched[t.term] {
+			hits = append(hits, t)
+		}
+	}
+	if len(hits) == 0 {
+		return ""
+	}
+
+	from, to := 0, len(text)
+	prefix, suffix := "", ""
+	if snippet && utf8.RuneCountInString(text) > snippetRunes {
+		from = backRunes(text, hits[0].start, snippetBefore)
+		to = forwardRunes(text, from, snippetRunes)
+		if from > 0 {
+			prefix = "…"
+		}
+		if to < len(text) {
+			suffix = "…"
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(prefix)
+	pos := from
+	for _, t := range hits {
+		if t.start < from || t.end > to {
+			continue
+		}
+		b.WriteString(html.EscapeString(text[pos:t.start]))
+		b.WriteString("<em>")
+		b.WriteString(html.EscapeString(text[t.start:t.end]))
+		b.WriteString("</em>")
+		pos = t.end
+	}
+	b.WriteString(html.EscapeString(text[pos:to]))
+	b.WriteString(suffix)
+	return b.String()
+}
+
+// highlights 生成名称与描述的高亮结果
+func highlights(doc Document, matched map[string]bool) map[string][]string {
+	out := make(map[string][]string)
+	if s := highlight(doc.Name, matched, false); s != "" {
+		out["name"] = []string{s}
+	}
+	if s := highlight(doc.Description, matched, true); s != "" {
+		out["description"] = []string{s}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+func backRunes(s string, i, n int) int {
+	for ; n > 0 && i > 0; n-- {
+		_, size := utf8.DecodeLastRuneInString(s[:i])
+		i -= size
+	}
+	return i
+}
+
+func forwardRunes(s string, i, n int) int {
+	for ; n > 0 && i < len(s); n-- {
+		_, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+	}
+	return i
+}
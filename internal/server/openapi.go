@@ -0,0 +1,129 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/songfei1983/play-go-api/internal/graph"
+	"github.com/songfei1983/play-go-api/internal/handler"
+	"github.com/songfei1983/play-go-api/internal/metrics"
+	"github.com/songfei1983/play-go-api/internal/money"
+	"github.com/songfei1983/play-go-api/internal/openapi"
+)
+
+const (
+	// specPath 运行时生成的 OpenAPI 文档地址
+	specPath = "/openapi.json"
+	// docsPath 渲染 OpenAPI 文档的页面地址
+	docsPath = "/docs"
+)
+
+// openAPI 创建文档生成器。资源的标准路由由注册表生成，
+// 这里补充其他路由的请求与响应类型，以及不需要 JWT 的接口
+func openAPI() *openapi.Generator {
+	g := openapi.NewGenerator("Play Go API", "1.0.0")
+	// 金额序列化为字符串，请求中也接受数字
+	g.UseSchema(money.Decimal{}, &openapi.Schema{Type: openapi.Types{"string", "number"}, Format: "decimal"})
+	g.UseParam("job_id", &openapi.Schema{Type: openapi.Types{"string"}})
+	g.UseParam("currency", &openapi.Schema{Type: openapi.Types{"string"}, MaxLength: intPtr(3)})
+
+	// 公开接口，与 JWT 中间件的 Skipper 一致
+	g.Describe(http.MethodPost, "/api/v1/register", openapi.OperationInfo{
+		Summary:  "Register a new user",
+		Public:   true,
+		Request:  handler.User{},
+		Response: handler.User{},
+		Status:   http.StatusCreated,
+	})
+	g.Describe(http.MethodPost, "/api/v1/login", openapi.OperationInfo{
+		Summary:  "Log in and obtain a JWT",
+		Public:   true,
+		Request:  handler.LoginRequest{},
+		Response: map[string]string{},
+	})
+	g.Describe(http.MethodGet, "/api/v1/files/*", openapi.OperationInfo{
+		Summary: "Download a file through a signed URL",
+		Public:  true,
+	})
+	g.Describe(http.MethodGet, "/health", openapi.OperationInfo{
+		Summary:  "Health check",
+		Public:   true,
+		Response: map[string]string{},
+	})
+	g.Describe(http.MethodGet, "/metrics", openapi.OperationInfo{
+		Summary: "Prometheus metrics",
+		Public:  true,
+	})
+
+	// 旧客户端使用的软删除地址
+	for _, name := range []string{"products", "categories", "tags"} {
+		g.Describe(http.MethodDelete, "/api/v1/"+name+"/:id/soft", openapi.OperationInfo{
+			Summary:     "Soft delete (deprecated)",
+			Description: "Deprecated alias of DELETE /api/v1/" + name + "/{id}.",
+			Deprecated:  true,
+			Status:      http.StatusNoContent,
+		})
+	}
+
+	g.Describe(http.MethodGet, "/api/v1/users/current", openapi.OperationInfo{Response: handler.User{}})
+	g.Describe(http.MethodGet, "/api/v1/users/import/:job_id", openapi.OperationInfo{Response: handler.ImportJob{}})
+	g.Describe(http.MethodGet, "/api/v1/products/search", openapi.OperationInfo{
+		Summary: "Search products",
+		Description: "Full-text search with highlights and facets. Query parameters: q, status, min_price, max_price, page, per_page, fuzzy. " +
+			"With fuzzy=true the memory backend tolerates typos by edit distance; the mysql backend only matches word prefixes.",
+		Response: handler.SearchResponse{},
+	})
+	g.Describe(http.MethodGet, "/api/v1/products/import/:job_id", openapi.OperationInfo{Response: handler.ImportJob{}})
+	g.Describe(http.MethodGet, "/api/v1/products/:id/history", openapi.OperationInfo{Response: []handler.Version{}})
+	g.Describe(http.MethodGet, "/api/v1/products/:id/prices", openapi.OperationInfo{Response: []handler.ProductPrice{}})
+	g.Describe(http.MethodGet, "/api/v1/products/:id/variants", openapi.OperationInfo{Response: []handler.ProductVariant{}})
+	g.Describe(http.MethodGet, "/api/v1/products/:id/variants/:variant_id", openapi.OperationInfo{Response: handler.ProductVariant{}})
+	g.Describe(http.MethodGet, "/api/v1/products/:id/reorder-rule", openapi.OperationInfo{Response: handler.ReorderRule{}})
+	g.Describe(http.MethodGet, "/api/v1/products/:id/attachments", openapi.OperationInfo{Response: []handler.Attachment{}})
+	g.Describe(http.MethodPost, "/api/v1/products/:id/attachments", openapi.OperationInfo{Response: handler.Attachment{}, Status: http.StatusCreated})
+	g.Describe(http.MethodGet, "/api/v1/alerts", openapi.OperationInfo{Response: []handler.StockAlert{}})
+	g.Describe(http.MethodGet, "/api/v1/cart", openapi.OperationInfo{Response: handler.Cart{}})
+	g.Describe(http.MethodPost, "/api/v1/cart/checkout", openapi.OperationInfo{Response: handler.Order{}, Status: http.StatusCreated})
+	g.Describe(http.MethodGet, "/api/v1/orders", openapi.OperationInfo{Response: []handler.Order{}})
+	g.Describe(http.MethodGet, "/api/v1/orders/:id", openapi.OperationInfo{Response: handler.Order{}})
+	g.Describe(http.MethodGet, "/api/v1/audit-logs", openapi.OperationInfo{Response: []handler.AuditLog{}})
+	g.Describe(http.MethodGet, "/api/v1/audit-logs/verify", openapi.OperationInfo{Response: handler.AuditVerification{}})
+	g.Describe(http.MethodGet, "/api/v1/webhooks", openapi.OperationInfo{Response: []handler.WebhookSubscription{}})
+	g.Describe(http.MethodGet, "/api/v1/webhooks/:id", openapi.OperationInfo{Response: handler.WebhookSubscription{}})
+	g.Describe(http.MethodGet, "/api/v1/webhooks/:id/deliveries", openapi.OperationInfo{Response: []handler.WebhookDelivery{}})
+	g.Describe(http.MethodGet, "/api/v1/events", openapi.OperationInfo{Summary: "Stream resource changes as Server-Sent Events"})
+	g.Describe(http.MethodGet, liveInventoryPath, openapi.OperationInfo{Summary: "Live inventory updates over WebSocket"})
+	g.Describe(http.MethodPost, "/api/v1/graphql", openapi.OperationInfo{
+		Summary: "Execute a GraphQL query or mutation",
+		Request: graph.Request{},
+		Status:  http.StatusOK,
+	})
+	return g
+}
+
+// validateAPI 按文档校验请求与响应。响应不符合文档说明实现与文档出现偏差，
+// 记录日志与指标，便于在预发环境发现
+func validateAPI(spec *openapi.Document, requests, responses bool) echo.MiddlewareFunc {
+	return openapi.NewValidator(spec).Middleware(openapi.ValidationOptions{
+		Requests:  requests,
+		Responses: responses,
+		OnViolation: func(c echo.Context, errs []openapi.FieldError) {
+			status := strconv.Itoa(c.Response().Status)
+			metrics.OpenAPIResponseViolations.WithLabelValues(c.Request().Method, c.Path(), status).Inc()
+
+			messages := make([]string, len(errs))
+			for i, e := range errs {
+				messages[i] = e.String()
+			}
+			c.Logger().Warnf("response to %s %s (%s) does not match the API specification: %s",
+				c.Request().Method, c.Path(), status, strings.Join(messages, "; "))
+		},
+	})
+}
+
+func intPtr(v int) *int {
+	return &v
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"bytes"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-redis/redismock/v8"
+	"github.com/labstack/echo/v4"
+	"github.com/songfei1983/play-go-api/internal/app"
+	"github.com/songfei1983/play-go-api/internal/events"
+	"github.com/songfei1983/play-go-api/internal/openapi"
+	"github.com/songfei1983/play-go-api/internal/payment"
+	"github.com/songfei1983/play-go-api/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+var update = flag.Bool("update", false, "rewrite docs/openapi.json from the registered routes")
+
+// committedSpec 提交到仓库的 OpenAPI 文档
+const committedSpec = "../../docs/openapi.json"
+
+// newTestServer 创建启用全部可选功能的服务，只注册路由，不启动后台任务。
+// configure 可以在创建服务前修改配置
+func newTestServer(t *testing.T, configure ...func(*app.App)) *Server {
+	db, _, err := sqlmock.New()
+	require.NoError(t, err)
+	gormDB, err := gorm.Open(mysql.New(mysql.Config{
+		Conn:                      db,
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{})
+	require.NoError(t, err)
+	redisClient, _ := redismock.NewClientMock()
+	blobs, err := storage.NewLocalStore(t.TempDir())
+	require.NoError(t, err)
+
+	a := &app.App{
+		DB:        gormDB,
+		Redis:     redisClient,
+		Blobs:     blobs,
+		URLSigner: storage.NewURLSigner([]byte("test")),
+		Payments:  payment.NewFakeProvider(),
+		Feed:      events.NewRedisFeed(redisClient, "test:feed", 100),
+	}
+	for _, fn := range configure {
+		fn(a)
+	}
+	return New(a)
+}
+
+func TestOpenAPISpec(t *testing.T) {
+	s := newTestServer(t)
+	got, err := openapi.Marshal(s.spec)
+	require.NoError(t, err)
+
+	t.Run("提交的文档与路由一致", func(t *testing.T) {
+		if *update {
+			require.NoError(t, os.WriteFile(committedSpec, got, 0o644))
+		}
+		want, err := os.ReadFile(committedSpec)
+		require.NoError(t, err)
+		if !bytes.Equal(want, got) {
+			t.Fatal("docs/openapi.json is out of date; run `make openapi` and commit the result")
+		}
+	})
+
+	t.Run("文档包含全部路由", func(t *testing.T) {
+		for _, route := range s.router.Routes() {
+			if route.Method == http.MethodOptions || route.Path == specPath || route.Path == docsPath {
+				continue
+			}
+			item, ok := s.spec.Paths[openapi.Path(route.Path)]
+			require.True(t, ok, "missing path %s", route.Path)
+			assert.NotNil(t, item.Operation(route.Method), "missing %s %s", route.Method, route.Path)
+		}
+		assert.NotContains(t, s.spec.Paths, "/api/v1/users/{id}/soft")
+		assert.True(t, s.spec.Paths["/api/v1/products/{id}/soft"].Delete.Deprecated)
+	})
+
+	t.Run("无需登录即可获取文档", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, specPath, nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, got, rec.Body.Bytes())
+
+		rec = httptest.NewRecorder()
+		s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, docsPath, nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `spec-url="/openapi.json"`)
+	})
+}
+
+func TestValidateAPI(t *testing.T) {
+	s := newTestServer(t, func(a *app.App) {
+		a.ValidateRequests = true
+		a.ValidateResponses = true
+	})
+
+	t.Run("请求不符合文档时不进入处理器", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/login", strings.NewReader(`{"username":1,"password":"secret"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.JSONEq(t, `{
+			"error": "request does not match the API specification",
+			"fields": [{"in": "body", "field": "username", "message": "expected string, got integer"}]
+		}`, rec.Body.String())
+	})
+
+	t.Run("JWT 校验先于文档校验", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/products/abc", nil))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "missing or malformed jwt")
+	})
+}
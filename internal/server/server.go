@@ -1,9 +1,13 @@
 package server
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"net"
 	"net/http"
+	"strings"
+	"time"
 
 	echojwt "github.com/labstack/echo-jwt/v4"
 	"github.com/labstack/echo/v4"
@@ -11,15 +15,48 @@ import (
 	"github.com/labstack/gommon/log"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/songfei1983/play-go-api/internal/app"
+	"github.com/songfei1983/play-go-api/internal/events"
+	"github.com/songfei1983/play-go-api/internal/graph"
 	"github.com/songfei1983/play-go-api/internal/handler"
 	mymiddleware "github.com/songfei1983/play-go-api/internal/middleware"
+	"github.com/songfei1983/play-go-api/internal/openapi"
+	"github.com/songfei1983/play-go-api/internal/rpc"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/labstack/echo/otelecho"
 )
 
+// liveInventoryPath 实时库存 WebSocket 地址，浏览器建立 WebSocket 时无法设置请求头，
+// 令牌也可以通过 token 查询参数传递
+const liveInventoryPath = "/api/v1/ws/inventory"
+
+// redactedURI 返回用于记录日志的请求地址，token 查询参数的值替换为 REDACTED
+func redactedURI(req *http.Request) string {
+	query := req.URL.Query()
+	if !query.Has("token") {
+		return req.RequestURI
+	}
+	query.Set("token", "REDACTED")
+	u := *req.URL
+	u.RawQuery = query.Encode()
+	return u.RequestURI()
+}
+
+// jwtSigningKey JWT 签名密钥
+var jwtSigningKey = []byte("your-secret-key") // Replace with your secret key
+
 type Server struct {
-	app    *app.App
-	router *echo.Echo
-	server *http.Server
+	app     *app.App
+	router  *echo.Echo
+	server  *http.Server
+	auditor *handler.Auditor
+	stop    context.CancelFunc
+	// rpc 与 REST 共用 userHandler、productHandler 的 gRPC 服务
+	rpc *rpc.Server
+	// resources 通过注册表生成标准路由的资源，记录的路由元数据用于生成 API 文档
+	resources *handler.Registry
+	// spec 根据路由表生成的 OpenAPI 文档
+	spec *openapi.Document
+	// workers 后台任务，在 Start 时启动
+	workers []func(ctx context.Context)
 }
 
 func New(app *app.App) *Server {
@@ -34,7 +71,13 @@ func New(app *app.App) *Server {
 		MaxAge:       86400, // 24小时
 	}))
 
-	e.Use(middleware.Logger())
+	// 访问日志中的 uri 隐去 token 查询参数，实时库存 WebSocket 通过它传递令牌
+	e.Use(middleware.LoggerWithConfig(middleware.LoggerConfig{
+		Format: strings.Replace(middleware.DefaultLoggerConfig.Format, "${uri}", "${custom}", 1),
+		CustomTagFunc: func(c echo.Context, buf *bytes.Buffer) (int, error) {
+			return buf.WriteString(redactedURI(c.Request()))
+		},
+	}))
 	e.Use(otelecho.Middleware("api-service"))
 	e.Use(middleware.RequestID())
 	e.Use(mymiddleware.MetricsMiddleware())
@@ -43,19 +86,30 @@ func New(app *app.App) *Server {
 
 	// Configure JWT middleware
 	jwtConfig := echojwt.Config{
-		SigningKey: []byte("your-secret-key"), // Replace with your secret key
+		SigningKey: jwtSigningKey,
 		Skipper: func(c echo.Context) bool {
 			return c.Request().URL.Path == "/health" ||
 				c.Request().URL.Path == "/metrics" ||
 				c.Request().URL.Path == "/api/v1/login" ||
-				c.Request().URL.Path == "/api/v1/register"
+				c.Request().URL.Path == "/api/v1/register" ||
+				c.Request().URL.Path == specPath ||
+				c.Request().URL.Path == docsPath ||
+				// 签名下载地址自带时效签名
+				handler.IsFilesPath(c.Request().URL.Path) ||
+				// WebSocket 在路由上单独校验，允许从查询参数读取令牌
+				c.Request().URL.Path == liveInventoryPath
 		},
 	}
 	e.Use(echojwt.WithConfig(jwtConfig))
+	// 变更历史等回调需要从 context 中获取操作者与请求 ID
+	e.Use(handler.RequestInfo())
+	auditor := handler.NewAuditor(app.DB)
+	e.Use(auditor.Middleware())
 
 	s := &Server{
-		app:    app,
-		router: e,
+		app:     app,
+		router:  e,
+		auditor: auditor,
 		server: &http.Server{
 			Addr:    fmt.Sprintf(":%s", "8080"),
 			Handler: e,
@@ -68,6 +122,8 @@ func New(app *app.App) *Server {
 
 func (s *Server) setupRoutes() {
 	userHandler := handler.NewUserHandler(s.app.DB, s.app.Redis)
+	userHandler.UseAuditor(s.auditor)
+	userHandler.PublishEvents()
 
 	// API routes
 	v1 := s.router.Group("/api/v1")
@@ -80,24 +136,202 @@ func (s *Server) setupRoutes() {
 	v1.POST("/login", userHandler.Login)
 	v1.OPTIONS("/login", handleOptions)
 
-	// User management endpoints
-	v1.GET("/users/current", userHandler.GetCurrentUser)
-	v1.GET("/users/:id", userHandler.GetUser)
-	v1.PUT("/users/:id", userHandler.UpdateUser)
-	v1.DELETE("/users/:id", userHandler.SoftDeleteUser)
-	v1.PATCH("/users/:id", userHandler.RestoreUser)
-	v1.OPTIONS("/users/:id", handleOptions)
+	// 标准 CRUD 路由由资源注册表统一生成
+	s.resources = handler.NewRegistry(v1, "/api/v1")
+	// 所有接口使用同一份管理员名单，adminOnly 限制注册表以外的管理接口
+	admins := handler.NewAdmins(s.app.AdminUserIDs)
+	adminOnly := handler.RequireAdmin(admins)
+	userHandler.UseAdmins(admins)
+
+	// User management endpoints，用户通过 /register 创建，不开放列表
+	users := handler.Register(s.resources, userHandler.BaseHandler, handler.ResourceOptions{
+		Description: "User management operations",
+		Operations:  []handler.Operation{handler.OpGet, handler.OpReplace, handler.OpUpdate, handler.OpDelete, handler.OpRestore},
+		SoftDelete:  true,
+		// 只有本人或管理员可以修改、删除账户，恢复已删除的账户只对管理员开放
+		Permission: handler.AllOf(
+			handler.SelfOrAdmin(admins, handler.OpReplace, handler.OpUpdate, handler.OpDelete),
+			handler.AdminOnly(admins, handler.OpRestore),
+		),
+		Handlers: map[handler.Operation]echo.HandlerFunc{
+			handler.OpGet:     userHandler.GetUser,
+			handler.OpReplace: userHandler.UpdateUser,
+			handler.OpUpdate:  userHandler.UpdateUser,
+			handler.OpDelete:  userHandler.SoftDeleteUser,
+			handler.OpRestore: userHandler.RestoreUser,
+		},
+	})
+	users.GET("/current", userHandler.GetCurrentUser)
+	// 导出包含全部用户的邮箱，导入可以创建账户，只对管理员开放
+	users.GET("/export", userHandler.Export, adminOnly)
+	users.POST("/import", userHandler.Import, adminOnly)
+	users.GET("/import/:job_id", userHandler.ImportStatus, adminOnly)
 
 	// Product routes
 	productHandler := handler.NewProductHandler(s.app.DB, s.app.Redis)
-	products := v1.Group("/products")
-	products.GET("", productHandler.List)
-	products.POST("", productHandler.Create)
-	products.GET("/:id", productHandler.Get)
-	products.PUT("/:id", productHandler.Update)
-	products.PATCH("/:id", productHandler.Update)
+	if s.app.Search != nil {
+		productHandler.UseSearchBackend(s.app.Search)
+	}
+	if s.app.Rates != nil {
+		productHandler.UseExchangeRates(s.app.Rates)
+	}
+	productHandler.EnableHistory()
+	productHandler.OnChange(handler.AuditChanges[handler.Product](s.auditor))
+	productHandler.PublishEvents()
+	products := handler.Register(s.resources, productHandler.BaseHandler, handler.ResourceOptions{
+		Description: "Product management operations",
+		SoftDelete:  true,
+	})
+	// 已废弃：与 DELETE /products/:id 相同，保留给旧客户端
 	products.DELETE("/:id/soft", productHandler.Delete)
-	products.POST("/:id/restore", productHandler.Restore)
+	products.POST("/bulk", productHandler.Bulk)
+	products.GET("/search", productHandler.Search)
+	products.GET("/export", productHandler.Export)
+	products.POST("/import", productHandler.Import)
+	products.GET("/import/:job_id", productHandler.ImportStatus)
+	products.GET("/:id/history", productHandler.History)
+	products.GET("/:id/prices", productHandler.ListPrices)
+	products.PUT("/:id/prices/:currency", productHandler.SetPrice)
+	products.DELETE("/:id/prices/:currency", productHandler.DeletePrice)
+	products.POST("/:id/stock/reserve", productHandler.ReserveStock)
+	products.POST("/:id/stock/commit", productHandler.CommitStock)
+	products.POST("/:id/stock/release", productHandler.ReleaseStock)
+	products.POST("/:id/stock/adjust", productHandler.AdjustStock, adminOnly)
+	products.PUT("/:id/tags", productHandler.SetTags)
+	products.GET("/:id/variants", productHandler.ListVariants)
+	products.POST("/:id/variants", productHandler.CreateVariant)
+	products.GET("/:id/variants/:variant_id", productHandler.GetVariant)
+	products.PUT("/:id/variants/:variant_id", productHandler.UpdateVariant)
+	products.PATCH("/:id/variants/:variant_id", productHandler.UpdateVariant)
+	products.DELETE("/:id/variants/:variant_id", productHandler.DeleteVariant)
+
+	// Low-stock alert routes
+	alerter := handler.NewStockAlerter(s.app.DB, s.app.Notifier)
+	productHandler.OnChange(alerter.ProductChanged)
+	alertHandler := handler.NewAlertHandler(s.app.DB, alerter)
+	products.GET("/:id/reorder-rule", alertHandler.GetReorderRule)
+	products.PUT("/:id/reorder-rule", alertHandler.SetReorderRule)
+	products.DELETE("/:id/reorder-rule", alertHandler.DeleteReorderRule)
+	alerts := v1.Group("/alerts")
+	alerts.GET("", alertHandler.ListAlerts)
+	alerts.POST("/:id/acknowledge", alertHandler.AcknowledgeAlert)
+	alerts.POST("/:id/resolve", alertHandler.ResolveAlert)
+
+	// Cart and order routes
+	if s.app.Payments != nil {
+		orderHandler := handler.NewOrderHandler(s.app.DB, productHandler, s.app.Payments)
+		cart := v1.Group("/cart")
+		cart.GET("", orderHandler.GetCart)
+		cart.POST("/items", orderHandler.AddCartItem)
+		cart.PUT("/items/:item_id", orderHandler.UpdateCartItem)
+		cart.DELETE("/items/:item_id", orderHandler.RemoveCartItem)
+		cart.POST("/checkout", orderHandler.Checkout)
+		orders := v1.Group("/orders")
+		orders.GET("", orderHandler.ListOrders)
+		orders.GET("/:id", orderHandler.GetOrder)
+		orders.POST("/:id/pay", orderHandler.PayOrder)
+		orders.POST("/:id/ship", orderHandler.ShipOrder, adminOnly)
+		orders.POST("/:id/complete", orderHandler.CompleteOrder, adminOnly)
+		orders.POST("/:id/cancel", orderHandler.CancelOrder)
+	}
+
+	// Attachment routes
+	if s.app.Blobs != nil {
+		attachmentHandler := handler.NewAttachmentHandler(s.app.DB, s.app.Blobs, s.app.URLSigner, s.app.MaxUploadBytes, s.app.SignedURLTTL)
+		products.POST("/:id/attachments", attachmentHandler.UploadProductAttachment)
+		products.GET("/:id/attachments", attachmentHandler.ListProductAttachments)
+		products.DELETE("/:id/attachments/:attachment_id", attachmentHandler.DeleteProductAttachment)
+		selfOrAdmin := handler.RequireSelfOrAdmin(admins)
+		v1.PUT("/users/:id/avatar", attachmentHandler.SetUserAvatar, selfOrAdmin)
+		v1.GET("/users/:id/avatar", attachmentHandler.GetUserAvatar)
+		v1.DELETE("/users/:id/avatar", attachmentHandler.DeleteUserAvatar, selfOrAdmin)
+		v1.GET("/files/*", attachmentHandler.Download)
+	}
+
+	// Category routes
+	categoryHandler := handler.NewCategoryHandler(s.app.DB, s.app.Redis)
+	categoryHandler.OnChange(handler.AuditChanges[handler.Category](s.auditor))
+	categoryHandler.PublishEvents()
+	categories := handler.Register(s.resources, categoryHandler.BaseHandler, handler.ResourceOptions{
+		Singular:    "category",
+		Description: "Hierarchical product categories",
+		SoftDelete:  true,
+	})
+	// 已废弃：与 DELETE /categories/:id 相同，保留给旧客户端
+	categories.DELETE("/:id/soft", categoryHandler.Delete)
+	categories.GET("/tree", categoryHandler.Tree)
+	categories.POST("/:id/move", categoryHandler.Move)
+	categories.GET("/:id/products", categoryHandler.Products)
+
+	// Tag routes
+	tagHandler := handler.NewTagHandler(s.app.DB, s.app.Redis)
+	tagHandler.OnChange(handler.AuditChanges[handler.Tag](s.auditor))
+	tagHandler.PublishEvents()
+	tags := handler.Register(s.resources, tagHandler.BaseHandler, handler.ResourceOptions{
+		Description: "Free-form product tags",
+		SoftDelete:  true,
+	})
+	// 已废弃：与 DELETE /tags/:id 相同，保留给旧客户端
+	tags.DELETE("/:id/soft", tagHandler.Delete)
+
+	// Audit log routes
+	auditHandler := handler.NewAuditHandler(s.auditor, admins)
+	auditLogs := v1.Group("/audit-logs")
+	auditLogs.GET("", auditHandler.ListAuditLogs)
+	auditLogs.GET("/verify", auditHandler.VerifyAuditLogs)
+
+	// Webhook routes
+	dispatcher := handler.NewWebhookDispatcher(s.app.DB, s.app.WebhookPolicy, admins)
+	webhookHandler := handler.NewWebhookHandler(s.app.DB, dispatcher)
+	webhooks := v1.Group("/webhooks")
+	webhooks.GET("", webhookHandler.ListWebhooks)
+	webhooks.POST("", webhookHandler.CreateWebhook)
+	webhooks.GET("/:id", webhookHandler.GetWebhook)
+	webhooks.PUT("/:id", webhookHandler.UpdateWebhook)
+	webhooks.PATCH("/:id", webhookHandler.UpdateWebhook)
+	webhooks.DELETE("/:id", webhookHandler.DeleteWebhook)
+	webhooks.GET("/:id/deliveries", webhookHandler.ListDeliveries)
+	webhooks.POST("/:id/deliveries/:delivery_id/redeliver", webhookHandler.RedeliverWebhook)
+
+	// Server-Sent Events route
+	streamHandler := handler.NewEventStreamHandler(s.app.Feed, admins, s.app.HeartbeatInterval)
+	v1.GET("/events", streamHandler.Stream)
+
+	// GraphQL endpoint，与 REST 使用同一组处理器与 JWT 校验
+	graphHandler := graph.NewHandler(userHandler, productHandler, categoryHandler, admins, graph.Limits{
+		MaxDepth:      s.app.GraphQLMaxDepth,
+		MaxComplexity: s.app.GraphQLMaxComplexity,
+	})
+	v1.POST("/graphql", graphHandler.Serve)
+	v1.OPTIONS("/graphql", handleOptions)
+
+	// gRPC 服务使用同一组处理器，变更回调、审计与事件发布与 REST 一致
+	s.rpc = rpc.NewServer(userHandler, productHandler, jwtSigningKey, admins)
+
+	// Live inventory WebSocket route
+	inventoryHub := handler.NewInventoryHub(s.app.Feed)
+	inventoryHandler := handler.NewInventoryHandler(s.app.DB, inventoryHub, s.app.MaxSubscriptions)
+	s.router.GET(liveInventoryPath, inventoryHandler.Live, echojwt.WithConfig(echojwt.Config{
+		SigningKey:  jwtSigningKey,
+		TokenLookup: "header:Authorization:Bearer ,query:token",
+	}))
+
+	// outbox 事件同时发布到消息代理、webhook 订阅与 SSE 变更流
+	brokers := events.Multi{dispatcher, s.app.Feed}
+	if s.app.Broker != nil {
+		brokers = append(events.Multi{s.app.Broker}, brokers...)
+	}
+
+	// 后台释放过期的库存预留、检查低库存、发布 outbox 事件、发送 webhook 并分发实时事件
+	relay := events.NewRelay(s.app.DB, brokers)
+	s.workers = []func(ctx context.Context){
+		func(ctx context.Context) { productHandler.RunReservationSweeper(ctx, time.Minute) },
+		func(ctx context.Context) { alerter.Run(ctx, s.app.AlertCheckInterval) },
+		func(ctx context.Context) { relay.Run(ctx, s.app.RelayInterval) },
+		func(ctx context.Context) { dispatcher.Run(ctx, s.app.WebhookInterval) },
+		s.app.Feed.Run,
+		inventoryHub.Run,
+	}
 
 	// Metrics endpoint for Prometheus
 	s.router.GET("/metrics", echo.WrapHandler(promhttp.Handler()))
@@ -113,6 +347,15 @@ func (s *Server) setupRoutes() {
 	s.router.OPTIONS("/health", func(c echo.Context) error {
 		return c.NoContent(http.StatusOK)
 	})
+
+	// OpenAPI 文档根据注册完成的路由表生成，文档地址本身不出现在文档中
+	s.spec = openAPI().Generate(s.router.Routes(), s.resources.Resources())
+	s.router.GET(specPath, openapi.SpecHandler(s.spec))
+	s.router.GET(docsPath, openapi.DocsHandler(specPath))
+
+	if s.app.ValidateRequests || s.app.ValidateResponses {
+		s.router.Use(validateAPI(s.spec, s.app.ValidateRequests, s.app.ValidateResponses))
+	}
 }
 
 // handleOptions handles OPTIONS requests for CORS
@@ -120,10 +363,29 @@ func handleOptions(c echo.Context) error {
 	return c.NoContent(http.StatusOK)
 }
 
+// Start 启动后台任务并开始处理 HTTP 请求
 func (s *Server) Start() error {
+	ctx, stop := context.WithCancel(context.Background())
+	s.stop = stop
+	for _, worker := range s.workers {
+		go worker(ctx)
+	}
 	return s.server.ListenAndServe()
 }
 
+// StartGRPC 在 app.GRPCAddr 上监听 gRPC 请求，直到 Shutdown
+func (s *Server) StartGRPC() error {
+	lis, err := net.Listen("tcp", s.app.GRPCAddr)
+	if err != nil {
+		return err
+	}
+	return s.rpc.Serve(lis)
+}
+
 func (s *Server) Shutdown(ctx context.Context) error {
+	if s.stop != nil {
+		s.stop()
+	}
+	s.rpc.Shutdown(ctx)
 	return s.server.Shutdown(ctx)
 }
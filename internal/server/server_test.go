@@ -0,0 +1,21 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactedURI(t *testing.T) {
+	t.Run("隐去令牌查询参数", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, liveInventoryPath+"?token=eyJhbGciOi.secret&product_id=7", nil)
+		assert.Equal(t, liveInventoryPath+"?product_id=7&token=REDACTED", redactedURI(req))
+	})
+
+	t.Run("没有令牌时保持原样", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/products?q=%E9%9E%8B&page=2", nil)
+		assert.Equal(t, "/api/v1/products?q=%E9%9E%8B&page=2", redactedURI(req))
+	})
+}
@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"time"
+)
+
+// URLSigner 为 API 自身提供的下载地址生成与校验 HMAC 签名
+type URLSigner struct {
+	key []byte
+}
+
+// NewURLSigner 创建签名器
+func NewURLSigner(key []byte) *URLSigner {
+	return &URLSigner{key: key}
+}
+
+// Sign 返回对象键在 expires 之前有效的签名
+func (s *URLSigner) Sign(key string, expires time.Time) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(key + "\n" + strconv.FormatInt(expires.Unix(), 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify 校验签名且未过期
+func (s *URLSigner) Verify(key string, expires time.Time, signature string, now time.Time) bool {
+	if !now.Before(expires) {
+		return false
+	}
+	want, err := hex.DecodeString(s.Sign(key, expires))
+	if err != nil {
+		return false
+	}
+	got, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(want, got)
+}
@@ -0,0 +1,45 @@
+// Package storage 提供上传文件的对象存储抽象，以及缩略图生成与下载地址签名
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+// ErrNotFound 对象不存在
+var ErrNotFound = errors.New("blob not found")
+
+// ErrInvalidKey 对象键不合法
+var ErrInvalidKey = errors.New("invalid blob key")
+
+// BlobStore 二进制对象存储
+type BlobStore interface {
+	// Put 写入对象，size 为内容长度，已存在的同名对象会被覆盖
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get 读取对象，不存在时返回 ErrNotFound
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete 删除对象，对象不存在时不报错
+	Delete(ctx context.Context, key string) error
+}
+
+// Presigner 可选接口，后端能直接生成带签名的限时下载地址（如 S3 预签名 URL）
+// 未实现该接口的后端由 API 自身提供签名下载
+type Presigner interface {
+	PresignGet(key string, ttl time.Duration) (string, error)
+}
+
+// ValidateKey 校验对象键：以 / 分隔的相对路径，不允许空段、. 与 .. 段
+func ValidateKey(key string) error {
+	if key == "" || len(key) > 512 || strings.ContainsAny(key, "\\\x00") {
+		return ErrInvalidKey
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return ErrInvalidKey
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+
+	// 注册 GIF 解码器
+	_ "image/gif"
+)
+
+// maxThumbnailSourcePixels 限制可生成缩略图的原图尺寸，防止解压炸弹耗尽内存
+const maxThumbnailSourcePixels = 50_000_000
+
+// ErrImageTooLarge 原图像素过多
+var ErrImageTooLarge = errors.New("image is too large to thumbnail")
+
+// Thumbnail 将 JPEG、PNG 或 GIF 图片等比缩小到最长边不超过 maxSide
+// PNG 与 GIF 输出 PNG 以保留透明度，其余输出 JPEG；原图已足够小时按原尺寸重新编码
+func Thumbnail(data []byte, maxSide int) ([]byte, string, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", err
+	}
+	if cfg.Width*cfg.Height > maxThumbnailSourcePixels {
+		return nil, "", ErrImageTooLarge
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", err
+	}
+
+	w, h := fitWithin(cfg.Width, cfg.Height, maxSide)
+	dst := resize(src, w, h)
+
+	var buf bytes.Buffer
+	switch format {
+	case "png", "gif":
+		err = png.Encode(&buf, dst)
+		return buf.Bytes(), "image/png", err
+	case "jpeg":
+		err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 85})
+		return buf.Bytes(), "image/jpeg", err
+	}
+	return nil, "", fmt.Errorf("unsupported image format %q", format)
+}
+
+// fitWithin 计算等比缩放后的尺寸
+func fitWithin(w, h, maxSide int) (int, int) {
+	if w <= maxSide && h <= maxSide {
+		return w, h
+	}
+	if w >= h {
+		return maxSide, max(1, h*maxSide/w)
+	}
+	return max(1, w*maxSide/h), maxSide
+}
+
+// resize 区域平均缩放，缩小时比最近邻采样更平滑
+func resize(src image.Image, w, h int) *image.RGBA {
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0 := b.Min.Y + y*b.Dy()/h
+		y1 := max(y0+1, b.Min.Y+(y+1)*b.Dy()/h)
+		for x := 0; x < w; x++ {
+			x0 := b.Min.X + x*b.Dx()/w
+			x1 := max(x0+1, b.Min.X+(x+1)*b.Dx()/w)
+
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, bl, a = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{
+				R: uint8(r / n >> 8),
+				G: uint8(g / n >> 8),
+				B: uint8(bl / n >> 8),
+				A: uint8(a / n >> 8),
+			})
+		}
+	}
+	return dst
+}